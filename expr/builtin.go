@@ -0,0 +1,81 @@
+package expr
+
+import (
+	"fmt"
+	"sync"
+)
+
+// userBuiltin is a function added with RegisterBuiltin.
+type userBuiltin struct {
+	arity int
+	fn    func([]Value) (Value, error)
+}
+
+var (
+	userBuiltinsMu sync.RWMutex
+	userBuiltins   = make(map[string]userBuiltin)
+)
+
+// RegisterBuiltin makes fn callable in expressions as name(arg1, ...,
+// argN), where N is arity (at least 1). Arguments are int-valued, like
+// those of min and max, and fn must return an int Value.
+//
+// fn must be pure and deterministic: its result may depend only on its
+// arguments, and it must not keep state between calls. The verifier
+// evaluates each expression once per state while building its tables and
+// treats the results as facts about the model, so a function that varies
+// between calls makes the verdict meaningless. Returning an error is
+// allowed and surfaces as a SPEC ERROR at the state being evaluated.
+//
+// RegisterBuiltin is meant to be called from an init function. It panics
+// if name is empty, is a keyword or an existing builtin, or if arity is
+// less than 1 or fn is nil.
+func RegisterBuiltin(name string, arity int, fn func([]Value) (Value, error)) {
+	if name == "" || fn == nil || arity < 1 {
+		panic(fmt.Sprintf("expr: RegisterBuiltin(%q): invalid arity or nil function", name))
+	}
+	if _, kw := keywords[name]; kw {
+		panic(fmt.Sprintf("expr: RegisterBuiltin(%q): name is a keyword", name))
+	}
+	userBuiltinsMu.Lock()
+	defer userBuiltinsMu.Unlock()
+	if isCoreBuiltin(name) || userBuiltins[name].fn != nil {
+		panic(fmt.Sprintf("expr: RegisterBuiltin(%q): already registered", name))
+	}
+	userBuiltins[name] = userBuiltin{arity: arity, fn: fn}
+}
+
+// lookupBuiltin returns the registered function name, if any.
+func lookupBuiltin(name string) (userBuiltin, bool) {
+	userBuiltinsMu.RLock()
+	defer userBuiltinsMu.RUnlock()
+	b, ok := userBuiltins[name]
+	return b, ok
+}
+
+// callBuiltin evaluates a call to a registered function.
+func callBuiltin(node *Node, env *Env) (Value, error) {
+	b, ok := lookupBuiltin(node.Name)
+	if !ok {
+		return Value{}, fmt.Errorf("unknown function %q", node.Name)
+	}
+	args := make([]Value, len(node.Children))
+	for i, child := range node.Children {
+		v, err := Eval(child, env)
+		if err != nil {
+			return Value{}, err
+		}
+		if !v.IsInt {
+			return Value{}, fmt.Errorf("%s requires int arguments", node.Name)
+		}
+		args[i] = v
+	}
+	v, err := b.fn(args)
+	if err != nil {
+		return Value{}, fmt.Errorf("%s: %w", node.Name, err)
+	}
+	if !v.IsInt {
+		return Value{}, fmt.Errorf("%s returned a non-int value", node.Name)
+	}
+	return v, nil
+}
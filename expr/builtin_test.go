@@ -0,0 +1,138 @@
+package expr
+
+import "testing"
+
+// builtinState is the state the builtin tests evaluate in.
+const builtinState = "x=3, flag=true, sev=high, status=paid, prev=paid, stage=shipped, power=off"
+
+func TestBetween(t *testing.T) {
+	runEvalCases(t, newTestEnv(t, builtinState), []evalCase{
+		{src: "between(x, 1, 5)", want: boolVal(true)},
+		{src: "between(x, 3, 3)", want: boolVal(true)},
+		{src: "between(x, 4, 5)", want: boolVal(false)},
+		{src: "between(x, 0, 2)", want: boolVal(false)},
+		{src: "between(x, 5, 1)", want: boolVal(false)},
+		{src: "between(x + 1, x, x + 1)", want: boolVal(true)},
+		{src: "not between(x, 0, 2)", want: boolVal(true)},
+		{src: "between(x, 1)", wantErr: "between requires 3 arguments, got 2"},
+		{src: "between(flag, 0, 1)", wantErr: "between requires int arguments, got bool"},
+		{src: "between(x, 0, 5) + 1", wantErr: "arithmetic requires int operand, got bool"},
+	})
+}
+
+func TestPrefix(t *testing.T) {
+	runEvalCases(t, newTestEnv(t, builtinState), []evalCase{
+		{src: `prefix(status, "pa")`, want: boolVal(true)},
+		{src: `prefix(status, "paid")`, want: boolVal(true)},
+		{src: `prefix(status, "")`, want: boolVal(true)},
+		{src: `prefix(status, "pe")`, want: boolVal(false)},
+		{src: `prefix(status, "paid_")`, want: boolVal(false)},
+		{src: `prefix(stage, "pa")`, want: boolVal(false)},
+		{src: `prefix(stage, "ship") and not prefix(power, "on")`, want: boolVal(true)},
+		{src: `prefix(x, "a")`, wantErr: "prefix requires an enum state variable as its first argument"},
+		{src: `prefix(paid, "p")`, wantErr: "prefix requires an enum state variable as its first argument"},
+		{src: `prefix(status, pa)`, wantErr: `prefix pattern must be a string literal, got "pa"`},
+		{src: `prefix(status)`, wantErr: "prefix requires 2 arguments"},
+		{src: `prefix(status, "a", "b")`, wantErr: "expected ')' after prefix arguments"},
+	})
+}
+
+func TestRegisteredBuiltins(t *testing.T) {
+	runEvalCases(t, newTestEnv(t, builtinState), []evalCase{
+		{src: "twice(x)", want: intVal(6)},
+		{src: "roundup(x, 2)", want: intVal(4)},
+		{src: "roundup(x, 3)", want: intVal(3)},
+		{src: "roundup(twice(x) + 1, 4) == 8", want: boolVal(true)},
+		{src: "roundup(x, x - 3)", wantErr: "roundup: step 0 must be positive"},
+		{src: "roundup(x)", wantErr: "roundup requires 2 arguments, got 1"},
+		{src: "roundup(x, flag)", wantErr: "roundup requires int arguments, got bool"},
+		{src: "truthy(x)", wantErr: "truthy returned a non-int value"},
+		{src: "thrice(x)", wantErr: "thrice"},
+	})
+}
+
+func TestRegisterBuiltinPanics(t *testing.T) {
+	fn := func(args []Value) (Value, error) { return args[0], nil }
+	tests := []struct {
+		name  string
+		arity int
+		fn    func([]Value) (Value, error)
+		want  string
+	}{
+		{"", 1, fn, `expr: RegisterBuiltin(""): invalid arity or nil function`},
+		{"ident", 0, fn, `expr: RegisterBuiltin("ident"): invalid arity or nil function`},
+		{"ident", 1, nil, `expr: RegisterBuiltin("ident"): invalid arity or nil function`},
+		{"and", 1, fn, `expr: RegisterBuiltin("and"): name is a keyword`},
+		{"min", 2, fn, `expr: RegisterBuiltin("min"): already registered`},
+		{"twice", 1, fn, `expr: RegisterBuiltin("twice"): already registered`},
+	}
+	for _, tt := range tests {
+		func() {
+			defer func() {
+				if got := recover(); got != tt.want {
+					t.Errorf("RegisterBuiltin(%q, %d): panic %v, want %q", tt.name, tt.arity, got, tt.want)
+				}
+			}()
+			RegisterBuiltin(tt.name, tt.arity, tt.fn)
+		}()
+	}
+}
+
+func TestDivision(t *testing.T) {
+	cases := []evalCase{
+		{src: "7 / 2", want: intVal(3)},
+		{src: "-7 / 2", want: intVal(-3)},
+		{src: "8 / 2", want: intVal(4)},
+		{src: "floordiv(7, 2)", want: intVal(3)},
+		{src: "floordiv(-7, 2)", want: intVal(-4)},
+		{src: "floordiv(7, -2)", want: intVal(-4)},
+		{src: "floordiv(-8, 2)", want: intVal(-4)},
+		{src: "floordiv(x, 0)", wantErr: "division by zero"},
+		{src: "floordiv(x)", wantErr: "floordiv requires 2 arguments, got 1"},
+		{src: "x / 0", wantErr: "division by zero"},
+	}
+	runEvalCases(t, newTestEnv(t, builtinState), cases)
+
+	strict := newTestEnv(t, builtinState)
+	strict.StrictDiv = true
+	runEvalCases(t, strict, []evalCase{
+		{src: "8 / 2", want: intVal(4)},
+		{src: "x / 3", want: intVal(1)},
+		{src: "7 / 2", wantErr: "inexact division 7 / 2 under strict arithmetic; use floordiv(a, b) to round down explicitly"},
+		{src: "x / 2", wantErr: "inexact division 3 / 2"},
+		{src: "floordiv(7, 2)", want: intVal(3)},
+	})
+}
+
+func TestMod(t *testing.T) {
+	runEvalCases(t, newTestEnv(t, builtinState), []evalCase{
+		{src: "mod(7, 3)", want: intVal(1)},
+		{src: "mod(6, 3)", want: intVal(0)},
+		{src: "mod(-1, 3)", want: intVal(2)},
+		{src: "mod(-7, 3)", want: intVal(2)},
+		{src: "mod(-6, 3)", want: intVal(0)},
+		{src: "mod(x - 5, 2)", want: intVal(0)},
+		{src: "mod(x - 4, 5)", want: intVal(4)},
+		{src: "-7 % 3", want: intVal(-1)}, // the operator keeps truncating semantics
+		{src: "mod(x, 0)", wantErr: "mod requires a positive divisor, got 0"},
+		{src: "mod(x, -2)", wantErr: "mod requires a positive divisor, got -2"},
+		{src: "mod(x)", wantErr: "mod requires 2 arguments, got 1"},
+		{src: "mod(flag, 2)", wantErr: "mod requires int arguments, got bool"},
+	})
+}
+
+func TestMinMaxOverSet(t *testing.T) {
+	runEvalCases(t, newTestEnv(t, builtinState), []evalCase{
+		{src: "max({1, 2, 3}) == 3", want: boolVal(true)},
+		{src: "max({1, 2, 3})", want: intVal(3)},
+		{src: "min({3, 1, 2})", want: intVal(1)},
+		{src: "max({7})", want: intVal(7)},
+		{src: "min({x, 9, x + 1})", want: intVal(3)},
+		{src: "max({x, 1}) == max(x, 1)", want: boolVal(true)},
+		{src: "x in {max({1, 2}), 5}", want: boolVal(false)},
+		{src: "max({})", wantErr: "empty set literal at position 4"},
+		{src: "max({1, flag})", wantErr: "max requires int arguments, got bool"},
+		{src: "min({1, 2}, 3)", wantErr: "expected ')' after min arguments"},
+		{src: "max({1, 2)", wantErr: "expected"},
+	})
+}
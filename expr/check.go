@@ -0,0 +1,408 @@
+package expr
+
+import (
+	"fmt"
+
+	"github.com/blackwell-systems/nccheck/registry"
+)
+
+// Kind classifies the static type of an expression.
+type Kind int
+
+const (
+	KindBool Kind = iota
+	KindInt
+	KindEnum
+	KindString
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindBool:
+		return "bool"
+	case KindInt:
+		return "int"
+	case KindEnum:
+		return "enum"
+	case KindString:
+		return "string"
+	}
+	return "unknown"
+}
+
+// Type is the static type of an expression.
+// Enum types carry the literals they may take. A state variable's domain is
+// exact (its full value list); a literal or parameter only covers a subset.
+type Type struct {
+	Kind    Kind
+	Domain  []string // enum literals, in ordinal order
+	Exact   bool     // Domain is a complete variable domain
+	Literal bool     // a bare enum literal
+	Name    string   // originating variable, parameter, or literal
+	Ordered bool     // an ordered enum; see VarDef.Ordered
+}
+
+// Checker statically type-checks expressions against a schema.
+// Enum values are int-encoded at runtime, so enums are accepted wherever
+// an int is expected, except as arithmetic operands.
+type Checker struct {
+	Schema   *registry.Schema
+	Literals map[string]int    // enum literal -> encoded value
+	Params   []registry.VarDef // event parameters in scope, if any
+}
+
+// Check infers the type of node, reporting the first type error found.
+func (c *Checker) Check(node *Node) (Type, error) {
+	switch node.Type {
+	case NodeLitInt:
+		return Type{Kind: KindInt}, nil
+
+	case NodeLitBool:
+		return Type{Kind: KindBool}, nil
+
+	case NodeLitString:
+		return Type{Kind: KindString, Name: node.Str}, nil
+
+	case NodeVar:
+		if idx := c.Schema.VarIndex(node.Name); idx >= 0 {
+			return varType(c.Schema.Vars[idx], true), nil
+		}
+		for _, p := range c.Params {
+			if p.Name == node.Name {
+				return varType(p, false), nil
+			}
+		}
+		if _, ok := c.Literals[node.Name]; ok {
+			return Type{Kind: KindEnum, Domain: []string{node.Name}, Literal: true, Name: node.Name}, nil
+		}
+		if _, ok := boolSynonyms[node.Name]; ok {
+			return Type{Kind: KindBool}, nil
+		}
+		return Type{}, fmt.Errorf("undefined identifier %q", node.Name)
+
+	case NodeNot:
+		if err := c.expect(node.Children[0], KindBool, "'not'"); err != nil {
+			return Type{}, err
+		}
+		return Type{Kind: KindBool}, nil
+
+	case NodeAnd, NodeOr:
+		op := "'and'"
+		if node.Type == NodeOr {
+			op = "'or'"
+		}
+		for _, child := range node.Children {
+			if err := c.expect(child, KindBool, op); err != nil {
+				return Type{}, err
+			}
+		}
+		return Type{Kind: KindBool}, nil
+
+	case NodeEq, NodeNeq:
+		left, err := c.Check(node.Children[0])
+		if err != nil {
+			return Type{}, err
+		}
+		right, err := c.Check(node.Children[1])
+		if err != nil {
+			return Type{}, err
+		}
+		if err := compareEquality(left, right); err != nil {
+			return Type{}, err
+		}
+		return Type{Kind: KindBool}, nil
+
+	case NodeIn:
+		x, err := c.Check(node.Children[0])
+		if err != nil {
+			return Type{}, err
+		}
+		for _, elemNode := range node.Children[1:] {
+			elem, err := c.Check(elemNode)
+			if err != nil {
+				return Type{}, err
+			}
+			if err := compareEquality(x, elem); err != nil {
+				return Type{}, fmt.Errorf("set membership: %w", err)
+			}
+		}
+		return Type{Kind: KindBool}, nil
+
+	case NodeLt, NodeLe, NodeGt, NodeGe:
+		left, err := c.Check(node.Children[0])
+		if err != nil {
+			return Type{}, err
+		}
+		right, err := c.Check(node.Children[1])
+		if err != nil {
+			return Type{}, err
+		}
+		if err := compareOrder(left, right); err != nil {
+			return Type{}, err
+		}
+		return Type{Kind: KindBool}, nil
+
+	case NodeAdd, NodeSub, NodeMul, NodeDiv, NodeMod:
+		for _, child := range node.Children {
+			if err := c.expectValue(child, "arithmetic"); err != nil {
+				return Type{}, err
+			}
+		}
+		return Type{Kind: KindInt}, nil
+
+	case NodeIf:
+		if err := c.expect(node.Children[0], KindBool, "if condition"); err != nil {
+			return Type{}, err
+		}
+		then, err := c.Check(node.Children[1])
+		if err != nil {
+			return Type{}, err
+		}
+		els, err := c.Check(node.Children[2])
+		if err != nil {
+			return Type{}, err
+		}
+		return unifyBranches(then, els)
+
+	case NodeCall:
+		if node.Name == "prefix" {
+			arg := node.Children[0]
+			if arg.Type != NodeVar || c.Schema.VarIndex(arg.Name) < 0 ||
+				c.Schema.Vars[c.Schema.VarIndex(arg.Name)].Type != registry.TypeEnum {
+				return Type{}, fmt.Errorf("prefix requires an enum state variable as its first argument")
+			}
+			return Type{Kind: KindBool}, nil
+		}
+		for _, child := range node.Children {
+			t, err := c.Check(child)
+			if err != nil {
+				return Type{}, err
+			}
+			if t.Kind == KindBool || t.Kind == KindString {
+				return Type{}, fmt.Errorf("%s requires int arguments, got %s", node.Name, t.Kind)
+			}
+			if t.Literal {
+				return Type{}, fmt.Errorf("enum literal %q used as argument to %s; enum literals may only be compared", t.Name, node.Name)
+			}
+			if t.Kind == KindEnum {
+				return Type{}, fmt.Errorf("enum %q used as argument to %s; enum values may only be compared, not computed with", t.Name, node.Name)
+			}
+		}
+		if node.Name == "between" {
+			return Type{Kind: KindBool}, nil
+		}
+		return Type{Kind: KindInt}, nil
+	}
+	return Type{}, fmt.Errorf("unknown node type %d", node.Type)
+}
+
+// expect checks node and requires it to have the given kind.
+func (c *Checker) expect(node *Node, want Kind, context string) error {
+	t, err := c.Check(node)
+	if err != nil {
+		return err
+	}
+	if t.Kind == want || (want == KindInt && t.Kind == KindEnum) {
+		return nil
+	}
+	return fmt.Errorf("%s requires %s operand, got %s", context, want, t.Kind)
+}
+
+// expectValue checks an arithmetic operand: it must be a plain int. Enum
+// values, whose encoding is an implementation detail, are rejected, so
+// status + 1 cannot silently compute with ordinals.
+func (c *Checker) expectValue(node *Node, context string) error {
+	t, err := c.Check(node)
+	if err != nil {
+		return err
+	}
+	if t.Literal {
+		return fmt.Errorf("enum literal %q used in %s; enum literals may only be compared", t.Name, context)
+	}
+	if t.Kind == KindEnum {
+		return fmt.Errorf("enum %q used in %s; enum values may only be compared, not computed with", t.Name, context)
+	}
+	if t.Kind == KindBool || t.Kind == KindString {
+		return fmt.Errorf("%s requires int operand, got %s", context, t.Kind)
+	}
+	return nil
+}
+
+// AssignableTo reports whether a value of type t may be assigned to the
+// variable v: bools to bools, ints to ints, and enums whose values all
+// belong to v's domain to enums.
+func AssignableTo(t Type, v registry.VarDef) error {
+	target := varType(v, true)
+	if t.Kind != target.Kind {
+		return fmt.Errorf("cannot assign %s value to %s variable %q", t.Kind, target.Kind, v.Name)
+	}
+	if t.Kind == KindEnum && !t.Exact && !t.Literal {
+		// A parameter, or a choice between literals: every value it may
+		// take must be one the variable can hold.
+		for _, lit := range t.Domain {
+			if !containsString(target.Domain, lit) {
+				return fmt.Errorf("cannot assign %q to %q: it may take value %q, which is not a value of %q",
+					t.Name, v.Name, lit, v.Name)
+			}
+		}
+		return nil
+	}
+	if t.Kind == KindEnum {
+		if err := compareEquality(target, t); err != nil {
+			return fmt.Errorf("cannot assign to %q: %w", v.Name, err)
+		}
+	}
+	return nil
+}
+
+func varType(v registry.VarDef, exact bool) Type {
+	switch v.Type {
+	case registry.TypeBool:
+		return Type{Kind: KindBool, Name: v.Name}
+	case registry.TypeEnum:
+		return Type{Kind: KindEnum, Domain: v.Values, Exact: exact, Name: v.Name, Ordered: v.Ordered}
+	}
+	return Type{Kind: KindInt, Name: v.Name}
+}
+
+// compareEquality checks that two operands of == or != are comparable.
+// A string literal names an enum literal and may only be compared with an
+// enum value.
+// Enums compare by ordinal at runtime, which is only literal identity when
+// both sides draw from the same ordering: two enum variables must have
+// identical domains, and a literal or parameter must belong to the domain
+// it is compared against.
+func compareEquality(left, right Type) error {
+	if left.Kind == KindString || right.Kind == KindString {
+		str, other := left, right
+		if right.Kind == KindString {
+			str, other = right, left
+		}
+		if other.Kind != KindEnum {
+			return fmt.Errorf("string %q may only be compared with an enum value, got %s", str.Name, other.Kind)
+		}
+		if other.Exact && !containsString(other.Domain, str.Name) {
+			return fmt.Errorf("cannot compare enum %q with %q: %q is not a value of %q",
+				other.Name, str.Name, str.Name, other.Name)
+		}
+		return nil
+	}
+	if left.Kind == KindBool || right.Kind == KindBool {
+		if left.Kind != right.Kind {
+			return fmt.Errorf("type mismatch in equality comparison: %s vs %s", left.Kind, right.Kind)
+		}
+		return nil
+	}
+	if (left.Kind == KindEnum) != (right.Kind == KindEnum) {
+		enum := left
+		if right.Kind == KindEnum {
+			enum = right
+		}
+		return fmt.Errorf("cannot compare enum %q with a plain integer; compare with one of its literals", enum.Name)
+	}
+	if left.Kind != KindEnum {
+		return nil
+	}
+	if left.Exact && right.Exact {
+		if !sameDomain(left.Domain, right.Domain) {
+			return fmt.Errorf("cannot compare enum %q with enum %q: value lists differ (%v vs %v)",
+				left.Name, right.Name, left.Domain, right.Domain)
+		}
+		return nil
+	}
+	sub, super := left, right
+	if left.Exact {
+		sub, super = right, left
+	}
+	if !super.Exact {
+		return nil
+	}
+	for _, lit := range sub.Domain {
+		if !containsString(super.Domain, lit) {
+			return fmt.Errorf("cannot compare enum %q with %q: %q is not a value of %q",
+				super.Name, sub.Name, lit, super.Name)
+		}
+	}
+	return nil
+}
+
+// compareOrder checks that two operands of <, <=, > or >= are ordered.
+// Ints always are. Enums are ordered only if declared with ordered: true,
+// and are then compared by ordinal with literals of their own domain or
+// with another ordered enum of the same domain; a comparison between two
+// bare literals has no ordered enum to take its order from.
+func compareOrder(left, right Type) error {
+	for _, t := range []Type{left, right} {
+		if t.Kind == KindBool || t.Kind == KindString {
+			return fmt.Errorf("comparison requires int operand, got %s", t.Kind)
+		}
+	}
+	if left.Kind != KindEnum && right.Kind != KindEnum {
+		return nil
+	}
+	if err := compareEquality(left, right); err != nil {
+		return err
+	}
+	ordered := false
+	for _, t := range []Type{left, right} {
+		switch {
+		case t.Ordered:
+			ordered = true
+		case !t.Literal:
+			return fmt.Errorf("cannot order enum %q: its values are unordered; declare it with ordered: true to compare by declaration order", t.Name)
+		}
+	}
+	if !ordered {
+		return fmt.Errorf("cannot order enum literals %q and %q without an ordered enum to compare against", left.Name, right.Name)
+	}
+	return nil
+}
+
+// unifyBranches returns the type of an if-then-else whose branches have
+// the given types. Both branches must have the same kind; enum branches
+// must be comparable, and the result covers the values of both.
+func unifyBranches(then, els Type) (Type, error) {
+	if then.Kind != els.Kind {
+		return Type{}, fmt.Errorf("if branches have different types: then is %s, else is %s", then.Kind, els.Kind)
+	}
+	if then.Kind != KindEnum {
+		return Type{Kind: then.Kind}, nil
+	}
+	if err := compareEquality(then, els); err != nil {
+		return Type{}, fmt.Errorf("if branches: %w", err)
+	}
+	switch {
+	case then.Exact:
+		return then, nil
+	case els.Exact:
+		return els, nil
+	}
+	domain := append([]string(nil), then.Domain...)
+	for _, lit := range els.Domain {
+		if !containsString(domain, lit) {
+			domain = append(domain, lit)
+		}
+	}
+	return Type{Kind: KindEnum, Domain: domain, Name: then.Name}, nil
+}
+
+func sameDomain(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package expr
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func init() {
+	RegisterBuiltin("twice", 1, func(args []Value) (Value, error) {
+		return Value{IsInt: true, Int: 2 * args[0].Int}, nil
+	})
+	RegisterBuiltin("roundup", 2, func(args []Value) (Value, error) {
+		x, k := args[0].Int, args[1].Int
+		if k <= 0 {
+			return Value{}, fmt.Errorf("step %d must be positive", k)
+		}
+		return Value{IsInt: true, Int: (x + k - 1) / k * k}, nil
+	})
+	RegisterBuiltin("truthy", 1, func(args []Value) (Value, error) {
+		return Value{IsBool: true, Bool: args[0].Int != 0}, nil
+	})
+}
+
+// checkString parses src and type-checks it against testSchema.
+func checkString(t *testing.T, src string) (Type, error) {
+	t.Helper()
+	node, err := Parse(src)
+	if err != nil {
+		t.Fatalf("Parse(%q): %v", src, err)
+	}
+	schema := testSchema()
+	lits, err := BuildEnumLiterals(schema)
+	if err != nil {
+		t.Fatalf("BuildEnumLiterals: %v", err)
+	}
+	return (&Checker{Schema: schema, Literals: lits}).Check(node)
+}
+
+func TestCheckEnumArithmetic(t *testing.T) {
+	tests := []struct {
+		src     string
+		wantErr string // substring of the error; "" if src type-checks
+	}{
+		{"x + 1", ""},
+		{"x * 2 - x % 3", ""},
+		{"status + 1", `enum "status" used in arithmetic`},
+		{"1 - status", `enum "status" used in arithmetic`},
+		{"paid + 1", `enum literal "paid" used in arithmetic`},
+		{"sev * 2", `enum "sev" used in arithmetic`},
+		{"min(x, 3)", ""},
+		{"clamp(x + 1, 0, 5)", ""},
+		{"twice(x)", ""},
+		{"min(status, 1)", `enum "status" used as argument to min`},
+		{"max(1, sev)", `enum "sev" used as argument to max`},
+		{"clamp(status, 0, 1)", `enum "status" used as argument to clamp`},
+		{"twice(status)", `enum "status" used as argument to twice`},
+		{"min(paid, 1)", `enum literal "paid" used as argument to min`},
+		{"twice(flag)", "twice requires int arguments, got bool"},
+	}
+	for _, tt := range tests {
+		_, err := checkString(t, tt.src)
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", tt.src, err)
+		case tt.wantErr != "" && err == nil:
+			t.Errorf("%s: no error, want %q", tt.src, tt.wantErr)
+		case tt.wantErr != "" && !strings.Contains(err.Error(), tt.wantErr):
+			t.Errorf("%s: error %q, want it to contain %q", tt.src, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCheckIfBranches(t *testing.T) {
+	tests := []struct {
+		src      string
+		wantKind Kind
+		wantErr  string // substring of the error; "" if src type-checks
+	}{
+		{"if flag then x else 0", KindInt, ""},
+		{"if x > 2 then flag else not flag", KindBool, ""},
+		{"if flag then status else prev", KindEnum, ""},
+		{"if flag then paid else pending", KindEnum, ""},
+		{"if flag then status else paid", KindEnum, ""},
+		{"(if flag then x else x + 1) + 1", KindInt, ""},
+		{"if flag then x else true", 0, "if branches have different types: then is int, else is bool"},
+		{"if flag then false else 1", 0, "if branches have different types: then is bool, else is int"},
+		{"if flag then status else 1", 0, "if branches have different types"},
+		{"if flag then status else stage", 0, "if branches: "},
+		{"if flag then status else shipped", 0, "if branches: "},
+		{"if x then 1 else 2", 0, "if condition"},
+		{"if flag then 1 elif x > 2 then 2 else 3", KindInt, ""},
+		{"if flag then 1 elif x > 2 then true else 3", 0, "if branches have different types: then is bool, else is int"},
+		{"if flag then 1 elif x then 2 else 3", 0, "if condition"},
+	}
+	for _, tt := range tests {
+		got, err := checkString(t, tt.src)
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", tt.src, err)
+		case tt.wantErr != "" && err == nil:
+			t.Errorf("%s: no error, want %q", tt.src, tt.wantErr)
+		case tt.wantErr != "" && !strings.Contains(err.Error(), tt.wantErr):
+			t.Errorf("%s: error %q, want it to contain %q", tt.src, err, tt.wantErr)
+		case err == nil && got.Kind != tt.wantKind:
+			t.Errorf("%s: type %s, want %s", tt.src, got.Kind, tt.wantKind)
+		}
+	}
+}
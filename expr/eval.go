@@ -2,6 +2,7 @@ package expr
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/blackwell-systems/nccheck/registry"
 )
@@ -12,6 +13,17 @@ type Value struct {
 	IsBool bool
 	Int    int
 	Bool   bool
+
+	// IsEnum marks an int that is an enum ordinal: the value of an enum
+	// variable, parameter or literal. Equality refuses to compare it with
+	// a plain int, whose match with an ordinal would be a coincidence of
+	// encoding.
+	IsEnum bool
+
+	// IsString marks a string literal. Strings are only meaningful when
+	// compared with an enum value, where they name one of its literals.
+	IsString bool
+	Str      string
 }
 
 // Env maps variable names to values, with schema for type info.
@@ -22,6 +34,11 @@ type Env struct {
 	// Populated once per schema.
 	EnumLiterals map[string]int // enum literal -> encoded int value
 	EnumVarMap   map[string]int // enum literal -> which var index it belongs to (for type checking)
+	// Params binds event parameter names to their values for one transition.
+	Params map[string]Value
+	// StrictDiv makes a division that leaves a remainder an error instead
+	// of truncating toward zero. floordiv is unaffected.
+	StrictDiv bool
 }
 
 // NewEnv creates an evaluation environment from schema + state.
@@ -34,7 +51,10 @@ func NewEnv(schema *registry.Schema, state registry.State, enumLiterals map[stri
 }
 
 // BuildEnumLiterals precomputes a lookup table of enum literal -> encoded value.
-// Returns error if any enum literal conflicts with a variable name or another enum.
+// A literal may appear in several enums only if it has the same position in
+// each, so that its encoding is unambiguous. Returns error if any enum literal
+// conflicts with a variable name or is declared at different positions.
+// Literals may reuse the bool synonyms yes/on/no/off, which they then shadow.
 func BuildEnumLiterals(schema *registry.Schema) (map[string]int, error) {
 	varNames := make(map[string]bool)
 	for _, v := range schema.Vars {
@@ -42,6 +62,7 @@ func BuildEnumLiterals(schema *registry.Schema) (map[string]int, error) {
 	}
 
 	literals := make(map[string]int)
+	owner := make(map[string]string) // literal -> first enum declaring it
 	for _, v := range schema.Vars {
 		if v.Type != registry.TypeEnum {
 			continue
@@ -50,10 +71,16 @@ func BuildEnumLiterals(schema *registry.Schema) (map[string]int, error) {
 			if varNames[lit] {
 				return nil, fmt.Errorf("enum literal %q conflicts with variable name", lit)
 			}
-			if _, exists := literals[lit]; exists {
-				return nil, fmt.Errorf("enum literal %q appears in multiple enums", lit)
+			if prev, exists := literals[lit]; exists {
+				if prev != idx {
+					return nil, fmt.Errorf(
+						"enum literal %q is value %d of %q but value %d of %q; enums sharing literals must list them in the same order",
+						lit, prev, owner[lit], idx, v.Name)
+				}
+				continue
 			}
 			literals[lit] = idx
+			owner[lit] = v.Name
 		}
 	}
 	return literals, nil
@@ -65,6 +92,9 @@ func Eval(node *Node, env *Env) (Value, error) {
 	case NodeLitInt:
 		return Value{IsInt: true, Int: node.IntVal}, nil
 
+	case NodeLitString:
+		return Value{IsString: true, Str: node.Str}, nil
+
 	case NodeLitBool:
 		return Value{IsBool: true, Bool: node.BoolVal}, nil
 
@@ -77,14 +107,22 @@ func Eval(node *Node, env *Env) (Value, error) {
 			case registry.TypeBool:
 				return Value{IsBool: true, Bool: env.State[idx] == 1}, nil
 			case registry.TypeEnum:
-				return Value{IsInt: true, Int: env.State[idx]}, nil
+				return Value{IsInt: true, IsEnum: true, Int: env.State[idx]}, nil
 			case registry.TypeInt:
 				return Value{IsInt: true, Int: env.State[idx]}, nil
 			}
 		}
+		// Check if it's a bound event parameter.
+		if val, ok := env.Params[node.Name]; ok {
+			return val, nil
+		}
 		// Check if it's an enum literal.
 		if val, ok := env.EnumLiterals[node.Name]; ok {
-			return Value{IsInt: true, Int: val}, nil
+			return Value{IsInt: true, IsEnum: true, Int: val}, nil
+		}
+		// Otherwise a bool synonym such as yes or off.
+		if b, ok := boolSynonyms[node.Name]; ok {
+			return Value{IsBool: true, Bool: b}, nil
 		}
 		return Value{}, fmt.Errorf("undefined identifier %q", node.Name)
 
@@ -135,19 +173,35 @@ func Eval(node *Node, env *Env) (Value, error) {
 		if err != nil {
 			return Value{}, err
 		}
-		eq := false
-		if left.IsBool && right.IsBool {
-			eq = left.Bool == right.Bool
-		} else if left.IsInt && right.IsInt {
-			eq = left.Int == right.Int
-		} else {
-			return Value{}, fmt.Errorf("type mismatch in equality comparison")
+		eq, ok := valuesEqual(left, right, env)
+		if !ok {
+			return Value{}, mismatch(left, right, "equality comparison")
 		}
 		if node.Type == NodeNeq {
 			eq = !eq
 		}
 		return Value{IsBool: true, Bool: eq}, nil
 
+	case NodeIn:
+		x, err := Eval(node.Children[0], env)
+		if err != nil {
+			return Value{}, err
+		}
+		for _, elemNode := range node.Children[1:] {
+			elem, err := Eval(elemNode, env)
+			if err != nil {
+				return Value{}, err
+			}
+			eq, ok := valuesEqual(x, elem, env)
+			if !ok {
+				return Value{}, mismatch(x, elem, "set membership")
+			}
+			if eq {
+				return Value{IsBool: true, Bool: true}, nil
+			}
+		}
+		return Value{IsBool: true, Bool: false}, nil
+
 	case NodeLt, NodeLe, NodeGt, NodeGe:
 		left, err := Eval(node.Children[0], env)
 		if err != nil {
@@ -197,6 +251,10 @@ func Eval(node *Node, env *Env) (Value, error) {
 			if right.Int == 0 {
 				return Value{}, fmt.Errorf("division by zero")
 			}
+			if env.StrictDiv && left.Int%right.Int != 0 {
+				return Value{}, fmt.Errorf("inexact division %d / %d under strict arithmetic; use floordiv(a, b) to round down explicitly",
+					left.Int, right.Int)
+			}
 			result = left.Int / right.Int
 		case NodeMod:
 			if right.Int == 0 {
@@ -253,6 +311,46 @@ func Eval(node *Node, env *Env) (Value, error) {
 				return a, nil
 			}
 			return b, nil
+		case "floordiv":
+			a, err := Eval(node.Children[0], env)
+			if err != nil {
+				return Value{}, err
+			}
+			b, err := Eval(node.Children[1], env)
+			if err != nil {
+				return Value{}, err
+			}
+			if !a.IsInt || !b.IsInt {
+				return Value{}, fmt.Errorf("floordiv requires int arguments")
+			}
+			if b.Int == 0 {
+				return Value{}, fmt.Errorf("division by zero")
+			}
+			q := a.Int / b.Int
+			if a.Int%b.Int != 0 && (a.Int < 0) != (b.Int < 0) {
+				q--
+			}
+			return Value{IsInt: true, Int: q}, nil
+		case "mod":
+			x, err := Eval(node.Children[0], env)
+			if err != nil {
+				return Value{}, err
+			}
+			n, err := Eval(node.Children[1], env)
+			if err != nil {
+				return Value{}, err
+			}
+			if !x.IsInt || !n.IsInt {
+				return Value{}, fmt.Errorf("mod requires int arguments")
+			}
+			if n.Int <= 0 {
+				return Value{}, fmt.Errorf("mod requires a positive divisor, got %d", n.Int)
+			}
+			r := x.Int % n.Int
+			if r < 0 {
+				r += n.Int
+			}
+			return Value{IsInt: true, Int: r}, nil
 		case "clamp":
 			lo, err := Eval(node.Children[0], env)
 			if err != nil {
@@ -277,8 +375,34 @@ func Eval(node *Node, env *Env) (Value, error) {
 				v = hi.Int
 			}
 			return Value{IsInt: true, Int: v}, nil
+		case "between":
+			x, err := Eval(node.Children[0], env)
+			if err != nil {
+				return Value{}, err
+			}
+			lo, err := Eval(node.Children[1], env)
+			if err != nil {
+				return Value{}, err
+			}
+			hi, err := Eval(node.Children[2], env)
+			if err != nil {
+				return Value{}, err
+			}
+			if !x.IsInt || !lo.IsInt || !hi.IsInt {
+				return Value{}, fmt.Errorf("between requires int arguments")
+			}
+			return Value{IsBool: true, Bool: lo.Int <= x.Int && x.Int <= hi.Int}, nil
+		case "prefix":
+			// The argument is an enum state variable; test its current
+			// literal's name rather than its encoding.
+			idx := env.Schema.VarIndex(node.Children[0].Name)
+			if node.Children[0].Type != NodeVar || idx < 0 || env.Schema.Vars[idx].Type != registry.TypeEnum {
+				return Value{}, fmt.Errorf("prefix requires an enum variable")
+			}
+			literal := env.Schema.Vars[idx].Values[env.State[idx]]
+			return Value{IsBool: true, Bool: strings.HasPrefix(literal, node.Str)}, nil
 		default:
-			return Value{}, fmt.Errorf("unknown function %q", node.Name)
+			return callBuiltin(node, env)
 		}
 
 	default:
@@ -297,3 +421,34 @@ func EvalBool(node *Node, env *Env) (bool, error) {
 	}
 	return v.Bool, nil
 }
+
+// mismatch describes why valuesEqual could not compare a and b.
+func mismatch(a, b Value, context string) error {
+	if a.IsInt && b.IsInt {
+		if a.IsEnum {
+			a = b
+		}
+		return fmt.Errorf("cannot compare an enum value with the plain integer %d in %s; compare with an enum literal", a.Int, context)
+	}
+	return fmt.Errorf("type mismatch in %s", context)
+}
+
+// valuesEqual compares two values for == and set membership. A string
+// compares equal to an enum value when it names that value's literal; an
+// enum ordinal never equals a plain int. ok is false if the values are not
+// comparable.
+func valuesEqual(a, b Value, env *Env) (eq, ok bool) {
+	switch {
+	case a.IsBool && b.IsBool:
+		return a.Bool == b.Bool, true
+	case a.IsInt && b.IsInt:
+		return a.Int == b.Int, a.IsEnum == b.IsEnum
+	case a.IsString && b.IsInt:
+		ord, known := env.EnumLiterals[a.Str]
+		return known && ord == b.Int, true
+	case a.IsInt && b.IsString:
+		ord, known := env.EnumLiterals[b.Str]
+		return known && ord == a.Int, true
+	}
+	return false, false
+}
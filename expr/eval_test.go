@@ -0,0 +1,230 @@
+package expr
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/blackwell-systems/nccheck/registry"
+)
+
+// testSchema is a small schema shared by the expr tests: an int, a bool,
+// an ordered enum, two enums with the same domain and one sharing only
+// part of it, and an enum whose literals are the bool synonyms on and off.
+func testSchema() *registry.Schema {
+	s := registry.NewSchema([]registry.VarDef{
+		{Name: "x", Type: registry.TypeInt, Min: 0, Max: 5, Size: 6},
+		{Name: "flag", Type: registry.TypeBool, Size: 2},
+		{Name: "sev", Type: registry.TypeEnum, Values: []string{"low", "high"}, Ordered: true, Size: 2},
+		{Name: "status", Type: registry.TypeEnum, Values: []string{"pending", "paid"}, Size: 2},
+		{Name: "prev", Type: registry.TypeEnum, Values: []string{"pending", "paid"}, Size: 2},
+		{Name: "stage", Type: registry.TypeEnum, Values: []string{"pending", "shipped"}, Size: 2},
+		{Name: "power", Type: registry.TypeEnum, Values: []string{"off", "on"}, Size: 2},
+	})
+	return &s
+}
+
+// newTestEnv returns an environment over testSchema in the state given as
+// name=value pairs.
+func newTestEnv(t *testing.T, state string) *Env {
+	t.Helper()
+	schema := testSchema()
+	lits, err := BuildEnumLiterals(schema)
+	if err != nil {
+		t.Fatalf("BuildEnumLiterals: %v", err)
+	}
+	st, err := schema.ParseState(state)
+	if err != nil {
+		t.Fatalf("ParseState(%q): %v", state, err)
+	}
+	return NewEnv(schema, st, lits)
+}
+
+// evalString parses, type-checks and evaluates src in env.
+func evalString(t *testing.T, src string, env *Env) (Value, error) {
+	t.Helper()
+	node, err := Parse(src)
+	if err != nil {
+		t.Fatalf("Parse(%q): %v", src, err)
+	}
+	c := &Checker{Schema: env.Schema, Literals: env.EnumLiterals}
+	if _, err := c.Check(node); err != nil {
+		return Value{}, err
+	}
+	return Eval(node, env)
+}
+
+// evalCase is one expression, evaluated in a test environment, and its
+// expected value or error.
+type evalCase struct {
+	src     string
+	want    Value
+	wantErr string // substring of the parse, check or eval error
+}
+
+// runEvalCases parses, checks and evaluates each case in env.
+func runEvalCases(t *testing.T, env *Env, cases []evalCase) {
+	t.Helper()
+	for _, tc := range cases {
+		var v Value
+		node, err := Parse(tc.src)
+		if err == nil {
+			c := &Checker{Schema: env.Schema, Literals: env.EnumLiterals}
+			if _, err = c.Check(node); err == nil {
+				v, err = Eval(node, env)
+			}
+		}
+		switch {
+		case tc.wantErr == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", tc.src, err)
+		case tc.wantErr != "" && err == nil:
+			t.Errorf("%s = %+v, want error %q", tc.src, v, tc.wantErr)
+		case tc.wantErr != "" && !strings.Contains(err.Error(), tc.wantErr):
+			t.Errorf("%s: error %q, want it to contain %q", tc.src, err, tc.wantErr)
+		case err == nil && v != tc.want:
+			t.Errorf("%s = %+v, want %+v", tc.src, v, tc.want)
+		}
+	}
+}
+
+// intVal and boolVal build expected values for evalCase.
+func intVal(n int) Value   { return Value{IsInt: true, Int: n} }
+func boolVal(b bool) Value { return Value{IsBool: true, Bool: b} }
+
+func TestBoolSynonyms(t *testing.T) {
+	env := newTestEnv(t, "x=0, flag=true, sev=low, status=pending, prev=pending, stage=pending, power=on")
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{"flag == yes", true},
+		{"flag == no", false},
+		{"yes and not no", true},
+		// on and off are literals of power here, so they shadow the synonyms.
+		{"power == on", true},
+		{"power == off", false},
+		{"power != off and flag", true},
+	}
+	for _, tt := range tests {
+		v, err := evalString(t, tt.src, env)
+		if err != nil {
+			t.Errorf("%s: %v", tt.src, err)
+			continue
+		}
+		if !v.IsBool || v.Bool != tt.want {
+			t.Errorf("%s = %+v, want %v", tt.src, v, tt.want)
+		}
+	}
+
+	// A shadowed synonym is an enum literal, not a bool.
+	if _, err := evalString(t, "flag == on", env); err == nil {
+		t.Error("flag == on: want a type error, on is a literal of power")
+	}
+}
+
+func TestEvalEnumEquality(t *testing.T) {
+	env := newTestEnv(t, "x=1, flag=true, sev=high, status=paid, prev=paid, stage=shipped, power=off")
+	tests := []struct {
+		src     string
+		want    bool
+		wantErr string // substring of the error; "" if src evaluates
+	}{
+		{"status == prev", true, ""},
+		{"status != prev", false, ""},
+		{"status == paid", true, ""},
+		{"stage == shipped", true, ""},
+		{"status == \"paid\"", true, ""},
+		{"pending == pending", true, ""},
+		{"status in {pending, paid}", true, ""},
+		{"x == 1", true, ""},
+		{"status == stage", false, "value lists differ"},
+		{"status == shipped", false, `"shipped" is not a value of "status"`},
+		{"status == 1", false, `cannot compare enum "status" with a plain integer`},
+		{"1 != stage", false, `cannot compare enum "stage" with a plain integer`},
+		{"x == paid", false, `cannot compare enum "paid" with a plain integer`},
+		{"flag == 1", false, "type mismatch in equality comparison: bool vs int"},
+	}
+	for _, tt := range tests {
+		v, err := evalString(t, tt.src, env)
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", tt.src, err)
+		case tt.wantErr != "" && err == nil:
+			t.Errorf("%s: no error, want %q", tt.src, tt.wantErr)
+		case tt.wantErr != "" && !strings.Contains(err.Error(), tt.wantErr):
+			t.Errorf("%s: error %q, want it to contain %q", tt.src, err, tt.wantErr)
+		case err == nil && (!v.IsBool || v.Bool != tt.want):
+			t.Errorf("%s = %+v, want %v", tt.src, v, tt.want)
+		}
+	}
+}
+
+// Without the checker, evaluation still refuses to equate an enum ordinal
+// with a plain int.
+func TestEvalEnumIntMismatch(t *testing.T) {
+	env := newTestEnv(t, "x=1, flag=true, sev=high, status=paid, prev=paid, stage=shipped, power=off")
+	for _, src := range []string{"status == 1", "1 == status", "x in {pending, paid}"} {
+		node, err := Parse(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = Eval(node, env)
+		if err == nil || !strings.Contains(err.Error(), "cannot compare an enum value with the plain integer 1") {
+			t.Errorf("%s: error %v, want an enum/int mismatch", src, err)
+		}
+	}
+}
+
+func TestSetMembership(t *testing.T) {
+	env := newTestEnv(t, "x=2, flag=false, sev=low, status=paid, prev=pending, stage=pending, power=on")
+	runEvalCases(t, env, []evalCase{
+		{src: "x in {1, 2, 3}", want: boolVal(true)},
+		{src: "x in {4}", want: boolVal(false)},
+		{src: "x not in {4, 5}", want: boolVal(true)},
+		{src: "x not in {2}", want: boolVal(false)},
+		{src: "x + 1 in {x + 1}", want: boolVal(true)},
+		{src: "status in {pending, paid}", want: boolVal(true)},
+		{src: "status not in {pending}", want: boolVal(true)},
+		{src: "status in {prev}", want: boolVal(false)},
+		{src: "flag in {true}", want: boolVal(false)},
+		{src: "x in {1, 2} and flag not in {true}", want: boolVal(true)},
+		{src: "not (x in {2})", want: boolVal(false)},
+		{src: "not x in {2}", wantErr: "'not' requires bool operand, got int"}, // not binds tighter
+		{src: "status in {shipped}", wantErr: `set membership: cannot compare enum "status" with "shipped"`},
+		{src: "x in {true}", wantErr: "set membership: type mismatch in equality comparison: int vs bool"},
+		{src: "x in {}", wantErr: "empty set literal at position 5"},
+		{src: "x in {1, 2", wantErr: "expected"},
+		{src: "x in 1", wantErr: "expected"},
+	})
+}
+
+func TestEvalTupleEquality(t *testing.T) {
+	env := newTestEnv(t, "x=2, flag=true, sev=low, status=paid, prev=paid, stage=pending, power=on")
+	runEvalCases(t, env, []evalCase{
+		{src: "(x, flag) == (2, true)", want: boolVal(true)},
+		{src: "(x, flag) == (2, false)", want: boolVal(false)},
+		{src: "(x, flag) != (2, false)", want: boolVal(true)},
+		{src: "(x, flag) != (2, true)", want: boolVal(false)},
+		{src: "(status, x) == (prev, 1 + 1)", want: boolVal(true)},
+		{src: "(status, stage) == (paid, pending)", want: boolVal(true)},
+		{src: "(x, flag) == (flag, x)", wantErr: "type mismatch in equality comparison: int vs bool"},
+		{src: "(x, flag) == (2)", wantErr: "tuple compared with a non-tuple"},
+	})
+}
+
+func TestEvalElif(t *testing.T) {
+	const chain = "if x < 1 then 10 elif x < 3 then 20 elif flag then 30 else 40"
+	tests := []struct {
+		state string
+		want  int
+	}{
+		{"x=0, flag=false", 10},
+		{"x=1, flag=true", 20},
+		{"x=2, flag=false", 20},
+		{"x=3, flag=true", 30},
+		{"x=5, flag=false", 40},
+	}
+	for _, tt := range tests {
+		env := newTestEnv(t, tt.state+", sev=low, status=paid, prev=paid, stage=pending, power=on")
+		runEvalCases(t, env, []evalCase{{src: chain, want: intVal(tt.want)}})
+	}
+}
@@ -1,7 +1,9 @@
 package expr
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 	"unicode"
 )
 
@@ -20,12 +22,12 @@ const (
 	TokIf
 	TokThen
 	TokElse
-	TokEq    // ==
-	TokNeq   // !=
-	TokLt    // <
-	TokLe    // <=
-	TokGt    // >
-	TokGe    // >=
+	TokEq  // ==
+	TokNeq // !=
+	TokLt  // <
+	TokLe  // <=
+	TokGt  // >
+	TokGe  // >=
 	TokPlus
 	TokMinus
 	TokStar
@@ -34,6 +36,11 @@ const (
 	TokLParen
 	TokRParen
 	TokComma
+	TokLBrace
+	TokRBrace
+	TokIn
+	TokString // "..." (Val holds the unescaped contents)
+	TokElif
 )
 
 // Token is a single lexer token.
@@ -52,11 +59,43 @@ var keywords = map[string]TokenType{
 	"if":    TokIf,
 	"then":  TokThen,
 	"else":  TokElse,
+	"elif":  TokElif,
+	"in":    TokIn,
 }
 
-// Lex tokenizes an expression string.
+// boolSynonyms are the config-style spellings of true and false. They are
+// not keywords: an identifier with one of these names means the bool only
+// when it is not a variable, parameter or enum literal, so an enum such as
+// [on, off] keeps working.
+var boolSynonyms = map[string]bool{
+	"yes": true,
+	"on":  true,
+	"no":  false,
+	"off": false,
+}
+
+// Lex tokenizes an expression string, stopping at the first error.
 func Lex(input string) ([]Token, error) {
+	tokens, errs := lex(input, false)
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+	return tokens, nil
+}
+
+// LexAll tokenizes an expression string, skipping over bad characters and
+// escapes so that every lexical error is found in one pass. The error, if
+// any, joins all of them (see errors.Join) in input order; the tokens then
+// omit the bad input and are only useful for diagnostics.
+func LexAll(input string) ([]Token, error) {
+	tokens, errs := lex(input, true)
+	return tokens, errors.Join(errs...)
+}
+
+// lex tokenizes input. Unless all is set it returns at the first error.
+func lex(input string, all bool) ([]Token, []error) {
 	var tokens []Token
+	var errs []error
 	i := 0
 	for i < len(input) {
 		ch := rune(input[i])
@@ -92,6 +131,43 @@ func Lex(input string) ([]Token, error) {
 			continue
 		}
 
+		// String literals.
+		if ch == '"' {
+			start := i
+			var sb strings.Builder
+			i++
+			for i < len(input) && input[i] != '"' {
+				if input[i] != '\\' {
+					sb.WriteByte(input[i])
+					i++
+					continue
+				}
+				if i+1 >= len(input) {
+					i = len(input) // a trailing backslash leaves the string open
+					break
+				}
+				switch input[i+1] {
+				case '"', '\\':
+					sb.WriteByte(input[i+1])
+				case 'n':
+					sb.WriteByte('\n')
+				default:
+					errs = append(errs, fmt.Errorf("unknown escape \\%c in string at position %d", input[i+1], i))
+					if !all {
+						return nil, errs
+					}
+				}
+				i += 2
+			}
+			if i >= len(input) {
+				errs = append(errs, fmt.Errorf("unterminated string starting at position %d", start))
+				break
+			}
+			tokens = append(tokens, Token{TokString, sb.String(), start})
+			i++
+			continue
+		}
+
 		// Two-character operators.
 		if i+1 < len(input) {
 			two := input[i : i+2]
@@ -115,8 +191,11 @@ func Lex(input string) ([]Token, error) {
 			}
 		}
 
-		// Single-character operators.
+		// Single-character operators. "!=" was matched above, so a lone
+		// '!' is the C-style spelling of 'not'.
 		switch ch {
+		case '!':
+			tokens = append(tokens, Token{TokNot, "!", i})
 		case '<':
 			tokens = append(tokens, Token{TokLt, "<", i})
 		case '>':
@@ -137,11 +216,18 @@ func Lex(input string) ([]Token, error) {
 			tokens = append(tokens, Token{TokRParen, ")", i})
 		case ',':
 			tokens = append(tokens, Token{TokComma, ",", i})
+		case '{':
+			tokens = append(tokens, Token{TokLBrace, "{", i})
+		case '}':
+			tokens = append(tokens, Token{TokRBrace, "}", i})
 		default:
-			return nil, fmt.Errorf("unexpected character %q at position %d", ch, i)
+			errs = append(errs, fmt.Errorf("unexpected character %q at position %d", ch, i))
+			if !all {
+				return nil, errs
+			}
 		}
 		i++
 	}
 	tokens = append(tokens, Token{TokEOF, "", len(input)})
-	return tokens, nil
+	return tokens, errs
 }
@@ -0,0 +1,98 @@
+package expr
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLexStrings(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    []Token
+		wantErr string
+	}{
+		{`"paid"`, []Token{{TokString, "paid", 0}, {TokEOF, "", 6}}, ""},
+		{`""`, []Token{{TokString, "", 0}, {TokEOF, "", 2}}, ""},
+		{`x == "a\"b"`, []Token{{TokIdent, "x", 0}, {TokEq, "==", 2}, {TokString, `a"b`, 5}, {TokEOF, "", 11}}, ""},
+		{`"a\\b" "c\nd"`, []Token{{TokString, `a\b`, 0}, {TokString, "c\nd", 7}, {TokEOF, "", 13}}, ""},
+		{`"\\"`, []Token{{TokString, `\`, 0}, {TokEOF, "", 4}}, ""},
+		{`"open`, nil, "unterminated string starting at position 0"},
+		{`x == "a\"`, nil, "unterminated string starting at position 5"},
+		{`"a\`, nil, "unterminated string starting at position 0"},
+		{`"a\tb"`, nil, `unknown escape \t in string at position 2`},
+	}
+	for _, tt := range tests {
+		got, err := Lex(tt.input)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Lex(%s): error %v, want %q", tt.input, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Lex(%s): %v", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Lex(%s) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestLexAll(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string // every error, in input order
+	}{
+		{"x == 1", nil},
+		{"x $ 1", []string{`unexpected character '$' at position 2`}},
+		{"x @ 1 # 2", []string{
+			`unexpected character '@' at position 2`,
+			`unexpected character '#' at position 6`,
+		}},
+		{`x ? "a\tb" == "open`, []string{
+			`unexpected character '?' at position 2`,
+			`unknown escape \t in string at position 6`,
+			`unterminated string starting at position 14`,
+		}},
+	}
+	for _, tt := range tests {
+		_, err := LexAll(tt.input)
+		var got []string
+		if err != nil {
+			got = strings.Split(err.Error(), "\n")
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("LexAll(%s): errors %q, want %q", tt.input, got, tt.want)
+		}
+		// Lex stops at the first of them.
+		if _, err := Lex(tt.input); len(tt.want) > 0 && (err == nil || err.Error() != tt.want[0]) {
+			t.Errorf("Lex(%s): error %v, want %q", tt.input, err, tt.want[0])
+		}
+	}
+}
+
+func TestLexBang(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []Token
+	}{
+		{"!flag", []Token{{TokNot, "!", 0}, {TokIdent, "flag", 1}, {TokEOF, "", 5}}},
+		{"!(a and b)", []Token{{TokNot, "!", 0}, {TokLParen, "(", 1}, {TokIdent, "a", 2}, {TokAnd, "and", 4},
+			{TokIdent, "b", 8}, {TokRParen, ")", 9}, {TokEOF, "", 10}}},
+		{"a != b", []Token{{TokIdent, "a", 0}, {TokNeq, "!=", 2}, {TokIdent, "b", 5}, {TokEOF, "", 6}}},
+		{"a!=b", []Token{{TokIdent, "a", 0}, {TokNeq, "!=", 1}, {TokIdent, "b", 3}, {TokEOF, "", 4}}},
+		{"!!a", []Token{{TokNot, "!", 0}, {TokNot, "!", 1}, {TokIdent, "a", 2}, {TokEOF, "", 3}}},
+	}
+	for _, tt := range tests {
+		got, err := Lex(tt.input)
+		if err != nil {
+			t.Errorf("Lex(%s): %v", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Lex(%s) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
@@ -28,6 +28,9 @@ const (
 	NodeMod
 	NodeIf // if-then-else
 	NodeCall
+	NodeIn // set membership: Children[0] in {Children[1:]...}
+	NodeLitString
+	NodeTuple // (a, b, ...); parse-time only, desugared by the parser
 )
 
 // Node is an AST node.
@@ -36,6 +39,7 @@ type Node struct {
 	IntVal   int
 	BoolVal  bool
 	Name     string // for Var, Call
+	Str      string // for LitString, and the pattern of prefix
 	Children []*Node
 }
 
@@ -59,6 +63,11 @@ func Parse(input string) (*Node, error) {
 	if p.peek().Type != TokEOF {
 		return nil, fmt.Errorf("unexpected token %q at position %d", p.peek().Val, p.peek().Pos)
 	}
+	var misplaced bool
+	Walk(node, func(n *Node) { misplaced = misplaced || n.Type == NodeTuple })
+	if misplaced {
+		return nil, fmt.Errorf("tuple used outside == or !=; tuples may only be compared with each other")
+	}
 	return node, nil
 }
 
@@ -102,16 +111,32 @@ func (p *Parser) parseExpr(minPrec int) (*Node, error) {
 
 	for {
 		tok := p.peek()
-		prec, nodeType, ok := infixInfo(tok.Type)
+		// 'if' only starts an expression (see parseUnary); after a complete
+		// operand it is a Python-style conditional, which the DSL lacks.
+		if tok.Type == TokIf {
+			return nil, fmt.Errorf("unexpected 'if' at position %d; a conditional is written if c then a else b", tok.Pos)
+		}
+		prec, nodeType, ok := p.infixInfo(tok)
 		if !ok || prec < minPrec {
 			break
 		}
 
-		// Handle 'if' as a special ternary.
-		if tok.Type == TokIf {
-			// left is already parsed (unused in standard ternary, but we handle
-			// this differently: 'if' starts at unary level)
-			break
+		// Set membership: 'in' and 'not in' take a braced set literal.
+		if nodeType == NodeIn {
+			negate := tok.Type == TokNot
+			p.advance()
+			if negate {
+				p.advance() // consume 'in'
+			}
+			elems, err := p.parseSet()
+			if err != nil {
+				return nil, err
+			}
+			left = &Node{Type: NodeIn, Children: append([]*Node{left}, elems...)}
+			if negate {
+				left = &Node{Type: NodeNot, Children: []*Node{left}}
+			}
+			continue
 		}
 
 		p.advance()
@@ -119,12 +144,37 @@ func (p *Parser) parseExpr(minPrec int) (*Node, error) {
 		if err != nil {
 			return nil, err
 		}
+		if (nodeType == NodeEq || nodeType == NodeNeq) && (left.Type == NodeTuple || right.Type == NodeTuple) {
+			if left, err = tupleCompare(nodeType, left, right); err != nil {
+				return nil, fmt.Errorf("%w at position %d", err, tok.Pos)
+			}
+			continue
+		}
 		left = &Node{Type: nodeType, Children: []*Node{left, right}}
 	}
 
 	return left, nil
 }
 
+// negatedComparison maps each comparison to its complement. Ordering
+// applies only to ints and ordered enums, which are totally ordered, so
+// not (a < b) holds exactly when a >= b; equality is two-valued on every
+// type.
+var negatedComparison = map[NodeType]NodeType{
+	NodeEq: NodeNeq, NodeNeq: NodeEq,
+	NodeLt: NodeGe, NodeGe: NodeLt,
+	NodeGt: NodeLe, NodeLe: NodeGt,
+}
+
+// negate returns "not operand", folding a negated comparison into its
+// complement so that not (a == b) parses as a != b.
+func negate(operand *Node) *Node {
+	if t, ok := negatedComparison[operand.Type]; ok {
+		return &Node{Type: t, Children: operand.Children}
+	}
+	return &Node{Type: NodeNot, Children: []*Node{operand}}
+}
+
 func (p *Parser) parseUnary() (*Node, error) {
 	tok := p.peek()
 
@@ -135,31 +185,13 @@ func (p *Parser) parseUnary() (*Node, error) {
 		if err != nil {
 			return nil, err
 		}
-		return &Node{Type: NodeNot, Children: []*Node{operand}}, nil
+		return negate(operand), nil
 	}
 
 	// 'if' ternary
 	if tok.Type == TokIf {
 		p.advance()
-		cond, err := p.parseExpr(0)
-		if err != nil {
-			return nil, err
-		}
-		if _, err := p.expect(TokThen); err != nil {
-			return nil, fmt.Errorf("expected 'then' in if-then-else")
-		}
-		then, err := p.parseExpr(0)
-		if err != nil {
-			return nil, err
-		}
-		if _, err := p.expect(TokElse); err != nil {
-			return nil, fmt.Errorf("expected 'else' in if-then-else")
-		}
-		els, err := p.parseExpr(0)
-		if err != nil {
-			return nil, err
-		}
-		return &Node{Type: NodeIf, Children: []*Node{cond, then, els}}, nil
+		return p.parseIfRest()
 	}
 
 	// Unary minus
@@ -179,6 +211,36 @@ func (p *Parser) parseUnary() (*Node, error) {
 	return p.parseAtom()
 }
 
+// parseIfRest parses the remainder of an if-then-else after 'if' (or
+// 'elif'). An elif chain desugars into nested ifs:
+// if a then x elif b then y else z is if a then x else (if b then y else z).
+func (p *Parser) parseIfRest() (*Node, error) {
+	cond, err := p.parseExpr(0)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(TokThen); err != nil {
+		return nil, fmt.Errorf("expected 'then' in if-then-else")
+	}
+	then, err := p.parseExpr(0)
+	if err != nil {
+		return nil, err
+	}
+	var els *Node
+	switch p.advance().Type {
+	case TokElif:
+		els, err = p.parseIfRest()
+	case TokElse:
+		els, err = p.parseExpr(0)
+	default:
+		return nil, fmt.Errorf("expected 'elif' or 'else' in if-then-else")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Node{Type: NodeIf, Children: []*Node{cond, then, els}}, nil
+}
+
 func (p *Parser) parseAtom() (*Node, error) {
 	tok := p.advance()
 
@@ -190,6 +252,9 @@ func (p *Parser) parseAtom() (*Node, error) {
 		}
 		return &Node{Type: NodeLitInt, IntVal: v}, nil
 
+	case TokString:
+		return &Node{Type: NodeLitString, Str: tok.Val}, nil
+
 	case TokTrue:
 		return &Node{Type: NodeLitBool, BoolVal: true}, nil
 
@@ -197,8 +262,13 @@ func (p *Parser) parseAtom() (*Node, error) {
 		return &Node{Type: NodeLitBool, BoolVal: false}, nil
 
 	case TokIdent:
-		// Check for function call: min, max, clamp.
-		if p.peek().Type == TokLParen && isBuiltin(tok.Val) {
+		// Check for a call to a builtin or registered function. An
+		// identifier can never be followed by '(' otherwise, so any other
+		// name there is a misspelt or unknown function.
+		if p.peek().Type == TokLParen {
+			if !isBuiltin(tok.Val) {
+				return nil, fmt.Errorf("unknown function %q at position %d", tok.Val, tok.Pos)
+			}
 			return p.parseCall(tok.Val)
 		}
 		return &Node{Type: NodeVar, Name: tok.Val}, nil
@@ -208,6 +278,18 @@ func (p *Parser) parseAtom() (*Node, error) {
 		if err != nil {
 			return nil, err
 		}
+		if p.peek().Type == TokComma {
+			elems := []*Node{expr}
+			for p.peek().Type == TokComma {
+				p.advance()
+				elem, err := p.parseExpr(0)
+				if err != nil {
+					return nil, err
+				}
+				elems = append(elems, elem)
+			}
+			expr = &Node{Type: NodeTuple, Children: elems}
+		}
 		if _, err := p.expect(TokRParen); err != nil {
 			return nil, fmt.Errorf("expected closing ')'")
 		}
@@ -218,8 +300,75 @@ func (p *Parser) parseAtom() (*Node, error) {
 	}
 }
 
+// tupleCompare desugars a tuple comparison elementwise:
+// (a, b) == (c, d) becomes a == c and b == d, and (a, b) != (c, d) becomes
+// a != c or b != d. Nested tuples are compared the same way.
+func tupleCompare(op NodeType, l, r *Node) (*Node, error) {
+	if l.Type != NodeTuple || r.Type != NodeTuple {
+		return nil, fmt.Errorf("tuple compared with a non-tuple")
+	}
+	if len(l.Children) != len(r.Children) {
+		return nil, fmt.Errorf("tuple arity mismatch: %d elements vs %d", len(l.Children), len(r.Children))
+	}
+	join := NodeAnd
+	if op == NodeNeq {
+		join = NodeOr
+	}
+	var out *Node
+	for i := range l.Children {
+		a, b := l.Children[i], r.Children[i]
+		cmp := &Node{Type: op, Children: []*Node{a, b}}
+		if a.Type == NodeTuple || b.Type == NodeTuple {
+			var err error
+			if cmp, err = tupleCompare(op, a, b); err != nil {
+				return nil, err
+			}
+		}
+		if out == nil {
+			out = cmp
+		} else {
+			out = &Node{Type: join, Children: []*Node{out, cmp}}
+		}
+	}
+	return out, nil
+}
+
+// parseSet parses a non-empty braced set literal: '{' expr (',' expr)* '}'.
+func (p *Parser) parseSet() ([]*Node, error) {
+	open := p.advance()
+	if open.Type != TokLBrace {
+		return nil, fmt.Errorf("expected '{' after 'in', got %q at position %d", open.Val, open.Pos)
+	}
+	if p.peek().Type == TokRBrace {
+		return nil, fmt.Errorf("empty set literal at position %d", open.Pos)
+	}
+	var elems []*Node
+	for {
+		elem, err := p.parseExpr(0)
+		if err != nil {
+			return nil, err
+		}
+		elems = append(elems, elem)
+		if p.peek().Type == TokComma {
+			p.advance()
+			continue
+		}
+		break
+	}
+	if _, err := p.expect(TokRBrace); err != nil {
+		return nil, fmt.Errorf("expected '}' to close set literal")
+	}
+	return elems, nil
+}
+
 func (p *Parser) parseCall(name string) (*Node, error) {
 	p.advance() // consume '('
+	if name == "prefix" {
+		return p.parsePrefix()
+	}
+	if (name == "min" || name == "max") && p.peek().Type == TokLBrace {
+		return p.parseSetFold(name)
+	}
 	var args []*Node
 	for {
 		arg, err := p.parseExpr(0)
@@ -239,25 +388,131 @@ func (p *Parser) parseCall(name string) (*Node, error) {
 
 	// Validate arity.
 	switch name {
-	case "min", "max":
+	case "min", "max", "floordiv", "mod":
 		if len(args) != 2 {
 			return nil, fmt.Errorf("%s requires 2 arguments, got %d", name, len(args))
 		}
-	case "clamp":
+	case "clamp", "between":
 		if len(args) != 3 {
-			return nil, fmt.Errorf("clamp requires 3 arguments, got %d", len(args))
+			return nil, fmt.Errorf("%s requires 3 arguments, got %d", name, len(args))
+		}
+	default:
+		if b, _ := lookupBuiltin(name); len(args) != b.arity {
+			return nil, fmt.Errorf("%s requires %d arguments, got %d", name, b.arity, len(args))
 		}
 	}
 
 	return &Node{Type: NodeCall, Name: name, Children: args}, nil
 }
 
+// parseSetFold parses the set argument of min({...}) or max({...}) and
+// folds it into nested two-argument calls: max({a, b, c}) becomes
+// max(max(a, b), c). A single element e becomes max(e, e), which keeps
+// the int type check. The opening '(' has been consumed.
+func (p *Parser) parseSetFold(name string) (*Node, error) {
+	elems, err := p.parseSet()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(TokRParen); err != nil {
+		return nil, fmt.Errorf("expected ')' after %s arguments", name)
+	}
+	acc := &Node{Type: NodeCall, Name: name, Children: []*Node{elems[0], elems[0]}}
+	for i, elem := range elems[1:] {
+		if i == 0 {
+			acc.Children[1] = elem
+			continue
+		}
+		acc = &Node{Type: NodeCall, Name: name, Children: []*Node{acc, elem}}
+	}
+	return acc, nil
+}
+
+// parsePrefix parses the arguments of prefix(x, "str"), whose pattern must
+// be a string literal. The opening '(' has been consumed.
+func (p *Parser) parsePrefix() (*Node, error) {
+	x, err := p.parseExpr(0)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(TokComma); err != nil {
+		return nil, fmt.Errorf("prefix requires 2 arguments")
+	}
+	pat := p.advance()
+	if pat.Type != TokString {
+		return nil, fmt.Errorf("prefix pattern must be a string literal, got %q at position %d", pat.Val, pat.Pos)
+	}
+	if _, err := p.expect(TokRParen); err != nil {
+		return nil, fmt.Errorf("expected ')' after prefix arguments")
+	}
+	return &Node{Type: NodeCall, Name: "prefix", Str: pat.Val, Children: []*Node{x}}, nil
+}
+
+// Walk calls fn for node and each of its descendants, parents first.
+func Walk(node *Node, fn func(*Node)) {
+	if node == nil {
+		return
+	}
+	fn(node)
+	for _, child := range node.Children {
+		Walk(child, fn)
+	}
+}
+
+// ResolveConstants replaces, in place, every variable reference to a name
+// in consts with the constant's integer literal. Callers must ensure that
+// constant names do not collide with variables or parameters.
+func ResolveConstants(node *Node, consts map[string]int) {
+	if len(consts) == 0 {
+		return
+	}
+	Walk(node, func(n *Node) {
+		if n.Type != NodeVar {
+			return
+		}
+		if v, ok := consts[n.Name]; ok {
+			*n = Node{Type: NodeLitInt, IntVal: v}
+		}
+	})
+}
+
+// IsBuiltin reports whether name is a builtin or registered function.
+func IsBuiltin(name string) bool {
+	return isBuiltin(name)
+}
+
 func isBuiltin(name string) bool {
-	return name == "min" || name == "max" || name == "clamp"
+	if isCoreBuiltin(name) {
+		return true
+	}
+	_, ok := lookupBuiltin(name)
+	return ok
+}
+
+func isCoreBuiltin(name string) bool {
+	switch name {
+	case "min", "max", "floordiv", "mod", "clamp", "between", "prefix":
+		return true
+	}
+	return false
+}
+
+func (p *Parser) infixInfo(tok Token) (prec int, nt NodeType, ok bool) {
+	// 'not' is prefix-only, except as the first half of 'not in' (which
+	// '!' cannot spell).
+	if tok.Type == TokNot {
+		if tok.Val == "not" && p.pos+1 < len(p.tokens) && p.tokens[p.pos+1].Type == TokIn {
+			return precCompare, NodeIn, true
+		}
+		return 0, 0, false
+	}
+	return infixInfo(tok.Type)
 }
 
 func infixInfo(tt TokenType) (prec int, nt NodeType, ok bool) {
 	switch tt {
+	case TokIn:
+		return precCompare, NodeIn, true
 	case TokOr:
 		return precOr, NodeOr, true
 	case TokAnd:
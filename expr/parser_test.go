@@ -0,0 +1,150 @@
+package expr
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/blackwell-systems/nccheck/registry"
+)
+
+// parseCase is one expression and the S-expression it parses to, or the
+// parse error it gives.
+type parseCase struct {
+	src     string
+	want    string // S-expression, after desugaring and folding
+	wantErr string
+}
+
+// runParseCases parses each case and compares the result.
+func runParseCases(t *testing.T, cases []parseCase) {
+	t.Helper()
+	for _, tt := range cases {
+		node, err := Parse(tt.src)
+		switch {
+		case tt.wantErr != "":
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Parse(%q): error %v, want %q", tt.src, err, tt.wantErr)
+			}
+		case err != nil:
+			t.Errorf("Parse(%q): %v", tt.src, err)
+		case node.String() != tt.want:
+			t.Errorf("Parse(%q) = %s, want %s", tt.src, node, tt.want)
+		}
+	}
+}
+
+func TestParseTuples(t *testing.T) {
+	runParseCases(t, []parseCase{
+		{"(x, flag) == (1, true)", "(and (== x 1) (== flag true))", ""},
+		{"(x, flag) != (1, true)", "(or (!= x 1) (!= flag true))", ""},
+		{"(x, status, sev) == (2, paid, low)", "(and (and (== x 2) (== status paid)) (== sev low))", ""},
+		{"(x, (status, sev)) == (2, (paid, low))", "(and (== x 2) (and (== status paid) (== sev low)))", ""},
+		{"(x) == (1)", "(== x 1)", ""}, // plain parentheses, not a 1-tuple
+		{"(x, flag) == (1, true) or x > 3", "(or (and (== x 1) (== flag true)) (> x 3))", ""},
+		{"(x, flag) == (1, true, 2)", "", "tuple arity mismatch: 2 elements vs 3"},
+		{"(x, flag) == x", "", "tuple compared with a non-tuple"},
+		{"(x, 1) < (2, 3)", "", "tuple used outside == or !="},
+		{"(x, 1)", "", "tuple used outside == or !="},
+		{"min((x, 1), 2) == 1", "", "tuple used outside == or !="},
+	})
+}
+
+func TestParseNegatedComparisons(t *testing.T) {
+	runParseCases(t, []parseCase{
+		{"not (x == 1)", "(!= x 1)", ""},
+		{"not (x != 1)", "(== x 1)", ""},
+		{"not (x < 1)", "(>= x 1)", ""},
+		{"not (x <= 1)", "(> x 1)", ""},
+		{"not (x > 1)", "(<= x 1)", ""},
+		{"not (x >= 1)", "(< x 1)", ""},
+		{"not (sev < high)", "(>= sev high)", ""},
+		{"not not (x < 1)", "(< x 1)", ""},
+		{"not ((x, flag) == (1, true))", "(not (and (== x 1) (== flag true)))", ""},
+		{"not flag", "(not flag)", ""},
+		{"not (flag and x == 1)", "(not (and flag (== x 1)))", ""},
+	})
+}
+
+// The folded form of a negated comparison evaluates like the negation
+// itself in every state of testSchema.
+func TestNegatedComparisonsEvaluateIdentically(t *testing.T) {
+	schema := testSchema()
+	lits, err := BuildEnumLiterals(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	comparisons := []string{
+		"x == 3", "x != 3", "x < 3", "x <= 3", "x > 3", "x >= 3",
+		"x + 1 < x * 2", "flag == true", "status != prev",
+		"sev < high", "sev >= low", "(x, flag) == (2, false)",
+	}
+	for _, src := range comparisons {
+		cmp, err := Parse(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		folded, err := Parse("not (" + src + ")")
+		if err != nil {
+			t.Fatal(err)
+		}
+		unfolded := &Node{Type: NodeNot, Children: []*Node{cmp}}
+		for sid := 0; sid < schema.TotalLen; sid++ {
+			env := NewEnv(schema, schema.Decode(registry.StateID(sid)), lits)
+			want, err := Eval(unfolded, env)
+			if err != nil {
+				t.Fatalf("not (%s): %v", src, err)
+			}
+			if got, err := Eval(folded, env); err != nil || got != want {
+				t.Errorf("not (%s) at %v: folded %s = %+v, %v; want %+v", src, env.State, folded, got, err, want)
+			}
+		}
+	}
+}
+
+func TestParseUnknownFunction(t *testing.T) {
+	runParseCases(t, []parseCase{
+		{"fooo(1, 2)", "", `unknown function "fooo" at position 0`},
+		{"x + mn(x, 1) > 2", "", `unknown function "mn" at position 4`},
+		{"not flag or clmp(0, x, 5) == 1", "", `unknown function "clmp" at position 12`},
+		{"twice(x) == 2", "(== (twice x) 2)", ""}, // registered in check_test.go
+		{"min(x, 1) == 0", "(== (min x 1) 0)", ""},
+		{"x (1)", "", `unknown function "x" at position 0`},
+	})
+}
+
+func TestParseElif(t *testing.T) {
+	runParseCases(t, []parseCase{
+		{"if x < 1 then 0 elif x < 3 then 1 else 2", "(if (< x 1) 0 (if (< x 3) 1 2))", ""},
+		{"if x < 1 then 0 elif x < 3 then 1 elif x < 5 then 2 else 3",
+			"(if (< x 1) 0 (if (< x 3) 1 (if (< x 5) 2 3)))", ""},
+		{"if flag then x else if x > 2 then 1 else 0", "(if flag x (if (> x 2) 1 0))", ""},
+		{"(if flag then 1 elif x > 2 then 2 else 3) + 1", "(+ (if flag 1 (if (> x 2) 2 3)) 1)", ""},
+		{"if x < 1 then 0 elif x < 3 then 1", "", "expected 'elif' or 'else' in if-then-else"},
+		{"if x < 1 then 0 elif then 1 else 2", "", "unexpected"},
+		{"if x < 1 then 0 elif x < 3 else 2", "", "expected 'then'"},
+		{"elif x then 1 else 2", "", "unexpected"},
+		{"x + elif", "", "unexpected"},
+	})
+}
+
+func TestParseBang(t *testing.T) {
+	runParseCases(t, []parseCase{
+		{"!flag", "(not flag)", ""},
+		{"!(flag and x > 1)", "(not (and flag (> x 1)))", ""},
+		{"!(x == 1)", "(!= x 1)", ""},
+		{"x != 1 and !flag", "(and (!= x 1) (not flag))", ""},
+		{"!!flag", "(not (not flag))", ""},
+		{"x ! in {1}", "", "unexpected"},
+	})
+}
+
+func TestMisplacedIf(t *testing.T) {
+	const hint = "; a conditional is written if c then a else b"
+	runParseCases(t, []parseCase{
+		{"1 if true then 2 else 3", "", "unexpected 'if' at position 2" + hint},
+		{"x + 1 if flag else 0", "", "unexpected 'if' at position 6" + hint},
+		{"(x if flag)", "", "unexpected 'if' at position 3" + hint},
+		{"x == if flag then 1 else 2", "(== x (if flag 1 2))", ""},
+		{"if flag then 1 else 2 + 3", "(if flag 1 (+ 2 3))", ""},
+	})
+}
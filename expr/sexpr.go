@@ -0,0 +1,57 @@
+package expr
+
+import (
+	"strconv"
+	"strings"
+)
+
+// sexprOps names the operator nodes in String's output.
+var sexprOps = map[NodeType]string{
+	NodeNot: "not", NodeAnd: "and", NodeOr: "or",
+	NodeEq: "==", NodeNeq: "!=", NodeLt: "<", NodeLe: "<=", NodeGt: ">", NodeGe: ">=",
+	NodeAdd: "+", NodeSub: "-", NodeMul: "*", NodeDiv: "/", NodeMod: "%",
+	NodeIf: "if", NodeIn: "in", NodeTuple: "tuple",
+}
+
+// String renders the AST as a parenthesized S-expression, e.g.
+// (and (< x 3) (== status paid)). Calls are (name args...), with the
+// pattern of prefix as its last argument. It shows the tree exactly as
+// parsed, desugarings included, and is meant for debugging.
+func (n *Node) String() string {
+	var sb strings.Builder
+	n.writeSexpr(&sb)
+	return sb.String()
+}
+
+func (n *Node) writeSexpr(sb *strings.Builder) {
+	switch n.Type {
+	case NodeLitInt:
+		sb.WriteString(strconv.Itoa(n.IntVal))
+		return
+	case NodeLitBool:
+		sb.WriteString(strconv.FormatBool(n.BoolVal))
+		return
+	case NodeLitString:
+		sb.WriteString(strconv.Quote(n.Str))
+		return
+	case NodeVar:
+		sb.WriteString(n.Name)
+		return
+	}
+	op, ok := sexprOps[n.Type]
+	if n.Type == NodeCall {
+		op, ok = n.Name, true
+	}
+	if !ok {
+		op = "?" + strconv.Itoa(int(n.Type))
+	}
+	sb.WriteString("(" + op)
+	for _, child := range n.Children {
+		sb.WriteByte(' ')
+		child.writeSexpr(sb)
+	}
+	if n.Type == NodeCall && n.Name == "prefix" {
+		sb.WriteString(" " + strconv.Quote(n.Str))
+	}
+	sb.WriteByte(')')
+}
@@ -0,0 +1,32 @@
+package expr
+
+import "testing"
+
+func TestNodeString(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"x", "x"},
+		{"42", "42"},
+		{"true", "true"},
+		{`"paid"`, `"paid"`},
+		{"x < 3 and status == paid", "(and (< x 3) (== status paid))"},
+		{"not flag or x + 1 * 2 >= 4", "(or (not flag) (>= (+ x (* 1 2)) 4))"},
+		{"if flag then 1 else x % 2", "(if flag 1 (% x 2))"},
+		{"x in {1, 2}", "(in x 1 2)"},
+		// Tuple equality is desugared by the parser, and String shows it so.
+		{"(x, flag) == (1, true)", "(and (== x 1) (== flag true))"},
+		{"max(x, 3) - min(x, 1)", "(- (max x 3) (min x 1))"},
+	}
+	for _, tt := range tests {
+		node, err := Parse(tt.src)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.src, err)
+			continue
+		}
+		if got := node.String(); got != tt.want {
+			t.Errorf("%s: String() = %q, want %q", tt.src, got, tt.want)
+		}
+	}
+}
@@ -2,4 +2,4 @@ module github.com/blackwell-systems/nccheck
 
 go 1.22.5
 
-require gopkg.in/yaml.v3 v3.0.1 // indirect
+require gopkg.in/yaml.v3 v3.0.1
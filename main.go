@@ -1,154 +1,736 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"log/slog"
 	"os"
+	"runtime/pprof"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/blackwell-systems/nccheck/expr"
 	"github.com/blackwell-systems/nccheck/registry"
 	"github.com/blackwell-systems/nccheck/verify"
 )
 
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Fprintf(os.Stderr, "Usage: nccheck <registry.yaml>\n")
-		os.Exit(1)
+	os.Exit(run())
+}
+
+// config holds the per-run settings derived from the command line.
+type config struct {
+	maxDepthReport   int
+	groupWFC         bool
+	orderSensitivity bool
+	monotoneRepair   bool
+	format           string
+	reachable        bool
+	countTransitions bool
+	deps             bool
+	dotRepair        bool
+	registryStats    bool
+	printEncoding    bool
+	graphJSON        string
+	validBitmap      string
+	repl             bool
+	traceState       string
+	assertFail       bool
+	bigConfirmed     bool
+	dryRun           bool
+	dumpAST          bool
+	timeout          time.Duration // 0: no limit
+	overlays         []string      // registries merged into the checked one
+	inputFormat      registry.InputFormat
+	explainPair      []string // two events for --explain-independence
+	opts             verify.Options
+}
+
+// exitTimeout is the exit code of a run aborted by --timeout.
+const exitTimeout = 3
+
+func run() int {
+	groupWFC := flag.Bool("group-by-invariant", false, "attribute WFC failures to the invariant whose repair was applied last; implies --fail-fast=false")
+	maxDepthReport := flag.Int("max-depth-report", 0, "list the `K` states with the deepest repair chains")
+	monotoneRepair := flag.Bool("check-monotone-repair", false, "report repairs that violate another invariant which held before the step; implies --fail-fast=false")
+	orderSensitivity := flag.Bool("events-order-sensitivity", false, "rank independent event pairs by the number of states where they fail to commute")
+	strictCC2 := flag.Bool("strict-cc2", false, "treat an event enabled at s but not at NF(s), or vice versa, as a CC2 failure")
+	checkDependent := flag.Bool("check-dependent-pairs", false, "also run CC1 on dependent event pairs and report which commute, without failing")
+	strictDependent := flag.Bool("strict-dependent-pairs", false, "like --check-dependent-pairs, but count non-commuting dependent pairs as CC1 failures")
+	strictArith := flag.Bool("strict-arith", false, "treat a division with a remainder in an effect or repair as an error instead of truncating")
+	outOfRange := flag.String("out-of-range", "error", "what an int effect or repair outside its range does: `policy` error, clamp or wrap")
+	shard := flag.String("shard", "", "run the per-state CC loops only on shard `i/N` of the state space")
+	maxStates := flag.Int("max-states", verify.MaxStates, "refuse state spaces larger than `N`; above the default also needs --i-understand-this-is-big")
+	maxTransitions := flag.Int("max-transitions", verify.MaxTransitions, "refuse parameterized events expanding to more than `N` transitions in total")
+	bigConfirmed := flag.Bool("i-understand-this-is-big", false, "confirm building tables for a state space over the default cap")
+	sparseStep := flag.Bool("sparse-step", false, "store the Step table sparsely: less memory when most events are disabled in most states, slower lookups")
+	inputFormat := flag.String("input-format", "yaml", "registry `syntax`: yaml or json (json is also accepted as yaml); use path - for stdin")
+	format := flag.String("format", "text", "output `format`: text, json or sarif")
+	reachable := flag.Bool("reachable", false, "count states reachable from the initial state")
+	countTransitions := flag.Bool("count-transitions", false, "report enabled transitions and average out-degree per state")
+	deps := flag.Bool("deps", false, "report each event's read/write sets and the CC1 independence matrix")
+	repairStrategy := flag.String("repair-strategy", "first", "which violated invariant to repair first: `first` declared, or highest priority")
+	canonical := flag.String("canonical", "none", "encode states in canonical `order`: none, enums (sort enum values) or all (also sort variables)")
+	focus := flag.String("invariant-focus", "", "check only the invariant `NAME` and its repair, ignoring all others")
+	events := flag.String("events", "", "check only the comma-separated events `NAMES`, excluding all others")
+	maxCCPairs := flag.Int("max-cc-pairs", 0, "compare at most `N` randomly sampled independent pairs in CC1 (0: all); a pass is then not exhaustive")
+	sampleSeed := flag.Int64("cc-sample-seed", 0, "`seed` for --max-cc-pairs sampling, to reproduce a run (0: time-based, reported)")
+	seed := flag.Int64("seed", 0, "visit states in a random order drawn from `N` while building tables; results must not change (0: StateID order)")
+	minimize := flag.Bool("counterexample-minimize", false, "generalize each CC1 counterexample, showing variables that do not affect the failure as *")
+	failFast := flag.Bool("fail-fast", true, "stop each check at its first counterexample; =false runs all checks to completion")
+	logLevel := flag.String("log-level", "warn", "diagnostic log `level` on stderr: debug, info, warn or error")
+	registryStats := flag.Bool("registry-stats", false, "print size and complexity stats (variables, states, pairs, reachable states, max repair depth) instead of checking")
+	printEncoding := flag.Bool("print-encoding", false, "explain the StateID encoding (strides, sizes, worked examples) instead of checking")
+	dotRepair := flag.Bool("dot-repair", false, "print the repair graph of invalid states as Graphviz DOT instead of checking")
+	graphJSON := flag.String("graph-json", "", "also write reachable states, transitions and repair steps as node/edge JSON to `path`")
+	validBitmap := flag.String("valid-bitmap", "", "also write the set of valid states as a packed bitmap file to `path`")
+	traceState := flag.String("trace-state", "", "print the repair steps from each state matching `SPEC` (name=value pairs, value * for all) instead of checking")
+	assertPass := flag.Bool("assert-pass", false, "exit 0 only if convergence is guaranteed (the default)")
+	assertFail := flag.Bool("assert-fail", false, "exit 0 only if a check fails, for negative tests of broken registries; implies --fail-fast=false")
+	explain := flag.String("explain-independence", "", "explain why CC1 treats events `E1,E2` as independent or dependent, instead of checking")
+	merge := flag.Bool("merge", false, "merge the events of every further registry argument into the first, and check the result")
+	timeout := flag.Duration("timeout", 0, "abort compile, table build, checks and reports after `duration` (e.g. 30s), exiting 3 (0: no limit)")
+	dumpAST := flag.Bool("dump-ast", false, "print each invariant, repair, guard and effect as an S-expression, as parsed and with constants resolved, instead of checking")
+	dryRun := flag.Bool("dry-run", false, "parse and type-check the registry without building tables or checking; exit 1 on errors")
+	lint := flag.Bool("lint", false, "report all structural problems in the registry instead of checking; exit 1 on errors")
+	jsonSchema := flag.Bool("summary-json-schema", false, "print the JSON Schema of --format json output and exit (no registry needed)")
+	replMode := flag.Bool("repl", false, "start an interactive expression evaluator instead of checking")
+	watch := flag.Bool("watch", false, "re-run the check whenever the registry file changes")
+	cpuProfile := flag.String("cpuprofile", "", "write a CPU profile of compile, build and checks to `path`")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: nccheck [flags] <registry.yaml | ->\n")
+		fmt.Fprintf(os.Stderr, "       nccheck --merge [flags] <base.yaml> <overlay.yaml>...\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *jsonSchema {
+		data, err := verify.JSONSchema()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			return 1
+		}
+		fmt.Println(string(data))
+		return 0
+	}
+	if flag.NArg() < 1 {
+		flag.Usage()
+		return 1
+	}
+
+	path := flag.Arg(0)
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(*logLevel)); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: unknown log level %q\n", *logLevel)
+		return 1
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+
+	if *format != "text" && *format != "json" && *format != "sarif" {
+		fmt.Fprintf(os.Stderr, "ERROR: unknown format %q (want text, json or sarif)\n", *format)
+		return 1
+	}
+	inFormat, err := registry.ParseInputFormat(*inputFormat)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	strategy, err := verify.ParseRepairStrategy(*repairStrategy)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	policy, err := verify.ParseOutOfRangePolicy(*outOfRange)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	var sh verify.Shard
+	if *shard != "" {
+		if sh, err = verify.ParseShard(*shard); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			return 1
+		}
+	}
+	order, err := verify.ParseCanonicalOrder(*canonical)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	if *assertPass && *assertFail {
+		fmt.Fprintf(os.Stderr, "ERROR: --assert-pass and --assert-fail cannot be combined\n")
+		return 1
+	}
+	if flag.Arg(0) == "-" && (*watch || *lint || *replMode) {
+		fmt.Fprintf(os.Stderr, "ERROR: --watch, --lint and --repl need a registry file, not stdin\n")
+		return 1
+	}
+	if *watch && *replMode {
+		fmt.Fprintf(os.Stderr, "ERROR: --watch and --repl cannot be combined\n")
+		return 1
+	}
+	if *explain != "" && len(splitList(*explain)) != 2 {
+		fmt.Fprintf(os.Stderr, "ERROR: --explain-independence wants two comma-separated events, got %q\n", *explain)
+		return 1
+	}
+	var overlays []string
+	if *merge {
+		if flag.NArg() < 2 {
+			fmt.Fprintf(os.Stderr, "ERROR: --merge needs a base registry and at least one overlay\n")
+			return 1
+		}
+		overlays = flag.Args()[1:]
+	}
+
+	cfg := config{
+		maxDepthReport:   *maxDepthReport,
+		groupWFC:         *groupWFC,
+		orderSensitivity: *orderSensitivity,
+		monotoneRepair:   *monotoneRepair,
+		format:           *format,
+		reachable:        *reachable,
+		countTransitions: *countTransitions,
+		deps:             *deps,
+		dotRepair:        *dotRepair,
+		registryStats:    *registryStats,
+		printEncoding:    *printEncoding,
+		graphJSON:        *graphJSON,
+		validBitmap:      *validBitmap,
+		repl:             *replMode,
+		traceState:       *traceState,
+		assertFail:       *assertFail,
+		bigConfirmed:     *bigConfirmed,
+		dryRun:           *dryRun,
+		dumpAST:          *dumpAST,
+		timeout:          *timeout,
+		overlays:         overlays,
+		inputFormat:      inFormat,
+		explainPair:      splitList(*explain),
+		opts: verify.Options{
+			StrictCC2:               *strictCC2,
+			CheckDependentPairs:     *checkDependent,
+			StrictDependentPairs:    *strictDependent,
+			StrictArith:             *strictArith,
+			OutOfRange:              policy,
+			Shard:                   sh,
+			MaxStates:               *maxStates,
+			SparseStep:              *sparseStep,
+			MaxTransitions:          *maxTransitions,
+			AllFailures:             !*failFast || *groupWFC || *monotoneRepair || *assertFail,
+			MinimizeCounterexamples: *minimize,
+			Seed:                    *seed,
+			MaxCCPairs:              *maxCCPairs,
+			SampleSeed:              *sampleSeed,
+			Repair:                  strategy,
+			Canonical:               order,
+			InvariantFocus:          *focus,
+			Events:                  splitList(*events),
+			Logger:                  logger,
+		},
+	}
+
+	if *cpuProfile != "" {
+		f, err := os.Create(*cpuProfile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		if err := pprof.StartCPUProfile(f); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: cpu profile: %v\n", err)
+			return 1
+		}
+		defer pprof.StopCPUProfile()
 	}
 
-	path := os.Args[1]
+	if *lint {
+		return lintFile(path)
+	}
+	if *watch {
+		return watchFile(path, cfg)
+	}
+	return check(path, cfg, nil)
+}
+
+// check loads, compiles and verifies the registry at path, printing the
+// report. It returns the process exit code. If cache is non-nil, compiled
+// expressions are reused across calls.
+func check(path string, cfg config, cache *verify.Cache) int {
 	start := time.Now()
+	ctx := context.Background()
+	if cfg.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.timeout)
+		defer cancel()
+	}
 
 	// Load and parse.
-	reg, err := registry.LoadFile(path)
+	reg, err := loadRegistry(path, cfg.overlays, cfg.inputFormat)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
-		os.Exit(1)
+		return 1
+	}
+	if cfg.dumpAST {
+		return dumpAST(reg)
 	}
 
 	// Compile expressions.
-	cr, err := verify.Compile(reg)
+	var cr *verify.CompiledRegistry
+	if cache != nil {
+		cr, err = cache.Compile(reg, cfg.opts)
+	} else {
+		cr, err = verify.CompileWithOptions(reg, cfg.opts)
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "COMPILE ERROR: %v\n", err)
-		os.Exit(1)
+		return 1
+	}
+	if err := ctx.Err(); err != nil {
+		return timedOut(&verify.InterruptedError{Phase: "compile", Err: err}, cfg)
+	}
+
+	if len(cfg.explainPair) == 2 {
+		x, err := cr.ExplainIndependence(cfg.explainPair[0], cfg.explainPair[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			return 1
+		}
+		fmt.Print(x)
+		return 0
+	}
+
+	if cfg.dryRun {
+		fmt.Printf("%s: OK (%d states, %d transitions; tables not built)\n",
+			path, cr.Schema.TotalLen, len(cr.EvtNames))
+		for _, w := range cr.NarrowingAssignments() {
+			fmt.Printf("  ! %s\n", w)
+		}
+		return 0
+	}
+
+	if n := cr.Schema.TotalLen; n > verify.MaxStates {
+		lo, hi := cr.TableBytes()
+		footprint := "about " + formatBytes(lo)
+		if hi != lo {
+			footprint = fmt.Sprintf("between %s and %s, depending on how many transitions are enabled", formatBytes(lo), formatBytes(hi))
+		}
+		if !cfg.bigConfirmed {
+			fmt.Fprintf(os.Stderr, "ERROR: %d states exceed the default cap of %d; tables would need %s.\n"+
+				"Pass --i-understand-this-is-big to proceed.\n", n, verify.MaxStates, footprint)
+			return 1
+		}
+		fmt.Fprintf(os.Stderr, "NOTE: checking %d states; tables need %s\n", n, footprint)
 	}
 
-	schema := cr.Schema
+	if cfg.printEncoding {
+		if err := cr.WriteEncoding(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			return 1
+		}
+		return 0
+	}
 
-	// Print header.
-	fmt.Printf("nccheck — Normalization Confluence Verifier\n")
-	fmt.Printf("════════════════════════════════════════════\n\n")
-	fmt.Printf("Registry:    %s\n", reg.Name)
-	fmt.Printf("Source:      %s\n\n", path)
+	if cfg.repl {
+		if err := runREPL(cr, os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			return 1
+		}
+		return 0
+	}
 
-	// State space summary.
-	var varParts []string
-	for _, v := range schema.Vars {
-		switch v.Type {
-		case registry.TypeBool:
-			varParts = append(varParts, fmt.Sprintf("%s:bool", v.Name))
-		case registry.TypeEnum:
-			varParts = append(varParts, fmt.Sprintf("%s:enum(%d)", v.Name, v.Size))
-		case registry.TypeInt:
-			varParts = append(varParts, fmt.Sprintf("%s:int[%d..%d]", v.Name, v.Min, v.Max))
+	if cfg.traceState != "" {
+		if err := traceStates(cr, cfg.traceState); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			return 1
 		}
+		return 0
 	}
-	fmt.Printf("State Space\n")
-	fmt.Printf("  Variables: %s\n", strings.Join(varParts, " × "))
-	fmt.Printf("  Total:     %d states\n", schema.TotalLen)
 
 	// Build tables.
-	if err := cr.BuildTables(); err != nil {
-		fmt.Fprintf(os.Stderr, "\nTABLE BUILD ERROR: %v\n", err)
-		os.Exit(1)
+	if err := cr.BuildTablesContext(ctx); err != nil {
+		if code, ok := interrupted(err, cfg); ok {
+			return code
+		}
+		fmt.Fprintf(os.Stderr, "TABLE BUILD ERROR: %v\n", err)
+		return 1
 	}
 
-	validCount, invalidCount := cr.Stats()
-	fmt.Printf("  Valid:     %d\n", validCount)
-	fmt.Printf("  Invalid:   %d\n\n", invalidCount)
+	if cfg.dotRepair {
+		if err := cr.WriteRepairDOT(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			return 1
+		}
+		return 0
+	}
 
-	// Events and invariants.
-	fmt.Printf("Events:      %d", len(reg.Events))
-	var evtNames []string
-	for _, e := range reg.Events {
-		evtNames = append(evtNames, e.Name)
+	if cfg.registryStats {
+		if err := printRegistryStats(cr, cfg.format); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			return 1
+		}
+		return 0
 	}
-	fmt.Printf("  [%s]\n", strings.Join(evtNames, ", "))
 
-	fmt.Printf("Invariants:  %d", len(reg.Invariants))
-	var invNames []string
-	for _, inv := range reg.Invariants {
-		invNames = append(invNames, inv.Name)
+	if cfg.graphJSON != "" {
+		if err := writeGraphJSON(cr, cfg.graphJSON); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: graph: %v\n", err)
+			return 1
+		}
+	}
+
+	if cfg.validBitmap != "" {
+		if err := writeValidBitmap(cr, cfg.validBitmap); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: valid bitmap: %v\n", err)
+			return 1
+		}
 	}
-	fmt.Printf("  [%s]\n\n", strings.Join(invNames, ", "))
 
-	// WFC check.
-	fmt.Printf("WFC (Well-Founded Compensation)\n")
-	wfcPass, maxDepth, badState, err := cr.CheckWFC()
+	// Run checks.
+	res, err := cr.VerifyContext(ctx)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "  ERROR: %v\n", err)
-		os.Exit(1)
+		if code, ok := interrupted(err, cfg); ok {
+			return code
+		}
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
 	}
-	if wfcPass {
-		fmt.Printf("  Result:    PASS\n")
-		fmt.Printf("  Max depth: %d\n\n", maxDepth)
-	} else {
-		fmt.Printf("  Result:    FAIL\n")
-		fmt.Printf("  Failure:   %s\n\n", badState)
+	// The analyses below are full passes over the state space, so they
+	// share the timeout with the checks.
+	err = cr.AnalyzeContext(ctx, func() error {
+		var err error
+		if !res.WFCPass && cfg.groupWFC {
+			if res.WFCGroups, err = cr.WFCFailuresByInvariant(); err != nil {
+				return err
+			}
+		}
+		if res.WFCPass && cfg.maxDepthReport > 0 {
+			if res.Deepest, err = cr.DeepestRepairs(cfg.maxDepthReport); err != nil {
+				return err
+			}
+		}
+		if cfg.orderSensitivity {
+			if res.OrderSensitivity, err = cr.OrderSensitivity(); err != nil {
+				return err
+			}
+		}
+		if cfg.monotoneRepair {
+			if res.RepairInterference, err = cr.RepairInterference(); err != nil {
+				return err
+			}
+		}
+		if cfg.reachable {
+			if res.ReachableStates, err = cr.ReachableCount(); err != nil {
+				return fmt.Errorf("reachability: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if code, ok := interrupted(err, cfg); ok {
+			return code
+		}
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
 	}
 
-	// CC check.
-	fmt.Printf("CC (Compensation Commutativity)\n")
-	ccResult := cr.CheckCC()
+	if cfg.countTransitions {
+		res.EnabledTransitions, res.AvgOutDegree = cr.TransitionStats()
+	}
 
-	if ccResult.CC1Pass {
-		fmt.Printf("  CC1:       PASS  (%d independent pairs checked, %d dependent skipped)\n",
-			ccResult.PairsChecked, ccResult.DependentSkipped)
-	} else {
-		fmt.Printf("  CC1:       FAIL\n")
-		fmt.Printf("    Events:  (%s, %s)\n", ccResult.CC1FailEvent1, ccResult.CC1FailEvent2)
-		fmt.Printf("    State:   %s\n", ccResult.CC1FailState)
-		fmt.Printf("    Order 1: %s → %s → %s\n",
-			ccResult.CC1FailEvent1, ccResult.CC1FailEvent2, ccResult.CC1FailNF1)
-		fmt.Printf("    Order 2: %s → %s → %s\n",
-			ccResult.CC1FailEvent2, ccResult.CC1FailEvent1, ccResult.CC1FailNF2)
+	if cfg.deps {
+		res.Dependencies = cr.EventDependencies()
 	}
 
-	if ccResult.CC2Pass {
-		fmt.Printf("  CC2:       PASS\n")
-	} else {
-		fmt.Printf("  CC2:       FAIL\n")
-		fmt.Printf("    Event:   %s\n", ccResult.CC2FailEvent)
-		fmt.Printf("    State:   %s\n", ccResult.CC2FailState)
-		fmt.Printf("    NF(s):   %s\n", ccResult.CC2FailNFState)
-		fmt.Printf("    Step(e,s):     → %s\n", ccResult.CC2FailNF1)
-		fmt.Printf("    Step(e,NF(s)): → %s\n", ccResult.CC2FailNF2)
-	}
-	fmt.Println()
-
-	// Summary.
-	elapsed := time.Since(start)
-	allPass := wfcPass && ccResult.CCPass
-
-	fmt.Printf("════════════════════════════════════════════\n")
-	if allPass {
-		fmt.Printf("Unique Normal Form:  YES\n")
-		fmt.Printf("Convergence:         GUARANTEED\n")
-	} else {
-		fmt.Printf("Convergence:         NOT GUARANTEED\n")
-		if !wfcPass {
-			fmt.Printf("  ✗ WFC failed\n")
+	res.Source = path
+	res.Elapsed = time.Since(start)
+	switch cfg.format {
+	case "json", "sarif":
+		format := verify.FormatJSON
+		if cfg.format == "sarif" {
+			format = verify.FormatSARIF
 		}
-		if !ccResult.CC1Pass {
-			fmt.Printf("  ✗ CC1 failed\n")
+		out, err := format(res)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			return 1
 		}
-		if !ccResult.CC2Pass {
-			fmt.Printf("  ✗ CC2 failed\n")
+		fmt.Print(out)
+	default:
+		fmt.Print(verify.FormatReport(res))
+	}
+
+	// Under --assert-fail a failing check is the expected outcome. Errors
+	// before the checks complete exit 1 either way.
+	if res.Passed() == cfg.assertFail {
+		return 1
+	}
+	return 0
+}
+
+// loadRegistry loads the registry at path and merges into it the events of
+// the registries at overlays, if any.
+func loadRegistry(path string, overlays []string, format registry.InputFormat) (*registry.Registry, error) {
+	reg, err := readRegistry(path, format)
+	if err != nil || len(overlays) == 0 {
+		return reg, err
+	}
+	regs := make([]*registry.Registry, len(overlays))
+	for i, p := range overlays {
+		if regs[i], err = readRegistry(p, format); err != nil {
+			return nil, err
+		}
+	}
+	return registry.Merge(reg, regs...)
+}
+
+// readRegistry reads the registry at path, or standard input if path is
+// "-", in the given format.
+func readRegistry(path string, format registry.InputFormat) (*registry.Registry, error) {
+	if path == "-" {
+		reg, err := registry.Read(os.Stdin, format)
+		if err != nil {
+			return nil, fmt.Errorf("stdin: %w", err)
+		}
+		return reg, nil
+	}
+	if format == registry.InputYAML {
+		return registry.LoadFile(path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	defer f.Close()
+	reg, err := registry.Read(f, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return reg, nil
+}
+
+// splitList splits a comma-separated flag value, dropping empty items.
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// lintFile prints every structural diagnostic for the registry at path and
+// returns 1 if any is an error.
+func lintFile(path string) int {
+	reg, diags, err := registry.LoadFileLenient(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	diags = append(diags, reg.Validate()...)
+	diags = append(diags, lexDiagnostics(reg)...)
+	errs := 0
+	for _, d := range diags {
+		fmt.Println(d)
+		if d.Severity == registry.SeverityError {
+			errs++
+		}
+	}
+	fmt.Printf("%s: %d error(s), %d warning(s)\n", path, errs, len(diags)-errs)
+	if errs > 0 {
+		return 1
+	}
+	return 0
+}
+
+// lexDiagnostics reports every lexical error in every expression of reg,
+// one diagnostic per expression.
+func lexDiagnostics(reg *registry.Registry) []registry.Diagnostic {
+	var diags []registry.Diagnostic
+	lex := func(field, src string) {
+		if _, err := expr.LexAll(src); err != nil {
+			diags = append(diags, registry.Diagnostic{Severity: registry.SeverityError, Field: field,
+				Message: strings.ReplaceAll(err.Error(), "\n", "; ")})
+		}
+	}
+	for _, inv := range reg.Invariants {
+		lex("invariants."+inv.Name+".expr", inv.Expr)
+	}
+	for i, rep := range reg.Compensation {
+		for _, target := range sortedKeys(rep.Assignments) {
+			lex(fmt.Sprintf("compensation[%d].repair.%s", i, target), rep.Assignments[target])
+		}
+	}
+	for _, evt := range reg.Events {
+		lex("events."+evt.Name+".guard", evt.Guard)
+		for _, target := range sortedKeys(evt.Assignments) {
+			lex("events."+evt.Name+".effect."+target, evt.Assignments[target])
+		}
+	}
+	return diags
+}
+
+// sortedKeys returns the keys of m in sorted order.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// formatBytes renders a byte count with a binary unit, e.g. "1.5 GiB".
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// interrupted reports whether err is a run cut short by --timeout and, if so,
+// prints the phase reached and returns exitTimeout.
+func interrupted(err error, cfg config) (int, bool) {
+	var ie *verify.InterruptedError
+	if !errors.As(err, &ie) {
+		return 0, false
+	}
+	return timedOut(ie, cfg), true
+}
+
+// timedOut prints the phase the timeout interrupted and returns exitTimeout.
+func timedOut(ie *verify.InterruptedError, cfg config) int {
+	fmt.Fprintf(os.Stderr, "TIMEOUT: timed out during %s (limit %v)\n", ie.Phase, cfg.timeout)
+	return exitTimeout
+}
+
+// dumpAST prints the AST of every expression in reg, before and after
+// constants are resolved. It needs no compilation, so it also works on
+// registries that fail to type-check; it returns 1 if any expression fails
+// to parse.
+func dumpAST(reg *registry.Registry) int {
+	code := 0
+	dump := func(label, src string) {
+		fmt.Printf("%s: %s\n", label, src)
+		node, err := expr.Parse(src)
+		if err != nil {
+			fmt.Printf("  error:    %v\n", err)
+			code = 1
+			return
+		}
+		fmt.Printf("  parsed:   %s\n", node)
+		expr.ResolveConstants(node, reg.Constants)
+		fmt.Printf("  resolved: %s\n", node)
+	}
+	dumpAssignments := func(label string, assignments map[string]string) {
+		vars := make([]string, 0, len(assignments))
+		for v := range assignments {
+			vars = append(vars, v)
+		}
+		sort.Strings(vars)
+		for _, v := range vars {
+			dump(fmt.Sprintf("%s %s", label, v), assignments[v])
 		}
 	}
-	fmt.Printf("Checked in:          %v\n", elapsed.Round(time.Microsecond))
+	for _, inv := range reg.Invariants {
+		dump(fmt.Sprintf("invariant %s", inv.Name), inv.Expr)
+	}
+	for _, rep := range reg.Compensation {
+		dumpAssignments(fmt.Sprintf("repair %s", rep.Invariant), rep.Assignments)
+	}
+	for _, evt := range reg.Events {
+		if evt.Guard != "" {
+			dump(fmt.Sprintf("event %s guard", evt.Name), evt.Guard)
+		}
+		dumpAssignments(fmt.Sprintf("event %s effect", evt.Name), evt.Assignments)
+	}
+	return code
+}
 
-	if !allPass {
-		os.Exit(1)
+// printRegistryStats prints the registry's stats as text, or as JSON under
+// --format json.
+func printRegistryStats(cr *verify.CompiledRegistry, format string) error {
+	stats, err := cr.RegistryStats()
+	if err != nil {
+		return err
+	}
+	if format != "json" {
+		fmt.Print(stats)
+		return nil
+	}
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+// writeGraphJSON writes the reachable state graph of cr to path.
+func writeGraphJSON(cr *verify.CompiledRegistry, path string) error {
+	g, err := cr.Graph()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(g, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// writeValidBitmap writes the valid-state bitmap to the file at path.
+func writeValidBitmap(cr *verify.CompiledRegistry, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(f)
+	if err := cr.WriteValidBitmap(bw); err != nil {
+		f.Close()
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// maxTraceStates bounds how many states a --trace-state wildcard may match.
+const maxTraceStates = 1000
+
+// traceStates prints the compensation trace of every state matching spec.
+func traceStates(cr *verify.CompiledRegistry, spec string) error {
+	states, err := cr.Schema.ParseStates(spec, maxTraceStates)
+	if err != nil {
+		return err
+	}
+	for i, st := range states {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Println(cr.FormatState(st))
+		steps, err := cr.RepairTrace(st)
+		for _, step := range steps {
+			fmt.Printf("  → %s  [%s]\n", cr.FormatState(step.State), step.Invariant)
+		}
+		if err != nil {
+			return err
+		}
+		if len(steps) == 0 {
+			fmt.Println("  valid")
+		}
 	}
+	return nil
 }
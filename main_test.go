@@ -0,0 +1,649 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blackwell-systems/nccheck/registry"
+	"github.com/blackwell-systems/nccheck/verify"
+)
+
+// runArgs runs the command line nccheck args with fresh flags and returns
+// the exit code and what was written to stdout and stderr.
+func runArgs(t *testing.T, args ...string) (code int, stdout, stderr string) {
+	t.Helper()
+	outF, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	errF, err := os.CreateTemp(t.TempDir(), "stderr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	savedArgs, savedOut, savedErr := os.Args, os.Stdout, os.Stderr
+	savedFlags := flag.CommandLine
+	defer func() {
+		os.Args, os.Stdout, os.Stderr = savedArgs, savedOut, savedErr
+		flag.CommandLine = savedFlags
+	}()
+	os.Args = append([]string{"nccheck"}, args...)
+	os.Stdout, os.Stderr = outF, errF
+	flag.CommandLine = flag.NewFlagSet("nccheck", flag.ContinueOnError)
+
+	code = run()
+	return code, readAll(t, outF), readAll(t, errF)
+}
+
+// readAll rewinds f and returns its contents.
+func readAll(t *testing.T, f *os.File) string {
+	t.Helper()
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestCPUProfile(t *testing.T) {
+	path := t.TempDir() + "/cpu.prof"
+	code, _, stderr := runArgs(t, "--cpuprofile", path, "examples/wallet.yaml")
+	if code != 0 {
+		t.Fatalf("exit %d: %s", code, stderr)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// pprof profiles are gzip-compressed protobufs.
+	if len(data) < 2 || data[0] != 0x1f || data[1] != 0x8b {
+		t.Errorf("%s is not a gzip-compressed profile (%d bytes)", path, len(data))
+	}
+
+	code, _, stderr = runArgs(t, "--cpuprofile", t.TempDir()+"/missing/cpu.prof", "examples/wallet.yaml")
+	if code != 1 || stderr == "" {
+		t.Errorf("unwritable profile path: exit %d, stderr %q; want exit 1 with an error", code, stderr)
+	}
+}
+
+// compileExample compiles one of the registries under examples/.
+func compileExample(t *testing.T, name string) *verify.CompiledRegistry {
+	t.Helper()
+	reg, err := registry.LoadFile("examples/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cr, err := verify.Compile(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cr
+}
+
+func TestREPL(t *testing.T) {
+	r := &repl{cr: compileExample(t, "order_fulfillment.yaml")}
+	steps := []struct {
+		line, want string
+		quit       bool
+	}{
+		{":show", "no state set", false},
+		{"status == pending", `error: expected name=value, got "status"`, false},
+		{"status=shipped, paid=false, in_stock=true, inventory=3",
+			"{status=shipped, paid=false, in_stock=true, inventory=3}", false},
+		{"status", "shipped", false},
+		{"shipped", "shipped", false},
+		{"inventory + 1", "4", false},
+		{"status == shipped and not paid", "true", false},
+		{"inventory + paid", "error: arithmetic requires int operand, got bool", false},
+		{":state status=pending, paid=true, in_stock=false, inventory=0",
+			"{status=pending, paid=true, in_stock=false, inventory=0}", false},
+		{":state status=lost, paid=true, in_stock=false, inventory=0",
+			`error: status: "lost" is not one of [pending confirmed shipped delivered cancelled]`, false},
+		{":show", "{status=pending, paid=true, in_stock=false, inventory=0}", false},
+		{"", "", false},
+		{":frobnicate", `unknown command ":frobnicate" (try :help)`, false},
+		{":help", replHelp, false},
+		{":quit", "", true},
+	}
+	for _, s := range steps {
+		got, quit := r.handle(s.line)
+		if got != s.want || quit != s.quit {
+			t.Errorf("%q: got %q (quit %v), want %q (quit %v)", s.line, got, quit, s.want, s.quit)
+		}
+	}
+}
+
+func TestRunREPLStopsAtQuit(t *testing.T) {
+	in := strings.NewReader("status=pending, paid=true, in_stock=false, inventory=0\npaid\n:q\npaid\n")
+	var out strings.Builder
+	if err := runREPL(compileExample(t, "order_fulfillment.yaml"), in, &out); err != nil {
+		t.Fatal(err)
+	}
+	want := "nccheck REPL — order_fulfillment (:help for commands)\n" +
+		"Enter a state as name=value pairs.\n" +
+		"state> {status=pending, paid=true, in_stock=false, inventory=0}\n" +
+		"expr> true\n" +
+		"expr> "
+	if out.String() != want {
+		t.Errorf("transcript:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestLogLevelFlag(t *testing.T) {
+	tests := []struct {
+		level    string
+		wantCode int
+		stderr   string // substring of stderr
+	}{
+		{"debug", 0, "phase start"},
+		{"warn", 0, ""},
+		{"loud", 1, `ERROR: unknown log level "loud"`},
+	}
+	for _, tt := range tests {
+		code, _, stderr := runArgs(t, "--log-level", tt.level, "examples/wallet.yaml")
+		if code != tt.wantCode || !strings.Contains(stderr, tt.stderr) || tt.stderr == "" && stderr != "" {
+			t.Errorf("--log-level %s: exit %d, stderr %q; want exit %d, stderr containing %q",
+				tt.level, code, stderr, tt.wantCode, tt.stderr)
+		}
+	}
+}
+
+func TestTraceState(t *testing.T) {
+	tests := []struct {
+		spec     string
+		wantCode int
+		want     string // stdout
+		wantErr  string // substring of stderr
+	}{
+		{"status=shipped, paid=*, in_stock=true, inventory=3", 0,
+			"{status=shipped, paid=false, in_stock=true, inventory=3}\n" +
+				"  → {status=confirmed, paid=false, in_stock=true, inventory=3}  [no_ship_without_pay]\n" +
+				"\n" +
+				"{status=shipped, paid=true, in_stock=true, inventory=3}\n" +
+				"  valid\n", ""},
+		{"status=shipped, paid=true, in_stock=true, inventory=3", 0,
+			"{status=shipped, paid=true, in_stock=true, inventory=3}\n  valid\n", ""},
+		{"status=lost, paid=*, in_stock=true, inventory=3", 1, "", `status: "lost" is not one of`},
+		{"status=shipped, paid=*", 1, "", "missing value for in_stock, inventory"},
+	}
+	for _, tt := range tests {
+		code, stdout, stderr := runArgs(t, "--trace-state", tt.spec, "examples/order_fulfillment.yaml")
+		if code != tt.wantCode || stdout != tt.want || !strings.Contains(stderr, tt.wantErr) {
+			t.Errorf("--trace-state %q: exit %d, stdout %q, stderr %q; want exit %d, stdout %q, stderr containing %q",
+				tt.spec, code, stdout, stderr, tt.wantCode, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestAssertFlags(t *testing.T) {
+	// wallet.yaml passes every check; counters.yaml fails CC; in
+	// pingpong.yaml the two repairs undo each other, so compensation
+	// never terminates.
+	pingpong := filepath.Join(t.TempDir(), "pingpong.yaml")
+	src := `
+registry:
+  name: pingpong
+  states:
+    a: {type: bool}
+    b: {type: bool}
+  initial: {a: false, b: false}
+  invariants:
+    no_a: {expr: "not a"}
+    no_b: {expr: "not b"}
+  compensation:
+    - invariant: no_a
+      repair: {a: false, b: true}
+    - invariant: no_b
+      repair: {a: true, b: false}
+  events:
+    set_a: {effect: {a: true}}
+`
+	if err := os.WriteFile(pingpong, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		args     []string
+		wantCode int
+	}{
+		{[]string{"examples/wallet.yaml"}, 0},
+		{[]string{"examples/counters.yaml"}, 1},
+		{[]string{"--assert-pass", "examples/wallet.yaml"}, 0},
+		{[]string{"--assert-pass", "examples/counters.yaml"}, 1},
+		{[]string{"--assert-fail", "examples/wallet.yaml"}, 1},
+		{[]string{"--assert-fail", "examples/counters.yaml"}, 0},
+		{[]string{pingpong}, 1},
+		{[]string{"--assert-fail", pingpong}, 0},
+		{[]string{"--assert-fail", "--fail-fast", pingpong}, 0},
+		{[]string{"--assert-fail", "examples/missing.yaml"}, 1}, // errors are never the expected failure
+		{[]string{"--assert-pass", "--assert-fail", "examples/wallet.yaml"}, 1},
+	}
+	for _, tt := range tests {
+		code, _, stderr := runArgs(t, tt.args...)
+		if code != tt.wantCode {
+			t.Errorf("%v: exit %d, want %d (stderr %q)", tt.args, code, tt.wantCode, stderr)
+		}
+	}
+}
+
+func TestMaxStatesConfirmation(t *testing.T) {
+	// One state over the default cap.
+	path := filepath.Join(t.TempDir(), "big.yaml")
+	src := fmt.Sprintf(`
+registry:
+  name: big
+  states:
+    x: {type: int, range: [0, %d]}
+  initial: {x: 0}
+  invariants:
+    any: {expr: "x >= 0"}
+  events:
+    inc:
+      guard: "x < %[1]d"
+      effect: {x: "x + 1"}
+`, verify.MaxStates)
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		args     []string
+		wantCode int
+		wantErr  string // substring of stderr
+	}{
+		{nil, 1, "state space too large: 1000001 (max 1000000)"},
+		{[]string{"--max-states", "2000000"}, 1, "ERROR: 1000001 states exceed the default cap of 1000000; tables would need about 32.4 MiB.\nPass --i-understand-this-is-big to proceed.\n"},
+		{[]string{"--max-states", "2000000", "--i-understand-this-is-big"}, 0, "NOTE: checking 1000001 states; tables need about 32.4 MiB\n"},
+		{[]string{"--max-states", "2000000", "--sparse-step"}, 1, "tables would need between 25.0 MiB and 32.6 MiB, depending on how many transitions are enabled.\n"},
+		{[]string{"--max-states", "1000", "--i-understand-this-is-big"}, 1, "state space too large: 1000001 (max 1000)"},
+	}
+	for _, tt := range tests {
+		code, _, stderr := runArgs(t, append(tt.args, path)...)
+		if code != tt.wantCode || !strings.Contains(stderr, tt.wantErr) {
+			t.Errorf("%v: exit %d, stderr %q; want exit %d, stderr containing %q", tt.args, code, stderr, tt.wantCode, tt.wantErr)
+		}
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{1 << 20, "1.0 MiB"},
+		{34000000, "32.4 MiB"},
+		{3 << 30, "3.0 GiB"},
+	}
+	for _, tt := range tests {
+		if got := formatBytes(tt.n); got != tt.want {
+			t.Errorf("formatBytes(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestLint(t *testing.T) {
+	bad := filepath.Join(t.TempDir(), "bad.yaml")
+	src := "registry:\n  name: bad\n  states:\n    n: {type: int, range: [3, 1]}\n    spare: {type: bool}\n" +
+		"  invariants:\n    pos: {expr: \"n >= 0\"}\n  events: {}\n"
+	if err := os.WriteFile(bad, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	typos := filepath.Join(t.TempDir(), "typos.yaml")
+	src = "registry:\n  name: typos\n  states:\n    n: {type: int, range: [0, 3]}\n" +
+		"  invariants:\n    pos: {expr: \"n >= 0\"}\n  compensation:\n    - {invariant: pos, repair: {n: \"0\"}}\n" +
+		"  events:\n    bump: {guard: \"n @ 3 # 1\", effect: {n: \"n $ 1\"}}\n"
+	if err := os.WriteFile(typos, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path     string
+		wantCode int
+		want     string
+	}{
+		{"examples/wallet.yaml", 0, "examples/wallet.yaml: 0 error(s), 0 warning(s)\n"},
+		{typos, 1, "error: events.bump.guard: unexpected character '@' at position 2; unexpected character '#' at position 6\n" +
+			"error: events.bump.effect.n: unexpected character '$' at position 2\n" +
+			typos + ": 2 error(s), 0 warning(s)\n"},
+		{bad, 1, `error: states.n: int "n" has empty range [3, 1]` + "\n" +
+			"warning: invariants.pos: no repair in compensation; checking fails if it is ever violated\n" +
+			"warning: states.spare: never read or written; it only multiplies the state space\n" +
+			bad + ": 1 error(s), 2 warning(s)\n"},
+	}
+	for _, tt := range tests {
+		code, stdout, stderr := runArgs(t, "--lint", tt.path)
+		if code != tt.wantCode || stdout != tt.want {
+			t.Errorf("--lint %s: exit %d, stdout %q (stderr %q); want exit %d, stdout %q", tt.path, code, stdout, stderr, tt.wantCode, tt.want)
+		}
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, inv, effect string) string {
+		path := filepath.Join(dir, name)
+		src := "registry:\n  name: " + name + "\n  states:\n    n: {type: int, range: [0, 999999]}\n" +
+			"  invariants:\n    ok: {expr: \"" + inv + "\"}\n  events:\n    bump: {effect: {n: \"" + effect + "\"}}\n"
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	// A million states: building tables would take a while, so a quick
+	// pass shows dry-run skips it.
+	big := write("big", "n >= 0", "n")
+	tests := []struct {
+		path       string
+		wantCode   int
+		wantStdout string
+		wantStderr string
+	}{
+		{"examples/wallet.yaml", 0, "examples/wallet.yaml: OK (22 states, 7 transitions; tables not built)\n", ""},
+		{big, 0, big + ": OK (1000000 states, 1 transitions; tables not built)\n", ""},
+		{write("syntax", "n >= ", "n"), 1, "", `invariant "ok": unexpected token "" at position 5`},
+		{write("types", "n and true", "n"), 1, "", `invariant "ok": 'and' requires bool operand, got int`},
+		{write("undefined", "n >= 0", "m + 1"), 1, "", `event "bump", var "n": undefined identifier "m"`},
+	}
+	for _, tt := range tests {
+		start := time.Now()
+		code, stdout, stderr := runArgs(t, "--dry-run", tt.path)
+		if code != tt.wantCode || stdout != tt.wantStdout || !strings.Contains(stderr, tt.wantStderr) {
+			t.Errorf("--dry-run %s: exit %d, stdout %q, stderr %q; want exit %d, stdout %q, stderr containing %q",
+				tt.path, code, stdout, stderr, tt.wantCode, tt.wantStdout, tt.wantStderr)
+		}
+		if d := time.Since(start); d > 5*time.Second {
+			t.Errorf("--dry-run %s took %v", tt.path, d)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, src string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	// examples/permissions.yaml split in two: revoke_write alone converges,
+	// but grant_read and grant_write fail CC1.
+	base := write("base.yaml", `
+registry:
+  name: permissions
+  states:
+    can_read: {type: bool}
+    can_write: {type: bool}
+  invariants:
+    write_needs_read: {expr: "not (can_write and not can_read)"}
+  compensation:
+    - invariant: write_needs_read
+      repair: {can_write: "false"}
+  events:
+    revoke_write: {effect: {can_write: "false"}}
+`)
+	grants := write("grants.yaml", `
+registry:
+  name: grants
+  states:
+    can_read: {type: bool}
+    can_write: {type: bool}
+  events:
+    grant_read: {effect: {can_read: "true"}}
+    grant_write: {effect: {can_write: "true"}}
+`)
+	again := write("again.yaml", `
+registry:
+  name: again
+  states:
+    can_read: {type: bool}
+  events:
+    revoke_write: {effect: {can_read: "false"}}
+`)
+	tests := []struct {
+		args       []string
+		wantCode   int
+		wantStdout string
+		wantStderr string
+	}{
+		{[]string{base}, 0, "Events:      1  [revoke_write]", ""},
+		{[]string{"--merge", base, grants}, 1, "Events:      3  [revoke_write, grant_read, grant_write]", ""},
+		{[]string{"--merge", base, again}, 1, "", `event "revoke_write" is declared in both "permissions" and "again"`},
+		{[]string{"--merge", base}, 1, "", "--merge needs a base registry and at least one overlay"},
+	}
+	for _, tt := range tests {
+		code, stdout, stderr := runArgs(t, tt.args...)
+		if code != tt.wantCode || !strings.Contains(stdout, tt.wantStdout) || !strings.Contains(stderr, tt.wantStderr) {
+			t.Errorf("%v: exit %d, stdout %q, stderr %q; want exit %d, stdout containing %q, stderr containing %q",
+				tt.args, code, stdout, stderr, tt.wantCode, tt.wantStdout, tt.wantStderr)
+		}
+	}
+}
+
+func TestValidBitmapFlag(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		path     string
+		wantCode int
+		wantErr  string
+	}{
+		{filepath.Join(dir, "wallet.ncvb"), 0, ""},
+		{filepath.Join(dir, "missing", "wallet.ncvb"), 1, "ERROR: valid bitmap: "},
+	}
+	cr := compileExample(t, "wallet.yaml")
+	if err := cr.BuildTables(); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		code, _, stderr := runArgs(t, "--valid-bitmap", tt.path, "examples/wallet.yaml")
+		if code != tt.wantCode || !strings.Contains(stderr, tt.wantErr) {
+			t.Errorf("--valid-bitmap %s: exit %d, stderr %q; want exit %d, stderr containing %q", tt.path, code, stderr, tt.wantCode, tt.wantErr)
+		}
+		if tt.wantCode != 0 {
+			continue
+		}
+		f, err := os.Open(tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := verify.ReadValidBitmap(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for sid, valid := range cr.Valid {
+			if b.Valid(registry.StateID(sid)) != valid {
+				t.Errorf("state %d: valid %v in the bitmap, %v in the table", sid, !valid, valid)
+			}
+		}
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	// A million states take a few hundred milliseconds to check.
+	slow := filepath.Join(t.TempDir(), "slow.yaml")
+	src := `
+registry:
+  name: slow
+  states:
+    n: {type: int, range: [0, 999999]}
+  invariants:
+    ok: {expr: "n >= 0"}
+  events:
+    bump: {guard: "n < 999999", effect: {n: "n + 1"}}
+`
+	if err := os.WriteFile(slow, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		args       []string
+		wantCode   int
+		wantStderr string
+	}{
+		{[]string{"--timeout", "1ns", "examples/wallet.yaml"}, exitTimeout, "TIMEOUT: timed out during compile (limit 1ns)\n"},
+		{[]string{"--timeout", "20ms", slow}, exitTimeout, "TIMEOUT: timed out during "},
+		{[]string{"--timeout", "1m", "examples/wallet.yaml"}, 0, ""},
+	}
+	for _, tt := range tests {
+		start := time.Now()
+		code, _, stderr := runArgs(t, tt.args...)
+		if code != tt.wantCode || !strings.HasPrefix(stderr, tt.wantStderr) {
+			t.Errorf("%v: exit %d, stderr %q; want exit %d, stderr starting %q", tt.args, code, stderr, tt.wantCode, tt.wantStderr)
+		}
+		if d := time.Since(start); tt.wantCode == exitTimeout && d > 5*time.Second {
+			t.Errorf("%v: cut off after %v", tt.args, d)
+		}
+	}
+}
+
+func TestRegistryStatsFlag(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--registry-stats", "examples/wallet.yaml"}, `Registry:            wallet
+Variables:           2  (1 bool, 0 enum, 1 int)
+States:              22  (12 valid)
+Invariants:          1
+Events:              3
+Transitions:         7  (130 enabled)
+Pairs:               6 independent, 15 dependent
+Reachable states:    12
+Max repair depth:    1
+`},
+		{[]string{"--registry-stats", "--format", "json", "examples/wallet.yaml"}, `{
+  "name": "wallet",
+  "variables": 2,
+  "bool_vars": 1,
+  "enum_vars": 0,
+  "int_vars": 1,
+  "states": 22,
+  "valid_states": 12,
+  "invariants": 1,
+  "events": 3,
+  "transitions": 7,
+  "enabled_transitions": 130,
+  "independent_pairs": 6,
+  "dependent_pairs": 15,
+  "reachable_states": 12,
+  "max_repair_depth": 1
+}
+`},
+	}
+	for _, tt := range tests {
+		code, stdout, stderr := runArgs(t, tt.args...)
+		if code != 0 || stdout != tt.want {
+			t.Errorf("%v: exit %d, stdout %q (stderr %q); want exit 0, stdout %q", tt.args, code, stdout, stderr, tt.want)
+		}
+	}
+}
+
+func TestInputFormatStdin(t *testing.T) {
+	const walletJSON = `{"registry": {"name": "wallet_json",
+  "states": {"balance": {"type": "int", "range": [0, 3]}},
+  "initial": {"balance": 0},
+  "invariants": {"non_negative": {"expr": "balance >= 0"}},
+  "events": {"deposit": {"guard": "balance < 3", "effect": {"balance": "balance + 1"}}}}}`
+	tests := []struct {
+		args       []string
+		stdin      string
+		wantCode   int
+		wantStdout string
+		wantStderr string
+	}{
+		{[]string{"--input-format", "json", "-"}, walletJSON, 0, "Registry:    wallet_json", ""},
+		{[]string{"-"}, walletJSON, 0, "Convergence:         GUARANTEED", ""},
+		{[]string{"--input-format", "json", "-"}, walletJSON[:30], 1, "", "ERROR: stdin: json parse: unexpected end of JSON input"},
+		{[]string{"--input-format", "json", "examples/wallet.yaml"}, "", 1, "", "ERROR: examples/wallet.yaml: json parse: "},
+		{[]string{"--input-format", "toml", "-"}, walletJSON, 1, "", `ERROR: unknown input format "toml" (want yaml or json)`},
+		{[]string{"--lint", "-"}, walletJSON, 1, "", "ERROR: --watch, --lint and --repl need a registry file, not stdin"},
+	}
+	for _, tt := range tests {
+		in, err := os.CreateTemp(t.TempDir(), "stdin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := in.WriteString(tt.stdin); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := in.Seek(0, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		savedIn := os.Stdin
+		os.Stdin = in
+		code, stdout, stderr := runArgs(t, tt.args...)
+		os.Stdin = savedIn
+		in.Close()
+		if code != tt.wantCode || !strings.Contains(stdout, tt.wantStdout) || !strings.Contains(stderr, tt.wantStderr) {
+			t.Errorf("%v: exit %d, stdout %q, stderr %q; want exit %d, stdout containing %q, stderr containing %q",
+				tt.args, code, stdout, stderr, tt.wantCode, tt.wantStdout, tt.wantStderr)
+		}
+	}
+}
+
+func TestDumpAST(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, effect string) string {
+		path := filepath.Join(dir, name)
+		src := `
+registry:
+  name: dump
+  constants:
+    LIMIT: 3
+  states:
+    n: {type: int, range: [0, 5]}
+  initial: {n: 0}
+  invariants:
+    small: {expr: "n <= LIMIT"}
+  compensation:
+    - invariant: small
+      repair: {n: "LIMIT"}
+  events:
+    inc:
+      guard: "n < 5"
+      effect: {n: "` + effect + `"}
+`
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	const head = `invariant small: n <= LIMIT
+  parsed:   (<= n LIMIT)
+  resolved: (<= n 3)
+repair small n: LIMIT
+  parsed:   LIMIT
+  resolved: 3
+event inc guard: n < 5
+  parsed:   (< n 5)
+  resolved: (< n 5)
+`
+	tests := []struct {
+		path       string
+		wantCode   int
+		wantStdout string
+	}{
+		{write("ok.yaml", "n + 1"), 0, head + `event inc effect n: n + 1
+  parsed:   (+ n 1)
+  resolved: (+ n 1)
+`},
+		{write("bad.yaml", "n +"), 1, head + `event inc effect n: n +
+  error:    unexpected token "" at position 3
+`},
+	}
+	for _, tt := range tests {
+		code, stdout, _ := runArgs(t, "--dump-ast", tt.path)
+		if code != tt.wantCode || stdout != tt.wantStdout {
+			t.Errorf("--dump-ast %s: exit %d, stdout\n%s\nwant exit %d, stdout\n%s", tt.path, code, stdout, tt.wantCode, tt.wantStdout)
+		}
+	}
+}
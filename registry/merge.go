@@ -0,0 +1,112 @@
+package registry
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Merge combines registries that share one state model but declare
+// different events. The result has base's name, state variables,
+// invariants, compensation and initial state, and the events of base
+// followed by those of each overlay in order.
+//
+// An overlay must be compatible with base: every variable, invariant and
+// constant it declares must also be declared in base, identically, and any
+// initial value it gives must agree. It may omit any of them, so an
+// overlay can declare just the variables its events need. Overlays may not
+// add compensation, since repairs belong with the invariants in base. An
+// event name declared twice across all inputs is an error. The result
+// shares nothing with base or the overlays.
+func Merge(base *Registry, overlays ...*Registry) (*Registry, error) {
+	out := base.Clone()
+	seen := make(map[string]string, len(base.Events)) // event -> registry declaring it
+	for _, e := range base.Events {
+		seen[e.Name] = base.Name
+	}
+
+	for _, ov := range overlays {
+		if err := checkOverlay(base, ov); err != nil {
+			return nil, fmt.Errorf("merge %q into %q: %w", ov.Name, base.Name, err)
+		}
+		for _, e := range ov.Clone().Events {
+			if from, ok := seen[e.Name]; ok {
+				return nil, fmt.Errorf("merge %q into %q: event %q is declared in both %q and %q",
+					ov.Name, base.Name, e.Name, from, ov.Name)
+			}
+			seen[e.Name] = ov.Name
+			out.Events = append(out.Events, e)
+		}
+	}
+	return out, nil
+}
+
+// checkOverlay reports the first declaration in ov that is missing from or
+// differs from base.
+func checkOverlay(base, ov *Registry) error {
+	vars := make(map[string]VarDef, len(base.Vars))
+	for _, v := range base.Vars {
+		vars[v.Name] = v
+	}
+	for _, v := range ov.Vars {
+		bv, ok := vars[v.Name]
+		if !ok {
+			return fmt.Errorf("variable %q is not declared in the base registry", v.Name)
+		}
+		if !reflect.DeepEqual(v, bv) {
+			return fmt.Errorf("variable %q is declared differently (%s vs %s in the base registry)",
+				v.Name, v.describe(), bv.describe())
+		}
+	}
+
+	invs := make(map[string]Invariant, len(base.Invariants))
+	for _, inv := range base.Invariants {
+		invs[inv.Name] = inv
+	}
+	for _, inv := range ov.Invariants {
+		binv, ok := invs[inv.Name]
+		if !ok {
+			return fmt.Errorf("invariant %q is not declared in the base registry", inv.Name)
+		}
+		if inv != binv {
+			return fmt.Errorf("invariant %q is declared differently (%q vs %q in the base registry)",
+				inv.Name, inv.Expr, binv.Expr)
+		}
+	}
+	if len(ov.Compensation) > 0 {
+		return fmt.Errorf("compensation may only be declared in the base registry")
+	}
+
+	for _, name := range sortedKeys(ov.Constants) {
+		bc, ok := base.Constants[name]
+		if !ok {
+			return fmt.Errorf("constant %q is not declared in the base registry", name)
+		}
+		if c := ov.Constants[name]; c != bc {
+			return fmt.Errorf("constant %q is %d, but %d in the base registry", name, c, bc)
+		}
+	}
+	for _, name := range sortedKeys(ov.Initial) {
+		bi, ok := base.Initial[name]
+		if ok && fmt.Sprint(bi) != fmt.Sprint(ov.Initial[name]) {
+			return fmt.Errorf("initial value of %q is %v, but %v in the base registry", name, ov.Initial[name], bi)
+		}
+	}
+	return nil
+}
+
+// describe renders a variable's type for error messages, e.g. "int[0..5]".
+func (v VarDef) describe() string {
+	switch v.Type {
+	case TypeBool:
+		return "bool"
+	case TypeEnum:
+		if v.Ordered {
+			return fmt.Sprintf("ordered enum%v", v.Values)
+		}
+		return fmt.Sprintf("enum%v", v.Values)
+	}
+	if v.AutoMax {
+		return fmt.Sprintf("int[%d..auto]", v.Min)
+	}
+	return fmt.Sprintf("int[%d..%d]", v.Min, v.Max)
+}
@@ -0,0 +1,146 @@
+package registry
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+const mergeBaseYAML = `
+registry:
+  name: base
+  constants: {cap: 3}
+  states:
+    n: {type: int, range: [0, cap]}
+    open: {type: bool}
+  initial: {n: 0, open: false}
+  invariants:
+    bounded: {expr: "n <= cap"}
+  compensation:
+    - invariant: bounded
+      repair: {n: "cap"}
+  events:
+    inc: {guard: "n < cap", effect: {n: "n + 1"}}
+`
+
+func TestMerge(t *testing.T) {
+	base, err := Parse([]byte(mergeBaseYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	overlay := func(name, body string) *Registry {
+		t.Helper()
+		reg, err := Parse([]byte("registry:\n  name: " + name + "\n" + body))
+		if err != nil {
+			t.Fatalf("overlay %s: %v", name, err)
+		}
+		return reg
+	}
+	doors := overlay("doors", `
+  states:
+    open: {type: bool}
+  events:
+    open_door: {effect: {open: "true"}}
+    close_door: {effect: {open: "false"}}
+`)
+	resets := overlay("resets", `
+  constants: {cap: 3}
+  states:
+    n: {type: int, range: [0, cap]}
+  initial: {n: 0}
+  invariants:
+    bounded: {expr: "n <= cap"}
+  events:
+    reset: {effect: {n: "0"}}
+`)
+
+	tests := []struct {
+		name       string
+		overlays   []*Registry
+		wantEvents []string
+		wantErr    string
+	}{
+		{"none", nil, []string{"inc"}, ""},
+		{"one", []*Registry{doors}, []string{"inc", "open_door", "close_door"}, ""},
+		{"two", []*Registry{doors, resets}, []string{"inc", "open_door", "close_door", "reset"}, ""},
+		{"collision with base", []*Registry{overlay("again", `
+  events:
+    inc: {effect: {}}
+`)}, nil, `merge "again" into "base": event "inc" is declared in both "base" and "again"`},
+		{"collision between overlays", []*Registry{doors, overlay("more_doors", `
+  events:
+    open_door: {effect: {}}
+`)}, nil, `event "open_door" is declared in both "doors" and "more_doors"`},
+		{"unknown variable", []*Registry{overlay("extra", `
+  states:
+    m: {type: bool}
+  events:
+    flip: {effect: {m: "not m"}}
+`)}, nil, `variable "m" is not declared in the base registry`},
+		{"different variable", []*Registry{overlay("wide", `
+  states:
+    n: {type: int, range: [0, 9]}
+  events:
+    jump: {effect: {n: "9"}}
+`)}, nil, `variable "n" is declared differently (int[0..9] vs int[0..3] in the base registry)`},
+		{"different invariant", []*Registry{overlay("strict", `
+  states:
+    n: {type: int, range: [0, 3]}
+  invariants:
+    bounded: {expr: "n < 3"}
+  events: {}
+`)}, nil, `invariant "bounded" is declared differently ("n < 3" vs "n <= cap" in the base registry)`},
+		{"compensation", []*Registry{overlay("fixer", `
+  states:
+    n: {type: int, range: [0, 3]}
+  invariants:
+    bounded: {expr: "n <= cap"}
+  constants: {cap: 3}
+  compensation:
+    - invariant: bounded
+      repair: {n: "0"}
+  events: {}
+`)}, nil, "compensation may only be declared in the base registry"},
+		{"different constant", []*Registry{overlay("bigger", `
+  constants: {cap: 4}
+  events: {}
+`)}, nil, `constant "cap" is 4, but 3 in the base registry`},
+		{"different initial value", []*Registry{overlay("late", `
+  states:
+    n: {type: int, range: [0, 3]}
+  initial: {n: 2}
+  events: {}
+`)}, nil, `initial value of "n" is 2, but 0 in the base registry`},
+	}
+	for _, tt := range tests {
+		got, err := Merge(base, tt.overlays...)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: error %v, want %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		var names []string
+		for _, e := range got.Events {
+			names = append(names, e.Name)
+		}
+		if !slices.Equal(names, tt.wantEvents) {
+			t.Errorf("%s: events %v, want %v", tt.name, names, tt.wantEvents)
+		}
+	}
+
+	// The merged registry shares nothing with its inputs.
+	merged, err := Merge(base, doors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged.Events[0].Assignments["n"] = "0"
+	merged.Events[1].Assignments["open"] = "false"
+	if base.Events[0].Assignments["n"] != "n + 1" || doors.Events[0].Assignments["open"] != "true" {
+		t.Error("changing the merged registry changed its inputs")
+	}
+}
@@ -1,8 +1,14 @@
 package registry
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"strconv"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
@@ -14,58 +20,303 @@ type rawFile struct {
 }
 
 type rawRegistry struct {
-	Name         string                       `yaml:"name"`
-	States       map[string]rawVar            `yaml:"states"`
-	Initial      map[string]interface{}        `yaml:"initial"`
-	Invariants   map[string]rawInvariant      `yaml:"invariants"`
-	Compensation []rawRepair                  `yaml:"compensation"`
-	Events       map[string]rawEvent          `yaml:"events"`
+	Name         string                  `yaml:"name"`
+	Constants    map[string]interface{}  `yaml:"constants"`
+	States       map[string]rawVar       `yaml:"states"`
+	Initial      map[string]interface{}  `yaml:"initial"`
+	Invariants   map[string]rawInvariant `yaml:"invariants"`
+	Compensation []rawRepair             `yaml:"compensation"`
+	Events       map[string]rawEvent     `yaml:"events"`
 }
 
 type rawVar struct {
-	Type   string   `yaml:"type"`
-	Values []string `yaml:"values"`
-	Range  []int    `yaml:"range"`
+	Type    string    `yaml:"type"`
+	Values  rawValues `yaml:"values"`
+	Range   rawRange  `yaml:"range"`
+	Ordered bool      `yaml:"ordered"`
+}
+
+// rawRange is an int range [min, max]. Either bound may name a constant,
+// resolved by parseVarDef, and the max may be the sentinel "auto", asking
+// the compiler to infer it from the spec.
+type rawRange struct {
+	Bounds  []int
+	Names   [2]string // constant names standing for Bounds[0] and Bounds[1]
+	AutoMax bool
+}
+
+func (r *rawRange) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.SequenceNode || len(node.Content) != 2 {
+		return node.Decode(&r.Bounds) // reported as a malformed range by parseVarDef
+	}
+	r.Bounds = make([]int, 2)
+	lo, hi := node.Content[0], node.Content[1]
+	if err := lo.Decode(&r.Bounds[0]); err != nil {
+		if !isIdentNode(lo) {
+			return fmt.Errorf("range min must be an integer or constant")
+		}
+		r.Names[0] = lo.Value
+	}
+	if hi.Kind == yaml.ScalarNode && hi.Value == "auto" {
+		r.AutoMax = true
+		return nil
+	}
+	if err := hi.Decode(&r.Bounds[1]); err != nil {
+		if !isIdentNode(hi) {
+			return fmt.Errorf("range max must be an integer, constant or auto")
+		}
+		r.Names[1] = hi.Value
+	}
+	return nil
+}
+
+// yamlPair is one key/value entry of a YAML mapping.
+type yamlPair struct {
+	Key   string
+	Value *yaml.Node
+}
+
+// mappingPairs returns the entries of a mapping node in document order,
+// following an alias to a mapping and expanding merge keys ("<<: *base" or
+// "<<: [*a, *b]") in place of the "<<" entry. As in YAML, a key given
+// explicitly overrides a merged one, and an earlier merge source overrides
+// a later one; the entry keeps the position where its key first appears.
+// A node that is not a mapping has no entries.
+func mappingPairs(node *yaml.Node) []yamlPair {
+	for node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	var pairs []yamlPair
+	index := make(map[string]int)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, val := node.Content[i], node.Content[i+1]
+		if !isMergeKey(key) {
+			if j, ok := index[key.Value]; ok {
+				pairs[j].Value = val // explicit beats merged
+				continue
+			}
+			index[key.Value] = len(pairs)
+			pairs = append(pairs, yamlPair{key.Value, val})
+			continue
+		}
+		for val.Kind == yaml.AliasNode {
+			val = val.Alias
+		}
+		sources := []*yaml.Node{val}
+		if val.Kind == yaml.SequenceNode {
+			sources = val.Content
+		}
+		for _, src := range sources {
+			for _, p := range mappingPairs(src) {
+				if _, ok := index[p.Key]; !ok {
+					index[p.Key] = len(pairs)
+					pairs = append(pairs, p)
+				}
+			}
+		}
+	}
+	return pairs
+}
+
+// isMergeKey reports whether a mapping key is the YAML merge key "<<".
+func isMergeKey(key *yaml.Node) bool {
+	return key.Kind == yaml.ScalarNode && (key.Tag == "!!merge" || (key.Value == "<<" && key.Style == 0))
+}
+
+// isIdentNode reports whether node is a plain scalar that could name a
+// constant.
+func isIdentNode(node *yaml.Node) bool {
+	return node.Kind == yaml.ScalarNode && node.Value != "" && identPattern.FindString(node.Value) == node.Value
+}
+
+// rawValues holds enum values given either as a list, where position is the
+// ordinal, or as a mapping of literal to explicit ordinal.
+type rawValues struct {
+	List     []string
+	Ordinals map[string]int // nil for the list form
+	Keys     []string       // mapping keys in declared order
+}
+
+func (v *rawValues) UnmarshalYAML(node *yaml.Node) error {
+	mapping := node
+	for mapping.Kind == yaml.AliasNode {
+		mapping = mapping.Alias
+	}
+	if mapping.Kind != yaml.MappingNode {
+		return node.Decode(&v.List)
+	}
+	v.Ordinals = make(map[string]int)
+	for _, pair := range mappingPairs(node) {
+		key := pair.Key
+		var ord int
+		if err := pair.Value.Decode(&ord); err != nil {
+			return fmt.Errorf("enum value %q: ordinal must be an integer", key)
+		}
+		v.Ordinals[key] = ord
+		v.Keys = append(v.Keys, key)
+	}
+	return nil
 }
 
 type rawInvariant struct {
-	Expr string `yaml:"expr"`
+	Expr     string `yaml:"expr"`
+	Priority int    `yaml:"priority"`
 }
 
 type rawRepair struct {
-	Invariant string            `yaml:"invariant"`
+	Invariant string                 `yaml:"invariant"`
 	Repair    map[string]interface{} `yaml:"repair"`
 }
 
 type rawEvent struct {
-	Guard  string                 `yaml:"guard"`
-	Effect map[string]interface{} `yaml:"effect"`
+	Params     yaml.Node              `yaml:"params"`
+	Guard      string                 `yaml:"guard"`
+	Effect     map[string]interface{} `yaml:"effect"`
+	Idempotent bool                   `yaml:"idempotent"`
 }
 
-// LoadFile parses a registry YAML file.
+// LoadFile parses a registry YAML file. Gzip-compressed files (a .gz
+// extension or gzip magic header) are decompressed transparently.
 func LoadFile(path string) (*Registry, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("read %s: %w", path, err)
 	}
+	if strings.HasSuffix(path, ".gz") || isGzip(data) {
+		data, err = gunzip(data)
+		if err != nil {
+			return nil, fmt.Errorf("decompress %s: %w", path, err)
+		}
+	}
 	return Parse(data)
 }
 
+// isGzip reports whether data begins with the gzip magic bytes.
+func isGzip(data []byte) bool {
+	return len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b
+}
+
+func gunzip(data []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
+
 // Parse parses registry YAML bytes.
 func Parse(data []byte) (*Registry, error) {
+	reg, _, err := parse(data, false)
+	return reg, err
+}
+
+// InputFormat is the syntax a registry is written in.
+type InputFormat int
+
+const (
+	InputYAML InputFormat = iota
+	InputJSON
+)
+
+// ParseInputFormat parses a format name: "yaml" or "json".
+func ParseInputFormat(name string) (InputFormat, error) {
+	switch name {
+	case "yaml":
+		return InputYAML, nil
+	case "json":
+		return InputJSON, nil
+	}
+	return 0, fmt.Errorf("unknown input format %q (want yaml or json)", name)
+}
+
+// ParseAs parses registry bytes in the given format. JSON is a subset of
+// YAML, so Parse already accepts it; InputJSON additionally requires
+// well-formed JSON and reports syntax errors with JSON byte offsets, which
+// are more useful for generated specs than the YAML parser's errors.
+func ParseAs(data []byte, format InputFormat) (*Registry, error) {
+	if format == InputJSON {
+		var v interface{}
+		if err := json.Unmarshal(data, &v); err != nil {
+			if se, ok := err.(*json.SyntaxError); ok {
+				return nil, fmt.Errorf("json parse: %v at offset %d", se, se.Offset)
+			}
+			return nil, fmt.Errorf("json parse: %w", err)
+		}
+	}
+	return Parse(data)
+}
+
+// Read reads a registry in the given format from r, such as standard
+// input. Gzip-compressed input is recognized by its magic header.
+func Read(r io.Reader, format InputFormat) (*Registry, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read: %w", err)
+	}
+	if isGzip(data) {
+		if data, err = gunzip(data); err != nil {
+			return nil, fmt.Errorf("decompress: %w", err)
+		}
+	}
+	return ParseAs(data, format)
+}
+
+// ParseLenient is Parse for linting: variable declarations are not checked
+// for empty domains, so that Validate can report every such problem along
+// with the rest. Declarations too malformed to represent (an unknown type,
+// a missing range) are left out of the registry and returned as error
+// diagnostics instead.
+func ParseLenient(data []byte) (*Registry, []Diagnostic, error) {
+	return parse(data, true)
+}
+
+// LoadFileLenient is LoadFile using ParseLenient.
+func LoadFileLenient(path string) (*Registry, []Diagnostic, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	if strings.HasSuffix(path, ".gz") || isGzip(data) {
+		data, err = gunzip(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("decompress %s: %w", path, err)
+		}
+	}
+	return ParseLenient(data)
+}
+
+func parse(data []byte, lenient bool) (*Registry, []Diagnostic, error) {
+	var diags []Diagnostic
 	var raw rawFile
 	if err := yaml.Unmarshal(data, &raw); err != nil {
-		return nil, fmt.Errorf("yaml parse: %w", err)
+		return nil, nil, fmt.Errorf("yaml parse: %w", err)
 	}
 	r := &raw.Registry
 	if r.Name == "" {
-		return nil, fmt.Errorf("registry must have a name")
+		return nil, nil, fmt.Errorf("registry must have a name")
 	}
 
 	reg := &Registry{
 		Name:    r.Name,
 		Initial: r.Initial,
 	}
+	if len(r.Constants) > 0 {
+		reg.Constants = make(map[string]int, len(r.Constants))
+		for _, name := range sortedKeys(r.Constants) {
+			n, ok := r.Constants[name].(int)
+			if !ok {
+				return nil, nil, fmt.Errorf("constant %q must be an integer, got %v", name, r.Constants[name])
+			}
+			if identPattern.FindString(name) != name {
+				return nil, nil, fmt.Errorf("constant %q is not a valid identifier", name)
+			}
+			reg.Constants[name] = n
+		}
+	}
 
 	// Parse state variables (deterministic order via yaml node ordering).
 	// We need stable ordering so re-parse to get key order.
@@ -75,24 +326,27 @@ func Parse(data []byte) (*Registry, error) {
 		} `yaml:"registry"`
 	}
 	if err := yaml.Unmarshal(data, &ordered); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	statesNode := &ordered.Registry.States
-	if statesNode.Kind == yaml.MappingNode {
-		for i := 0; i < len(statesNode.Content)-1; i += 2 {
-			keyNode := statesNode.Content[i]
-			name := keyNode.Value
-			rv, ok := r.States[name]
-			if !ok {
-				return nil, fmt.Errorf("state var %q not found", name)
-			}
-			vd, err := parseVarDef(name, rv)
-			if err != nil {
-				return nil, err
+	for _, pair := range mappingPairs(&ordered.Registry.States) {
+		name := pair.Key
+		rv, ok := r.States[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("state var %q not found", name)
+		}
+		vd, err := parseVarDef(name, rv, reg.Constants)
+		if err == nil && !lenient {
+			err = CheckVarDef(vd)
+		}
+		if err != nil {
+			if !lenient {
+				return nil, nil, err
 			}
-			reg.Vars = append(reg.Vars, vd)
+			diags = append(diags, Diagnostic{SeverityError, "states." + name, err.Error()})
+			continue
 		}
+		reg.Vars = append(reg.Vars, vd)
 	}
 
 	// Parse invariants (preserve order).
@@ -102,25 +356,26 @@ func Parse(data []byte) (*Registry, error) {
 		} `yaml:"registry"`
 	}
 	if err := yaml.Unmarshal(data, &invOrdered); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	invNode := &invOrdered.Registry.Invariants
-	if invNode.Kind == yaml.MappingNode {
-		for i := 0; i < len(invNode.Content)-1; i += 2 {
-			name := invNode.Content[i].Value
-			ri, ok := r.Invariants[name]
-			if !ok {
-				return nil, fmt.Errorf("invariant %q not found", name)
-			}
-			reg.Invariants = append(reg.Invariants, Invariant{Name: name, Expr: ri.Expr})
+	for _, pair := range mappingPairs(&invOrdered.Registry.Invariants) {
+		name := pair.Key
+		ri, ok := r.Invariants[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("invariant %q not found", name)
 		}
+		reg.Invariants = append(reg.Invariants, Invariant{Name: name, Expr: ri.Expr, Priority: ri.Priority})
 	}
 
 	// Parse compensation (already ordered as list).
 	for _, rc := range r.Compensation {
 		assignments := make(map[string]string)
 		for k, v := range rc.Repair {
-			assignments[k] = fmt.Sprintf("%v", v)
+			src, err := assignmentSource(v)
+			if err != nil {
+				return nil, nil, fmt.Errorf("compensation for %q: repair of %q: %w", rc.Invariant, k, err)
+			}
+			assignments[k] = src
 		}
 		reg.Compensation = append(reg.Compensation, Repair{
 			Invariant:   rc.Invariant,
@@ -135,57 +390,196 @@ func Parse(data []byte) (*Registry, error) {
 		} `yaml:"registry"`
 	}
 	if err := yaml.Unmarshal(data, &evtOrdered); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	evtNode := &evtOrdered.Registry.Events
-	if evtNode.Kind == yaml.MappingNode {
-		for i := 0; i < len(evtNode.Content)-1; i += 2 {
-			name := evtNode.Content[i].Value
-			re, ok := r.Events[name]
-			if !ok {
-				return nil, fmt.Errorf("event %q not found", name)
+	for _, pair := range mappingPairs(&evtOrdered.Registry.Events) {
+		name := pair.Key
+		re, ok := r.Events[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("event %q not found", name)
+		}
+		assignments := make(map[string]string)
+		for k, v := range re.Effect {
+			src, err := assignmentSource(v)
+			if err != nil {
+				return nil, nil, fmt.Errorf("event %q: effect on %q: %w", name, k, err)
 			}
-			assignments := make(map[string]string)
-			for k, v := range re.Effect {
-				assignments[k] = fmt.Sprintf("%v", v)
+			assignments[k] = src
+		}
+		params, err := parseParams(name, &re.Params, reg.Constants)
+		if err != nil {
+			return nil, nil, err
+		}
+		reg.Events = append(reg.Events, Event{
+			Name:        name,
+			Params:      params,
+			Guard:       re.Guard,
+			Assignments: assignments,
+			Idempotent:  re.Idempotent,
+		})
+	}
+
+	if err := checkConstantNames(reg); err != nil {
+		return nil, nil, err
+	}
+	return reg, diags, nil
+}
+
+// checkConstantNames rejects a constant whose name is also a state
+// variable, enum value or event parameter: expressions could not tell
+// which one a reference means.
+func checkConstantNames(reg *Registry) error {
+	for _, v := range reg.Vars {
+		if _, ok := reg.Constants[v.Name]; ok {
+			return fmt.Errorf("constant %q is also a state variable", v.Name)
+		}
+		for _, lit := range v.Values {
+			if _, ok := reg.Constants[lit]; ok {
+				return fmt.Errorf("constant %q is also a value of enum %q", lit, v.Name)
 			}
-			reg.Events = append(reg.Events, Event{
-				Name:        name,
-				Guard:       re.Guard,
-				Assignments: assignments,
-			})
 		}
 	}
+	for _, evt := range reg.Events {
+		for _, p := range evt.Params {
+			if _, ok := reg.Constants[p.Name]; ok {
+				return fmt.Errorf("constant %q is also a parameter of event %q", p.Name, evt.Name)
+			}
+		}
+	}
+	return nil
+}
 
-	return reg, nil
+// parseParams parses an event's params block, preserving declared order.
+func parseParams(event string, node *yaml.Node, constants map[string]int) ([]VarDef, error) {
+	if node.Kind == 0 {
+		return nil, nil
+	}
+	if node.Kind != yaml.MappingNode && node.Kind != yaml.AliasNode {
+		return nil, fmt.Errorf("event %q: params must be a mapping", event)
+	}
+	var params []VarDef
+	for _, pair := range mappingPairs(node) {
+		name := pair.Key
+		var rv rawVar
+		if err := pair.Value.Decode(&rv); err != nil {
+			return nil, fmt.Errorf("event %q param %q: %w", event, name, err)
+		}
+		vd, err := parseVarDef(name, rv, constants)
+		if err == nil {
+			err = CheckVarDef(vd)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("event %q param: %w", event, err)
+		}
+		if vd.AutoMax {
+			return nil, fmt.Errorf("event %q param %q: range max auto is only supported for state variables", event, name)
+		}
+		params = append(params, vd)
+	}
+	return params, nil
 }
 
-func parseVarDef(name string, rv rawVar) (VarDef, error) {
-	vd := VarDef{Name: name}
+// parseVarDef converts a raw declaration, resolving range bounds that name
+// constants. It does not check that the domain is non-empty; see
+// CheckVarDef.
+func parseVarDef(name string, rv rawVar, constants map[string]int) (VarDef, error) {
+	vd := VarDef{Name: name, Ordered: rv.Ordered}
+	if rv.Ordered && rv.Type != "enum" {
+		return vd, fmt.Errorf("%s %q: ordered applies only to enums", rv.Type, name)
+	}
 	switch rv.Type {
 	case "bool":
 		vd.Type = TypeBool
 		vd.Size = 2
 	case "enum":
 		vd.Type = TypeEnum
-		vd.Values = rv.Values
-		vd.Size = len(rv.Values)
-		if vd.Size == 0 {
-			return vd, fmt.Errorf("enum %q has no values", name)
+		if rv.Values.Ordinals != nil {
+			values, err := orderedValues(name, rv.Values)
+			if err != nil {
+				return vd, err
+			}
+			vd.Values = values
+		} else {
+			vd.Values = rv.Values.List
 		}
+		vd.Size = len(vd.Values)
 	case "int":
 		vd.Type = TypeInt
-		if len(rv.Range) != 2 {
+		if len(rv.Range.Bounds) != 2 {
 			return vd, fmt.Errorf("int %q needs range: [min, max]", name)
 		}
-		vd.Min = rv.Range[0]
-		vd.Max = rv.Range[1]
-		vd.Size = vd.Max - vd.Min + 1
-		if vd.Size <= 0 {
-			return vd, fmt.Errorf("int %q has empty range [%d, %d]", name, vd.Min, vd.Max)
+		for i, c := range rv.Range.Names {
+			if c == "" {
+				continue
+			}
+			n, ok := constants[c]
+			if !ok {
+				return vd, fmt.Errorf("int %q: range bound %q is not a defined constant", name, c)
+			}
+			rv.Range.Bounds[i] = n
+		}
+		vd.Min = rv.Range.Bounds[0]
+		vd.Max = rv.Range.Bounds[1]
+		if rv.Range.AutoMax {
+			vd.Max, vd.AutoMax = vd.Min, true
 		}
+		vd.Size = vd.Max - vd.Min + 1
 	default:
 		return vd, fmt.Errorf("unknown type %q for %q", rv.Type, name)
 	}
 	return vd, nil
 }
+
+// CheckVarDef reports an error if v has an empty domain: an enum without
+// values or an int range whose max is below its min.
+func CheckVarDef(v VarDef) error {
+	switch v.Type {
+	case TypeEnum:
+		if len(v.Values) == 0 {
+			return fmt.Errorf("enum %q has no values", v.Name)
+		}
+	case TypeInt:
+		if v.Max < v.Min {
+			return fmt.Errorf("int %q has empty range [%d, %d]", v.Name, v.Min, v.Max)
+		}
+	}
+	return nil
+}
+
+// orderedValues places explicitly numbered enum values at their ordinals.
+// Ordinals must be unique and contiguous from 0.
+func orderedValues(name string, rv rawValues) ([]string, error) {
+	values := make([]string, len(rv.Keys))
+	for _, key := range rv.Keys {
+		ord := rv.Ordinals[key]
+		if ord < 0 || ord >= len(values) {
+			return nil, fmt.Errorf("enum %q: ordinal %d for %q out of range; ordinals must be contiguous from 0 to %d",
+				name, ord, key, len(values)-1)
+		}
+		if values[ord] != "" {
+			return nil, fmt.Errorf("enum %q: ordinal %d used by both %q and %q", name, ord, values[ord], key)
+		}
+		values[ord] = key
+	}
+	return values, nil
+}
+
+// assignmentSource converts a decoded YAML effect or repair value to
+// expression source. Strings are taken as written; unquoted integers and
+// booleans become the corresponding literal.
+func assignmentSource(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case int:
+		return strconv.Itoa(v), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return "", fmt.Errorf("fractional values unsupported (got %v)", v)
+	case nil:
+		return "", fmt.Errorf("missing value")
+	default:
+		return "", fmt.Errorf("unsupported value %v of type %T", v, v)
+	}
+}
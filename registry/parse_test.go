@@ -0,0 +1,408 @@
+package registry
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// flagsYAML is a minimal registry shared by the parse tests.
+const flagsYAML = `
+registry:
+  name: flags
+  states:
+    a: {type: bool}
+    n: {type: int, range: [0, 2]}
+  initial: {a: false, n: 0}
+  invariants:
+    small: {expr: "n < 2"}
+  compensation:
+    - invariant: small
+      repair: {n: 0}
+  events:
+    set_a:
+      effect: {a: true}
+    inc:
+      guard: "n < 2"
+      effect: {n: "n + 1"}
+`
+
+// writeFile writes data to name in a fresh temporary directory and
+// returns its path.
+func writeFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func gzipped(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestLoadFileGzip(t *testing.T) {
+	want, err := Parse([]byte(flagsYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr string
+	}{
+		{"flags.yaml", []byte(flagsYAML), ""},
+		{"flags.yaml.gz", gzipped(t, []byte(flagsYAML)), ""},
+		{"flags.yaml", gzipped(t, []byte(flagsYAML)), ""}, // detected by its header
+		{"flags.yaml.gz", []byte(flagsYAML), "decompress"},
+		{"flags.yaml.gz", gzipped(t, []byte(flagsYAML))[:20], "decompress"},
+	}
+	for _, tt := range tests {
+		got, err := LoadFile(writeFile(t, tt.name, tt.data))
+		switch {
+		case tt.wantErr != "":
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s (%d bytes): error %v, want %q", tt.name, len(tt.data), err, tt.wantErr)
+			}
+		case err != nil:
+			t.Errorf("%s: %v", tt.name, err)
+		case !reflect.DeepEqual(got, want):
+			t.Errorf("%s: loaded %+v, want %+v", tt.name, got, want)
+		}
+	}
+}
+
+// parseWithVar parses a registry declaring the single state variable s as
+// given by the YAML flow mapping def.
+func parseWithVar(def string) (*Registry, error) {
+	return Parse([]byte(`
+registry:
+  name: one
+  states:
+    s: ` + def + `
+  invariants:
+    ok: {expr: "true"}
+  events:
+    noop:
+      effect: {}
+`))
+}
+
+func TestEnumOrdinals(t *testing.T) {
+	tests := []struct {
+		def     string
+		want    []string
+		wantErr string
+	}{
+		{"{type: enum, values: [a, b, c]}", []string{"a", "b", "c"}, ""},
+		{"{type: enum, values: {c: 2, a: 0, b: 1}}", []string{"a", "b", "c"}, ""},
+		{"{type: enum, values: {b: 1, a: 0}}", []string{"a", "b"}, ""},
+		{"{type: enum, values: {a: 0, b: 2}}", nil, `enum "s": ordinal 2 for "b" out of range; ordinals must be contiguous from 0 to 1`},
+		{"{type: enum, values: {a: -1, b: 0}}", nil, `ordinal -1 for "a" out of range`},
+		{"{type: enum, values: {a: 0, b: 0}}", nil, `enum "s": ordinal 0 used by both "a" and "b"`},
+		{"{type: enum, values: {a: 0, b: x}}", nil, `enum value "b": ordinal must be an integer`},
+		{"{type: enum, values: {}}", nil, `enum "s" has no values`},
+	}
+	for _, tt := range tests {
+		reg, err := parseWithVar(tt.def)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: error %v, want %q", tt.def, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.def, err)
+			continue
+		}
+		if got := reg.Vars[0].Values; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: values %v, want %v", tt.def, got, tt.want)
+		}
+	}
+}
+
+func TestAssignmentValues(t *testing.T) {
+	const tmpl = `
+registry:
+  name: vals
+  states:
+    a: {type: bool}
+    n: {type: int, range: [0, 2]}
+  invariants:
+    small: {expr: "n < 2"}
+  compensation:
+    - invariant: small
+      repair: {n: REPAIR}
+  events:
+    set:
+      effect: {EFFECT}
+`
+	tests := []struct {
+		effect, repair string
+		want           map[string]string // the set event's assignments
+		wantRepair     string
+		wantErr        string
+	}{
+		{"n: 1", "0", map[string]string{"n": "1"}, "0", ""},
+		{"a: true", "0", map[string]string{"a": "true"}, "0", ""},
+		{"a: false, n: 2", "0", map[string]string{"a": "false", "n": "2"}, "0", ""},
+		{`n: "n + 1"`, `"n - 1"`, map[string]string{"n": "n + 1"}, "n - 1", ""},
+		{"n: 1.5", "0", nil, "", `event "set": effect on "n": fractional values unsupported (got 1.5)`},
+		{"n: 1", "0.5", nil, "", `compensation for "small": repair of "n": fractional values unsupported (got 0.5)`},
+		{"n: ", "0", nil, "", `event "set": effect on "n": missing value`},
+	}
+	for _, tt := range tests {
+		src := strings.NewReplacer("EFFECT", tt.effect, "REPAIR", tt.repair).Replace(tmpl)
+		reg, err := Parse([]byte(src))
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("effect {%s}, repair %s: error %v, want %q", tt.effect, tt.repair, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("effect {%s}, repair %s: %v", tt.effect, tt.repair, err)
+			continue
+		}
+		if got := reg.Events[0].Assignments; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("effect {%s}: assignments %v, want %v", tt.effect, got, tt.want)
+		}
+		if got := reg.Compensation[0].Assignments["n"]; got != tt.wantRepair {
+			t.Errorf("repair %s: assignment %q, want %q", tt.repair, got, tt.wantRepair)
+		}
+	}
+}
+
+func TestConstants(t *testing.T) {
+	const tmpl = `
+registry:
+  name: consts
+  constants: {CONSTS}
+  states:
+    n: {type: int, range: RANGE}
+  invariants:
+    ok: {expr: "true"}
+  events:
+    bump:
+      params:
+        k: {type: int, range: [1, 3]}
+      effect: {}
+`
+	tests := []struct {
+		consts, rng      string
+		wantMin, wantMax int
+		wantErr          string
+	}{
+		{"capacity: 10", "[0, capacity]", 0, 10, ""},
+		{"low: 2, high: 5", "[low, high]", 2, 5, ""},
+		{"low: -3", "[low, 0]", -3, 0, ""},
+		{"low: 1", "[low, auto]", 1, 1, ""},
+		{"", "[0, capacity]", 0, 0, `int "n": range bound "capacity" is not a defined constant`},
+		{"capacity: 2.5", "[0, capacity]", 0, 0, `constant "capacity" must be an integer, got 2.5`},
+		{"capacity: big", "[0, capacity]", 0, 0, `constant "capacity" must be an integer, got big`},
+		{"n: 3", "[0, n]", 0, 0, `constant "n" is also a state variable`},
+		{"k: 3", "[0, k]", 0, 0, `constant "k" is also a parameter of event "bump"`},
+		{"capacity: 3", "[0, \"a b\"]", 0, 0, "range max must be an integer, constant or auto"},
+	}
+	for _, tt := range tests {
+		src := strings.NewReplacer("CONSTS", tt.consts, "RANGE", tt.rng).Replace(tmpl)
+		reg, err := Parse([]byte(src))
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("constants {%s}, range %s: error %v, want %q", tt.consts, tt.rng, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("constants {%s}, range %s: %v", tt.consts, tt.rng, err)
+			continue
+		}
+		if v := reg.Vars[0]; v.Min != tt.wantMin || v.Max != tt.wantMax {
+			t.Errorf("constants {%s}, range %s: [%d, %d], want [%d, %d]", tt.consts, tt.rng, v.Min, v.Max, tt.wantMin, tt.wantMax)
+		}
+	}
+}
+
+func TestParseAs(t *testing.T) {
+	const flagsJSON = `{"registry": {"name": "flags",
+  "states": {"a": {"type": "bool"}, "n": {"type": "int", "range": [0, 2]}},
+  "initial": {"a": false, "n": 0},
+  "invariants": {"small": {"expr": "n < 2"}},
+  "compensation": [{"invariant": "small", "repair": {"n": 0}}],
+  "events": {"set_a": {"effect": {"a": true}}, "inc": {"guard": "n < 2", "effect": {"n": "n + 1"}}}}}`
+	want, err := Parse([]byte(flagsYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		data    string
+		format  InputFormat
+		wantErr string
+	}{
+		{"json as json", flagsJSON, InputJSON, ""},
+		{"json as yaml", flagsJSON, InputYAML, ""},
+		{"yaml as yaml", flagsYAML, InputYAML, ""},
+		{"yaml as json", flagsYAML, InputJSON, "json parse: invalid character 'r' looking for beginning of value at offset 2"},
+		{"truncated json", flagsJSON[:40], InputJSON, "json parse: unexpected end of JSON input"},
+		{"trailing comma", `{"registry": {"name": "x",}}`, InputJSON, "at offset 27"},
+	}
+	for _, tt := range tests {
+		got, err := ParseAs([]byte(tt.data), tt.format)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: error %v, want %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, want)
+		}
+	}
+}
+
+func TestParseInputFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    InputFormat
+		wantErr string
+	}{
+		{"yaml", InputYAML, ""},
+		{"json", InputJSON, ""},
+		{"toml", 0, `unknown input format "toml" (want yaml or json)`},
+	}
+	for _, tt := range tests {
+		got, err := ParseInputFormat(tt.name)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("ParseInputFormat(%q): error %v, want %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseInputFormat(%q) = %v, %v; want %v", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestMergeKeys(t *testing.T) {
+	want, err := Parse([]byte(flagsYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each case rebuilds flagsYAML with some sections merged or aliased
+	// from anchors; most share its tail, rest.
+	const rest = `
+  initial: {a: false, n: 0}
+  invariants:
+    small: {expr: "n < 2"}
+  compensation:
+    - invariant: small
+      repair: {n: 0}
+  events:
+    set_a:
+      effect: {a: true}
+    inc:
+      guard: "n < 2"
+      effect: {n: "n + 1"}
+`
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"merge key", `
+common: &common
+  a: {type: bool}
+registry:
+  name: flags
+  states:
+    <<: *common
+    n: {type: int, range: [0, 2]}` + rest},
+		{"explicit beats merged", `
+common: &common
+  a: {type: bool}
+  n: {type: int, range: [0, 5]}
+registry:
+  name: flags
+  states:
+    <<: *common
+    n: {type: int, range: [0, 2]}` + rest},
+		{"merge list", `
+flags: &flags
+  a: {type: bool}
+counts: &counts
+  n: {type: int, range: [0, 2]}
+registry:
+  name: flags
+  states:
+    <<: [*flags, *counts]` + rest},
+		{"earlier source wins", `
+flags: &flags
+  a: {type: bool}
+  n: {type: int, range: [0, 2]}
+counts: &counts
+  n: {type: int, range: [0, 5]}
+registry:
+  name: flags
+  states:
+    <<: [*flags, *counts]` + rest},
+		{"aliased mapping", `
+vars: &vars
+  a: {type: bool}
+  n: {type: int, range: [0, 2]}
+registry:
+  name: flags
+  states: *vars` + rest},
+		{"merged invariants and events", `
+invs: &invs
+  small: {expr: "n < 2"}
+evts: &evts
+  set_a:
+    effect: {a: true}
+registry:
+  name: flags
+  states:
+    a: {type: bool}
+    n: {type: int, range: [0, 2]}
+  initial: {a: false, n: 0}
+  invariants:
+    <<: *invs
+  compensation:
+    - invariant: small
+      repair: {n: 0}
+  events:
+    <<: *evts
+    inc:
+      guard: "n < 2"
+      effect: {n: "n + 1"}
+`},
+	}
+	for _, tt := range tests {
+		got, err := Parse([]byte(tt.data))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, want)
+		}
+	}
+}
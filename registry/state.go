@@ -0,0 +1,213 @@
+package registry
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// ParseState parses a valuation written as "name=value" pairs separated by
+// commas or whitespace, e.g. "x=3, flag=true, status=pending". Every
+// variable in the schema must be assigned exactly once.
+func (s *Schema) ParseState(spec string) (State, error) {
+	choices, err := s.parseAssignments(spec, false)
+	if err != nil {
+		return nil, err
+	}
+	st := make(State, len(s.Vars))
+	for i, c := range choices {
+		st[i] = c[0]
+	}
+	return st, nil
+}
+
+// Format renders st with variable names and decoded values, e.g.
+// {x=3, flag=true, status=pending}; without the braces, ParseState accepts
+// it back. An enum index outside the variable's values is shown as ?N.
+func (s *Schema) Format(st State) string {
+	parts := make([]string, len(st))
+	for i, v := range st {
+		vd := s.Vars[i]
+		switch vd.Type {
+		case TypeBool:
+			if v == 1 {
+				parts[i] = vd.Name + "=true"
+			} else {
+				parts[i] = vd.Name + "=false"
+			}
+		case TypeEnum:
+			if v >= 0 && v < len(vd.Values) {
+				parts[i] = vd.Name + "=" + vd.Values[v]
+			} else {
+				parts[i] = fmt.Sprintf("%s=?%d", vd.Name, v)
+			}
+		case TypeInt:
+			parts[i] = fmt.Sprintf("%s=%d", vd.Name, v)
+		}
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+// ParseStates is ParseState with wildcards: a value of "*" stands for every
+// value in the variable's domain, and the result is the cross product of
+// all choices in StateID order, e.g. "x=3, flag=*" yields two states. It is
+// an error if the expansion has more than limit states.
+func (s *Schema) ParseStates(spec string, limit int) ([]State, error) {
+	choices, err := s.parseAssignments(spec, true)
+	if err != nil {
+		return nil, err
+	}
+	total := 1
+	for _, c := range choices {
+		total *= len(c)
+		if total > limit {
+			return nil, fmt.Errorf("%q matches more than %d states", spec, limit)
+		}
+	}
+
+	states := make([]State, 0, total)
+	pick := make([]int, len(choices)) // odometer over choices
+	for {
+		st := make(State, len(s.Vars))
+		for i, c := range choices {
+			st[i] = c[pick[i]]
+		}
+		states = append(states, st)
+		i := len(pick) - 1
+		for ; i >= 0; i-- {
+			pick[i]++
+			if pick[i] < len(choices[i]) {
+				break
+			}
+			pick[i] = 0
+		}
+		if i < 0 {
+			return states, nil
+		}
+	}
+}
+
+// parseAssignments parses "name=value" pairs into, for each variable, the
+// list of int-encoded values it may take: one value, or with wildcard
+// allowed and a value of "*", its whole domain in order.
+func (s *Schema) parseAssignments(spec string, wildcard bool) ([][]int, error) {
+	choices := make([][]int, len(s.Vars))
+
+	fields := strings.FieldsFunc(spec, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+	for _, field := range fields {
+		name, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return nil, fmt.Errorf("expected name=value, got %q", field)
+		}
+		idx := s.VarIndex(name)
+		if idx < 0 {
+			return nil, fmt.Errorf("unknown variable %q", name)
+		}
+		if choices[idx] != nil {
+			return nil, fmt.Errorf("variable %q assigned twice", name)
+		}
+		if value == "*" {
+			if !wildcard {
+				return nil, fmt.Errorf("variable %q: wildcard * is not allowed here", name)
+			}
+			choices[idx] = s.domain(idx)
+			continue
+		}
+		v, err := s.ParseValue(idx, value)
+		if err != nil {
+			return nil, err
+		}
+		choices[idx] = []int{v}
+	}
+
+	var missing []string
+	for i, c := range choices {
+		if c == nil {
+			missing = append(missing, s.Vars[i].Name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing value for %s", strings.Join(missing, ", "))
+	}
+	return choices, nil
+}
+
+// domain lists every int-encoded value of the variable at varIdx.
+func (s *Schema) domain(varIdx int) []int {
+	v := s.Vars[varIdx]
+	lo := 0
+	if v.Type == TypeInt {
+		lo = v.Min
+	}
+	vals := make([]int, v.Size)
+	for i := range vals {
+		vals[i] = lo + i
+	}
+	return vals
+}
+
+// ParseValue parses a single value for the variable at varIdx into its
+// int encoding, checking that it lies in the variable's domain.
+func (s *Schema) ParseValue(varIdx int, value string) (int, error) {
+	v := s.Vars[varIdx]
+	switch v.Type {
+	case TypeBool:
+		switch value {
+		case "true", "yes", "on":
+			return 1, nil
+		case "false", "no", "off":
+			return 0, nil
+		}
+		return 0, fmt.Errorf("%s: expected true or false, got %q", v.Name, value)
+	case TypeEnum:
+		idx := s.EnumIndex(varIdx, value)
+		if idx < 0 {
+			return 0, fmt.Errorf("%s: %q is not one of %v", v.Name, value, v.Values)
+		}
+		return idx, nil
+	default:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return 0, fmt.Errorf("%s: expected integer, got %q", v.Name, value)
+		}
+		if n < v.Min || n > v.Max {
+			return 0, fmt.Errorf("%s: %d outside range [%d, %d]", v.Name, n, v.Min, v.Max)
+		}
+		return n, nil
+	}
+}
+
+// CheckState reports an error if st does not have one in-domain value per
+// schema variable.
+func (s *Schema) CheckState(st State) error {
+	if len(st) != len(s.Vars) {
+		return fmt.Errorf("state has %d values, schema has %d variables", len(st), len(s.Vars))
+	}
+	for i, v := range s.Vars {
+		lo, hi := 0, v.Size-1
+		if v.Type == TypeInt {
+			lo, hi = v.Min, v.Max
+		}
+		if st[i] < lo || st[i] > hi {
+			return fmt.Errorf("variable %q: value %d out of range [%d, %d]", v.Name, st[i], lo, hi)
+		}
+	}
+	return nil
+}
+
+// RandomState draws a valuation uniformly from the state space using rng:
+// each variable independently takes a value in its domain (bools and enums
+// in [0, Size), ints in [Min, Max]).
+func (s *Schema) RandomState(rng *rand.Rand) State {
+	st := make(State, len(s.Vars))
+	for i, v := range s.Vars {
+		st[i] = rng.Intn(v.Size)
+		if v.Type == TypeInt {
+			st[i] += v.Min
+		}
+	}
+	return st
+}
@@ -0,0 +1,201 @@
+package registry
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// testSchema is a schema with one variable of each type.
+func testSchema() Schema {
+	return NewSchema([]VarDef{
+		{Name: "x", Type: TypeInt, Min: 0, Max: 3, Size: 4},
+		{Name: "flag", Type: TypeBool, Size: 2},
+		{Name: "power", Type: TypeEnum, Values: []string{"off", "on"}, Size: 2},
+	})
+}
+
+func TestParseValue(t *testing.T) {
+	s := testSchema()
+	tests := []struct {
+		v, value string
+		want     int
+		wantErr  bool
+	}{
+		{"x", "2", 2, false},
+		{"x", "4", 0, true},
+		{"x", "two", 0, true},
+		{"flag", "true", 1, false},
+		{"flag", "yes", 1, false},
+		{"flag", "on", 1, false},
+		{"flag", "false", 0, false},
+		{"flag", "no", 0, false},
+		{"flag", "off", 0, false},
+		{"flag", "1", 0, true},
+		// An enum's own literals win over the bool synonyms.
+		{"power", "off", 0, false},
+		{"power", "on", 1, false},
+		{"power", "yes", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := s.ParseValue(s.VarIndex(tt.v), tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseValue(%s, %q) error = %v, wantErr %v", tt.v, tt.value, err, tt.wantErr)
+			continue
+		}
+		if err == nil && got != tt.want {
+			t.Errorf("ParseValue(%s, %q) = %d, want %d", tt.v, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestParseState(t *testing.T) {
+	s := testSchema()
+	tests := []struct {
+		spec    string
+		want    State
+		wantErr string
+	}{
+		{"x=1, flag=true, power=on", State{1, 1, 1}, ""},
+		{"power=off x=3\tflag=false", State{3, 0, 0}, ""},
+		{"x=1,flag=true,power=on", State{1, 1, 1}, ""},
+		{"x=1, flag=true", nil, "missing value for power"},
+		{"", nil, "missing value for x, flag, power"},
+		{"x=1, x=2, flag=true, power=on", nil, `variable "x" assigned twice`},
+		{"x=1, y=2, flag=true, power=on", nil, `unknown variable "y"`},
+		{"x=1, flag, power=on", nil, `expected name=value, got "flag"`},
+		{"x=*, flag=true, power=on", nil, `variable "x": wildcard * is not allowed here`},
+		{"x=9, flag=true, power=on", nil, "x: 9 outside range [0, 3]"},
+	}
+	for _, tt := range tests {
+		got, err := s.ParseState(tt.spec)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("ParseState(%q) error %v, want %q", tt.spec, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("ParseState(%q) = %v, %v; want %v", tt.spec, got, err, tt.want)
+		}
+	}
+}
+
+func TestRandomStateRoundTrip(t *testing.T) {
+	schemas := map[string]Schema{
+		"mixed": testSchema(),
+		"signed": NewSchema([]VarDef{
+			{Name: "d", Type: TypeInt, Min: -3, Max: 2, Size: 6},
+			{Name: "s", Type: TypeEnum, Values: []string{"a", "b", "c"}, Size: 3},
+			{Name: "one", Type: TypeInt, Min: 7, Max: 7, Size: 1},
+		}),
+	}
+	for name, s := range schemas {
+		rng := rand.New(rand.NewSource(1))
+		seen := make([]bool, s.TotalLen)
+		for i := 0; i < 10000; i++ {
+			st := s.RandomState(rng)
+			for vi, v := range s.Vars {
+				lo, hi := 0, v.Size-1
+				if v.Type == TypeInt {
+					lo, hi = v.Min, v.Max
+				}
+				if st[vi] < lo || st[vi] > hi {
+					t.Fatalf("%s: %s = %d, outside [%d, %d]", name, v.Name, st[vi], lo, hi)
+				}
+			}
+			id := s.Encode(st)
+			if int(id) < 0 || int(id) >= s.TotalLen {
+				t.Fatalf("%s: Encode(%v) = %d, outside the state space", name, st, id)
+			}
+			if got := s.Decode(id); !got.Equal(st) {
+				t.Fatalf("%s: Decode(Encode(%v)) = %v", name, st, got)
+			}
+			seen[id] = true
+		}
+		for id, ok := range seen {
+			if !ok {
+				t.Errorf("%s: state %d never drawn in 10000 samples", name, id)
+			}
+		}
+	}
+}
+
+func TestParseStates(t *testing.T) {
+	s := testSchema()
+	tests := []struct {
+		spec    string
+		limit   int
+		want    []State
+		wantErr string
+	}{
+		{"x=3, flag=*, power=on", 10, []State{{3, 0, 1}, {3, 1, 1}}, ""},
+		{"x=1, flag=true, power=off", 1, []State{{1, 1, 0}}, ""},
+		{"x=*, flag=false, power=*", 8, []State{
+			{0, 0, 0}, {0, 0, 1}, {1, 0, 0}, {1, 0, 1},
+			{2, 0, 0}, {2, 0, 1}, {3, 0, 0}, {3, 0, 1},
+		}, ""},
+		{"x=*, flag=*, power=*", 16, nil, ""}, // the whole space; checked below
+		{"x=*, flag=*, power=*", 15, nil, `"x=*, flag=*, power=*" matches more than 15 states`},
+		{"x=*, flag=*", 100, nil, "missing value for power"},
+		{"x=*, x=1, flag=*, power=on", 100, nil, `variable "x" assigned twice`},
+		{"x=**, flag=*, power=on", 100, nil, `x: expected integer, got "**"`},
+	}
+	for _, tt := range tests {
+		got, err := s.ParseStates(tt.spec, tt.limit)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("ParseStates(%q, %d) error %v, want %q", tt.spec, tt.limit, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseStates(%q, %d): %v", tt.spec, tt.limit, err)
+			continue
+		}
+		if tt.want == nil {
+			tt.want = make([]State, s.TotalLen)
+			for id := range tt.want {
+				tt.want[id] = s.Decode(StateID(id))
+			}
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("ParseStates(%q) = %d states, want %d", tt.spec, len(got), len(tt.want))
+			continue
+		}
+		for i := range got {
+			if !got[i].Equal(tt.want[i]) {
+				t.Errorf("ParseStates(%q)[%d] = %v, want %v", tt.spec, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	s := testSchema()
+	tests := []struct {
+		st   State
+		want string
+	}{
+		{State{0, 0, 0}, "{x=0, flag=false, power=off}"},
+		{State{3, 1, 1}, "{x=3, flag=true, power=on}"},
+		// An enum index outside the values, e.g. from a corrupt encoding.
+		{State{2, 1, 2}, "{x=2, flag=true, power=?2}"},
+		{State{2, 0, -1}, "{x=2, flag=false, power=?-1}"},
+	}
+	for _, tt := range tests {
+		got := s.Format(tt.st)
+		if got != tt.want {
+			t.Errorf("Format(%v) = %q, want %q", tt.st, got, tt.want)
+			continue
+		}
+		if tt.st[2] < 0 || tt.st[2] > 1 {
+			continue
+		}
+		// Without the braces, the in-range forms parse back to the same state.
+		back, err := s.ParseState(strings.Trim(got, "{}"))
+		if err != nil || !back.Equal(tt.st) {
+			t.Errorf("ParseState(%q) = %v, %v; want %v", got, back, err, tt.st)
+		}
+	}
+}
@@ -1,5 +1,11 @@
 package registry
 
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
 // VarType represents the type of a state variable.
 type VarType int
 
@@ -17,12 +23,21 @@ type VarDef struct {
 	Min    int      // for int range
 	Max    int      // for int range
 	Size   int      // number of possible values
+
+	// Ordered marks an enum declared with ordered: true, whose values may
+	// be compared with <, <=, > and >= by declaration ordinal.
+	Ordered bool
+
+	// AutoMax marks an int declared with range [min, auto]. Its Max is a
+	// placeholder (equal to Min) until the compiler infers it.
+	AutoMax bool
 }
 
 // Invariant is a named boolean predicate over state.
 type Invariant struct {
-	Name string
-	Expr string
+	Name     string
+	Expr     string
+	Priority int // higher is repaired first under the priority strategy; default 0
 }
 
 // Repair is a compensation step targeting one invariant.
@@ -32,15 +47,20 @@ type Repair struct {
 }
 
 // Event is a named transition with optional guard and effects.
+// Params, if any, are bound during guard and effect evaluation; each
+// combination of parameter values is a distinct transition.
 type Event struct {
 	Name        string
+	Params      []VarDef          // optional bounded parameters
 	Guard       string            // optional boolean expression
 	Assignments map[string]string // var -> expression string
+	Idempotent  bool              // declared idempotent; checked by the verifier
 }
 
 // Registry is the complete spec for a single registry.
 type Registry struct {
 	Name         string
+	Constants    map[string]int // named integers usable in ranges and expressions
 	Vars         []VarDef
 	Initial      map[string]interface{}
 	Invariants   []Invariant
@@ -48,12 +68,100 @@ type Registry struct {
 	Events       []Event
 }
 
+// Clone returns a deep copy of r: slices, assignment maps, parameters and
+// enum value lists are copied, so the copy can be mutated without affecting
+// r. Initial values are scalars and are copied by value.
+func (r *Registry) Clone() *Registry {
+	out := *r
+	if r.Constants != nil {
+		out.Constants = make(map[string]int, len(r.Constants))
+		for k, v := range r.Constants {
+			out.Constants[k] = v
+		}
+	}
+	if r.Initial != nil {
+		out.Initial = make(map[string]interface{}, len(r.Initial))
+		for k, v := range r.Initial {
+			out.Initial[k] = v
+		}
+	}
+	out.Vars = cloneVarDefs(r.Vars)
+	out.Invariants = append([]Invariant(nil), r.Invariants...)
+	if r.Compensation != nil {
+		out.Compensation = make([]Repair, len(r.Compensation))
+		for i, rep := range r.Compensation {
+			rep.Assignments = cloneAssignments(rep.Assignments)
+			out.Compensation[i] = rep
+		}
+	}
+	if r.Events != nil {
+		out.Events = make([]Event, len(r.Events))
+		for i, evt := range r.Events {
+			evt.Params = cloneVarDefs(evt.Params)
+			evt.Assignments = cloneAssignments(evt.Assignments)
+			out.Events[i] = evt
+		}
+	}
+	return &out
+}
+
+func cloneVarDefs(vars []VarDef) []VarDef {
+	if vars == nil {
+		return nil
+	}
+	out := make([]VarDef, len(vars))
+	for i, v := range vars {
+		v.Values = append([]string(nil), v.Values...)
+		out[i] = v
+	}
+	return out
+}
+
+func cloneAssignments(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
 // State is a concrete valuation: variable index -> value (int-encoded).
 // For bool: 0=false, 1=true
 // For enum: index into VarDef.Values
 // For int:  actual value (within range)
 type State []int
 
+// Equal reports whether s and o have the same length and values.
+func (s State) Equal(o State) bool {
+	if len(s) != len(o) {
+		return false
+	}
+	for i := range s {
+		if s[i] != o[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// String renders s by variable index, e.g. {0=1, 1=3}. It has no schema,
+// so values are shown encoded; see Schema for names.
+func (s State) String() string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, v := range s {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "%d=%d", i, v)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
 // StateID is a bitpacked integer encoding of a State.
 type StateID int
 
@@ -90,7 +198,22 @@ func (s *Schema) Encode(st State) StateID {
 
 // Decode unpacks a StateID into a state.
 func (s *Schema) Decode(id StateID) State {
-	st := make(State, len(s.Vars))
+	return s.DecodeInto(id, make(State, len(s.Vars)))
+}
+
+// DecodeChecked is Decode with validation: it returns an error for an id
+// outside [0, TotalLen), such as the -1 "disabled" sentinel of a Step
+// table, instead of a meaningless state.
+func (s *Schema) DecodeChecked(id StateID) (State, error) {
+	if id < 0 || int(id) >= s.TotalLen {
+		return nil, fmt.Errorf("state id %d out of range [0, %d)", id, s.TotalLen)
+	}
+	return s.Decode(id), nil
+}
+
+// DecodeInto unpacks a StateID into st, which must have one slot per
+// variable, and returns it. Hot loops use it to avoid allocating.
+func (s *Schema) DecodeInto(id StateID, st State) State {
 	rem := int(id)
 	for i := range s.Vars {
 		st[i] = rem / s.Strides[i]
@@ -121,3 +244,98 @@ func (s *Schema) EnumIndex(varIdx int, value string) int {
 	}
 	return -1
 }
+
+// Canonical returns a copy of r whose enum values are sorted by byte-wise
+// string order and, if sortVars is set, whose variables are sorted by name
+// the same way. Registries that differ only in declaration order then get
+// identical schemas and StateIDs. Expressions and initial values refer to
+// enum literals by name, so the copy is equivalent to r.
+//
+// A literal shared by several enums must have the same position in each,
+// and ordered enums keep their declared order, which gives <, <=, > and >=
+// their meaning. Enums linked by shared literals, directly or through
+// other enums, are therefore sorted together: if sorting each of them
+// (ordered ones excepted) would give a shared literal different positions,
+// all of them keep their declared order.
+func (r *Registry) Canonical(sortVars bool) *Registry {
+	out := *r
+	out.Vars = append([]VarDef(nil), r.Vars...)
+	for _, group := range enumGroups(out.Vars) {
+		sorted := make([][]string, len(group))
+		for k, i := range group {
+			sorted[k] = out.Vars[i].Values
+			if !out.Vars[i].Ordered {
+				sorted[k] = append([]string(nil), sorted[k]...)
+				sort.Strings(sorted[k])
+			}
+		}
+		if !samePositions(sorted) {
+			continue
+		}
+		for k, i := range group {
+			out.Vars[i].Values = sorted[k]
+		}
+	}
+	if sortVars {
+		sort.SliceStable(out.Vars, func(i, j int) bool { return out.Vars[i].Name < out.Vars[j].Name })
+	}
+	return &out
+}
+
+// enumGroups partitions the enum variables of vars, as indices, into
+// groups connected by shared literals, each in declaration order.
+func enumGroups(vars []VarDef) [][]int {
+	parent := make([]int, len(vars))
+	find := func(i int) int {
+		for parent[i] != i {
+			parent[i] = parent[parent[i]]
+			i = parent[i]
+		}
+		return i
+	}
+	first := make(map[string]int) // literal -> first enum declaring it
+	for i, v := range vars {
+		parent[i] = i
+		if v.Type != TypeEnum {
+			continue
+		}
+		for _, lit := range v.Values {
+			if j, ok := first[lit]; ok {
+				parent[find(i)] = find(j)
+			} else {
+				first[lit] = i
+			}
+		}
+	}
+	var groups [][]int
+	index := make(map[int]int) // root -> position in groups
+	for i, v := range vars {
+		if v.Type != TypeEnum {
+			continue
+		}
+		root := find(i)
+		k, ok := index[root]
+		if !ok {
+			k = len(groups)
+			index[root] = k
+			groups = append(groups, nil)
+		}
+		groups[k] = append(groups[k], i)
+	}
+	return groups
+}
+
+// samePositions reports whether every literal appearing in several of the
+// value lists has the same position in each.
+func samePositions(lists [][]string) bool {
+	pos := make(map[string]int)
+	for _, values := range lists {
+		for i, lit := range values {
+			if p, ok := pos[lit]; ok && p != i {
+				return false
+			}
+			pos[lit] = i
+		}
+	}
+	return true
+}
@@ -0,0 +1,219 @@
+package registry
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCanonicalKeepsOrderedEnums(t *testing.T) {
+	reg := &Registry{Vars: []VarDef{
+		{Name: "sev", Type: TypeEnum, Values: []string{"low", "medium", "high"}, Ordered: true, Size: 3},
+		{Name: "peak", Type: TypeEnum, Values: []string{"low", "medium", "high"}, Size: 3},
+		{Name: "mode", Type: TypeEnum, Values: []string{"run", "idle"}, Size: 2},
+	}}
+	got := reg.Canonical(true)
+	want := map[string][]string{
+		"sev":  {"low", "medium", "high"}, // ordered
+		"peak": {"low", "medium", "high"}, // shares literals with sev
+		"mode": {"idle", "run"},
+	}
+	for _, v := range got.Vars {
+		if !reflect.DeepEqual(v.Values, want[v.Name]) {
+			t.Errorf("%s values = %v, want %v", v.Name, v.Values, want[v.Name])
+		}
+	}
+	if reg.Vars[2].Values[0] != "run" {
+		t.Errorf("Canonical modified the original: %v", reg.Vars[2].Values)
+	}
+}
+
+func TestCanonicalSharedLiterals(t *testing.T) {
+	enum := func(name string, ordered bool, values ...string) VarDef {
+		return VarDef{Name: name, Type: TypeEnum, Values: values, Ordered: ordered, Size: len(values)}
+	}
+	tests := []struct {
+		name string
+		vars []VarDef
+		want [][]string // values of each var after Canonical(false)
+	}{
+		{"partial overlap", []VarDef{
+			enum("a", false, "p", "q"),
+			enum("b", false, "p", "q", "aa"),
+		}, [][]string{{"p", "q"}, {"p", "q", "aa"}}},
+		{"same list", []VarDef{
+			enum("a", false, "q", "p"),
+			enum("b", false, "q", "p"),
+		}, [][]string{{"p", "q"}, {"p", "q"}}},
+		{"overlap that sorts consistently", []VarDef{
+			enum("a", false, "q", "p"),
+			enum("b", false, "z", "q", "p"),
+		}, [][]string{{"p", "q"}, {"p", "q", "z"}}},
+		// a and b sort consistently, but b and c do not, so a stays
+		// declared too.
+		{"transitive", []VarDef{
+			enum("a", false, "q", "p"),
+			enum("b", false, "q", "p", "zz"),
+			enum("c", false, "m", "n", "zz", "a"),
+			enum("d", false, "y", "x"),
+		}, [][]string{{"q", "p"}, {"q", "p", "zz"}, {"m", "n", "zz", "a"}, {"x", "y"}}},
+		{"linked to an ordered enum", []VarDef{
+			enum("o", true, "low", "high"),
+			enum("b", false, "low", "high", "mid"),
+			enum("c", false, "x", "y", "mid"),
+		}, [][]string{{"low", "high"}, {"low", "high", "mid"}, {"x", "y", "mid"}}},
+	}
+	for _, tt := range tests {
+		reg := &Registry{Vars: tt.vars}
+		got := reg.Canonical(false)
+		for i, v := range got.Vars {
+			if !reflect.DeepEqual(v.Values, tt.want[i]) {
+				t.Errorf("%s: %s values = %v, want %v", tt.name, v.Name, v.Values, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestDecodeIntoMatchesDecode(t *testing.T) {
+	s := testSchema()
+	buf := make(State, len(s.Vars))
+	for id := StateID(0); int(id) < s.TotalLen; id++ {
+		want := s.Decode(id)
+		got := s.DecodeInto(id, buf)
+		if !got.Equal(want) {
+			t.Fatalf("DecodeInto(%d) = %v, want %v", id, got, want)
+		}
+		if &got[0] != &buf[0] {
+			t.Fatalf("DecodeInto(%d) did not decode into the given state", id)
+		}
+		if s.Encode(got) != id {
+			t.Fatalf("Encode(DecodeInto(%d)) = %d", id, s.Encode(got))
+		}
+	}
+}
+
+func TestDecodeChecked(t *testing.T) {
+	s := testSchema() // 16 states
+	tests := []struct {
+		id      StateID
+		want    State
+		wantErr string
+	}{
+		{0, State{0, 0, 0}, ""},
+		{1, State{0, 0, 1}, ""},
+		{15, State{3, 1, 1}, ""},
+		{-1, nil, "state id -1 out of range [0, 16)"},
+		{16, nil, "state id 16 out of range [0, 16)"},
+		{-17, nil, "state id -17 out of range [0, 16)"},
+	}
+	for _, tt := range tests {
+		got, err := s.DecodeChecked(tt.id)
+		switch {
+		case tt.wantErr != "":
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("DecodeChecked(%d): error %v, want %q", tt.id, err, tt.wantErr)
+			}
+		case err != nil:
+			t.Errorf("DecodeChecked(%d): %v", tt.id, err)
+		case !got.Equal(tt.want) || !got.Equal(s.Decode(tt.id)):
+			t.Errorf("DecodeChecked(%d) = %v, want %v", tt.id, got, tt.want)
+		}
+	}
+}
+
+// cloneYAML fills every part of a Registry that Clone copies.
+const cloneYAML = `
+registry:
+  name: clone
+  constants: {cap: 3}
+  states:
+    n: {type: int, range: [0, cap]}
+    mode: {type: enum, values: [idle, run]}
+  initial: {n: 0, mode: idle}
+  invariants:
+    small: {expr: "n < cap"}
+  compensation:
+    - invariant: small
+      repair: {n: 0}
+  events:
+    set:
+      params:
+        m: {type: enum, values: [idle, run]}
+      effect: {mode: "m"}
+`
+
+func TestClone(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(r *Registry)
+	}{
+		{"name", func(r *Registry) { r.Name = "other" }},
+		{"constant", func(r *Registry) { r.Constants["cap"] = 9 }},
+		{"initial", func(r *Registry) { r.Initial["n"] = 2 }},
+		{"variable", func(r *Registry) { r.Vars[0].Max = 9 }},
+		{"enum value", func(r *Registry) { r.Vars[1].Values[0] = "stopped" }},
+		{"added variable", func(r *Registry) { r.Vars = append(r.Vars[:1], VarDef{Name: "x"}) }},
+		{"invariant", func(r *Registry) { r.Invariants[0].Expr = "false" }},
+		{"repair", func(r *Registry) { r.Compensation[0].Assignments["n"] = "1" }},
+		{"event", func(r *Registry) { r.Events[0].Guard = "false" }},
+		{"effect", func(r *Registry) { r.Events[0].Assignments["mode"] = "run" }},
+		{"parameter", func(r *Registry) { r.Events[0].Params[0].Values[1] = "fast" }},
+	}
+	for _, tt := range tests {
+		orig, err := Parse([]byte(cloneYAML))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pristine, err := Parse([]byte(cloneYAML))
+		if err != nil {
+			t.Fatal(err)
+		}
+		clone := orig.Clone()
+		if !reflect.DeepEqual(clone, orig) {
+			t.Fatalf("Clone() = %+v, want %+v", clone, orig)
+		}
+		tt.mutate(clone)
+		if !reflect.DeepEqual(orig, pristine) {
+			t.Errorf("changing the clone's %s changed the original", tt.name)
+		}
+	}
+}
+
+func TestStateEqual(t *testing.T) {
+	tests := []struct {
+		s, o State
+		want bool
+	}{
+		{State{1, 0, 3}, State{1, 0, 3}, true},
+		{State{}, State{}, true},
+		{nil, State{}, true},
+		{State{1, 0, 3}, State{1, 0, 2}, false},
+		{State{1, 0, 3}, State{3, 0, 1}, false},
+		{State{1, 0}, State{1, 0, 3}, false},
+		{State{0}, nil, false},
+	}
+	for _, tt := range tests {
+		if got := tt.s.Equal(tt.o); got != tt.want {
+			t.Errorf("%v.Equal(%v) = %v, want %v", tt.s, tt.o, got, tt.want)
+		}
+		if got := tt.o.Equal(tt.s); got != tt.want {
+			t.Errorf("%v.Equal(%v) = %v, want %v", tt.o, tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestStateString(t *testing.T) {
+	tests := []struct {
+		s    State
+		want string
+	}{
+		{State{1, 0, 3}, "{0=1, 1=0, 2=3}"},
+		{State{7}, "{0=7}"},
+		{State{}, "{}"},
+		{nil, "{}"},
+	}
+	for _, tt := range tests {
+		if got := tt.s.String(); got != tt.want {
+			t.Errorf("String() = %q, want %q", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package registry
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Severity grades a Diagnostic.
+type Severity int
+
+const (
+	// SeverityError marks a problem that prevents checking the registry.
+	SeverityError Severity = iota
+	// SeverityWarning marks a likely mistake that does not.
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	if s == SeverityError {
+		return "error"
+	}
+	return "warning"
+}
+
+// Diagnostic is one finding of Validate. Field locates it in the YAML,
+// e.g. "states.x" or "compensation[1].invariant".
+type Diagnostic struct {
+	Severity Severity
+	Field    string
+	Message  string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s: %s", d.Severity, d.Field, d.Message)
+}
+
+// identPattern matches identifiers in expression source. Validate does not
+// parse expressions (that is the compiler's job), so this over-approximates
+// references: an identifier inside a string literal also counts.
+var identPattern = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_]*`)
+
+// Validate runs cheap structural checks over the whole registry and returns
+// every problem found, in declaration order, rather than stopping at the
+// first. It does not parse or type-check expressions. A registry with no
+// SeverityError diagnostics may still fail to compile.
+func (r *Registry) Validate() []Diagnostic {
+	var diags []Diagnostic
+	add := func(sev Severity, field, format string, args ...interface{}) {
+		diags = append(diags, Diagnostic{sev, field, fmt.Sprintf(format, args...)})
+	}
+
+	vars := make(map[string]bool, len(r.Vars))
+	for _, v := range r.Vars {
+		vars[v.Name] = true
+	}
+	for _, v := range r.Vars {
+		field := "states." + v.Name
+		if err := CheckVarDef(v); err != nil {
+			add(SeverityError, field, "%v", err)
+		}
+		seen := make(map[string]bool, len(v.Values))
+		for _, lit := range v.Values {
+			if seen[lit] {
+				add(SeverityError, field, "enum value %q listed twice", lit)
+			}
+			seen[lit] = true
+			if vars[lit] {
+				add(SeverityError, field, "enum value %q is also a variable name", lit)
+			}
+		}
+	}
+
+	invariants := make(map[string]bool, len(r.Invariants))
+	for _, inv := range r.Invariants {
+		invariants[inv.Name] = true
+		if inv.Expr == "" {
+			add(SeverityError, "invariants."+inv.Name, "missing expr")
+		}
+	}
+
+	checkTargets := func(field string, assignments map[string]string) {
+		for _, target := range sortedKeys(assignments) {
+			if !vars[target] {
+				add(SeverityError, field+"."+target, "assigns unknown variable %q", target)
+			}
+		}
+	}
+	repaired := make(map[string]bool)
+	for i, rep := range r.Compensation {
+		field := fmt.Sprintf("compensation[%d]", i)
+		switch {
+		case rep.Invariant == "":
+			add(SeverityError, field+".invariant", "missing invariant name")
+		case !invariants[rep.Invariant]:
+			add(SeverityError, field+".invariant", "no invariant named %q", rep.Invariant)
+		}
+		repaired[rep.Invariant] = true
+		if len(rep.Assignments) == 0 {
+			add(SeverityWarning, field+".repair", "repair assigns nothing")
+		}
+		checkTargets(field+".repair", rep.Assignments)
+	}
+	for _, inv := range r.Invariants {
+		if !repaired[inv.Name] {
+			add(SeverityWarning, "invariants."+inv.Name, "no repair in compensation; checking fails if it is ever violated")
+		}
+	}
+
+	for _, evt := range r.Events {
+		field := "events." + evt.Name
+		for _, p := range evt.Params {
+			if vars[p.Name] {
+				add(SeverityError, field+".params."+p.Name, "parameter shadows state variable %q", p.Name)
+			}
+		}
+		checkTargets(field+".effect", evt.Assignments)
+		checkParamDomains(field, evt, r.Vars, add)
+	}
+
+	for _, v := range r.Vars {
+		if _, ok := r.Initial[v.Name]; !ok && len(r.Initial) > 0 {
+			add(SeverityWarning, "initial."+v.Name, "no initial value")
+		}
+	}
+	for _, name := range sortedKeys(r.Initial) {
+		if !vars[name] {
+			add(SeverityError, "initial."+name, "unknown variable %q", name)
+		}
+	}
+
+	used := make(map[string]bool)
+	mark := func(src string) {
+		for _, id := range identPattern.FindAllString(src, -1) {
+			used[id] = true
+		}
+	}
+	for _, inv := range r.Invariants {
+		mark(inv.Expr)
+	}
+	for _, rep := range r.Compensation {
+		for target, src := range rep.Assignments {
+			used[target] = true
+			mark(src)
+		}
+	}
+	for _, evt := range r.Events {
+		mark(evt.Guard)
+		for target, src := range evt.Assignments {
+			used[target] = true
+			mark(src)
+		}
+	}
+	for _, v := range r.Vars {
+		if !used[v.Name] {
+			add(SeverityWarning, "states."+v.Name, "never read or written; it only multiplies the state space")
+		}
+	}
+	return diags
+}
+
+// sortedKeys returns the keys of m in sorted order, for deterministic
+// diagnostics.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// checkParamDomains reports effects that assign an enum parameter directly
+// to an enum variable lacking some of the parameter's values, since those
+// transitions would produce a value the variable cannot hold.
+func checkParamDomains(field string, evt Event, vars []VarDef, add func(Severity, string, string, ...interface{})) {
+	for _, target := range sortedKeys(evt.Assignments) {
+		src := strings.TrimSpace(evt.Assignments[target])
+		for _, p := range evt.Params {
+			if p.Name != src || p.Type != TypeEnum {
+				continue
+			}
+			for _, v := range vars {
+				if v.Name != target || v.Type != TypeEnum {
+					continue
+				}
+				for _, lit := range p.Values {
+					if !containsValue(v.Values, lit) {
+						add(SeverityError, field+".effect."+target,
+							"parameter %q takes value %q, which is not a value of enum %q", p.Name, lit, target)
+					}
+				}
+			}
+		}
+	}
+}
+
+func containsValue(values []string, lit string) bool {
+	for _, v := range values {
+		if v == lit {
+			return true
+		}
+	}
+	return false
+}
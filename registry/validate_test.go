@@ -0,0 +1,125 @@
+package registry
+
+import (
+	"strings"
+	"testing"
+)
+
+// malformedYAML has several independent structural problems.
+const malformedYAML = `
+registry:
+  name: bad
+  states:
+    mode: {type: enum, values: []}
+    n: {type: int, range: [3, 1]}
+    kind: {type: enum, values: [a, b, a, n]}
+    spare: {type: bool}
+    ok: {type: bool}
+  initial: {ok: false, ghost: 1}
+  invariants:
+    pos: {expr: "n >= 0"}
+    check: {expr: "ok or kind == a"}
+  compensation:
+    - invariant: pos
+      repair: {n: 0}
+    - invariant: missing
+      repair: {}
+  events:
+    set:
+      params:
+        ok: {type: bool}
+      effect: {ok: "ok", nope: 1}
+`
+
+func TestValidate(t *testing.T) {
+	if _, err := Parse([]byte(malformedYAML)); err == nil {
+		t.Fatal("Parse accepted the malformed registry")
+	}
+	reg, diags, err := ParseLenient([]byte(malformedYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	diags = append(diags, reg.Validate()...)
+	want := []string{
+		`error: states.mode: enum "mode" has no values`,
+		`error: states.n: int "n" has empty range [3, 1]`,
+		`error: states.kind: enum value "a" listed twice`,
+		`error: states.kind: enum value "n" is also a variable name`,
+		`error: compensation[1].invariant: no invariant named "missing"`,
+		`warning: compensation[1].repair: repair assigns nothing`,
+		`warning: invariants.check: no repair in compensation; checking fails if it is ever violated`,
+		`error: events.set.params.ok: parameter shadows state variable "ok"`,
+		`error: events.set.effect.nope: assigns unknown variable "nope"`,
+		`warning: initial.mode: no initial value`,
+		`warning: initial.n: no initial value`,
+		`warning: initial.kind: no initial value`,
+		`warning: initial.spare: no initial value`,
+		`error: initial.ghost: unknown variable "ghost"`,
+		`warning: states.mode: never read or written; it only multiplies the state space`,
+		`warning: states.spare: never read or written; it only multiplies the state space`,
+	}
+	got := make([]string, len(diags))
+	for i, d := range diags {
+		got[i] = d.String()
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("diagnostics:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	clean, err := Parse([]byte(flagsYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diags := clean.Validate(); len(diags) != 0 {
+		t.Errorf("flagsYAML: unexpected diagnostics %v", diags)
+	}
+}
+
+func TestValidateParamDomains(t *testing.T) {
+	const tmpl = `
+registry:
+  name: status
+  states:
+    status: {type: enum, values: [draft, review]}
+    stage: {type: enum, values: [draft, review, live]}
+  initial: {status: draft, stage: draft}
+  invariants:
+    any: {expr: "status == draft or stage != live"}
+  compensation:
+    - invariant: any
+      repair: {stage: "draft"}
+  events:
+    set:
+      params:
+        s: {type: enum, values: VALUES}
+      effect: {EFFECT}
+`
+	tests := []struct {
+		values, effect string
+		want           []string
+	}{
+		{"[draft, review]", `status: "s"`, nil},
+		{"[draft, review, live]", `stage: "s"`, nil},
+		{"[draft, review, live]", `status: " s "`, []string{
+			`error: events.set.effect.status: parameter "s" takes value "live", which is not a value of enum "status"`,
+		}},
+		{"[live]", `status: "s", stage: "s"`, []string{
+			`error: events.set.effect.status: parameter "s" takes value "live", which is not a value of enum "status"`,
+		}},
+		{"[draft, review, live]", `status: "if s == live then draft else review"`, nil}, // not a plain copy
+	}
+	for _, tt := range tests {
+		src := strings.NewReplacer("VALUES", tt.values, "EFFECT", tt.effect).Replace(tmpl)
+		reg, err := Parse([]byte(src))
+		if err != nil {
+			t.Fatalf("values %s, effect {%s}: %v", tt.values, tt.effect, err)
+		}
+		var got []string
+		for _, d := range reg.Validate() {
+			got = append(got, d.String())
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("values %s, effect {%s}: diagnostics %q, want %q", tt.values, tt.effect, got, tt.want)
+		}
+	}
+}
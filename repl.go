@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/blackwell-systems/nccheck/expr"
+	"github.com/blackwell-systems/nccheck/registry"
+	"github.com/blackwell-systems/nccheck/verify"
+)
+
+const replHelp = `Commands:
+  :state name=value, ...   set the current state (all variables)
+  :show                     print the current state
+  :help                     show this help
+  :quit                     exit
+Anything else is evaluated as an expression in the current state.`
+
+// repl evaluates expressions against a chosen state of a compiled registry.
+type repl struct {
+	cr    *verify.CompiledRegistry
+	state registry.State // nil until a state has been set
+}
+
+// prompt returns the prompt for the next line of input.
+func (r *repl) prompt() string {
+	if r.state == nil {
+		return "state> "
+	}
+	return "expr> "
+}
+
+// handle processes one line of input, returning the text to print and
+// whether the session should end. Until a state is set, bare input is
+// parsed as a state rather than an expression.
+func (r *repl) handle(line string) (string, bool) {
+	line = strings.TrimSpace(line)
+	switch {
+	case line == "":
+		return "", false
+	case line == ":quit" || line == ":q":
+		return "", true
+	case line == ":help":
+		return replHelp, false
+	case line == ":show":
+		if r.state == nil {
+			return "no state set", false
+		}
+		return r.cr.FormatState(r.state), false
+	case strings.HasPrefix(line, ":state"):
+		return r.setState(strings.TrimPrefix(line, ":state")), false
+	case strings.HasPrefix(line, ":"):
+		return fmt.Sprintf("unknown command %q (try :help)", line), false
+	case r.state == nil:
+		return r.setState(line), false
+	}
+
+	v, t, err := r.cr.Eval(line, r.state)
+	if err != nil {
+		return "error: " + err.Error(), false
+	}
+	return formatValue(v, t), false
+}
+
+func (r *repl) setState(spec string) string {
+	st, err := r.cr.Schema.ParseState(spec)
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	r.state = st
+	return r.cr.FormatState(st)
+}
+
+// formatValue renders a value using its static type, so enum values print
+// as their literal names.
+func formatValue(v expr.Value, t expr.Type) string {
+	switch {
+	case v.IsBool:
+		return strconv.FormatBool(v.Bool)
+	case v.IsString:
+		return strconv.Quote(v.Str)
+	case t.Kind == expr.KindEnum && v.Int >= 0 && v.Int < len(t.Domain) && t.Exact:
+		return t.Domain[v.Int]
+	case t.Kind == expr.KindEnum && t.Literal:
+		return t.Name
+	}
+	return strconv.Itoa(v.Int)
+}
+
+// runREPL reads lines from in until EOF or :quit, writing prompts and
+// results to out.
+func runREPL(cr *verify.CompiledRegistry, in io.Reader, out io.Writer) error {
+	r := &repl{cr: cr}
+	fmt.Fprintf(out, "nccheck REPL — %s (:help for commands)\n", cr.Reg.Name)
+	fmt.Fprintf(out, "Enter a state as name=value pairs.\n")
+
+	sc := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(out, r.prompt())
+		if !sc.Scan() {
+			fmt.Fprintln(out)
+			return sc.Err()
+		}
+		text, quit := r.handle(sc.Text())
+		if text != "" {
+			fmt.Fprintln(out, text)
+		}
+		if quit {
+			return nil
+		}
+	}
+}
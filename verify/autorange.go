@@ -0,0 +1,134 @@
+package verify
+
+import (
+	"fmt"
+
+	"github.com/blackwell-systems/nccheck/expr"
+	"github.com/blackwell-systems/nccheck/registry"
+)
+
+// MaxAutoRange caps the number of values an inferred int range may have.
+const MaxAutoRange = 1 << 12
+
+// inferAutoRanges resolves int variables declared with range [min, auto].
+// The max becomes the largest integer literal the variable is compared
+// against or assigned anywhere in the spec (one more for a strict "x > c",
+// so that the comparison can hold). reg is not modified; if any range was
+// inferred a copy with the resolved variables is returned.
+func inferAutoRanges(reg *registry.Registry) (*registry.Registry, error) {
+	auto := make(map[string]int) // var name -> index into reg.Vars
+	for i, v := range reg.Vars {
+		if v.AutoMax {
+			auto[v.Name] = i
+		}
+	}
+	if len(auto) == 0 {
+		return reg, nil
+	}
+
+	bound := make(map[string]int)
+	note := func(name string, c int) {
+		if _, ok := auto[name]; !ok {
+			return
+		}
+		if b, seen := bound[name]; !seen || c > b {
+			bound[name] = c
+		}
+	}
+	scan := func(src string) error {
+		node, err := parseWithConstants(src, reg.Constants)
+		if err != nil {
+			return fmt.Errorf("expression %q: %w", src, err)
+		}
+		expr.Walk(node, func(n *expr.Node) {
+			if len(n.Children) != 2 {
+				return
+			}
+			l, r := n.Children[0], n.Children[1]
+			op := n.Type
+			if l.Type == expr.NodeLitInt && r.Type == expr.NodeVar {
+				l, r, op = r, l, mirror(op)
+			}
+			if l.Type != expr.NodeVar || r.Type != expr.NodeLitInt {
+				return
+			}
+			switch op {
+			case expr.NodeGt:
+				note(l.Name, r.IntVal+1)
+			case expr.NodeEq, expr.NodeNeq, expr.NodeLt, expr.NodeLe, expr.NodeGe:
+				note(l.Name, r.IntVal)
+			}
+		})
+		return nil
+	}
+	assign := func(target, src string) error {
+		if err := scan(src); err != nil {
+			return err
+		}
+		if node, _ := parseWithConstants(src, reg.Constants); node.Type == expr.NodeLitInt {
+			note(target, node.IntVal)
+		}
+		return nil
+	}
+
+	for _, inv := range reg.Invariants {
+		if err := scan(inv.Expr); err != nil {
+			return nil, fmt.Errorf("invariant %q: %w", inv.Name, err)
+		}
+	}
+	for _, rep := range reg.Compensation {
+		for target, src := range rep.Assignments {
+			if err := assign(target, src); err != nil {
+				return nil, fmt.Errorf("repair for %q: %w", rep.Invariant, err)
+			}
+		}
+	}
+	for _, evt := range reg.Events {
+		if evt.Guard != "" {
+			if err := scan(evt.Guard); err != nil {
+				return nil, fmt.Errorf("event %q guard: %w", evt.Name, err)
+			}
+		}
+		for target, src := range evt.Assignments {
+			if err := assign(target, src); err != nil {
+				return nil, fmt.Errorf("event %q: %w", evt.Name, err)
+			}
+		}
+	}
+
+	out := *reg
+	out.Vars = append([]registry.VarDef(nil), reg.Vars...)
+	for name, i := range auto {
+		v := &out.Vars[i]
+		max, ok := bound[name]
+		if !ok {
+			return nil, fmt.Errorf("int %q: cannot infer range max: it is never compared with or assigned an integer literal", name)
+		}
+		if max < v.Min {
+			return nil, fmt.Errorf("int %q: inferred range max %d is below min %d", name, max, v.Min)
+		}
+		if size := max - v.Min + 1; size > MaxAutoRange {
+			return nil, fmt.Errorf("int %q: inferred range [%d, %d] has %d values, over the auto limit of %d; set max explicitly",
+				name, v.Min, max, size, MaxAutoRange)
+		}
+		v.Max = max
+		v.Size = max - v.Min + 1
+		v.AutoMax = false
+	}
+	return &out, nil
+}
+
+// mirror returns the comparison equivalent to op with its operands swapped.
+func mirror(op expr.NodeType) expr.NodeType {
+	switch op {
+	case expr.NodeLt:
+		return expr.NodeGt
+	case expr.NodeLe:
+		return expr.NodeGe
+	case expr.NodeGt:
+		return expr.NodeLt
+	case expr.NodeGe:
+		return expr.NodeLe
+	}
+	return op
+}
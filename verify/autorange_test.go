@@ -0,0 +1,61 @@
+package verify
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestAutoRange(t *testing.T) {
+	const tmpl = `
+registry:
+  name: auto
+  constants: {LIMIT: 6}
+  states:
+    x: {type: int, range: [%d, auto]}
+  initial: {x: %[1]d}
+  invariants:
+    bound: {expr: "%[2]s"}
+  compensation:
+    - invariant: bound
+      repair: {x: "x - 1"}
+  events:
+    inc:
+      effect: {x: "%[3]s"}
+`
+	tests := []struct {
+		min         int
+		inv, effect string
+		wantMax     int
+		wantErr     string
+	}{
+		{0, "x <= 7", "x + 1", 7, ""},
+		{0, "x < 4", "x + 1", 4, ""},
+		{0, "x > 5 or x == 0", "x + 1", 6, ""},
+		{0, "9 >= x", "x + 1", 9, ""},
+		{0, "x <= LIMIT", "x + 1", 6, ""},
+		{0, "x <= 3", "10", 10, ""},
+		{2, "x != 2 and x <= 5", "x + 1", 5, ""},
+		{0, "x + 1 <= 3", "x + 1", 0, `int "x": cannot infer range max`},
+		{0, "x <= 5000", "x + 1", 0, `int "x": inferred range [0, 5000] has 5001 values, over the auto limit of 4096`},
+		{5, "x <= 2", "x + 1", 0, `int "x": inferred range max 2 is below min 5`},
+	}
+	for _, tt := range tests {
+		src := fmt.Sprintf(tmpl, tt.min, tt.inv, tt.effect)
+		if tt.wantErr != "" {
+			if err := compileErr(t, src, Options{}); !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: error %q, want it to contain %q", tt.inv, err, tt.wantErr)
+			}
+			continue
+		}
+		cr := compileYAML(t, src, Options{})
+		v := cr.Schema.Vars[0]
+		if v.Min != tt.min || v.Max != tt.wantMax || v.Size != tt.wantMax-tt.min+1 || v.AutoMax {
+			t.Errorf("%s: x has range [%d, %d] (size %d, auto %v), want [%d, %d]",
+				tt.inv, v.Min, v.Max, v.Size, v.AutoMax, tt.min, tt.wantMax)
+		}
+		if rv := cr.Reg.Vars[0]; rv.AutoMax || rv.Max != tt.wantMax {
+			t.Errorf("%s: compiled registry has max %d (auto %v), want %d", tt.inv, rv.Max, rv.AutoMax, tt.wantMax)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package verify
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/blackwell-systems/nccheck/registry"
+)
+
+// Valid bitmap file layout, all integers little-endian:
+//
+//	magic       4 bytes  "NCVB"
+//	version     uint32   1
+//	total       uint64   number of states (Schema.TotalLen)
+//	fingerprint 32 bytes SchemaFingerprint of the schema
+//	bits        (total+7)/8 bytes; state s is bit s%8 (LSB first) of byte s/8
+var bitmapMagic = [4]byte{'N', 'C', 'V', 'B'}
+
+const bitmapVersion = 1
+
+// ValidBitmap is the set of valid states as read by ReadValidBitmap.
+type ValidBitmap struct {
+	TotalLen    int
+	Fingerprint [32]byte
+	Bits        []byte
+}
+
+// Valid reports whether state sid is in the set.
+func (b *ValidBitmap) Valid(sid registry.StateID) bool {
+	return b.Bits[sid/8]&(1<<(uint(sid)%8)) != 0
+}
+
+// SchemaFingerprint digests the variable declarations that determine
+// StateIDs, so a bitmap can be matched to the schema it was written for.
+func SchemaFingerprint(schema *registry.Schema) ([32]byte, error) {
+	data, err := json.Marshal(schema.Vars)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	return sha256.Sum256(data), nil
+}
+
+// WriteValidBitmap writes the Valid table to w in the valid bitmap format.
+// BuildTables must have been called.
+func (cr *CompiledRegistry) WriteValidBitmap(w io.Writer) error {
+	fp, err := SchemaFingerprint(&cr.Schema)
+	if err != nil {
+		return err
+	}
+	var hdr bytes.Buffer
+	hdr.Write(bitmapMagic[:])
+	binary.Write(&hdr, binary.LittleEndian, uint32(bitmapVersion))
+	binary.Write(&hdr, binary.LittleEndian, uint64(cr.Schema.TotalLen))
+	hdr.Write(fp[:])
+	if _, err := w.Write(hdr.Bytes()); err != nil {
+		return err
+	}
+
+	bits := make([]byte, (cr.Schema.TotalLen+7)/8)
+	for sid, valid := range cr.Valid {
+		if valid {
+			bits[sid/8] |= 1 << (uint(sid) % 8)
+		}
+	}
+	_, err = w.Write(bits)
+	return err
+}
+
+// ReadValidBitmap reads a bitmap written by WriteValidBitmap. Compare its
+// Fingerprint with SchemaFingerprint before trusting its StateIDs.
+func ReadValidBitmap(r io.Reader) (*ValidBitmap, error) {
+	var hdr struct {
+		Magic       [4]byte
+		Version     uint32
+		Total       uint64
+		Fingerprint [32]byte
+	}
+	if err := binary.Read(r, binary.LittleEndian, &hdr); err != nil {
+		return nil, fmt.Errorf("valid bitmap header: %w", err)
+	}
+	if hdr.Magic != bitmapMagic {
+		return nil, fmt.Errorf("not a valid bitmap (magic %q)", hdr.Magic[:])
+	}
+	if hdr.Version != bitmapVersion {
+		return nil, fmt.Errorf("unsupported valid bitmap version %d", hdr.Version)
+	}
+	if hdr.Total > uint64(MaxStates)*1024 {
+		return nil, fmt.Errorf("valid bitmap claims %d states", hdr.Total)
+	}
+	b := &ValidBitmap{TotalLen: int(hdr.Total), Fingerprint: hdr.Fingerprint}
+	b.Bits = make([]byte, (b.TotalLen+7)/8)
+	if _, err := io.ReadFull(r, b.Bits); err != nil {
+		return nil, fmt.Errorf("valid bitmap body: %w", err)
+	}
+	return b, nil
+}
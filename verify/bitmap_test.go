@@ -0,0 +1,78 @@
+package verify
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/blackwell-systems/nccheck/registry"
+)
+
+func TestValidBitmapRoundTrip(t *testing.T) {
+	for _, name := range exampleNames {
+		cr := compileExample(t, name, Options{})
+		var buf bytes.Buffer
+		if err := cr.WriteValidBitmap(&buf); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if want := 48 + (cr.Schema.TotalLen+7)/8; buf.Len() != want {
+			t.Errorf("%s: %d bytes, want %d", name, buf.Len(), want)
+		}
+		b, err := ReadValidBitmap(&buf)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		fp, err := SchemaFingerprint(&cr.Schema)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.TotalLen != cr.Schema.TotalLen || b.Fingerprint != fp {
+			t.Errorf("%s: header %d states, fingerprint %x; want %d, %x", name, b.TotalLen, b.Fingerprint, cr.Schema.TotalLen, fp)
+		}
+		for sid, valid := range cr.Valid {
+			if b.Valid(registry.StateID(sid)) != valid {
+				t.Errorf("%s: state %d valid %v in the bitmap, %v in the table", name, sid, !valid, valid)
+			}
+		}
+	}
+}
+
+func TestReadValidBitmapErrors(t *testing.T) {
+	cr := compileExample(t, "wallet.yaml", Options{})
+	var buf bytes.Buffer
+	if err := cr.WriteValidBitmap(&buf); err != nil {
+		t.Fatal(err)
+	}
+	good := buf.Bytes()
+	with := func(off int, b ...byte) []byte {
+		data := append([]byte(nil), good...)
+		copy(data[off:], b)
+		return data
+	}
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr string
+	}{
+		{"empty", nil, "valid bitmap header: EOF"},
+		{"short header", good[:20], "valid bitmap header: unexpected EOF"},
+		{"magic", with(0, 'X'), `not a valid bitmap (magic "XCVB")`},
+		{"version", with(4, 2), "unsupported valid bitmap version 2"},
+		{"huge", with(8, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f), "valid bitmap claims"},
+		{"short body", good[:len(good)-1], "valid bitmap body: unexpected EOF"},
+	}
+	for _, tt := range tests {
+		_, err := ReadValidBitmap(bytes.NewReader(tt.data))
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: error %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+
+	// A different schema has a different fingerprint.
+	other := compileExample(t, "counters.yaml", Options{})
+	fp1, _ := SchemaFingerprint(&cr.Schema)
+	fp2, _ := SchemaFingerprint(&other.Schema)
+	if fp1 == fp2 {
+		t.Error("wallet and counters have the same schema fingerprint")
+	}
+}
@@ -0,0 +1,118 @@
+package verify
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/blackwell-systems/nccheck/expr"
+	"github.com/blackwell-systems/nccheck/registry"
+)
+
+// Cache reuses the structure-dependent part of compilation (parsing,
+// type checking and parameter expansion) across compiles of identical
+// registries. Table building is state-dependent and is never cached: each
+// compile returns a CompiledRegistry with empty tables.
+//
+// A Cache is safe for concurrent use; the CompiledRegistry values it
+// returns are not.
+type Cache struct {
+	mu      sync.Mutex
+	entries map[string]*CompiledRegistry
+	hits    int
+	misses  int
+}
+
+// NewCache returns an empty compile cache.
+func NewCache() *Cache {
+	return &Cache{entries: make(map[string]*CompiledRegistry)}
+}
+
+// Compile returns a compiled form of reg, parsing its expressions only if
+// no registry with the same fingerprint has been compiled before.
+func (c *Cache) Compile(reg *registry.Registry, opts Options) (*CompiledRegistry, error) {
+	fp, err := Fingerprint(reg)
+	if err != nil {
+		return nil, err
+	}
+	fp += compileKey(opts)
+
+	c.mu.Lock()
+	base, ok := c.entries[fp]
+	if ok {
+		c.hits++
+	} else {
+		c.misses++
+	}
+	c.mu.Unlock()
+
+	if !ok {
+		base, err = CompileWithOptions(reg, opts)
+		if err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		c.entries[fp] = base
+		c.mu.Unlock()
+	}
+	return base.reuse(opts), nil
+}
+
+// compileKey renders the options CompileWithOptions reads, other than
+// Repair, which reuse applies afresh: canonical order, focus and event
+// filtering change the compiled form, and the state and transition caps
+// decide whether it compiles at all.
+func compileKey(opts Options) string {
+	return fmt.Sprintf("|%d|%s|%s|%d|%d", opts.Canonical, opts.InvariantFocus, strings.Join(opts.Events, ","),
+		opts.MaxStates, opts.MaxTransitions)
+}
+
+// Stats reports how many compiles were served from the cache and how many
+// had to parse the registry.
+func (c *Cache) Stats() (hits, misses int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses
+}
+
+// Fingerprint returns a digest of everything in reg that compilation
+// depends on. Registries with equal fingerprints compile identically.
+func Fingerprint(reg *registry.Registry) (string, error) {
+	// encoding/json sorts map keys, so the encoding is canonical.
+	data, err := json.Marshal(reg)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// reuse returns a CompiledRegistry that shares cr's registry and parsed
+// expression trees, which are never mutated, but has its own options,
+// scratch buffers and (not yet built) tables. cr.Reg already has any auto
+// ranges resolved and the canonical order, focus and event filter applied.
+func (cr *CompiledRegistry) reuse(opts Options) *CompiledRegistry {
+	out := &CompiledRegistry{
+		Reg:          cr.Reg,
+		Opts:         opts,
+		Schema:       cr.Schema,
+		EnumLiterals: cr.EnumLiterals,
+		InvExprs:     cr.InvExprs,
+		RepExprs:     cr.RepExprs,
+		Repairs:      cr.Repairs,
+		EvtGuards:    cr.EvtGuards,
+		EvtExprs:     cr.EvtExprs,
+		EvtNames:     cr.EvtNames,
+		EvtSource:    cr.EvtSource,
+		EvtParams:    cr.EvtParams,
+		excluded:     cr.excluded,
+		repairOrder:  repairOrder(cr.Reg.Invariants, opts.Repair),
+		pre:          make(registry.State, len(cr.Schema.Vars)),
+		post:         make(registry.State, len(cr.Schema.Vars)),
+	}
+	out.env = expr.NewEnv(&out.Schema, nil, out.EnumLiterals)
+	return out
+}
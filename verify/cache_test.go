@@ -0,0 +1,101 @@
+package verify
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/blackwell-systems/nccheck/registry"
+)
+
+func TestCacheReusesParsedExpressions(t *testing.T) {
+	parse := func(src string) *registry.Registry {
+		reg, err := registry.Parse([]byte(src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return reg
+	}
+	c := NewCache()
+	steps := []struct {
+		src        string
+		opts       Options
+		wantMisses int // parses so far
+		wantReuse  bool
+	}{
+		{chainYAML, Options{}, 1, false},
+		{chainYAML, Options{}, 1, true},
+		{chainYAML, Options{SparseStep: true}, 1, true}, // not part of the key
+		{swapYAML, Options{}, 2, false},
+		{chainYAML, Options{}, 2, true},
+		{chainYAML, Options{Events: []string{"grow"}}, 3, false},
+	}
+	var first *CompiledRegistry
+	for i, st := range steps {
+		cr, err := c.Compile(parse(st.src), st.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hits, misses := c.Stats()
+		if misses != st.wantMisses || hits+misses != i+1 {
+			t.Errorf("step %d: Stats() = %d hits, %d misses; want %d misses of %d", i, hits, misses, st.wantMisses, i+1)
+		}
+		if i == 0 {
+			first = cr
+			continue
+		}
+		if cr == first {
+			t.Errorf("step %d: Compile returned the cached CompiledRegistry itself", i)
+		}
+		shared := len(cr.InvExprs) > 0 && len(first.InvExprs) > 0 && cr.InvExprs[0] == first.InvExprs[0]
+		if shared != st.wantReuse {
+			t.Errorf("step %d: shares parsed invariants = %v, want %v", i, shared, st.wantReuse)
+		}
+	}
+
+	// A cached compile verifies exactly like a fresh one.
+	cached, err := c.Compile(parse(chainYAML), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cached.BuildTables(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := cached.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, want := verifyYAML(t, chainYAML, Options{})
+	got.Elapsed, want.Elapsed = 0, 0
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("cached compile verified as %+v, want %+v", got, want)
+	}
+}
+
+func TestCacheAppliesCaps(t *testing.T) {
+	reg, err := registry.Parse([]byte(chainYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewCache()
+	if _, err := c.Compile(reg, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	// chainYAML has 105 states and 2 transitions; a cached compile
+	// enforces the caps as a fresh one does.
+	tests := []struct {
+		opts    Options
+		wantErr error
+	}{
+		{Options{MaxStates: 100}, ErrStateSpaceTooLarge},
+		{Options{MaxTransitions: 1}, ErrTooManyTransitions},
+		{Options{MaxStates: 105, MaxTransitions: 2}, nil},
+		{Options{}, nil},
+	}
+	for _, tt := range tests {
+		_, err := c.Compile(reg, tt.opts)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("Compile with %+v: error %v, want %v", tt.opts, err, tt.wantErr)
+		}
+	}
+}
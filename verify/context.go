@@ -0,0 +1,61 @@
+package verify
+
+import (
+	"context"
+	"fmt"
+)
+
+// InterruptedError reports a run cut short by its context, e.g. by a
+// deadline, naming the phase that was in progress.
+type InterruptedError struct {
+	Phase string // "table build (nf)", "cc", ...
+	Err   error  // the context's error
+}
+
+func (e *InterruptedError) Error() string {
+	return fmt.Sprintf("interrupted during %s: %v", e.Phase, e.Err)
+}
+
+func (e *InterruptedError) Unwrap() error { return e.Err }
+
+// pollInterval is how many loop iterations pass between context checks.
+const pollInterval = 1 << 12
+
+// BuildTablesContext is BuildTables, abandoned with an *InterruptedError
+// once ctx is done. The tables are then incomplete and must not be used.
+func (cr *CompiledRegistry) BuildTablesContext(ctx context.Context) error {
+	cr.ctx = ctx
+	defer func() { cr.ctx = nil }()
+	return cr.BuildTables()
+}
+
+// VerifyContext is Verify, abandoned with an *InterruptedError once ctx is
+// done. The checks poll ctx periodically, so it returns shortly after the
+// deadline rather than at the end of the current phase.
+func (cr *CompiledRegistry) VerifyContext(ctx context.Context) (*Result, error) {
+	cr.ctx = ctx
+	defer func() { cr.ctx = nil }()
+	return cr.Verify()
+}
+
+// AnalyzeContext runs f, which calls the analyses that follow Verify
+// (DeepestRepairs, OrderSensitivity, RepairInterference, Reachable, ...),
+// abandoning them with an *InterruptedError once ctx is done, as
+// VerifyContext does for the checks.
+func (cr *CompiledRegistry) AnalyzeContext(ctx context.Context, f func() error) error {
+	cr.ctx = ctx
+	defer func() { cr.ctx = nil }()
+	return f()
+}
+
+// interrupted returns an *InterruptedError naming phase if the context of
+// the current run is done, checking only every pollInterval-th i.
+func (cr *CompiledRegistry) interrupted(phase string, i int) error {
+	if cr.ctx == nil || i%pollInterval != 0 {
+		return nil
+	}
+	if err := cr.ctx.Err(); err != nil {
+		return &InterruptedError{Phase: phase, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package verify
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// countdownCtx is a context that is done from its n-th Err call on, so a
+// test can stop a run at a chosen poll.
+type countdownCtx struct {
+	context.Context
+	n int
+}
+
+func (c *countdownCtx) Err() error {
+	if c.n <= 0 {
+		return context.DeadlineExceeded
+	}
+	c.n--
+	return nil
+}
+
+func TestInterruptedPhase(t *testing.T) {
+	tests := []struct {
+		build, verify int // polls that succeed in BuildTables, Verify; -1: no context
+		wantPhase     string
+	}{
+		{0, -1, "table build (valid)"},
+		{1, -1, "table build (nf)"},
+		{2, -1, "table build (step)"},
+		{-1, 0, "wfc"},
+		{-1, 1, "cc"},
+	}
+	for _, tt := range tests {
+		var err error
+		if tt.build >= 0 {
+			cr := compileYAML(t, walletYAML, Options{})
+			err = cr.BuildTablesContext(&countdownCtx{context.Background(), tt.build})
+		} else {
+			cr := compileExample(t, "wallet.yaml", Options{})
+			_, err = cr.VerifyContext(&countdownCtx{context.Background(), tt.verify})
+		}
+		var ie *InterruptedError
+		if !errors.As(err, &ie) || ie.Phase != tt.wantPhase {
+			t.Errorf("stopped at poll %d/%d: error %v, want an interruption during %s", tt.build, tt.verify, err, tt.wantPhase)
+			continue
+		}
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("%s: error %v does not wrap the context's error", tt.wantPhase, err)
+		}
+	}
+
+	// A context that stays live changes nothing.
+	cr := compileYAML(t, walletYAML, Options{})
+	if err := cr.BuildTablesContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	res, err := cr.VerifyContext(context.Background())
+	if err != nil {
+		t.Fatalf("VerifyContext with a live context: %v", err)
+	}
+	if !res.Passed() {
+		t.Errorf("VerifyContext with a live context failed:\n%s", FormatReport(res))
+	}
+}
+
+func TestAnalyzeContextPhase(t *testing.T) {
+	tests := []struct {
+		yaml      string
+		opts      Options
+		analysis  func(cr *CompiledRegistry) error
+		wantPhase string
+	}{
+		{walletYAML, Options{}, func(cr *CompiledRegistry) error {
+			_, err := cr.DeepestRepairs(3)
+			return err
+		}, "deepest repairs"},
+		{walletYAML, Options{}, func(cr *CompiledRegistry) error {
+			_, err := cr.OrderSensitivity()
+			return err
+		}, "order sensitivity"},
+		{divergeYAML, Options{AllFailures: true}, func(cr *CompiledRegistry) error {
+			_, err := cr.WFCFailuresByInvariant()
+			return err
+		}, "wfc grouping"},
+		{walletYAML, Options{}, func(cr *CompiledRegistry) error {
+			_, err := cr.RepairInterference()
+			return err
+		}, "repair interference"},
+		{walletYAML, Options{}, func(cr *CompiledRegistry) error {
+			_, err := cr.ReachableCount()
+			return err
+		}, "reachability"},
+	}
+	for _, tt := range tests {
+		cr, _ := verifyYAML(t, tt.yaml, tt.opts)
+		err := cr.AnalyzeContext(&countdownCtx{context.Background(), 0}, func() error { return tt.analysis(cr) })
+		var ie *InterruptedError
+		if !errors.As(err, &ie) || ie.Phase != tt.wantPhase {
+			t.Errorf("error %v, want an interruption during %s", err, tt.wantPhase)
+		}
+		// Outside AnalyzeContext the same analysis runs to completion.
+		if err := tt.analysis(cr); err != nil {
+			t.Errorf("%s without a context: %v", tt.wantPhase, err)
+		}
+	}
+}
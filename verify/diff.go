@@ -0,0 +1,70 @@
+package verify
+
+import (
+	"fmt"
+
+	"github.com/blackwell-systems/nccheck/registry"
+)
+
+// NFDiff is a state whose normal form differs between two registries.
+type NFDiff struct {
+	State registry.State
+	A     registry.State // normal form under the first registry
+	B     registry.State // normal form under the second registry
+}
+
+// Diff compares the normal-form tables of two compiled registries over
+// the same schema and returns every state whose normal form differs, in
+// StateID order. Tables are built if needed. It is meant for regression
+// tests after editing compensation.
+func Diff(a, b *CompiledRegistry) ([]NFDiff, error) {
+	if err := sameSchema(a.Schema, b.Schema); err != nil {
+		return nil, err
+	}
+	if err := a.ensureTables(); err != nil {
+		return nil, fmt.Errorf("first registry: %w", err)
+	}
+	if err := b.ensureTables(); err != nil {
+		return nil, fmt.Errorf("second registry: %w", err)
+	}
+	var diffs []NFDiff
+	for sid := range a.NF {
+		if a.NF[sid] == b.NF[sid] {
+			continue
+		}
+		diffs = append(diffs, NFDiff{
+			State: a.Schema.Decode(registry.StateID(sid)),
+			A:     a.Schema.Decode(a.NF[sid]),
+			B:     b.Schema.Decode(b.NF[sid]),
+		})
+	}
+	return diffs, nil
+}
+
+// sameSchema reports an error describing the first difference between two
+// schemas, or nil if they encode states identically.
+func sameSchema(a, b registry.Schema) error {
+	if len(a.Vars) != len(b.Vars) {
+		return fmt.Errorf("schemas differ: %d vs %d variables", len(a.Vars), len(b.Vars))
+	}
+	for i := range a.Vars {
+		va, vb := a.Vars[i], b.Vars[i]
+		if va.Name != vb.Name || va.Type != vb.Type || va.Min != vb.Min || va.Max != vb.Max ||
+			va.Size != vb.Size || !equalStrings(va.Values, vb.Values) {
+			return fmt.Errorf("schemas differ at variable %d (%q vs %q)", i, va.Name, vb.Name)
+		}
+	}
+	return nil
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,37 @@
+package verify
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/blackwell-systems/nccheck/registry"
+)
+
+func TestDiff(t *testing.T) {
+	// Repairing on_when_set by resetting x instead of setting on changes
+	// the normal form of exactly the states with x > 0 and on false.
+	edited := strings.Replace(dotYAML, "repair: {on: true}", "repair: {x: 0}", 1)
+	a := compileYAML(t, dotYAML, Options{})
+	b := compileYAML(t, edited, Options{})
+	got, err := Diff(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// States are (x, on).
+	want := []NFDiff{
+		{State: registry.State{1, 0}, A: registry.State{1, 1}, B: registry.State{0, 0}},
+		{State: registry.State{2, 0}, A: registry.State{1, 1}, B: registry.State{0, 0}},
+		{State: registry.State{3, 0}, A: registry.State{1, 1}, B: registry.State{0, 0}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Diff = %v, want %v", got, want)
+	}
+
+	if got, err := Diff(a, compileYAML(t, dotYAML, Options{})); err != nil || len(got) != 0 {
+		t.Errorf("Diff of identical registries = %v, %v; want none", got, err)
+	}
+	if _, err := Diff(a, compileYAML(t, chainYAML, Options{})); err == nil || !strings.Contains(err.Error(), "schemas differ") {
+		t.Errorf("Diff across schemas: error %v, want a schema mismatch", err)
+	}
+}
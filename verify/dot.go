@@ -0,0 +1,59 @@
+package verify
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/blackwell-systems/nccheck/registry"
+)
+
+// WriteRepairDOT renders the compensation structure as a Graphviz digraph.
+// Every invalid state is a node with one edge to the state its next repair
+// step produces, labelled with the invariant being repaired. Valid states
+// reached this way are the normal forms and are drawn as accepting nodes.
+// Because repair is deterministic each invalid state has exactly one
+// outgoing edge, so a WFC failure shows up as a cycle.
+//
+// BuildTables must have been called.
+func (cr *CompiledRegistry) WriteRepairDOT(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "digraph %q {\n", cr.Reg.Name+"_repair")
+	fmt.Fprintf(bw, "  rankdir=LR;\n")
+	fmt.Fprintf(bw, "  node [shape=box];\n")
+
+	normalForms := make(map[registry.StateID]bool)
+	for sid := 0; sid < cr.Schema.TotalLen; sid++ {
+		if cr.Valid[sid] {
+			continue
+		}
+		next, ri, err := cr.repairStep(registry.StateID(sid))
+		if err != nil {
+			return fmt.Errorf("repair at state %s: %w",
+				cr.fmtState(cr.Schema.Decode(registry.StateID(sid))), err)
+		}
+		if ri < 0 {
+			continue
+		}
+		fmt.Fprintf(bw, "  s%d [label=%s];\n", sid, dotQuote(cr.fmtState(cr.Schema.Decode(registry.StateID(sid)))))
+		fmt.Fprintf(bw, "  s%d -> s%d [label=%s];\n", sid, next, dotQuote(cr.Reg.Invariants[ri].Name))
+		if cr.Valid[next] {
+			normalForms[next] = true
+		}
+	}
+	for sid := 0; sid < cr.Schema.TotalLen; sid++ {
+		if normalForms[registry.StateID(sid)] {
+			fmt.Fprintf(bw, "  s%d [label=%s, shape=doublecircle];\n",
+				sid, dotQuote(cr.fmtState(cr.Schema.Decode(registry.StateID(sid)))))
+		}
+	}
+
+	fmt.Fprintf(bw, "}\n")
+	return bw.Flush()
+}
+
+// dotQuote returns s as a double-quoted DOT string.
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,73 @@
+package verify
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const dotYAML = `
+registry:
+  name: dot
+  states:
+    x: {type: int, range: [0, 3]}
+    on: {type: bool}
+  initial: {x: 0, on: false}
+  invariants:
+    x_small: {expr: "x <= 1"}
+    on_when_set: {expr: "x == 0 or on"}
+  compensation:
+    - invariant: x_small
+      repair: {x: "x - 1"}
+    - invariant: on_when_set
+      repair: {on: true}
+  events:
+    grow:
+      guard: "x < 3"
+      effect: {x: "x + 1"}
+`
+
+func TestWriteRepairDOT(t *testing.T) {
+	cr, _ := verifyYAML(t, dotYAML, Options{})
+	var buf bytes.Buffer
+	if err := cr.WriteRepairDOT(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	// Every invalid state has exactly one edge, to its next repair step.
+	tests := []struct {
+		from, to, inv string
+	}{
+		{"x=3, on=false", "x=2, on=false", "x_small"},
+		{"x=3, on=true", "x=2, on=true", "x_small"},
+		{"x=2, on=false", "x=1, on=false", "x_small"},
+		{"x=2, on=true", "x=1, on=true", "x_small"},
+		{"x=1, on=false", "x=1, on=true", "on_when_set"},
+	}
+	for _, tt := range tests {
+		from, err := cr.Schema.ParseState(tt.from)
+		if err != nil {
+			t.Fatal(err)
+		}
+		to, err := cr.Schema.ParseState(tt.to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		edge := fmt.Sprintf("s%d -> s%d [label=%s];", cr.Schema.Encode(from), cr.Schema.Encode(to), dotQuote(tt.inv))
+		if !strings.Contains(out, edge) {
+			t.Errorf("missing repair edge %s -> %s (%s):\n%s", tt.from, tt.to, tt.inv, out)
+		}
+	}
+	if got, want := strings.Count(out, " -> "), len(tests); got != want {
+		t.Errorf("%d edges, want %d:\n%s", got, want, out)
+	}
+
+	// Only x=1, on=true is reached as a normal form.
+	nf, _ := cr.Schema.ParseState("x=1, on=true")
+	accept := fmt.Sprintf("s%d [label=%s, shape=doublecircle];", cr.Schema.Encode(nf), dotQuote(cr.fmtState(nf)))
+	if !strings.Contains(out, accept) || strings.Count(out, "doublecircle") != 1 {
+		t.Errorf("want %s as the only accepting node:\n%s", accept, out)
+	}
+}
@@ -0,0 +1,83 @@
+package verify
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/blackwell-systems/nccheck/registry"
+)
+
+// WriteEncoding explains how states map to StateIDs: each variable's size,
+// stride and share of the ID range, the value codes (as in Encoding), and
+// worked examples encoding and decoding the initial state, if any, and the
+// last state. It reads only the schema and needs no tables.
+func (cr *CompiledRegistry) WriteEncoding(w io.Writer) error {
+	s := &cr.Schema
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "Encoding of %s: %d states, StateID = Σ code × stride\n\n", cr.Reg.Name, s.TotalLen)
+
+	width := len("variable")
+	for _, v := range s.Vars {
+		width = max(width, len(v.Name))
+	}
+	fmt.Fprintf(bw, "  %-*s  %8s  %10s  %s\n", width, "variable", "size", "stride", "contributes")
+	for i, v := range s.Vars {
+		fmt.Fprintf(bw, "  %-*s  %8d  %10d  0..%d\n", width, v.Name, v.Size, s.Strides[i], (v.Size-1)*s.Strides[i])
+	}
+	fmt.Fprintln(bw)
+	fmt.Fprintf(bw, "Codes (an int in [min, max] is coded as value - min)\n")
+	for _, line := range cr.Encoding() {
+		fmt.Fprintf(bw, "  %s\n", line)
+	}
+
+	type example struct {
+		label string
+		st    registry.State
+	}
+	var examples []example
+	if init, err := cr.InitialState(); err == nil {
+		examples = append(examples, example{"initial", init})
+	}
+	if s.TotalLen > 0 {
+		examples = append(examples, example{"last", s.Decode(registry.StateID(s.TotalLen - 1))})
+	}
+	if len(examples) > 0 {
+		fmt.Fprintln(bw)
+		fmt.Fprintf(bw, "Examples\n")
+	}
+	for _, ex := range examples {
+		id := s.Encode(ex.st)
+		terms := make([]string, len(ex.st))
+		for i, v := range s.Vars {
+			terms[i] = fmt.Sprintf("%d×%d", code(v, ex.st[i]), s.Strides[i])
+		}
+		fmt.Fprintf(bw, "  %s %s\n", ex.label, s.Format(ex.st))
+		fmt.Fprintf(bw, "    encode: %s = %d\n", strings.Join(terms, " + "), id)
+
+		fmt.Fprintf(bw, "    decode %d:\n", id)
+		rem := int(id)
+		for i, v := range s.Vars {
+			q := rem / s.Strides[i]
+			step := fmt.Sprintf("%s = %d / %d = %d", v.Name, rem, s.Strides[i], q)
+			if v.Type == registry.TypeInt && v.Min != 0 {
+				step += fmt.Sprintf(" + min %d = %d", v.Min, q+v.Min)
+			}
+			if i < len(s.Vars)-1 {
+				step += fmt.Sprintf(", rest %d %% %d = %d", rem, s.Strides[i], rem%s.Strides[i])
+			}
+			fmt.Fprintf(bw, "      %s\n", step)
+			rem %= s.Strides[i]
+		}
+	}
+	return bw.Flush()
+}
+
+// code returns the 0-based code of value in v's domain.
+func code(v registry.VarDef, value int) int {
+	if v.Type == registry.TypeInt {
+		return value - v.Min
+	}
+	return value
+}
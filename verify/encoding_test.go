@@ -0,0 +1,60 @@
+package verify
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/blackwell-systems/nccheck/registry"
+)
+
+func TestWriteEncoding(t *testing.T) {
+	for _, name := range exampleNames {
+		src, err := os.ReadFile(filepath.Join("..", "examples", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cr := compileYAML(t, string(src), Options{})
+		var b strings.Builder
+		if err := cr.WriteEncoding(&b); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		out := b.String()
+		schema := registry.NewSchema(cr.Reg.Vars)
+
+		if want := fmt.Sprintf("%d states", schema.TotalLen); !strings.Contains(out, want) {
+			t.Errorf("%s: header does not mention %q:\n%s", name, want, out)
+		}
+
+		// The stride table has one row per variable, in order.
+		lines := strings.Split(out, "\n")
+		start := slices.IndexFunc(lines, func(l string) bool { return strings.HasPrefix(l, "  variable") })
+		if start < 0 || start+len(schema.Vars) >= len(lines) {
+			t.Fatalf("%s: no stride table:\n%s", name, out)
+		}
+		for i, v := range schema.Vars {
+			f := strings.Fields(lines[start+1+i])
+			if len(f) != 4 || f[0] != v.Name {
+				t.Errorf("%s: row %d is %q, want variable %s", name, i, lines[start+1+i], v.Name)
+				continue
+			}
+			size, _ := strconv.Atoi(f[1])
+			stride, _ := strconv.Atoi(f[2])
+			if size != v.Size || stride != schema.Strides[i] {
+				t.Errorf("%s: %s has size %d, stride %d; NewSchema gives %d, %d", name, v.Name, size, stride, v.Size, schema.Strides[i])
+			}
+			if want := fmt.Sprintf("0..%d", (v.Size-1)*schema.Strides[i]); f[3] != want {
+				t.Errorf("%s: %s contributes %s, want %s", name, v.Name, f[3], want)
+			}
+		}
+
+		// The last worked example encodes to the highest StateID.
+		if want := fmt.Sprintf("= %d\n", schema.TotalLen-1); !strings.Contains(out, want) {
+			t.Errorf("%s: no example encoding to %d:\n%s", name, schema.TotalLen-1, out)
+		}
+	}
+}
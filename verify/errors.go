@@ -0,0 +1,37 @@
+package verify
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned by compilation and table building, for use with
+// errors.Is. The returned errors wrap them with details such as the state
+// involved.
+var (
+	// ErrStateSpaceTooLarge reports a state space over the cap set by
+	// MaxStates or Options.MaxStates.
+	ErrStateSpaceTooLarge = errors.New("state space too large")
+
+	// ErrTooManyTransitions reports parameterized events expanding to more
+	// transitions than MaxTransitions or Options.MaxTransitions.
+	ErrTooManyTransitions = errors.New("too many transitions")
+
+	// ErrCompensationNonTerminating reports compensation that exceeds
+	// MaxRepairIter steps from some state.
+	ErrCompensationNonTerminating = errors.New("compensation did not terminate")
+)
+
+// RangeError reports an int effect or repair that computed a value outside
+// its target's range under OutOfRangeError. Use errors.As to retrieve it.
+type RangeError struct {
+	Var      string
+	Value    int
+	Min, Max int
+	State    string // the pre-state, formatted
+}
+
+func (e *RangeError) Error() string {
+	return fmt.Sprintf("SPEC ERROR: assignment to %q computed value %d, allowed range [%d, %d] in state %s",
+		e.Var, e.Value, e.Min, e.Max, e.State)
+}
@@ -0,0 +1,101 @@
+package verify
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestTypedErrors(t *testing.T) {
+	const rangeYAML = `
+registry:
+  name: overflow
+  states:
+    x: {type: int, range: [0, 3]}
+  invariants:
+    any: {expr: "true"}
+  events:
+    bump: {effect: {x: "x + 1"}}
+`
+	const paramYAML = `
+registry:
+  name: fanout
+  states:
+    x: {type: int, range: [0, 3]}
+  invariants:
+    any: {expr: "true"}
+  events:
+    set:
+      params:
+        v: {type: int, range: [0, 3]}
+      effect: {x: v}
+`
+	tests := []struct {
+		name   string
+		err    func() error
+		target error
+	}{
+		{"too many states", func() error {
+			return compileErr(t, chainYAML, Options{MaxStates: 100}) // chainYAML has 105
+		}, ErrStateSpaceTooLarge},
+		{"too many transitions", func() error {
+			return compileErr(t, paramYAML, Options{MaxTransitions: 3})
+		}, ErrTooManyTransitions},
+		{"non-terminating", func() error {
+			return compileYAML(t, divergeYAML, Options{}).BuildTables()
+		}, ErrCompensationNonTerminating},
+	}
+	sentinels := []error{ErrStateSpaceTooLarge, ErrTooManyTransitions, ErrCompensationNonTerminating}
+	for _, tt := range tests {
+		err := tt.err()
+		for _, s := range sentinels {
+			if got, want := errors.Is(err, s), s == tt.target; got != want {
+				t.Errorf("%s: errors.Is(%v, %v) = %v, want %v", tt.name, err, s, got, want)
+			}
+		}
+	}
+
+	err := compileYAML(t, rangeYAML, Options{}).BuildTables()
+	var re *RangeError
+	if !errors.As(err, &re) {
+		t.Fatalf("out of range: error %v, want a *RangeError", err)
+	}
+	want := RangeError{Var: "x", Value: 4, Min: 0, Max: 3, State: "{x=3}"}
+	if *re != want {
+		t.Errorf("RangeError = %+v, want %+v", *re, want)
+	}
+	if !strings.Contains(err.Error(), `SPEC ERROR: assignment to "x" computed value 4, allowed range [0, 3] in state {x=3}`) {
+		t.Errorf("out of range: error %q", err)
+	}
+}
+
+func TestResultPassed(t *testing.T) {
+	tests := []struct {
+		name string
+		res  Result
+		want bool
+	}{
+		{"all pass", Result{WFCPass: true, CC: CCResult{CCPass: true}}, true},
+		{"WFC fails", Result{WFCPass: false, CC: CCResult{CCPass: true}}, false},
+		{"CC fails", Result{WFCPass: true, CC: CCResult{CCPass: false}}, false},
+		{"idempotence fails", Result{WFCPass: true, CC: CCResult{CCPass: true},
+			Idempotence: []IdempotenceResult{{Event: "a", Pass: true}, {Event: "b", Pass: false}}}, false},
+		{"idempotence passes", Result{WFCPass: true, CC: CCResult{CCPass: true},
+			Idempotence: []IdempotenceResult{{Event: "a", Pass: true}}}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.res.Passed(); got != tt.want {
+			t.Errorf("%s: Passed() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	for name, want := range map[string]bool{"wallet.yaml": true, "counters.yaml": false} {
+		res, err := compileExample(t, name, Options{}).Verify()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Passed() != want {
+			t.Errorf("%s: Passed() = %v, want %v", name, res.Passed(), want)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package verify
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/blackwell-systems/nccheck/registry"
+)
+
+// Graph is a generic node/edge view of the reachable state space, for
+// external visualizers.
+type Graph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+// GraphNode is one state. Values maps each variable to a bool, int, or
+// enum literal string.
+type GraphNode struct {
+	ID      int                    `json:"id"` // StateID
+	Label   string                 `json:"label"`
+	Values  map[string]interface{} `json:"values"`
+	Valid   bool                   `json:"valid"`
+	Initial bool                   `json:"initial,omitempty"`
+}
+
+// GraphEdge is a transition (Kind "event", Label the transition name) from
+// a normal form to the raw post-state, or a single compensation step (Kind
+// "repair", Label the invariant repaired).
+type GraphEdge struct {
+	From  int    `json:"from"`
+	To    int    `json:"to"`
+	Kind  string `json:"kind"`
+	Label string `json:"label"`
+}
+
+// Graph builds the graph of states reachable from the initial state: every
+// reachable normal form with its enabled transitions, plus the invalid
+// intermediate states and repair steps leading back to a normal form.
+// Requires tables.
+func (cr *CompiledRegistry) Graph() (*Graph, error) {
+	reachable, err := cr.Reachable()
+	if err != nil {
+		return nil, err
+	}
+	init, err := cr.InitialState()
+	if err != nil {
+		return nil, err
+	}
+	initID := cr.Schema.Encode(init)
+
+	g := &Graph{}
+	nodes := make(map[registry.StateID]bool)
+	repaired := make(map[registry.StateID]bool)
+
+	// repairChain adds the compensation steps from sid to its normal form.
+	// Chains stop at an already expanded state, so cycles terminate.
+	repairChain := func(sid registry.StateID) error {
+		for !cr.Valid[sid] && !repaired[sid] {
+			repaired[sid] = true
+			next, ri, err := cr.repairStep(sid)
+			if err != nil {
+				return fmt.Errorf("repair at state %s: %w", cr.fmtState(cr.Schema.Decode(sid)), err)
+			}
+			if ri < 0 {
+				break
+			}
+			nodes[next] = true
+			g.Edges = append(g.Edges, GraphEdge{From: int(sid), To: int(next), Kind: "repair",
+				Label: cr.Reg.Invariants[ri].Name})
+			sid = next
+		}
+		return nil
+	}
+
+	nodes[initID] = true
+	if err := repairChain(initID); err != nil {
+		return nil, err
+	}
+	for sid, ok := range reachable {
+		if !ok {
+			continue
+		}
+		nodes[registry.StateID(sid)] = true
+		for ei := range cr.EvtNames {
+			if cr.Step.Next(ei, registry.StateID(sid)) == -1 {
+				continue
+			}
+			st := cr.Schema.DecodeInto(registry.StateID(sid), cr.pre)
+			post, err := cr.applyEvent(ei, st)
+			if err != nil {
+				return nil, fmt.Errorf("event %q at state %s: %w", cr.EvtNames[ei], cr.fmtState(st), err)
+			}
+			postID := cr.Schema.Encode(post)
+			nodes[postID] = true
+			g.Edges = append(g.Edges, GraphEdge{From: sid, To: int(postID), Kind: "event", Label: cr.EvtNames[ei]})
+			if err := repairChain(postID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	ids := make([]int, 0, len(nodes))
+	for sid := range nodes {
+		ids = append(ids, int(sid))
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		st := cr.Schema.Decode(registry.StateID(id))
+		g.Nodes = append(g.Nodes, GraphNode{
+			ID:      id,
+			Label:   cr.fmtState(st),
+			Values:  cr.valuation(st),
+			Valid:   cr.Valid[id],
+			Initial: registry.StateID(id) == initID,
+		})
+	}
+	return g, nil
+}
+
+// valuation maps each variable of st to its natural JSON value.
+func (cr *CompiledRegistry) valuation(st registry.State) map[string]interface{} {
+	vals := make(map[string]interface{}, len(st))
+	for i, v := range cr.Schema.Vars {
+		switch v.Type {
+		case registry.TypeBool:
+			vals[v.Name] = st[i] == 1
+		case registry.TypeEnum:
+			vals[v.Name] = v.Values[st[i]]
+		default:
+			vals[v.Name] = st[i]
+		}
+	}
+	return vals
+}
@@ -0,0 +1,65 @@
+package verify
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestGraphJSON(t *testing.T) {
+	// From x=0, on=false, grow leads to x=1, on=false, which is repaired to
+	// x=1, on=true; growing again gives x=2, on=true, repaired back.
+	cr, _ := verifyYAML(t, dotYAML, Options{})
+	g, err := cr.Graph()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Graph
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	id := func(state string) int {
+		st, err := cr.Schema.ParseState(state)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return int(cr.Schema.Encode(st))
+	}
+	wantNodes := []struct {
+		state          string
+		valid, initial bool
+	}{
+		{"x=0, on=false", true, true},
+		{"x=1, on=false", false, false},
+		{"x=1, on=true", true, false},
+		{"x=2, on=true", false, false},
+	}
+	if len(got.Nodes) != len(wantNodes) {
+		t.Fatalf("%d nodes, want %d: %s", len(got.Nodes), len(wantNodes), data)
+	}
+	for i, w := range wantNodes {
+		n := got.Nodes[i]
+		if n.ID != id(w.state) || n.Label != "{"+w.state+"}" || n.Valid != w.valid || n.Initial != w.initial {
+			t.Errorf("node %d = %+v, want %s valid=%v initial=%v", i, n, w.state, w.valid, w.initial)
+		}
+	}
+	// JSON numbers decode as float64.
+	if want := map[string]interface{}{"x": 2.0, "on": true}; !reflect.DeepEqual(got.Nodes[3].Values, want) {
+		t.Errorf("node values %v, want %v", got.Nodes[3].Values, want)
+	}
+
+	wantEdges := []GraphEdge{
+		{id("x=0, on=false"), id("x=1, on=false"), "event", "grow"},
+		{id("x=1, on=false"), id("x=1, on=true"), "repair", "on_when_set"},
+		{id("x=1, on=true"), id("x=2, on=true"), "event", "grow"},
+		{id("x=2, on=true"), id("x=1, on=true"), "repair", "x_small"},
+	}
+	if !reflect.DeepEqual(got.Edges, wantEdges) {
+		t.Errorf("edges %+v, want %+v", got.Edges, wantEdges)
+	}
+}
@@ -0,0 +1,72 @@
+package verify
+
+import (
+	"fmt"
+
+	"github.com/blackwell-systems/nccheck/registry"
+)
+
+// IdempotenceResult is the outcome of checking one transition for
+// idempotence: applying it twice must reach the same normal form as
+// applying it once.
+type IdempotenceResult struct {
+	Event     string `json:"event"` // transition name
+	Pass      bool   `json:"pass"`
+	FailCount int    `json:"fail_count,omitempty"` // failing states (all of them under AllFailures)
+	State     string `json:"state,omitempty"`      // first counterexample
+	Once      string `json:"once,omitempty"`       // Step(e, s)
+	Twice     string `json:"twice,omitempty"`      // Step(e, Step(e, s))
+}
+
+// CheckIdempotent checks that each named event satisfies
+// Step[e][Step[e][s]] == Step[e][s] at every state where both steps are
+// enabled. Parameterized events are checked per transition. Requires
+// tables.
+func (cr *CompiledRegistry) CheckIdempotent(eventNames []string) ([]IdempotenceResult, error) {
+	var results []IdempotenceResult
+	for _, name := range eventNames {
+		src := -1
+		for i, evt := range cr.Reg.Events {
+			if evt.Name == name {
+				src = i
+			}
+		}
+		if src < 0 {
+			return nil, fmt.Errorf("idempotence: unknown event %q", name)
+		}
+		for ei := range cr.EvtNames {
+			if cr.EvtSource[ei] == src {
+				results = append(results, cr.checkIdempotent(ei))
+			}
+		}
+	}
+	return results, nil
+}
+
+func (cr *CompiledRegistry) checkIdempotent(ei int) IdempotenceResult {
+	r := IdempotenceResult{Event: cr.EvtNames[ei], Pass: true}
+	for sid := 0; sid < cr.Schema.TotalLen; sid++ {
+		if cr.interrupted("idempotence", sid) != nil {
+			break // Verify reports the interruption
+		}
+		once := cr.Step.Next(ei, registry.StateID(sid))
+		if once == -1 {
+			continue
+		}
+		twice := cr.Step.Next(ei, once)
+		if twice == -1 || twice == once {
+			continue
+		}
+		if r.Pass {
+			r.Pass = false
+			r.State = cr.fmtState(cr.Schema.Decode(registry.StateID(sid)))
+			r.Once = cr.fmtState(cr.Schema.Decode(once))
+			r.Twice = cr.fmtState(cr.Schema.Decode(twice))
+		}
+		r.FailCount++
+		if !cr.Opts.AllFailures {
+			break
+		}
+	}
+	return r
+}
@@ -0,0 +1,71 @@
+package verify
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const idempotentYAML = `
+registry:
+  name: idem
+  states:
+    x: {type: int, range: [0, 3]}
+    done: {type: bool}
+  initial: {x: 0, done: false}
+  invariants:
+    done_at_top: {expr: "not done or x == 3"}
+  compensation:
+    - invariant: done_at_top
+      repair: {x: 3}
+  events:
+    finish:
+      idempotent: true
+      effect: {done: true}
+    inc:
+      idempotent: true
+      guard: "x < 3"
+      effect: {x: "x + 1"}
+    set:
+      idempotent: true
+      params:
+        v: {type: int, range: [1, 2]}
+      guard: "not done"
+      effect: {x: v}
+    reset:
+      effect: {x: 0, done: false}
+`
+
+func TestCheckIdempotent(t *testing.T) {
+	_, res := verifyYAML(t, idempotentYAML, Options{AllFailures: true})
+	// inc is enabled twice running from x=0 and x=1 (with done false,
+	// the only valid states below 3).
+	want := []IdempotenceResult{
+		{Event: "finish", Pass: true},
+		{Event: "inc", Pass: false, FailCount: 2,
+			State: "{x=0, done=false}", Once: "{x=1, done=false}", Twice: "{x=2, done=false}"},
+		{Event: "set(v=1)", Pass: true},
+		{Event: "set(v=2)", Pass: true},
+	}
+	if !reflect.DeepEqual(res.Idempotence, want) {
+		t.Errorf("Idempotence = %+v,\nwant %+v", res.Idempotence, want)
+	}
+	if res.IdempotencePass() || res.Passed() {
+		t.Error("a failing idempotent event should fail the result")
+	}
+	if report := FormatReport(res); !strings.Contains(report, "Idempotence (Step(e, Step(e, s)) = Step(e, s))") {
+		t.Errorf("report has no idempotence section:\n%s", report)
+	}
+
+	cr, _ := verifyYAML(t, idempotentYAML, Options{})
+	got, err := cr.CheckIdempotent([]string{"reset", "inc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || !got[0].Pass || got[1].Pass || got[1].FailCount != 1 {
+		t.Errorf("CheckIdempotent(reset, inc) = %+v, want reset to pass and inc to stop at its first failure", got)
+	}
+	if _, err := cr.CheckIdempotent([]string{"missing"}); err == nil || !strings.Contains(err.Error(), `idempotence: unknown event "missing"`) {
+		t.Errorf("unknown event: error %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package verify
+
+import (
+	"sort"
+
+	"github.com/blackwell-systems/nccheck/registry"
+)
+
+// RepairInterference counts the repair steps for one invariant that
+// violate another invariant which held before the step. Such a pair can
+// ping-pong: each repair undoes the other, and compensation never ends.
+type RepairInterference struct {
+	Repaired string `json:"repaired"` // invariant whose repair was applied
+	Broken   string `json:"broken"`   // invariant it violated
+	States   int    `json:"states"`   // states where the step broke it
+	Before   string `json:"before"`   // the lowest such state
+	After    string `json:"after"`    // the state the repair step led to
+}
+
+// RepairInterference applies one repair step at every invalid state and
+// returns the pairs of invariants where repairing the first turned the
+// second from satisfied to violated, most frequent first, then in
+// declaration order. It is diagnostic: interference is harmless if the
+// broken invariant's repair does not in turn break the first. It uses the
+// invariant table if BuildTables has filled it, and evaluates otherwise.
+func (cr *CompiledRegistry) RepairInterference() ([]RepairInterference, error) {
+	n := len(cr.InvExprs)
+	found := make([]RepairInterference, n*n) // [repaired*n+broken]
+	before := make([]bool, n)
+	st := make(registry.State, len(cr.Schema.Vars))
+	for i := 0; i < cr.Schema.TotalLen; i++ {
+		if err := cr.interrupted("repair interference", i); err != nil {
+			return nil, err
+		}
+		sid := registry.StateID(i)
+		cr.Schema.DecodeInto(sid, st)
+		valid := true
+		for j := range before {
+			v, err := cr.invariantHolds(j, sid, st)
+			if err != nil {
+				return nil, err
+			}
+			before[j], valid = v, valid && v
+		}
+		if valid {
+			continue
+		}
+		next, ri, err := cr.repairStep(sid)
+		if err != nil {
+			return nil, err
+		}
+		cr.Schema.DecodeInto(next, st)
+		for j, held := range before {
+			if j == ri || !held {
+				continue
+			}
+			v, err := cr.invariantHolds(j, next, st)
+			if err != nil {
+				return nil, err
+			}
+			if v {
+				continue
+			}
+			ix := &found[ri*n+j]
+			if ix.States == 0 {
+				ix.Before = cr.fmtState(cr.Schema.Decode(sid))
+				ix.After = cr.fmtState(st)
+			}
+			ix.States++
+		}
+	}
+
+	var out []RepairInterference
+	for k, ix := range found {
+		if ix.States == 0 {
+			continue
+		}
+		ix.Repaired = cr.Reg.Invariants[k/n].Name
+		ix.Broken = cr.Reg.Invariants[k%n].Name
+		out = append(out, ix)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].States > out[j].States })
+	return out, nil
+}
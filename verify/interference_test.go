@@ -0,0 +1,63 @@
+package verify
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRepairInterference(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want []RepairInterference
+	}{
+		// Repairing low violates high and vice versa: the two ping-pong.
+		{"cycle", cycleYAML, []RepairInterference{
+			{Repaired: "low", Broken: "high", States: 1, Before: "{x=2}", After: "{x=3}"},
+			{Repaired: "high", Broken: "low", States: 1, Before: "{x=3}", After: "{x=2}"},
+		}},
+		// Repairing bounded violates clear, but not the other way round, so
+		// compensation still terminates.
+		{"one way", `
+registry:
+  name: oneway
+  states:
+    x: {type: int, range: [0, 3]}
+    y: {type: bool}
+  initial: {x: 0, y: false}
+  invariants:
+    bounded: {expr: "x <= 2"}
+    clear: {expr: "not y"}
+  compensation:
+    - invariant: bounded
+      repair: {x: 0, y: true}
+    - invariant: clear
+      repair: {y: false}
+  events:
+    inc:
+      guard: "x < 3"
+      effect: {x: "x + 1"}
+`, []RepairInterference{
+			{Repaired: "bounded", Broken: "clear", States: 1, Before: "{x=3, y=false}", After: "{x=0, y=true}"},
+		}},
+		{"independent", walletYAML, nil},
+	}
+	for _, tt := range tests {
+		// With and without the invariant table.
+		for _, tables := range []bool{false, true} {
+			cr := compileYAML(t, tt.yaml, Options{AllFailures: true})
+			if tables {
+				if err := cr.BuildTables(); err != nil {
+					t.Fatalf("%s: %v", tt.name, err)
+				}
+			}
+			got, err := cr.RepairInterference()
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s (tables %v): %+v, want %+v", tt.name, tables, got, tt.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package verify
+
+import (
+	"context"
+	"log/slog"
+)
+
+// log returns the configured logger, or one that discards everything.
+func (cr *CompiledRegistry) log() *slog.Logger {
+	if cr.Opts.Logger != nil {
+		return cr.Opts.Logger
+	}
+	return discardLogger
+}
+
+// debugEnabled reports whether debug events will be emitted, so hot loops
+// can skip building log attributes.
+func (cr *CompiledRegistry) debugEnabled() bool {
+	return cr.log().Enabled(context.Background(), slog.LevelDebug)
+}
+
+var discardLogger = slog.New(discardHandler{})
+
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
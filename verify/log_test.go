@@ -0,0 +1,51 @@
+package verify
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestLogging(t *testing.T) {
+	tests := []struct {
+		level slog.Level
+		want  []string // substrings of the log
+		not   []string
+	}{
+		{slog.LevelDebug, []string{
+			"msg=\"phase start\" phase=valid states=22",
+			"msg=\"phase start\" phase=nf",
+			"msg=\"phase start\" phase=step states=22 transitions=7",
+			"msg=repair iter=0 invariant=frozen_is_empty",
+			"msg=\"tables built\" states=22 valid=12 invalid=10 transitions=7",
+			"msg=\"wfc checked\" pass=true max_depth=1",
+			"msg=\"cc checked\" cc1_pass=true cc2_pass=true",
+		}, nil},
+		{slog.LevelInfo, []string{"msg=\"tables built\"", "msg=\"cc checked\""}, []string{"phase start", "msg=repair"}},
+		{slog.LevelWarn, nil, []string{"msg="}},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: tt.level}))
+		verifyYAML(t, walletYAML, Options{Logger: logger})
+		log := buf.String()
+		for _, s := range tt.want {
+			if !strings.Contains(log, s) {
+				t.Errorf("level %v: log lacks %q:\n%s", tt.level, s, log)
+			}
+		}
+		for _, s := range tt.not {
+			if strings.Contains(log, s) {
+				t.Errorf("level %v: log has %q:\n%s", tt.level, s, log)
+			}
+		}
+	}
+}
+
+func TestNilLoggerDiscards(t *testing.T) {
+	cr := compileYAML(t, walletYAML, Options{})
+	if cr.log() != discardLogger || cr.debugEnabled() {
+		t.Error("a nil Logger should discard everything")
+	}
+}
@@ -0,0 +1,108 @@
+package verify
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/blackwell-systems/nccheck/registry"
+)
+
+// maxMinimizeCube bounds how many states MinimizeCC1 enumerates to test one
+// generalization. A variable whose generalization would exceed it is kept.
+const maxMinimizeCube = 1 << 16
+
+// MinimizeCC1 generalizes a CC1 counterexample: starting from st, where
+// transitions e1 and e2 fail to commute, it tries each variable in
+// declaration order and marks it "don't care" if the pair still fails to
+// commute for every value of it (and of the variables already marked). The
+// result is a minimal, though not necessarily minimum, set of variables
+// that explain the failure. dontCare[i] reports whether variable i is
+// irrelevant. Requires tables.
+func (cr *CompiledRegistry) MinimizeCC1(e1, e2 int, st registry.State) (dontCare []bool) {
+	witness := func(sid registry.StateID) bool {
+		s1, s2 := cr.Step.Next(e1, sid), cr.Step.Next(e2, sid)
+		if s1 == -1 || s2 == -1 {
+			return false
+		}
+		r12, r21 := cr.Step.Next(e2, s1), cr.Step.Next(e1, s2)
+		return r12 != -1 && r21 != -1 && r12 != r21
+	}
+
+	dontCare = make([]bool, len(cr.Schema.Vars))
+	for i := range cr.Schema.Vars {
+		dontCare[i] = true
+		if cr.cubeSize(dontCare) > maxMinimizeCube || !cr.allInCube(st, dontCare, witness) {
+			dontCare[i] = false
+		}
+	}
+	return dontCare
+}
+
+// cubeSize returns the number of states obtained by letting every variable
+// marked in free range over its domain.
+func (cr *CompiledRegistry) cubeSize(free []bool) int {
+	n := 1
+	for i, v := range cr.Schema.Vars {
+		if free[i] {
+			n *= v.Size
+			if n > maxMinimizeCube {
+				return n
+			}
+		}
+	}
+	return n
+}
+
+// allInCube reports whether pred holds for every state that agrees with st
+// on the variables not marked in free.
+func (cr *CompiledRegistry) allInCube(st registry.State, free []bool, pred func(registry.StateID) bool) bool {
+	lo := func(v registry.VarDef) int {
+		if v.Type == registry.TypeInt {
+			return v.Min
+		}
+		return 0
+	}
+	cur := append(registry.State(nil), st...)
+	var idx []int // free variables, odometer order
+	for i, v := range cr.Schema.Vars {
+		if free[i] {
+			idx = append(idx, i)
+			cur[i] = lo(v)
+		}
+	}
+	for {
+		if !pred(cr.Schema.Encode(cur)) {
+			return false
+		}
+		k := len(idx) - 1
+		for ; k >= 0; k-- {
+			v := cr.Schema.Vars[idx[k]]
+			cur[idx[k]]++
+			if cur[idx[k]] < lo(v)+v.Size {
+				break
+			}
+			cur[idx[k]] = lo(v)
+		}
+		if k < 0 {
+			return true
+		}
+	}
+}
+
+// fmtPartial formats st like fmtState, writing * for don't-care variables.
+func (cr *CompiledRegistry) fmtPartial(st registry.State, dontCare []bool) string {
+	parts := make([]string, len(st))
+	for i, v := range cr.Schema.Vars {
+		switch {
+		case dontCare[i]:
+			parts[i] = v.Name + "=*"
+		case v.Type == registry.TypeBool:
+			parts[i] = fmt.Sprintf("%s=%t", v.Name, st[i] == 1)
+		case v.Type == registry.TypeEnum:
+			parts[i] = v.Name + "=" + v.Values[st[i]]
+		default:
+			parts[i] = fmt.Sprintf("%s=%d", v.Name, st[i])
+		}
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
@@ -0,0 +1,84 @@
+package verify
+
+import (
+	"slices"
+	"testing"
+)
+
+// noisyPermissionsYAML is examples/permissions.yaml with a colour that no
+// grant, revoke or repair reads or writes: grant_read and grant_write fail
+// to commute from can_read=false whatever it is.
+const noisyPermissionsYAML = `
+registry:
+  name: noisy_permissions
+  states:
+    colour: {type: enum, values: [red, green, blue]}
+    can_read: {type: bool}
+    can_write: {type: bool}
+  invariants:
+    write_needs_read: {expr: "not (can_write and not can_read)"}
+  compensation:
+    - invariant: write_needs_read
+      repair: {can_write: "false"}
+  events:
+    grant_read: {effect: {can_read: "true"}}
+    grant_write: {effect: {can_write: "true"}}
+    paint: {effect: {colour: "green"}}
+`
+
+func TestMinimizeCC1(t *testing.T) {
+	cr, res := verifyYAML(t, noisyPermissionsYAML, Options{MinimizeCounterexamples: true})
+	if res.CC.CC1Pass {
+		t.Fatal("CC1 passed, want grant_read and grant_write to fail to commute")
+	}
+	if got, want := res.CC.CC1FailMinimal, "{colour=*, can_read=false, can_write=*}"; got != want {
+		t.Errorf("minimal counterexample %s, want %s", got, want)
+	}
+
+	e1 := slices.Index(cr.EvtNames, "grant_read")
+	e2 := slices.Index(cr.EvtNames, "grant_write")
+	tests := []struct {
+		state string
+		want  []bool // colour, can_read, can_write
+	}{
+		{"colour=red, can_read=false, can_write=false", []bool{true, false, true}},
+		{"colour=blue, can_read=false, can_write=true", []bool{true, false, true}},
+	}
+	for _, tt := range tests {
+		st, err := cr.Schema.ParseState(tt.state)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := cr.MinimizeCC1(e1, e2, st); !slices.Equal(got, tt.want) {
+			t.Errorf("MinimizeCC1 from %s = %v, want %v", tt.state, got, tt.want)
+		}
+	}
+
+	// Without the option the counterexample is left as found.
+	_, res = verifyYAML(t, noisyPermissionsYAML, Options{})
+	if res.CC.CC1FailMinimal != "" {
+		t.Errorf("minimal counterexample %s without MinimizeCounterexamples", res.CC.CC1FailMinimal)
+	}
+}
+
+func TestMinimizeExamples(t *testing.T) {
+	tests := []struct {
+		example string
+		want    string
+	}{
+		{"access_control.yaml", "{read_perm=r_none, write_perm=*, audited=true}"},
+		{"permissions.yaml", "{can_read=false, can_write=*}"},
+		{"traffic_light.yaml", "{ns=ns_green, ew=*}"},
+		{"workflow.yaml", "{review=draft, publish=*}"},
+	}
+	for _, tt := range tests {
+		cr := compileExample(t, tt.example, Options{MinimizeCounterexamples: true})
+		res, err := cr.Verify()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.example, err)
+		}
+		if got := res.CC.CC1FailMinimal; got != tt.want {
+			t.Errorf("%s: minimal counterexample %s, want %s", tt.example, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package verify
+
+import (
+	"fmt"
+
+	"github.com/blackwell-systems/nccheck/expr"
+	"github.com/blackwell-systems/nccheck/registry"
+)
+
+// Scope selects the states ForAll and Exists range over.
+type Scope int
+
+const (
+	// ScopeAll ranges over every state of the schema. It needs no tables.
+	ScopeAll Scope = iota
+	// ScopeValid ranges over the states satisfying every invariant.
+	ScopeValid
+	// ScopeReachable ranges over the states reachable from the initial
+	// state, as in Reachable.
+	ScopeReachable
+)
+
+// ForAll reports whether the boolean expression src holds in every state
+// of scope. If not, it also returns the counterexample with the lowest
+// StateID. Tables are built if the scope needs them.
+func (cr *CompiledRegistry) ForAll(src string, scope Scope) (bool, registry.State, error) {
+	found, st, err := cr.findState(src, scope, false)
+	return !found, st, err
+}
+
+// Exists reports whether the boolean expression src holds in some state of
+// scope, and returns the witness with the lowest StateID. Tables are built
+// if the scope needs them.
+func (cr *CompiledRegistry) Exists(src string, scope Scope) (bool, registry.State, error) {
+	return cr.findState(src, scope, true)
+}
+
+// findState returns the first state of scope, in StateID order, where src
+// evaluates to want.
+func (cr *CompiledRegistry) findState(src string, scope Scope, want bool) (bool, registry.State, error) {
+	node, err := cr.parse(src)
+	if err != nil {
+		return false, nil, err
+	}
+	t, err := cr.typecheck(node, nil)
+	if err != nil {
+		return false, nil, err
+	}
+	if t.Kind != expr.KindBool {
+		return false, nil, fmt.Errorf("property must be bool, got %s", t.Kind)
+	}
+
+	var in []bool // nil: every state
+	switch scope {
+	case ScopeValid:
+		if err := cr.ensureTables(); err != nil {
+			return false, nil, err
+		}
+		in = cr.Valid
+	case ScopeReachable:
+		if err := cr.ensureTables(); err != nil {
+			return false, nil, err
+		}
+		if in, err = cr.Reachable(); err != nil {
+			return false, nil, err
+		}
+	}
+
+	for sid := 0; sid < cr.Schema.TotalLen; sid++ {
+		if in != nil && !in[sid] {
+			continue
+		}
+		st := cr.Schema.Decode(registry.StateID(sid))
+		v, err := expr.EvalBool(node, cr.makeEnv(st))
+		if err != nil {
+			return false, nil, fmt.Errorf("at state %s: %w", cr.fmtState(st), err)
+		}
+		if v == want {
+			return true, st, nil
+		}
+	}
+	return false, nil, nil
+}
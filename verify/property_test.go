@@ -0,0 +1,54 @@
+package verify
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestForAllExists(t *testing.T) {
+	const inv = "not frozen or balance == 0"
+	tests := []struct {
+		exists  bool // Exists rather than ForAll
+		src     string
+		scope   Scope
+		want    bool
+		wantSt  string // the counterexample or witness; "" if none
+		wantErr string
+	}{
+		{false, "balance <= 10", ScopeAll, true, "", ""},
+		{false, inv, ScopeAll, false, "{balance=1, frozen=true}", ""},
+		{false, inv, ScopeValid, true, "", ""},
+		{false, inv, ScopeReachable, true, "", ""},
+		{false, "balance < 10", ScopeReachable, false, "{balance=10, frozen=false}", ""},
+		{true, "frozen and balance > 0", ScopeAll, true, "{balance=1, frozen=true}", ""},
+		{true, "frozen and balance > 0", ScopeValid, false, "", ""},
+		{true, "balance == 7", ScopeReachable, true, "{balance=7, frozen=false}", ""},
+		{false, "balance + 1", ScopeAll, false, "", "property must be bool, got int"},
+		{true, "nope", ScopeAll, false, "", `undefined identifier "nope"`},
+	}
+	cr := compileYAML(t, walletYAML, Options{})
+	for _, tt := range tests {
+		name, check := "ForAll", cr.ForAll
+		if tt.exists {
+			name, check = "Exists", cr.Exists
+		}
+		got, st, err := check(tt.src, tt.scope)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s(%q): error %v, want %q", name, tt.src, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s(%q, %d): %v", name, tt.src, tt.scope, err)
+			continue
+		}
+		gotSt := ""
+		if st != nil {
+			gotSt = cr.fmtState(st)
+		}
+		if got != tt.want || gotSt != tt.wantSt {
+			t.Errorf("%s(%q, %d) = %v, %q, want %v, %q", name, tt.src, tt.scope, got, gotSt, tt.want, tt.wantSt)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package verify
+
+import (
+	"fmt"
+
+	"github.com/blackwell-systems/nccheck/registry"
+)
+
+// InitialState converts the registry's initial valuation into a State.
+// Every variable must be given an initial value.
+func (cr *CompiledRegistry) InitialState() (registry.State, error) {
+	if len(cr.Reg.Initial) == 0 {
+		return nil, fmt.Errorf("registry %q has no initial state", cr.Reg.Name)
+	}
+	st := make(registry.State, len(cr.Schema.Vars))
+	for i, v := range cr.Schema.Vars {
+		raw, ok := cr.Reg.Initial[v.Name]
+		if !ok {
+			return nil, fmt.Errorf("initial state: missing value for %q", v.Name)
+		}
+		val, err := cr.Schema.ParseValue(i, fmt.Sprintf("%v", raw))
+		if err != nil {
+			return nil, fmt.Errorf("initial state: %w", err)
+		}
+		st[i] = val
+	}
+	for name := range cr.Reg.Initial {
+		if cr.Schema.VarIndex(name) < 0 {
+			return nil, fmt.Errorf("initial state: unknown variable %q", name)
+		}
+	}
+	return st, nil
+}
+
+// Reachable returns, for every state, whether it is reachable from the
+// normal form of the initial state by a sequence of enabled transitions.
+// Requires tables.
+func (cr *CompiledRegistry) Reachable() ([]bool, error) {
+	init, err := cr.InitialState()
+	if err != nil {
+		return nil, err
+	}
+	seen := make([]bool, cr.Schema.TotalLen)
+	start := cr.NF[cr.Schema.Encode(init)]
+	seen[start] = true
+	queue := []registry.StateID{start}
+	for polled := 0; len(queue) > 0; polled++ {
+		if err := cr.interrupted("reachability", polled); err != nil {
+			return nil, err
+		}
+		sid := queue[0]
+		queue = queue[1:]
+		for ei := range cr.EvtNames {
+			next := cr.Step.Next(ei, sid)
+			if next == -1 || seen[next] {
+				continue
+			}
+			seen[next] = true
+			queue = append(queue, next)
+		}
+	}
+	return seen, nil
+}
+
+// ReachableCount returns the number of states reachable from the initial
+// state. Requires tables.
+func (cr *CompiledRegistry) ReachableCount() (int, error) {
+	seen, err := cr.Reachable()
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, ok := range seen {
+		if ok {
+			count++
+		}
+	}
+	return count, nil
+}
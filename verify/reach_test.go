@@ -0,0 +1,61 @@
+package verify
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReachableCount(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want int
+	}{
+		// x in 0..3 and y in 0..x: 1+2+3+4 states.
+		{"chain", chainYAML, 10},
+		// Every unfrozen balance, and frozen only when empty.
+		{"wallet", walletYAML, 12},
+	}
+	for _, tt := range tests {
+		cr := compileYAML(t, tt.src, Options{})
+		if err := cr.BuildTables(); err != nil {
+			t.Fatal(err)
+		}
+		got, err := cr.ReachableCount()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: %d reachable states, want %d", tt.name, got, tt.want)
+		}
+		seen, err := cr.Reachable()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for sid, ok := range seen {
+			if ok && !cr.Valid[sid] {
+				t.Errorf("%s: reachable state %d is invalid", tt.name, sid)
+			}
+		}
+	}
+}
+
+func TestInitialStateErrors(t *testing.T) {
+	tests := []struct {
+		initial string
+		wantErr string
+	}{
+		{"{balance: 0, frozen: false}", ""},
+		{"{balance: 0}", `initial state: missing value for "frozen"`},
+		{"{balance: 0, frozen: false, extra: 1}", `initial state: unknown variable "extra"`},
+		{"{balance: 11, frozen: false}", "initial state: balance: 11 outside range [0, 10]"},
+	}
+	for _, tt := range tests {
+		src := strings.Replace(walletYAML, "{balance: 0, frozen: false}", tt.initial, 1)
+		cr := compileYAML(t, src, Options{})
+		_, err := cr.InitialState()
+		if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+			t.Errorf("initial %s: error %v, want %q", tt.initial, err, tt.wantErr)
+		}
+	}
+}
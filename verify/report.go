@@ -0,0 +1,281 @@
+package verify
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const rule = "════════════════════════════════════════════"
+
+// FormatReport renders a verification result as the human-readable text
+// report printed by the nccheck CLI.
+func FormatReport(r *Result) string {
+	var b strings.Builder
+
+	// Header.
+	fmt.Fprintf(&b, "nccheck — Normalization Confluence Verifier\n")
+	fmt.Fprintf(&b, "%s\n\n", rule)
+	fmt.Fprintf(&b, "Registry:    %s\n", r.Name)
+	fmt.Fprintf(&b, "Source:      %s\n\n", r.Source)
+
+	// State space summary.
+	fmt.Fprintf(&b, "State Space\n")
+	fmt.Fprintf(&b, "  Variables: %s\n", r.VarSummary)
+	fmt.Fprintf(&b, "  Total:     %d states\n", r.StateCount)
+	if len(r.Encoding) > 0 {
+		fmt.Fprintf(&b, "  Encoding:  (canonical order; StateID = Σ value × stride)\n")
+		for _, line := range r.Encoding {
+			fmt.Fprintf(&b, "    %s\n", line)
+		}
+	}
+	fmt.Fprintf(&b, "  Valid:     %d\n", r.ValidStates)
+	fmt.Fprintf(&b, "  Invalid:   %d\n", r.InvalidStates)
+	if r.ReachableStates > 0 {
+		fmt.Fprintf(&b, "  Reachable: %d of %d states\n", r.ReachableStates, r.StateCount)
+	}
+	fmt.Fprintln(&b)
+
+	// Events and invariants.
+	fmt.Fprintf(&b, "Events:      %d  [%s]\n", len(r.Events), strings.Join(r.Events, ", "))
+	if len(r.Excluded) > 0 {
+		fmt.Fprintf(&b, "Excluded:    %d  [%s]  (events filter)\n", len(r.Excluded), strings.Join(r.Excluded, ", "))
+	}
+	if r.Transitions != len(r.Events) {
+		fmt.Fprintf(&b, "Transitions: %d  (parameterized events expanded)\n", r.Transitions)
+	}
+	if r.EnabledTransitions > 0 {
+		fmt.Fprintf(&b, "Enabled:     %d (state, transition) pairs, avg out-degree %.2f\n",
+			r.EnabledTransitions, r.AvgOutDegree)
+	}
+	fmt.Fprintf(&b, "Invariants:  %d  [%s]\n", len(r.Invariants), strings.Join(r.Invariants, ", "))
+	if r.Focus != "" {
+		fmt.Fprintf(&b, "Focus:       %s  (all other invariants ignored)\n", r.Focus)
+	}
+	if r.Shard != "" {
+		fmt.Fprintf(&b, "Shard:       %s  (CC covers this shard's states only; a global PASS needs every shard)\n", r.Shard)
+	}
+	fmt.Fprintln(&b)
+
+	// WFC.
+	fmt.Fprintf(&b, "WFC (Well-Founded Compensation)\n")
+	if r.WFCPass {
+		fmt.Fprintf(&b, "  Result:    PASS\n")
+		fmt.Fprintf(&b, "  Max depth: %d\n\n", r.WFCMaxDepth)
+		if len(r.Deepest) > 0 {
+			fmt.Fprintf(&b, "Deepest Repair Chains (top %d)\n", len(r.Deepest))
+			for _, d := range r.Deepest {
+				fmt.Fprintf(&b, "  depth %-3d %s → %s\n", d.Depth, d.State, d.NF)
+			}
+			fmt.Fprintln(&b)
+		}
+	} else {
+		fmt.Fprintf(&b, "  Result:    FAIL\n")
+		fmt.Fprintf(&b, "  Failure:   %s\n", r.WFCBadState)
+		if r.WFCFailCount > 1 {
+			fmt.Fprintf(&b, "  Failing:   %d states\n", r.WFCFailCount)
+		}
+		if len(r.WFCGroups) > 0 {
+			fmt.Fprintf(&b, "  By invariant (repair applied last):\n")
+			for _, g := range r.WFCGroups {
+				name := g.Invariant
+				if name == "" {
+					name = "(no repair)"
+				}
+				fmt.Fprintf(&b, "    %s: %d states, %s, e.g. %s\n", name, g.States, g.Kind, g.State)
+			}
+		}
+		fmt.Fprintln(&b)
+	}
+
+	// CC.
+	cc := &r.CC
+	fmt.Fprintf(&b, "CC (Compensation Commutativity)\n")
+	if cc.CC1Pass {
+		fmt.Fprintf(&b, "  CC1:       PASS  (%d independent pairs checked, %d dependent skipped)\n",
+			cc.PairsChecked, cc.DependentSkipped)
+		if cc.Sampled {
+			fmt.Fprintf(&b, "    Sampled, not exhaustive: %d of %d independent pairs (seed %d)\n",
+				cc.PairsChecked, cc.PairsTotal, cc.SampleSeed)
+		}
+	} else {
+		fmt.Fprintf(&b, "  CC1:       FAIL\n")
+		fmt.Fprintf(&b, "    Events:  (%s, %s)\n", cc.CC1FailEvent1, cc.CC1FailEvent2)
+		fmt.Fprintf(&b, "    State:   %s\n", cc.CC1FailState)
+		if cc.CC1FailMinimal != "" {
+			fmt.Fprintf(&b, "    Minimal: %s  (* = any value)\n", cc.CC1FailMinimal)
+		}
+		fmt.Fprintf(&b, "    Order 1: %s → %s → %s\n",
+			cc.CC1FailEvent1, cc.CC1FailEvent2, cc.CC1FailNF1)
+		fmt.Fprintf(&b, "    Order 2: %s → %s → %s\n",
+			cc.CC1FailEvent2, cc.CC1FailEvent1, cc.CC1FailNF2)
+		if cc.CC1FailCount > 1 {
+			fmt.Fprintf(&b, "    Failing: %d pairs, %d states total\n", len(cc.CC1Failures), cc.CC1FailCount)
+			for _, pf := range cc.CC1Failures {
+				if pf.Minimal != "" {
+					fmt.Fprintf(&b, "      (%s, %s): %d states, e.g. %s, minimal %s\n", pf.Event1, pf.Event2, pf.States, pf.State, pf.Minimal)
+				} else {
+					fmt.Fprintf(&b, "      (%s, %s): %d states, e.g. %s\n", pf.Event1, pf.Event2, pf.States, pf.State)
+				}
+			}
+		}
+	}
+	if len(cc.DependentPairs) > 0 {
+		commuting := 0
+		for _, dp := range cc.DependentPairs {
+			if dp.Commutes {
+				commuting++
+			}
+		}
+		fmt.Fprintf(&b, "  Dependent: %d pairs checked, %d commute\n", len(cc.DependentPairs), commuting)
+		for _, dp := range cc.DependentPairs {
+			if !dp.Commutes {
+				fmt.Fprintf(&b, "    (%s, %s): does not commute, e.g. at %s\n", dp.Event1, dp.Event2, dp.State)
+			}
+		}
+	}
+	if cc.CC2Pass {
+		fmt.Fprintf(&b, "  CC2:       PASS\n")
+	} else {
+		fmt.Fprintf(&b, "  CC2:       FAIL\n")
+		fmt.Fprintf(&b, "    Event:   %s\n", cc.CC2FailEvent)
+		fmt.Fprintf(&b, "    State:   %s\n", cc.CC2FailState)
+		fmt.Fprintf(&b, "    NF(s):   %s\n", cc.CC2FailNFState)
+		if cc.CC2FailReason != "" {
+			fmt.Fprintf(&b, "    Reason:  %s\n", cc.CC2FailReason)
+		}
+		fmt.Fprintf(&b, "    Step(e,s):     → %s\n", cc.CC2FailNF1)
+		fmt.Fprintf(&b, "    Step(e,NF(s)): → %s\n", cc.CC2FailNF2)
+		if cc.CC2FailCount > 1 {
+			fmt.Fprintf(&b, "    Failing: %d (event, state) instances\n", cc.CC2FailCount)
+		}
+	}
+	fmt.Fprintln(&b)
+
+	if len(r.OrderSensitivity) > 0 {
+		fmt.Fprintf(&b, "Order Sensitivity (non-commuting independent pairs, worst first)\n")
+		for i, ps := range r.OrderSensitivity {
+			fmt.Fprintf(&b, "  %2d. (%s, %s): %d of %d states (%.1f%%), e.g. %s\n", i+1, ps.Event1, ps.Event2,
+				ps.Failing, ps.Compared, 100*float64(ps.Failing)/float64(ps.Compared), ps.State)
+		}
+		fmt.Fprintln(&b)
+	}
+
+	if len(r.RepairInterference) > 0 {
+		fmt.Fprintf(&b, "Repair Interference (repairs that violate an invariant which held, most frequent first)\n")
+		for _, ix := range r.RepairInterference {
+			fmt.Fprintf(&b, "  repair for %q breaks %q in %d state(s), e.g. %s → %s\n",
+				ix.Repaired, ix.Broken, ix.States, ix.Before, ix.After)
+		}
+		fmt.Fprintln(&b)
+	}
+
+	if len(r.Idempotence) > 0 {
+		fmt.Fprintf(&b, "Idempotence (Step(e, Step(e, s)) = Step(e, s))\n")
+		for _, ir := range r.Idempotence {
+			if ir.Pass {
+				fmt.Fprintf(&b, "  %-20s PASS\n", ir.Event)
+				continue
+			}
+			fmt.Fprintf(&b, "  %-20s FAIL\n", ir.Event)
+			fmt.Fprintf(&b, "    State:   %s\n", ir.State)
+			fmt.Fprintf(&b, "    Once:    → %s\n", ir.Once)
+			fmt.Fprintf(&b, "    Twice:   → %s\n", ir.Twice)
+			if ir.FailCount > 1 {
+				fmt.Fprintf(&b, "    Failing: %d states\n", ir.FailCount)
+			}
+		}
+		fmt.Fprintln(&b)
+	}
+
+	if r.Dependencies != nil {
+		writeDependencies(&b, r.Events, r.Dependencies)
+	}
+
+	if len(r.Warnings) > 0 {
+		fmt.Fprintf(&b, "Warnings\n")
+		for _, w := range r.Warnings {
+			fmt.Fprintf(&b, "  ! %s\n", w)
+		}
+		fmt.Fprintln(&b)
+	}
+
+	// Summary.
+	fmt.Fprintf(&b, "%s\n", rule)
+	if r.WFCPass && cc.CCPass && cc.Sampled {
+		fmt.Fprintf(&b, "Convergence:         NOT REFUTED (CC1 sampled, not exhaustive)\n")
+	} else if r.WFCPass && cc.CCPass {
+		fmt.Fprintf(&b, "Unique Normal Form:  YES\n")
+		fmt.Fprintf(&b, "Convergence:         GUARANTEED\n")
+	} else {
+		fmt.Fprintf(&b, "Convergence:         NOT GUARANTEED\n")
+		if !r.WFCPass {
+			fmt.Fprintf(&b, "  ✗ WFC failed\n")
+		}
+		if !cc.CC1Pass {
+			fmt.Fprintf(&b, "  ✗ CC1 failed\n")
+		}
+		if !cc.CC2Pass {
+			fmt.Fprintf(&b, "  ✗ CC2 failed\n")
+		}
+	}
+	if !r.IdempotencePass() {
+		fmt.Fprintf(&b, "  ✗ Idempotence failed\n")
+	}
+	fmt.Fprintf(&b, "Checked in:          %v\n", r.Elapsed.Round(time.Microsecond))
+
+	return b.String()
+}
+
+// writeDependencies renders each event's read/write sets followed by a
+// matrix marking which event pairs CC1 treats as independent.
+func writeDependencies(b *strings.Builder, events []string, deps map[string]Dependencies) {
+	fmt.Fprintf(b, "Event Dependencies\n")
+	width := 0
+	for _, name := range events {
+		width = max(width, len(name))
+	}
+	list := func(vars []string) string {
+		if len(vars) == 0 {
+			return "-"
+		}
+		return strings.Join(vars, ", ")
+	}
+	for i, name := range events {
+		d := deps[name]
+		fmt.Fprintf(b, "  %2d %-*s  reads: %s  writes: %s\n", i+1, width, name, list(d.Reads), list(d.Writes))
+	}
+
+	fmt.Fprintf(b, "\n  Independence (. independent, x dependent)\n     ")
+	for i := range events {
+		fmt.Fprintf(b, " %2d", i+1)
+	}
+	fmt.Fprintln(b)
+	for i, e1 := range events {
+		fmt.Fprintf(b, "  %2d ", i+1)
+		for j, e2 := range events {
+			mark := "x"
+			if i != j && deps[e1].independentOf(deps[e2]) {
+				mark = "."
+			}
+			fmt.Fprintf(b, "  %s", mark)
+		}
+		fmt.Fprintln(b)
+	}
+	fmt.Fprintln(b)
+}
+
+// String returns the text report for r.
+func (r *Result) String() string {
+	return FormatReport(r)
+}
+
+// FormatJSON renders a verification result as indented JSON.
+func FormatJSON(r *Result) (string, error) {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data) + "\n", nil
+}
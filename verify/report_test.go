@@ -0,0 +1,156 @@
+package verify
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden reports in testdata")
+
+func TestFormatReportGolden(t *testing.T) {
+	for _, name := range []string{"wallet.yaml", "counters.yaml", "order_fulfillment.yaml"} {
+		cr := compileExample(t, name, Options{})
+		res, err := cr.Verify()
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Source = "examples/" + name
+		res.Elapsed = 1500 * time.Microsecond
+		got := FormatReport(res)
+		if s := res.String(); s != got {
+			t.Errorf("%s: String() differs from FormatReport", name)
+		}
+
+		golden := filepath.Join("testdata", strings.TrimSuffix(name, ".yaml")+".golden")
+		if *update {
+			if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		want, err := os.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != string(want) {
+			t.Errorf("%s: report differs from %s (run with -update to accept):\n%s", name, golden, got)
+		}
+	}
+}
+
+func TestFormatJSONRoundTrip(t *testing.T) {
+	for _, name := range []string{"wallet.yaml", "counters.yaml"} {
+		cr := compileExample(t, name, Options{AllFailures: true})
+		res, err := cr.Verify()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.ReachableStates, err = cr.ReachableCount(); err != nil {
+			t.Fatal(err)
+		}
+		out, err := FormatJSON(res)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var back Result
+		if err := json.Unmarshal([]byte(out), &back); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		again, err := FormatJSON(&back)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again != out {
+			t.Errorf("%s: JSON does not round-trip:\n%s\nthen:\n%s", name, out, again)
+		}
+		if back.ReachableStates != res.ReachableStates || back.WFCPass != res.WFCPass || back.CC.CCPass != res.CC.CCPass {
+			t.Errorf("%s: decoded %+v, want %+v", name, back, res)
+		}
+	}
+}
+
+func TestEventDependencies(t *testing.T) {
+	const src = `
+registry:
+  name: deps
+  states:
+    a: {type: int, range: [0, 2]}
+    b: {type: int, range: [0, 2]}
+    c: {type: bool}
+    d: {type: bool}
+  initial: {a: 0, b: 0, c: false, d: false}
+  invariants:
+    any: {expr: "true"}
+  events:
+    move:
+      guard: "a < 2 and not d"
+      effect: {b: "if c then 1 else 0", a: "a + 1"}
+    reset:
+      effect: {a: 0, b: 0}
+    set:
+      params:
+        v: {type: bool}
+      effect: {c: v}
+    idle: {}
+`
+	cr := compileYAML(t, src, Options{})
+	want := map[string]Dependencies{
+		"move":  {Reads: []string{"a", "c", "d"}, Writes: []string{"a", "b"}},
+		"reset": {Reads: []string{}, Writes: []string{"a", "b"}},
+		"set":   {Reads: []string{}, Writes: []string{"c"}},
+		"idle":  {Reads: []string{}, Writes: []string{}},
+	}
+	if got := cr.EventDependencies(); !reflect.DeepEqual(got, want) {
+		t.Errorf("EventDependencies() = %v, want %v", got, want)
+	}
+}
+
+func TestDependenciesIndependentOf(t *testing.T) {
+	deps := func(reads, writes []string) Dependencies {
+		return Dependencies{Reads: reads, Writes: writes}
+	}
+	tests := []struct {
+		name string
+		d, o Dependencies
+		want bool
+	}{
+		{"disjoint", deps([]string{"x"}, []string{"x"}), deps([]string{"y"}, []string{"y"}), true},
+		{"shared reads", deps([]string{"x"}, []string{"y"}), deps([]string{"x"}, []string{"z"}), true},
+		{"write/write", deps(nil, []string{"x"}), deps(nil, []string{"x"}), false},
+		{"write/read", deps(nil, []string{"x"}), deps([]string{"x"}, nil), false},
+		{"read/write", deps([]string{"x"}, nil), deps(nil, []string{"x"}), false},
+		{"empty", deps(nil, nil), deps(nil, nil), true},
+	}
+	for _, tt := range tests {
+		if got := tt.d.independentOf(tt.o); got != tt.want {
+			t.Errorf("%s: independentOf = %v, want %v", tt.name, got, tt.want)
+		}
+		if got := tt.o.independentOf(tt.d); got != tt.want {
+			t.Errorf("%s (swapped): independentOf = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// The dependency report's independence matrix must agree with the test CC1
+// uses on the compiled access sets.
+func TestDependencyMatrixMatchesCC1(t *testing.T) {
+	for _, name := range exampleNames {
+		cr := compileExample(t, name, Options{})
+		reads, writes := cr.accessSets()
+		deps := cr.EventDependencies()
+		for i, e1 := range cr.Reg.Events {
+			for j, e2 := range cr.Reg.Events {
+				want := independent(reads[i], writes[i], reads[j], writes[j])
+				if got := deps[e1.Name].independentOf(deps[e2.Name]); got != want {
+					t.Errorf("%s: %s/%s independentOf = %v, independent = %v", name, e1.Name, e2.Name, got, want)
+				}
+			}
+		}
+	}
+}
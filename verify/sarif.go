@@ -0,0 +1,143 @@
+package verify
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// SARIF 2.1.0 types, limited to the fields FormatSARIF emits.
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool      sarifTool       `json:"tool"`
+	Artifacts []sarifArtifact `json:"artifacts,omitempty"`
+	Results   []sarifResult   `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifArtifact struct {
+	Location sarifArtifactLocation `json:"location"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation *sarifPhysicalLocation `json:"physicalLocation,omitempty"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+
+type sarifLogicalLocation struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+}
+
+// sarifRules are the properties FormatSARIF reports on, in ruleIndex order.
+var sarifRules = []sarifRule{
+	{"WFC", sarifMessage{"Compensation terminates in a valid state from every state"}},
+	{"CC1", sarifMessage{"Independent events commute up to compensation"}},
+	{"CC2", sarifMessage{"Compensation does not change where an event leads"}},
+	{"IDEMPOTENCE", sarifMessage{"An event declared idempotent has the same effect applied twice"}},
+}
+
+// FormatSARIF renders r as a SARIF 2.1.0 log for code-scanning tools, with
+// one error result per failed property: WFC, each failing CC1 pair, CC2,
+// and each failing idempotent event. Results point at the registry file
+// and name the events involved as logical locations; the Result carries no
+// line numbers, so no region is given.
+func FormatSARIF(r *Result) (string, error) {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "nccheck",
+			InformationURI: "https://github.com/blackwell-systems/nccheck",
+			Rules:          sarifRules,
+		}},
+		Results: []sarifResult{},
+	}
+	if r.Source != "" {
+		run.Artifacts = []sarifArtifact{{Location: sarifArtifactLocation{URI: r.Source}}}
+	}
+	add := func(rule int, msg string, events ...string) {
+		loc := sarifLocation{}
+		if r.Source != "" {
+			loc.PhysicalLocation = &sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: r.Source}}
+		}
+		for _, e := range events {
+			loc.LogicalLocations = append(loc.LogicalLocations, sarifLogicalLocation{Name: e, Kind: "function"})
+		}
+		res := sarifResult{RuleID: sarifRules[rule].ID, RuleIndex: rule, Level: "error", Message: sarifMessage{msg}}
+		if loc.PhysicalLocation != nil || len(loc.LogicalLocations) > 0 {
+			res.Locations = []sarifLocation{loc}
+		}
+		run.Results = append(run.Results, res)
+	}
+
+	if !r.WFCPass {
+		add(0, fmt.Sprintf("%s: %s", r.Name, r.WFCBadState))
+	}
+	cc := &r.CC
+	for _, pf := range cc.CC1Failures {
+		add(1, fmt.Sprintf("%s: events %s and %s do not commute at %s: %s then %s reaches %s, the reverse order %s",
+			r.Name, pf.Event1, pf.Event2, pf.State, pf.Event1, pf.Event2, pf.NF1, pf.NF2), pf.Event1, pf.Event2)
+	}
+	if !cc.CC2Pass {
+		msg := fmt.Sprintf("%s: event %s at %s reaches %s, but from its normal form %s reaches %s",
+			r.Name, cc.CC2FailEvent, cc.CC2FailState, cc.CC2FailNF1, cc.CC2FailNFState, cc.CC2FailNF2)
+		if cc.CC2FailReason != "" {
+			msg += " (" + cc.CC2FailReason + ")"
+		}
+		add(2, msg, cc.CC2FailEvent)
+	}
+	for _, ir := range r.Idempotence {
+		if !ir.Pass {
+			add(3, fmt.Sprintf("%s: event %s is not idempotent at %s: once reaches %s, twice %s",
+				r.Name, ir.Event, ir.State, ir.Once, ir.Twice), ir.Event)
+		}
+	}
+
+	data, err := json.MarshalIndent(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	}, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data) + "\n", nil
+}
@@ -0,0 +1,96 @@
+package verify
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+func TestFormatSARIF(t *testing.T) {
+	tests := []struct {
+		name      string
+		result    func() *Result
+		wantRules []string // ruleId of each result, in order
+	}{
+		{"wallet", func() *Result {
+			res, err := compileExample(t, "wallet.yaml", Options{}).Verify()
+			if err != nil {
+				t.Fatal(err)
+			}
+			return res
+		}, nil},
+		{"counters", func() *Result {
+			res, err := compileExample(t, "counters.yaml", Options{AllFailures: true}).Verify()
+			if err != nil {
+				t.Fatal(err)
+			}
+			return res
+		}, []string{"CC1", "CC1", "CC1", "CC1", "CC2"}},
+		{"diverge", func() *Result {
+			_, res := verifyYAML(t, divergeYAML, Options{AllFailures: true})
+			return res
+		}, []string{"WFC"}},
+	}
+	for _, tt := range tests {
+		res := tt.result()
+		res.Source = "specs/" + tt.name + ".yaml"
+		out, err := FormatSARIF(res)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		var log struct {
+			Schema  string `json:"$schema"`
+			Version string `json:"version"`
+			Runs    []struct {
+				Tool struct {
+					Driver struct {
+						Name  string `json:"name"`
+						Rules []struct {
+							ID string `json:"id"`
+						} `json:"rules"`
+					} `json:"driver"`
+				} `json:"tool"`
+				Artifacts []struct {
+					Location struct {
+						URI string `json:"uri"`
+					} `json:"location"`
+				} `json:"artifacts"`
+				Results []struct {
+					RuleID    string `json:"ruleId"`
+					RuleIndex int    `json:"ruleIndex"`
+					Level     string `json:"level"`
+					Message   struct {
+						Text string `json:"text"`
+					} `json:"message"`
+				} `json:"results"`
+			} `json:"runs"`
+		}
+		if err := json.Unmarshal([]byte(out), &log); err != nil {
+			t.Fatalf("%s: SARIF is not valid JSON: %v", tt.name, err)
+		}
+		if log.Version != "2.1.0" || log.Schema == "" || len(log.Runs) != 1 {
+			t.Fatalf("%s: version %q, $schema %q, %d runs; want 2.1.0, a schema and one run", tt.name, log.Version, log.Schema, len(log.Runs))
+		}
+		run := log.Runs[0]
+		if run.Tool.Driver.Name != "nccheck" || len(run.Tool.Driver.Rules) == 0 {
+			t.Errorf("%s: driver %q with %d rules", tt.name, run.Tool.Driver.Name, len(run.Tool.Driver.Rules))
+		}
+		if len(run.Artifacts) != 1 || run.Artifacts[0].Location.URI != res.Source {
+			t.Errorf("%s: artifacts %+v, want the registry file", tt.name, run.Artifacts)
+		}
+		var rules []string
+		for _, r := range run.Results {
+			rules = append(rules, r.RuleID)
+			if r.RuleIndex >= len(run.Tool.Driver.Rules) || run.Tool.Driver.Rules[r.RuleIndex].ID != r.RuleID {
+				t.Errorf("%s: result for %s has rule index %d", tt.name, r.RuleID, r.RuleIndex)
+			}
+			if r.Level != "error" || r.Message.Text == "" {
+				t.Errorf("%s: result for %s has level %q, message %q", tt.name, r.RuleID, r.Level, r.Message.Text)
+			}
+		}
+		if !slices.Equal(rules, tt.wantRules) {
+			t.Errorf("%s: results for %v, want %v", tt.name, rules, tt.wantRules)
+		}
+	}
+}
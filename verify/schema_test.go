@@ -0,0 +1,124 @@
+package verify
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+// validate checks v, decoded from JSON, against the subset of JSON Schema
+// that JSONSchema emits: type, properties, required, items and
+// additionalProperties.
+func validate(schema map[string]interface{}, v interface{}, path string) error {
+	var types []string
+	switch ty := schema["type"].(type) {
+	case string:
+		types = []string{ty}
+	case []interface{}:
+		for _, s := range ty {
+			types = append(types, s.(string))
+		}
+	}
+	var got string
+	switch v.(type) {
+	case nil:
+		got = "null"
+	case bool:
+		got = "boolean"
+	case string:
+		got = "string"
+	case float64:
+		got = "number"
+		if n := v.(float64); n == float64(int64(n)) && slices.Contains(types, "integer") {
+			got = "integer"
+		}
+	case []interface{}:
+		got = "array"
+	case map[string]interface{}:
+		got = "object"
+	}
+	if len(types) > 0 && !slices.Contains(types, got) {
+		return fmt.Errorf("%s: got %s, want %v", path, got, types)
+	}
+
+	switch v := v.(type) {
+	case []interface{}:
+		items, _ := schema["items"].(map[string]interface{})
+		for i, e := range v {
+			if err := validate(items, e, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		if props, ok := schema["properties"].(map[string]interface{}); ok {
+			for _, r := range schema["required"].([]interface{}) {
+				if _, ok := v[r.(string)]; !ok {
+					return fmt.Errorf("%s: missing required %q", path, r)
+				}
+			}
+			for k, e := range v {
+				p, ok := props[k].(map[string]interface{})
+				if !ok {
+					return fmt.Errorf("%s: unexpected property %q", path, k)
+				}
+				if err := validate(p, e, path+"."+k); err != nil {
+					return err
+				}
+			}
+		} else if extra, ok := schema["additionalProperties"].(map[string]interface{}); ok {
+			for k, e := range v {
+				if err := validate(extra, e, path+"."+k); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func TestJSONSchemaValidatesResult(t *testing.T) {
+	data, err := JSONSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatalf("schema is not valid JSON: %v", err)
+	}
+
+	tests := []struct {
+		example string
+		opts    Options
+	}{
+		{"wallet.yaml", Options{}},
+		{"counters.yaml", Options{AllFailures: true}},
+		{"workflow.yaml", Options{CheckDependentPairs: true}},
+		{"order_fulfillment.yaml", Options{}},
+	}
+	for _, tt := range tests {
+		cr := compileExample(t, tt.example, tt.opts)
+		res, err := cr.Verify()
+		if err != nil {
+			t.Fatalf("%s: verify: %v", tt.example, err)
+		}
+		out, err := FormatJSON(res)
+		if err != nil {
+			t.Fatalf("%s: FormatJSON: %v", tt.example, err)
+		}
+		var v interface{}
+		if err := json.Unmarshal([]byte(out), &v); err != nil {
+			t.Fatalf("%s: %v", tt.example, err)
+		}
+		if err := validate(schema, v, "$"); err != nil {
+			t.Errorf("%s: %v", tt.example, err)
+		}
+
+		// The validator is not vacuous: a field the schema does not
+		// describe is rejected.
+		v.(map[string]interface{})["bogus"] = 1
+		if err := validate(schema, v, "$"); err == nil {
+			t.Errorf("%s: an unknown property passed validation", tt.example)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package verify
+
+import (
+	"sort"
+
+	"github.com/blackwell-systems/nccheck/registry"
+)
+
+// PairSensitivity counts, for one independent transition pair, the states
+// where CC1 compares the two orders and those where they disagree.
+type PairSensitivity struct {
+	Event1   string `json:"event1"`
+	Event2   string `json:"event2"`
+	Failing  int    `json:"failing"`  // states where the two orders reach different states
+	Compared int    `json:"compared"` // states where both orders run to completion
+	State    string `json:"state"`    // the lowest failing state
+}
+
+// OrderSensitivity runs CC1 over every independent transition pair to
+// completion, ignoring sampling and fail-fast, and returns the pairs that
+// fail to commute anywhere, worst first: by failing states, then by the
+// failing fraction of compared states, then in declaration order. Only the
+// shard's states are compared. Requires tables.
+func (cr *CompiledRegistry) OrderSensitivity() ([]PairSensitivity, error) {
+	lo, hi := cr.Opts.Shard.Range(cr.Schema.TotalLen)
+	reads, writes := cr.accessSets()
+	var out []PairSensitivity
+	polled := 0
+	for e1 := range cr.EvtNames {
+		for e2 := e1 + 1; e2 < len(cr.EvtNames); e2++ {
+			s1, s2 := cr.EvtSource[e1], cr.EvtSource[e2]
+			if !independent(reads[s1], writes[s1], reads[s2], writes[s2]) {
+				continue
+			}
+			ps := PairSensitivity{Event1: cr.EvtNames[e1], Event2: cr.EvtNames[e2]}
+			for sid := lo; sid < hi; sid++ {
+				if err := cr.interrupted("order sensitivity", polled); err != nil {
+					return nil, err
+				}
+				polled++
+				compared, commutes := cr.commutesAt(e1, e2, registry.StateID(sid))
+				if !compared {
+					continue
+				}
+				ps.Compared++
+				if !commutes {
+					if ps.Failing == 0 {
+						ps.State = cr.fmtState(cr.Schema.Decode(registry.StateID(sid)))
+					}
+					ps.Failing++
+				}
+			}
+			if ps.Failing > 0 {
+				out = append(out, ps)
+			}
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.Failing != b.Failing {
+			return a.Failing > b.Failing
+		}
+		return a.Failing*b.Compared > b.Failing*a.Compared
+	})
+	return out, nil
+}
+
+// commutesAt reports whether CC1 compares transitions e1 and e2 at sid
+// (both enabled there, and each enabled after the other) and, if so,
+// whether the two orders reach the same state.
+func (cr *CompiledRegistry) commutesAt(e1, e2 int, sid registry.StateID) (compared, commutes bool) {
+	s1, s2 := cr.Step.Next(e1, sid), cr.Step.Next(e2, sid)
+	if s1 == -1 || s2 == -1 {
+		return false, false
+	}
+	r12, r21 := cr.Step.Next(e2, s1), cr.Step.Next(e1, s2)
+	if r12 == -1 || r21 == -1 {
+		return false, false
+	}
+	return true, r12 == r21
+}
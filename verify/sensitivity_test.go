@@ -0,0 +1,70 @@
+package verify
+
+import (
+	"reflect"
+	"testing"
+)
+
+// sensitivityYAML has two problematic pairs, each an event granting a
+// flag and another needing it: (grant_read, grant_write) and (make_admin,
+// start_audit). Their repairs also leave two cross pairs non-commuting.
+const sensitivityYAML = `
+registry:
+  name: sens
+  states:
+    can_read: {type: bool}
+    can_write: {type: bool}
+    admin: {type: bool}
+    audit: {type: bool}
+  invariants:
+    write_needs_read: {expr: "not (can_write and not can_read)"}
+    audit_needs_admin: {expr: "not (audit and not admin)"}
+  compensation:
+    - invariant: write_needs_read
+      repair: {can_write: "false"}
+    - invariant: audit_needs_admin
+      repair: {audit: "false"}
+  events:
+    grant_read: {effect: {can_read: "true"}}
+    grant_write: {effect: {can_write: "true"}}
+    make_admin: {guard: "not can_write", effect: {admin: "true"}}
+    start_audit: {effect: {audit: "true"}}
+`
+
+func TestOrderSensitivity(t *testing.T) {
+	const none = "{can_read=false, can_write=false, admin=false, audit=false}"
+	want := []PairSensitivity{
+		{Event1: "grant_read", Event2: "grant_write", Failing: 8, Compared: 16, State: none},
+		// Ties on failing states go to the higher failing fraction.
+		{Event1: "make_admin", Event2: "start_audit", Failing: 4, Compared: 8, State: none},
+		{Event1: "grant_read", Event2: "start_audit", Failing: 4, Compared: 16,
+			State: "{can_read=false, can_write=true, admin=false, audit=false}"},
+		{Event1: "grant_read", Event2: "make_admin", Failing: 2, Compared: 8,
+			State: "{can_read=false, can_write=false, admin=false, audit=true}"},
+	}
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"default", Options{}},
+		// The ranking ignores fail-fast and sampling.
+		{"all failures", Options{AllFailures: true}},
+		{"sampled", Options{MaxCCPairs: 1, SampleSeed: 1}},
+	}
+	for _, tt := range tests {
+		cr, _ := verifyYAML(t, sensitivityYAML, tt.opts)
+		got, err := cr.OrderSensitivity()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: OrderSensitivity() =\n%+v\nwant\n%+v", tt.name, got, want)
+		}
+	}
+
+	// A registry whose pairs all commute ranks nothing.
+	cr := compileExample(t, "wallet.yaml", Options{})
+	if got, err := cr.OrderSensitivity(); err != nil || len(got) != 0 {
+		t.Errorf("wallet.yaml: OrderSensitivity() = %+v, %v; want none", got, err)
+	}
+}
@@ -0,0 +1,112 @@
+package verify
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/blackwell-systems/nccheck/registry"
+)
+
+// RegistryStats summarizes the size and shape of a registry, for tracking
+// how a spec grows over time.
+type RegistryStats struct {
+	Name               string `json:"name"`
+	Variables          int    `json:"variables"`
+	BoolVars           int    `json:"bool_vars"`
+	EnumVars           int    `json:"enum_vars"`
+	IntVars            int    `json:"int_vars"`
+	States             int    `json:"states"`
+	ValidStates        int    `json:"valid_states"`
+	Invariants         int    `json:"invariants"`
+	Events             int    `json:"events"`
+	Transitions        int    `json:"transitions"`         // after parameter expansion
+	EnabledTransitions int    `json:"enabled_transitions"` // enabled Step entries
+	IndependentPairs   int    `json:"independent_pairs"`   // transition pairs CC1 compares
+	DependentPairs     int    `json:"dependent_pairs"`
+	ReachableStates    *int   `json:"reachable_states,omitempty"` // nil without an initial state
+	MaxRepairDepth     *int   `json:"max_repair_depth,omitempty"` // nil if repair does not terminate
+}
+
+// RegistryStats computes the stats of the compiled registry, building the
+// tables if needed.
+func (cr *CompiledRegistry) RegistryStats() (*RegistryStats, error) {
+	if err := cr.ensureTables(); err != nil {
+		return nil, err
+	}
+	s := &RegistryStats{
+		Name:        cr.Reg.Name,
+		Variables:   len(cr.Schema.Vars),
+		States:      cr.Schema.TotalLen,
+		Invariants:  len(cr.InvExprs),
+		Events:      len(cr.Reg.Events),
+		Transitions: len(cr.EvtNames),
+	}
+	for _, v := range cr.Schema.Vars {
+		switch v.Type {
+		case registry.TypeBool:
+			s.BoolVars++
+		case registry.TypeEnum:
+			s.EnumVars++
+		case registry.TypeInt:
+			s.IntVars++
+		}
+	}
+	s.ValidStates, _ = cr.Stats()
+	s.EnabledTransitions, _ = cr.TransitionStats()
+
+	reads, writes := cr.accessSets()
+	for e1 := range cr.EvtNames {
+		for e2 := e1 + 1; e2 < len(cr.EvtNames); e2++ {
+			s1, s2 := cr.EvtSource[e1], cr.EvtSource[e2]
+			if independent(reads[s1], writes[s1], reads[s2], writes[s2]) {
+				s.IndependentPairs++
+			} else {
+				s.DependentPairs++
+			}
+		}
+	}
+
+	if len(cr.Reg.Initial) > 0 {
+		n, err := cr.ReachableCount()
+		if err != nil {
+			return nil, err
+		}
+		s.ReachableStates = &n
+	}
+	if depths, err := cr.repairDepths(); err == nil {
+		max := 0
+		for _, d := range depths {
+			if d > max {
+				max = d
+			}
+		}
+		s.MaxRepairDepth = &max
+	}
+	return s, nil
+}
+
+// String renders the stats as aligned "key: value" lines.
+func (s *RegistryStats) String() string {
+	var b strings.Builder
+	line := func(key string, format string, args ...interface{}) {
+		fmt.Fprintf(&b, "%-20s %s\n", key+":", fmt.Sprintf(format, args...))
+	}
+	line("Registry", "%s", s.Name)
+	line("Variables", "%d  (%d bool, %d enum, %d int)", s.Variables, s.BoolVars, s.EnumVars, s.IntVars)
+	line("States", "%d  (%d valid)", s.States, s.ValidStates)
+	line("Invariants", "%d", s.Invariants)
+	line("Events", "%d", s.Events)
+	line("Transitions", "%d  (%d enabled)", s.Transitions, s.EnabledTransitions)
+	line("Pairs", "%d independent, %d dependent", s.IndependentPairs, s.DependentPairs)
+	if s.ReachableStates != nil {
+		line("Reachable states", "%d", *s.ReachableStates)
+	} else {
+		line("Reachable states", "n/a (no initial state)")
+	}
+	if s.MaxRepairDepth != nil {
+		line("Max repair depth", "%d", *s.MaxRepairDepth)
+	} else {
+		line("Max repair depth", "n/a (repair does not terminate)")
+	}
+	return b.String()
+}
@@ -0,0 +1,85 @@
+package verify
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// statsYAML is small enough to count by hand; see TestRegistryStats.
+const statsYAML = `
+registry:
+  name: stats
+  states:
+    x: {type: int, range: [0, 3]}
+    b: {type: bool}
+    mode: {type: enum, values: [idle, run]}
+  initial: {x: 0, b: false, mode: idle}
+  invariants:
+    small: {expr: "x < 3"}
+    b_needs_run: {expr: "not (b and mode == idle)"}
+  compensation:
+    - invariant: small
+      repair: {x: "x - 1"}
+    - invariant: b_needs_run
+      repair: {b: "false"}
+  events:
+    inc: {guard: "x < 3", effect: {x: "x + 1"}}
+    toggle: {effect: {b: "not b"}}
+    start: {effect: {mode: "run"}}
+    set:
+      params:
+        v: {type: int, range: [0, 1]}
+      guard: "mode == run"
+      effect: {x: v}
+`
+
+func TestRegistryStats(t *testing.T) {
+	intp := func(n int) *int { return &n }
+	// 16 states; valid are x < 3 with (b, mode) one of (false, idle),
+	// (false, run), (true, run). Enabled: inc in 12 states, toggle and
+	// start in all 16, each set binding in the 8 with mode=run. Of the 10
+	// transition pairs, inc/toggle, inc/start, toggle/start and
+	// toggle/set(v=0|1) are independent. From x=0, b=false, mode=idle
+	// every valid state is reachable; x=3, b=true, mode=idle takes two
+	// repairs.
+	full := RegistryStats{
+		Name: "stats", Variables: 3, BoolVars: 1, EnumVars: 1, IntVars: 1,
+		States: 16, ValidStates: 9, Invariants: 2, Events: 4,
+		Transitions: 5, EnabledTransitions: 60,
+		IndependentPairs: 5, DependentPairs: 5,
+		ReachableStates: intp(9), MaxRepairDepth: intp(2),
+	}
+	noInitial := full
+	noInitial.ReachableStates = nil
+
+	diverge := RegistryStats{
+		Name: "diverge", Variables: 1, IntVars: 1,
+		States: 4, ValidStates: 2, Invariants: 1, Events: 1,
+		Transitions: 1, EnabledTransitions: 3,
+		ReachableStates: intp(4),
+	}
+
+	tests := []struct {
+		name string
+		src  string
+		opts Options
+		want RegistryStats
+	}{
+		{"stats", statsYAML, Options{}, full},
+		{"no initial", strings.Replace(statsYAML, "  initial: {x: 0, b: false, mode: idle}\n", "", 1), Options{}, noInitial},
+		// Repair from x=2 never terminates, so there is no max depth;
+		// inc still counts as enabled wherever its guard holds.
+		{"diverge", divergeYAML, Options{AllFailures: true}, diverge},
+	}
+	for _, tt := range tests {
+		cr := compileYAML(t, tt.src, tt.opts)
+		got, err := cr.RegistryStats()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(*got, tt.want) {
+			t.Errorf("%s: RegistryStats() =\n%s\nwant\n%s", tt.name, got, &tt.want)
+		}
+	}
+}
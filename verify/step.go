@@ -0,0 +1,134 @@
+package verify
+
+import (
+	"math/bits"
+
+	"github.com/blackwell-systems/nccheck/registry"
+)
+
+// StepTable is the precomputed transition relation: for each transition e
+// and state s, the normal form reached by firing e at s and compensating.
+type StepTable interface {
+	// Next returns Step(e, s), or -1 if e is not enabled at s.
+	Next(e int, s registry.StateID) registry.StateID
+	// Enabled returns the number of states where e is enabled.
+	Enabled(e int) int
+	// Bytes returns the approximate memory held by the table.
+	Bytes() int64
+}
+
+// stepBuilder fills a StepTable. Each transition's entries must be set in
+// increasing state order, and finish called once all are set.
+type stepBuilder interface {
+	StepTable
+	set(e int, s, next registry.StateID)
+	finish()
+}
+
+func newStepTable(sparse bool, transitions, states int) stepBuilder {
+	if sparse {
+		return newSparseStep(transitions, states)
+	}
+	return newDenseStep(transitions, states)
+}
+
+// DenseStep stores every entry, -1 for disabled: DenseStep[e][s]. Lookups
+// are a single index, but memory is transitions × states StateIDs however
+// few transitions are enabled.
+type DenseStep [][]registry.StateID
+
+func newDenseStep(transitions, states int) DenseStep {
+	d := make(DenseStep, transitions)
+	for e := range d {
+		d[e] = make([]registry.StateID, states)
+		for s := range d[e] {
+			d[e][s] = -1
+		}
+	}
+	return d
+}
+
+func (d DenseStep) Next(e int, s registry.StateID) registry.StateID { return d[e][s] }
+
+func (d DenseStep) Enabled(e int) int {
+	n := 0
+	for _, next := range d[e] {
+		if next != -1 {
+			n++
+		}
+	}
+	return n
+}
+
+func (d DenseStep) Bytes() int64 {
+	if len(d) == 0 {
+		return 0
+	}
+	return int64(len(d)) * int64(len(d[0])) * 8
+}
+
+func (d DenseStep) set(e int, s, next registry.StateID) { d[e][s] = next }
+
+func (d DenseStep) finish() {}
+
+// SparseStep stores, per transition, a bitmap of the states where it is
+// enabled and the successors of those states only, in state order. A
+// lookup ranks the state among the enabled ones using per-word popcount
+// prefixes. Memory is about one bit per state plus one StateID per enabled
+// entry, which pays off when most transitions are disabled in most states.
+type SparseStep []sparseRow
+
+type sparseRow struct {
+	enabled []uint64           // bit s set if the transition is enabled at s
+	rank    []int32            // rank[w] = enabled states before word w
+	next    []registry.StateID // successors of the enabled states, in state order
+}
+
+func newSparseStep(transitions, states int) SparseStep {
+	sp := make(SparseStep, transitions)
+	words := (states + 63) / 64
+	for e := range sp {
+		sp[e] = sparseRow{enabled: make([]uint64, words), rank: make([]int32, words)}
+	}
+	return sp
+}
+
+func (sp SparseStep) Next(e int, s registry.StateID) registry.StateID {
+	row := &sp[e]
+	w, bit := int(s)/64, uint(s)%64
+	word := row.enabled[w]
+	if word&(1<<bit) == 0 {
+		return -1
+	}
+	return row.next[int(row.rank[w])+bits.OnesCount64(word&(1<<bit-1))]
+}
+
+func (sp SparseStep) Enabled(e int) int { return len(sp[e].next) }
+
+func (sp SparseStep) Bytes() int64 {
+	var n int64
+	for _, row := range sp {
+		n += int64(len(row.enabled))*8 + int64(len(row.rank))*4 + int64(len(row.next))*8
+	}
+	return n
+}
+
+func (sp SparseStep) set(e int, s, next registry.StateID) {
+	if next == -1 {
+		return
+	}
+	row := &sp[e]
+	row.enabled[int(s)/64] |= 1 << (uint(s) % 64)
+	row.next = append(row.next, next)
+}
+
+func (sp SparseStep) finish() {
+	for e := range sp {
+		row := &sp[e]
+		var n int32
+		for w, word := range row.enabled {
+			row.rank[w] = n
+			n += int32(bits.OnesCount64(word))
+		}
+	}
+}
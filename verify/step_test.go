@@ -0,0 +1,102 @@
+package verify
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/blackwell-systems/nccheck/registry"
+)
+
+func TestSparseStepMatchesDense(t *testing.T) {
+	tests := []struct {
+		states  int
+		density float64 // fraction of enabled entries
+	}{
+		{1, 1},
+		{63, 0.5},
+		{64, 0.5},
+		{65, 0.1},
+		{200, 0},
+		{200, 1},
+		{1000, 0.02},
+	}
+	rng := rand.New(rand.NewSource(1))
+	for _, tt := range tests {
+		const transitions = 3
+		dense := newStepTable(false, transitions, tt.states)
+		sparse := newStepTable(true, transitions, tt.states)
+		for e := 0; e < transitions; e++ {
+			for s := 0; s < tt.states; s++ {
+				next := registry.StateID(-1)
+				if rng.Float64() < tt.density {
+					next = registry.StateID(rng.Intn(tt.states))
+				}
+				dense.set(e, registry.StateID(s), next)
+				sparse.set(e, registry.StateID(s), next)
+			}
+		}
+		dense.finish()
+		sparse.finish()
+		for e := 0; e < transitions; e++ {
+			if d, s := dense.Enabled(e), sparse.Enabled(e); d != s {
+				t.Errorf("%d states: Enabled(%d) dense %d, sparse %d", tt.states, e, d, s)
+			}
+			for s := 0; s < tt.states; s++ {
+				sid := registry.StateID(s)
+				if d, sp := dense.Next(e, sid), sparse.Next(e, sid); d != sp {
+					t.Errorf("%d states: Next(%d, %d) dense %d, sparse %d", tt.states, e, s, d, sp)
+				}
+			}
+		}
+	}
+}
+
+func TestSparseStepVerifiesTheSame(t *testing.T) {
+	for _, name := range exampleNames {
+		dense := compileExample(t, name, Options{})
+		sparse := compileExample(t, name, Options{SparseStep: true})
+		if _, ok := sparse.Step.(SparseStep); !ok {
+			t.Fatalf("%s: Step is %T, want SparseStep", name, sparse.Step)
+		}
+		for e := range dense.EvtNames {
+			for s := range dense.Valid {
+				sid := registry.StateID(s)
+				if d, sp := dense.Step.Next(e, sid), sparse.Step.Next(e, sid); d != sp {
+					t.Errorf("%s: Next(%s, %d) dense %d, sparse %d", name, dense.EvtNames[e], s, d, sp)
+				}
+			}
+		}
+		rd, err := dense.Verify()
+		if err != nil {
+			t.Fatal(err)
+		}
+		rs, err := sparse.Verify()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rd.WFCPass != rs.WFCPass || rd.CC.CCPass != rs.CC.CCPass || rd.CC.CC1FailState != rs.CC.CC1FailState {
+			t.Errorf("%s: dense and sparse verdicts differ", name)
+		}
+	}
+}
+
+func TestTableBytesFollowsStepLayout(t *testing.T) {
+	for _, name := range exampleNames {
+		dense := compileExample(t, name, Options{})
+		sparse := compileExample(t, name, Options{SparseStep: true})
+		dlo, dhi := dense.TableBytes()
+		if dlo != dhi {
+			t.Errorf("%s: dense estimate is a range, %d to %d", name, dlo, dhi)
+		}
+		// The dense Step table is counted exactly, so the rest of the
+		// estimate is the part shared by both layouts.
+		fixed := dlo - dense.Step.Bytes()
+		slo, shi := sparse.TableBytes()
+		if got := sparse.Step.Bytes(); got < slo-fixed || got > shi-fixed {
+			t.Errorf("%s: sparse Step holds %d bytes, estimated %d to %d", name, got, slo-fixed, shi-fixed)
+		}
+		if slo >= dlo {
+			t.Errorf("%s: sparse minimum %d is not below the dense %d", name, slo, dlo)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package verify
+
+import (
+	"fmt"
+
+	"github.com/blackwell-systems/nccheck/registry"
+)
+
+// TraceStep is one compensation step: the invariant repaired and the
+// state it produced.
+type TraceStep struct {
+	Invariant string
+	State     registry.State
+}
+
+// RepairTrace returns the compensation steps taken from st to its normal
+// form; it is empty if st is valid. It evaluates repairs directly and does
+// not need tables.
+func (cr *CompiledRegistry) RepairTrace(st registry.State) ([]TraceStep, error) {
+	if err := cr.Schema.CheckState(st); err != nil {
+		return nil, err
+	}
+	var steps []TraceStep
+	current := cr.Schema.Encode(st)
+	for len(steps) < MaxRepairIter {
+		next, ri, err := cr.repairStep(current)
+		if err != nil {
+			return steps, err
+		}
+		if ri < 0 {
+			return steps, nil
+		}
+		steps = append(steps, TraceStep{
+			Invariant: cr.Reg.Invariants[ri].Name,
+			State:     cr.Schema.Decode(next),
+		})
+		current = next
+	}
+	return steps, fmt.Errorf("%w within %d steps from state %s",
+		ErrCompensationNonTerminating, MaxRepairIter, cr.fmtState(st))
+}
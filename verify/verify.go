@@ -1,8 +1,14 @@
 package verify
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"math/rand"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/blackwell-systems/nccheck/expr"
 	"github.com/blackwell-systems/nccheck/registry"
@@ -11,56 +17,373 @@ import (
 // CompiledRegistry holds precompiled expressions and lookup tables.
 type CompiledRegistry struct {
 	Reg          *registry.Registry
+	Opts         Options
 	Schema       registry.Schema
 	EnumLiterals map[string]int
 
-	InvExprs []*expr.Node // parsed invariant expressions
-	RepExprs []map[int]*expr.Node // repair[i] -> varIdx -> parsed expr
-	EvtGuards []*expr.Node // nil if no guard
+	InvExprs  []*expr.Node         // parsed invariant expressions
+	RepExprs  []map[int]*expr.Node // repair[i] -> varIdx -> parsed expr
+	EvtGuards []*expr.Node         // nil if no guard
 	EvtExprs  []map[int]*expr.Node // event[i] -> varIdx -> parsed expr
 
+	// Repairs[i] lists the repairs for invariant i, as indices into
+	// RepExprs in declaration order. Repairs are matched to invariants by
+	// name; when there are several, repairStep tries them in turn.
+	Repairs [][]int
+
+	// Events are expanded into transitions, one per parameter combination.
+	// All Evt* slices are indexed by transition; unparameterized events
+	// contribute exactly one transition.
+	EvtNames  []string                // transition name, e.g. "deposit(n=3)"
+	EvtSource []int                   // transition -> index into Reg.Events
+	EvtParams []map[string]expr.Value // nil if the event has no params
+
 	// Precomputed tables.
-	Valid []bool                // Valid[stateID] = V(state)
-	NF    []registry.StateID   // NF[stateID] = normal form
-	Step  [][]registry.StateID // Step[eventIdx][stateID] = NF(apply(e, state))
-	// -1 in Step means event not enabled at that state.
+	Valid []bool             // Valid[stateID] = V(state)
+	NF    []registry.StateID // NF[stateID] = normal form
+	Step  StepTable          // Step.Next(eventIdx, stateID) = NF(apply(e, state))
+	// -1 from Step.Next means event not enabled at that state.
+
+	// Scratch buffers reused across evaluations to avoid per-state
+	// allocation. Table building is single-threaded; pre holds the decoded
+	// state being evaluated and post the state being written, so effects
+	// always read an unmodified pre-state.
+	env  *expr.Env
+	pre  registry.State
+	post registry.State
+
+	// diverges marks states whose compensation did not terminate; only
+	// populated under Opts.AllFailures, where NF[s] is left as s.
+	diverges []bool
+
+	// depth[s] is the number of repair steps from s to NF[s], or -1 while
+	// unresolved (and for diverging states).
+	depth []int
+
+	// repairOrder lists invariant indices in the order repairStep tries
+	// them, as determined by Opts.Repair.
+	repairOrder []int
+
+	// invSat[i] counts the states satisfying invariant i.
+	invSat []int
+
+	// holds memoizes invariant truth per state, filled alongside Valid:
+	// bit i of holds[s*invWords+i/64] is set if invariant i holds at s.
+	// repairStep consults it instead of re-evaluating the invariants, so
+	// each invariant is evaluated once per state. Nil until BuildTables.
+	holds    []uint64
+	invWords int
+
+	// stalls[i] records the repair steps for invariant i that did not
+	// progress (see repairStep), found while computing normal forms; stalled marks their
+	// source states (bit s of stalled[s/64]) so that a step revisited by
+	// a diverging chain is counted once.
+	stalls  []repairStall
+	stalled []uint64
+
+	// ctx, if set by BuildTablesContext or VerifyContext, is polled by the
+	// long loops; see interrupted.
+	ctx context.Context
+
+	// excluded lists the declared events left out by Opts.Events.
+	excluded []string
+
+	// moves[e] records whether transition e changed the raw state at any
+	// state where it is enabled, before compensation.
+	moves []bool
+
+	// parsed caches parse results by source string, so an expression
+	// repeated across invariants, repairs and events shares one AST.
+	// Nodes are never modified once parsed and resolved.
+	parsed map[string]*expr.Node
 }
 
 // Result holds verification results.
 type Result struct {
-	StateCount int
-	VarSummary string
-
-	WFCPass       bool
-	WFCMaxDepth   int
-	WFCError      string
-	WFCBadState   string
-
-	CCPass        bool
-	CC1Pass       bool
-	CC2Pass       bool
-	CC1Error      string
-	CC2Error      string
-	CC1Pair       [2]string // event names
-	CC1State      string
-	CC1Trace1     string
-	CC1Trace2     string
-
-	EventCount    int
-	InvariantCount int
-	PairsChecked  int
-	ValidStates   int
-	InvalidStates int
+	Name   string `json:"name"`
+	Source string `json:"source"`
+
+	VarSummary      string `json:"var_summary"` // e.g. "x:int[0..5] × flag:bool"
+	StateCount      int    `json:"state_count"`
+	ValidStates     int    `json:"valid_states"`
+	InvalidStates   int    `json:"invalid_states"`
+	ReachableStates int    `json:"reachable_states,omitempty"` // 0 if not computed
+
+	Events      []string `json:"events"`      // declared event names
+	Transitions int      `json:"transitions"` // transitions after parameter expansion
+	Invariants  []string `json:"invariants"`
+	Focus       string   `json:"focus,omitempty"`    // the only active invariant, if focused
+	Excluded    []string `json:"excluded,omitempty"` // events left out by Options.Events
+	Shard       string   `json:"shard,omitempty"`    // "i/N" if CC covered one shard only
+
+	Encoding []string `json:"encoding,omitempty"` // per-variable value encoding, if canonicalized
+
+	EnabledTransitions int     `json:"enabled_transitions,omitempty"` // enabled Step entries; 0 if not computed
+	AvgOutDegree       float64 `json:"avg_out_degree,omitempty"`      // EnabledTransitions / StateCount
+
+	WFCPass      bool         `json:"wfc_pass"`
+	WFCMaxDepth  int          `json:"wfc_max_depth"`
+	WFCBadState  string       `json:"wfc_bad_state,omitempty"`
+	WFCFailCount int          `json:"wfc_fail_count,omitempty"` // failing states (all of them under AllFailures)
+	WFCGroups    []WFCGroup   `json:"wfc_groups,omitempty"`     // optional failures by invariant
+	Deepest      []DepthEntry `json:"deepest,omitempty"`        // optional deepest-repair report
+
+	CC CCResult `json:"cc"`
+
+	OrderSensitivity []PairSensitivity `json:"order_sensitivity,omitempty"` // optional CC1 ranking, worst pair first
+
+	RepairInterference []RepairInterference `json:"repair_interference,omitempty"` // optional; repairs breaking other invariants
+
+	Idempotence []IdempotenceResult `json:"idempotence,omitempty"` // events declared idempotent
+
+	Warnings []string `json:"warnings,omitempty"` // non-fatal modelling issues
+
+	Dependencies map[string]Dependencies `json:"dependencies,omitempty"` // per-event read/write sets; nil if not requested
+
+	Elapsed time.Duration `json:"elapsed_ns"`
 }
 
 const MaxStates = 1_000_000
+
+// MaxTransitions caps the transitions all events expand to. The Step table
+// holds one row per transition, and CC1 compares pairs of them.
+const MaxTransitions = 10_000
 const MaxRepairIter = 1000
 
-// Compile parses all expressions and builds the compiled registry.
+// MinUsefulStates is the smallest state space not reported as trivial.
+const MinUsefulStates = 2
+
+// Options configures compilation and checking.
+type Options struct {
+	// StrictCC2 reports states where an event is enabled at s but not at
+	// NF(s), or vice versa, as CC2 failures. By default such states are
+	// skipped.
+	StrictCC2 bool
+
+	// AllFailures runs every check to completion, counting all failing
+	// states and pairs, instead of stopping at the first counterexample.
+	AllFailures bool
+
+	// MaxCCPairs, when positive, caps the independent pairs CC1 compares.
+	// If there are more, MaxCCPairs of them are drawn at random using
+	// SampleSeed (a time-based seed if zero) and the result is marked as
+	// sampled: a pass is then evidence, not proof.
+	MaxCCPairs int
+	SampleSeed int64
+
+	// Seed, if non-zero, makes BuildTables visit states in a pseudo-random
+	// order drawn from it when computing validity and normal forms, instead
+	// of StateID order. Results must not depend on the order, so a run
+	// whose result differs from the unseeded one exposes a checker bug.
+	Seed int64
+
+	// MinimizeCounterexamples generalizes each CC1 counterexample to the
+	// variables it depends on; see MinimizeCC1.
+	MinimizeCounterexamples bool
+
+	// CheckDependentPairs runs the CC1 comparison on dependent event pairs
+	// too and reports whether each commutes, without failing CC1.
+	// StrictDependentPairs does the same and counts non-commuting
+	// dependent pairs as CC1 failures.
+	CheckDependentPairs  bool
+	StrictDependentPairs bool
+
+	// StrictArith makes a division that leaves a remainder in an effect or
+	// repair an error rather than truncating.
+	StrictArith bool
+
+	// OutOfRange decides what an effect or repair does when it computes a
+	// value outside its int target's range. The zero value,
+	// OutOfRangeError, aborts table building with a SPEC ERROR; the
+	// others change the model's semantics.
+	OutOfRange OutOfRangePolicy
+
+	// Shard restricts the per-state CC loops to one slice of the StateID
+	// range; tables and the independence analysis still cover all states.
+	// The zero value checks every state.
+	Shard Shard
+
+	// MaxStates overrides the MaxStates cap on the state space when
+	// positive. Table memory grows linearly with it; see TableBytes.
+	MaxStates int
+
+	// MaxTransitions overrides the MaxTransitions cap on the expanded
+	// transitions when positive.
+	MaxTransitions int
+
+	// SparseStep stores the Step table sparsely (see SparseStep), trading
+	// slower lookups for memory proportional to the enabled transitions.
+	SparseStep bool
+
+	// Repair selects which violated invariant is repaired at each
+	// compensation step. The zero value is RepairFirstDeclared.
+	Repair RepairStrategy
+
+	// InvariantFocus, if set, names the only invariant (and repair) that is
+	// active; all others are ignored by table building and the checks.
+	InvariantFocus string
+
+	// Canonical sorts enum values, and with CanonicalAll also variables,
+	// before the schema is built, so that StateIDs do not depend on
+	// declaration order. The zero value keeps declaration order.
+	Canonical CanonicalOrder
+
+	// Events, if non-empty, names the only events that take part in table
+	// building and the checks; all others are excluded entirely.
+	Events []string
+
+	// Logger receives structured diagnostics (phases, counts, repair
+	// steps). Nil discards them.
+	Logger *slog.Logger
+}
+
+// RepairStrategy chooses the invariant repaired when several are violated.
+type RepairStrategy int
+
+const (
+	// RepairFirstDeclared repairs the first violated invariant in
+	// declaration order.
+	RepairFirstDeclared RepairStrategy = iota
+	// RepairPriority repairs the violated invariant with the highest
+	// priority, breaking ties by declaration order.
+	RepairPriority
+)
+
+// ParseRepairStrategy parses a strategy name: "first" or "priority".
+func ParseRepairStrategy(name string) (RepairStrategy, error) {
+	switch name {
+	case "first":
+		return RepairFirstDeclared, nil
+	case "priority":
+		return RepairPriority, nil
+	}
+	return 0, fmt.Errorf("unknown repair strategy %q (want first or priority)", name)
+}
+
+// OutOfRangePolicy handles an int assignment whose value falls outside
+// the target variable's declared range.
+type OutOfRangePolicy int
+
+const (
+	// OutOfRangeError reports a SPEC ERROR and stops table building.
+	OutOfRangeError OutOfRangePolicy = iota
+	// OutOfRangeClamp saturates the value at the nearest bound, so a
+	// counter at its max stays there.
+	OutOfRangeClamp
+	// OutOfRangeWrap reduces the value modulo the range size, so max+1
+	// becomes min, as in fixed-width arithmetic.
+	OutOfRangeWrap
+)
+
+// ParseOutOfRangePolicy parses a policy name: "error", "clamp" or "wrap".
+func ParseOutOfRangePolicy(name string) (OutOfRangePolicy, error) {
+	switch name {
+	case "error":
+		return OutOfRangeError, nil
+	case "clamp":
+		return OutOfRangeClamp, nil
+	case "wrap":
+		return OutOfRangeWrap, nil
+	}
+	return 0, fmt.Errorf("unknown out-of-range policy %q (want error, clamp or wrap)", name)
+}
+
+// Shard selects part Index (0-based) of Count equal slices of the state
+// space. CC passes globally only if it passes on every shard, and the
+// failure counts of all shards add up to those of an unsharded run.
+type Shard struct {
+	Index int
+	Count int
+}
+
+// ParseShard parses a 1-based "i/N" shard spec, such as "2/4".
+func ParseShard(spec string) (Shard, error) {
+	var i, n int
+	if _, err := fmt.Sscanf(spec, "%d/%d", &i, &n); err != nil || fmt.Sprintf("%d/%d", i, n) != spec {
+		return Shard{}, fmt.Errorf("invalid shard %q (want i/N, e.g. 2/4)", spec)
+	}
+	if n < 1 || i < 1 || i > n {
+		return Shard{}, fmt.Errorf("invalid shard %q: need 1 <= i <= N", spec)
+	}
+	return Shard{Index: i - 1, Count: n}, nil
+}
+
+// Range returns the half-open StateID range [lo, hi) of the shard in a
+// space of total states. A zero Shard covers everything.
+func (sh Shard) Range(total int) (lo, hi int) {
+	if sh.Count <= 1 {
+		return 0, total
+	}
+	return total * sh.Index / sh.Count, total * (sh.Index + 1) / sh.Count
+}
+
+// String formats the shard as the 1-based "i/N" accepted by ParseShard.
+func (sh Shard) String() string {
+	return fmt.Sprintf("%d/%d", sh.Index+1, sh.Count)
+}
+
+// CanonicalOrder selects how much of the schema is put in canonical order.
+type CanonicalOrder int
+
+const (
+	// CanonicalNone keeps the declared order of variables and enum values.
+	CanonicalNone CanonicalOrder = iota
+	// CanonicalEnums sorts each enum's values.
+	CanonicalEnums
+	// CanonicalAll sorts each enum's values and the variables by name.
+	CanonicalAll
+)
+
+// ParseCanonicalOrder parses an ordering name: "none", "enums" or "all".
+func ParseCanonicalOrder(name string) (CanonicalOrder, error) {
+	switch name {
+	case "none":
+		return CanonicalNone, nil
+	case "enums":
+		return CanonicalEnums, nil
+	case "all":
+		return CanonicalAll, nil
+	}
+	return 0, fmt.Errorf("unknown canonical order %q (want none, enums or all)", name)
+}
+
+// Compile parses all expressions and builds the compiled registry
+// with default options.
 func Compile(reg *registry.Registry) (*CompiledRegistry, error) {
+	return CompileWithOptions(reg, Options{})
+}
+
+// CompileWithOptions parses all expressions and builds the compiled registry.
+func CompileWithOptions(reg *registry.Registry, opts Options) (*CompiledRegistry, error) {
+	reg, err := inferAutoRanges(reg)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Canonical != CanonicalNone {
+		reg = reg.Canonical(opts.Canonical == CanonicalAll)
+	}
+	if opts.InvariantFocus != "" {
+		if reg, err = focusInvariant(reg, opts.InvariantFocus); err != nil {
+			return nil, err
+		}
+	}
+	var excluded []string
+	if len(opts.Events) > 0 {
+		if reg, excluded, err = filterEvents(reg, opts.Events); err != nil {
+			return nil, err
+		}
+	}
 	schema := registry.NewSchema(reg.Vars)
-	if schema.TotalLen > MaxStates {
-		return nil, fmt.Errorf("state space too large: %d (max %d)", schema.TotalLen, MaxStates)
+	maxStates := MaxStates
+	if opts.MaxStates > 0 {
+		maxStates = opts.MaxStates
+	}
+	maxTransitions := MaxTransitions
+	if opts.MaxTransitions > 0 {
+		maxTransitions = opts.MaxTransitions
+	}
+	if schema.TotalLen > maxStates {
+		return nil, fmt.Errorf("%w: %d (max %d)", ErrStateSpaceTooLarge, schema.TotalLen, maxStates)
 	}
 
 	enumLiterals, err := expr.BuildEnumLiterals(&schema)
@@ -70,16 +393,25 @@ func Compile(reg *registry.Registry) (*CompiledRegistry, error) {
 
 	cr := &CompiledRegistry{
 		Reg:          reg,
+		Opts:         opts,
 		Schema:       schema,
 		EnumLiterals: enumLiterals,
+		excluded:     excluded,
+		pre:          make(registry.State, len(schema.Vars)),
+		post:         make(registry.State, len(schema.Vars)),
 	}
+	cr.env = expr.NewEnv(&cr.Schema, nil, enumLiterals)
+	cr.repairOrder = repairOrder(reg.Invariants, opts.Repair)
 
 	// Parse invariant expressions.
 	for _, inv := range reg.Invariants {
-		node, err := expr.Parse(inv.Expr)
+		node, err := cr.parse(inv.Expr)
 		if err != nil {
 			return nil, fmt.Errorf("invariant %q: %w", inv.Name, err)
 		}
+		if _, err := cr.typecheck(node, nil); err != nil {
+			return nil, fmt.Errorf("invariant %q: %w", inv.Name, err)
+		}
 		cr.InvExprs = append(cr.InvExprs, node)
 	}
 
@@ -87,328 +419,1257 @@ func Compile(reg *registry.Registry) (*CompiledRegistry, error) {
 	for _, rep := range reg.Compensation {
 		repMap := make(map[int]*expr.Node)
 		for varName, exprStr := range rep.Assignments {
-			idx := schema.VarIndex(varName)
-			if idx < 0 {
-				return nil, fmt.Errorf("repair for %q: unknown variable %q", rep.Invariant, varName)
+			idx, err := cr.assignTarget(varName, nil)
+			if err != nil {
+				return nil, fmt.Errorf("repair for %q: %w", rep.Invariant, err)
 			}
-			node, err := expr.Parse(exprStr)
+			node, err := cr.parse(exprStr)
 			if err != nil {
 				return nil, fmt.Errorf("repair for %q, var %q: %w", rep.Invariant, varName, err)
 			}
+			if err := cr.checkAssignment(node, idx, nil); err != nil {
+				return nil, fmt.Errorf("repair for %q, var %q: %w", rep.Invariant, varName, err)
+			}
 			repMap[idx] = node
 		}
 		cr.RepExprs = append(cr.RepExprs, repMap)
 	}
+	cr.Repairs = make([][]int, len(reg.Invariants))
+	for i, rep := range reg.Compensation {
+		ii := invariantIndex(reg.Invariants, rep.Invariant)
+		if ii < 0 {
+			return nil, fmt.Errorf("repair for %q: no invariant named %q", rep.Invariant, rep.Invariant)
+		}
+		cr.Repairs[ii] = append(cr.Repairs[ii], i)
+	}
 
-	// Parse event expressions.
-	for _, evt := range reg.Events {
+	// Parse event expressions and expand parameterized events.
+	for ei, evt := range reg.Events {
 		var guard *expr.Node
 		if evt.Guard != "" {
-			guard, err = expr.Parse(evt.Guard)
+			guard, err = cr.parse(evt.Guard)
 			if err != nil {
 				return nil, fmt.Errorf("event %q guard: %w", evt.Name, err)
 			}
+			if _, err := cr.typecheck(guard, evt.Params); err != nil {
+				return nil, fmt.Errorf("event %q guard: %w", evt.Name, err)
+			}
+		}
+
+		evtMap := make(map[int]*expr.Node)
+		for varName, exprStr := range evt.Assignments {
+			idx, err := cr.assignTarget(varName, evt.Params)
+			if err != nil {
+				return nil, fmt.Errorf("event %q: %w", evt.Name, err)
+			}
+			node, err := cr.parse(exprStr)
+			if err != nil {
+				return nil, fmt.Errorf("event %q, var %q: %w", evt.Name, varName, err)
+			}
+			if err := cr.checkAssignment(node, idx, evt.Params); err != nil {
+				return nil, fmt.Errorf("event %q, var %q: %w", evt.Name, varName, err)
+			}
+			evtMap[idx] = node
+		}
+
+		if len(cr.EvtNames)+paramCombinations(evt, maxTransitions) > maxTransitions {
+			return nil, fmt.Errorf("%w: event %q takes the count over %d", ErrTooManyTransitions, evt.Name, maxTransitions)
+		}
+		names, bindings, err := cr.expandParams(evt)
+		if err != nil {
+			return nil, err
+		}
+		for i := range names {
+			cr.EvtGuards = append(cr.EvtGuards, guard)
+			cr.EvtExprs = append(cr.EvtExprs, evtMap)
+			cr.EvtNames = append(cr.EvtNames, names[i])
+			cr.EvtSource = append(cr.EvtSource, ei)
+			cr.EvtParams = append(cr.EvtParams, bindings[i])
+		}
+	}
+
+	return cr, nil
+}
+
+// paramCombinations returns the number of transitions evt expands to, the
+// product of its parameter domain sizes, or limit+1 if that exceeds limit.
+// It does not overflow on wide ranges.
+func paramCombinations(evt registry.Event, limit int) int {
+	n := 1
+	for _, p := range evt.Params {
+		if p.Size > 0 && n > limit/p.Size {
+			return limit + 1
+		}
+		n *= p.Size
+	}
+	return n
+}
+
+// focusInvariant returns a copy of reg keeping only the named invariant and
+// its repairs.
+func focusInvariant(reg *registry.Registry, name string) (*registry.Registry, error) {
+	out := *reg
+	out.Invariants, out.Compensation = nil, nil
+	for _, inv := range reg.Invariants {
+		if inv.Name == name {
+			out.Invariants = append(out.Invariants, inv)
+		}
+	}
+	if len(out.Invariants) == 0 {
+		return nil, fmt.Errorf("invariant focus: no invariant named %q", name)
+	}
+	for _, rep := range reg.Compensation {
+		if rep.Invariant == name {
+			out.Compensation = append(out.Compensation, rep)
+		}
+	}
+	return &out, nil
+}
+
+// filterEvents returns a copy of reg keeping only the named events, and the
+// names of the events it dropped, both in declaration order.
+func filterEvents(reg *registry.Registry, names []string) (*registry.Registry, []string, error) {
+	keep := make(map[string]bool, len(names))
+	for _, name := range names {
+		keep[name] = true
+	}
+	out := *reg
+	out.Events = nil
+	var dropped []string
+	for _, evt := range reg.Events {
+		if keep[evt.Name] {
+			out.Events = append(out.Events, evt)
+			delete(keep, evt.Name)
+		} else {
+			dropped = append(dropped, evt.Name)
+		}
+	}
+	for _, name := range names {
+		if keep[name] {
+			return nil, nil, fmt.Errorf("events filter: no event named %q", name)
+		}
+	}
+	return &out, dropped, nil
+}
+
+// assignTarget resolves the target of an effect or repair assignment to a
+// state variable index, naming the specific misuse otherwise.
+func (cr *CompiledRegistry) assignTarget(name string, params []registry.VarDef) (int, error) {
+	if idx := cr.Schema.VarIndex(name); idx >= 0 {
+		return idx, nil
+	}
+	if _, ok := cr.EnumLiterals[name]; ok {
+		return -1, fmt.Errorf("cannot assign to enum literal %q; only state variables can be assigned", name)
+	}
+	if expr.IsBuiltin(name) {
+		return -1, fmt.Errorf("cannot assign to builtin %q; only state variables can be assigned", name)
+	}
+	for _, p := range params {
+		if p.Name == name {
+			return -1, fmt.Errorf("cannot assign to parameter %q; only state variables can be assigned", name)
+		}
+	}
+	return -1, fmt.Errorf("unknown variable %q", name)
+}
+
+// parse parses expression source, replacing references to the registry's
+// constants with their values. Identical sources return the same *Node.
+func (cr *CompiledRegistry) parse(src string) (*expr.Node, error) {
+	if node, ok := cr.parsed[src]; ok {
+		return node, nil
+	}
+	node, err := parseWithConstants(src, cr.Reg.Constants)
+	if err != nil {
+		return nil, err
+	}
+	if cr.parsed == nil {
+		cr.parsed = make(map[string]*expr.Node)
+	}
+	cr.parsed[src] = node
+	return node, nil
+}
+
+func parseWithConstants(src string, consts map[string]int) (*expr.Node, error) {
+	node, err := expr.Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	expr.ResolveConstants(node, consts)
+	return node, nil
+}
+
+// typecheck runs the static type checker over a parsed expression, with
+// any event parameters in scope.
+func (cr *CompiledRegistry) typecheck(node *expr.Node, params []registry.VarDef) (expr.Type, error) {
+	c := expr.Checker{Schema: &cr.Schema, Literals: cr.EnumLiterals, Params: params}
+	return c.Check(node)
+}
+
+// checkAssignment type-checks the right-hand side of an assignment to the
+// variable at varIdx and checks that its type fits the variable.
+func (cr *CompiledRegistry) checkAssignment(node *expr.Node, varIdx int, params []registry.VarDef) error {
+	t, err := cr.typecheck(node, params)
+	if err != nil {
+		return err
+	}
+	return expr.AssignableTo(t, cr.Schema.Vars[varIdx])
+}
+
+// expandParams enumerates every combination of an event's parameter values,
+// returning one transition name and parameter binding per combination.
+// An event without params yields a single transition with a nil binding.
+func (cr *CompiledRegistry) expandParams(evt registry.Event) ([]string, []map[string]expr.Value, error) {
+	if len(evt.Params) == 0 {
+		return []string{evt.Name}, []map[string]expr.Value{nil}, nil
+	}
+
+	// Resolve each parameter's domain up front.
+	domains := make([][]expr.Value, len(evt.Params))
+	labels := make([][]string, len(evt.Params))
+	for pi, p := range evt.Params {
+		if cr.Schema.VarIndex(p.Name) >= 0 {
+			return nil, nil, fmt.Errorf("event %q: param %q shadows a state variable", evt.Name, p.Name)
+		}
+		if _, ok := cr.EnumLiterals[p.Name]; ok {
+			return nil, nil, fmt.Errorf("event %q: param %q shadows an enum literal", evt.Name, p.Name)
+		}
+		switch p.Type {
+		case registry.TypeBool:
+			domains[pi] = []expr.Value{{IsBool: true, Bool: false}, {IsBool: true, Bool: true}}
+			labels[pi] = []string{"false", "true"}
+		case registry.TypeEnum:
+			for _, lit := range p.Values {
+				val, ok := cr.EnumLiterals[lit]
+				if !ok {
+					return nil, nil, fmt.Errorf("event %q: param %q value %q is not a declared enum literal",
+						evt.Name, p.Name, lit)
+				}
+				domains[pi] = append(domains[pi], expr.Value{IsInt: true, IsEnum: true, Int: val})
+				labels[pi] = append(labels[pi], lit)
+			}
+		case registry.TypeInt:
+			for v := p.Min; v <= p.Max; v++ {
+				domains[pi] = append(domains[pi], expr.Value{IsInt: true, Int: v})
+				labels[pi] = append(labels[pi], fmt.Sprintf("%d", v))
+			}
+		}
+	}
+
+	// Odometer over the cartesian product, last param varying fastest.
+	var names []string
+	var bindings []map[string]expr.Value
+	idx := make([]int, len(evt.Params))
+	for {
+		binding := make(map[string]expr.Value, len(evt.Params))
+		parts := make([]string, len(evt.Params))
+		for pi, p := range evt.Params {
+			binding[p.Name] = domains[pi][idx[pi]]
+			parts[pi] = p.Name + "=" + labels[pi][idx[pi]]
+		}
+		names = append(names, evt.Name+"("+strings.Join(parts, ", ")+")")
+		bindings = append(bindings, binding)
+
+		pi := len(idx) - 1
+		for ; pi >= 0; pi-- {
+			idx[pi]++
+			if idx[pi] < len(domains[pi]) {
+				break
+			}
+			idx[pi] = 0
+		}
+		if pi < 0 {
+			return names, bindings, nil
+		}
+	}
+}
+
+// BuildTables precomputes Valid, NF, and Step tables.
+func (cr *CompiledRegistry) BuildTables() error {
+	n := cr.Schema.TotalLen
+	cr.Valid = make([]bool, n)
+	cr.NF = make([]registry.StateID, n)
+	cr.diverges = make([]bool, n)
+	cr.depth = make([]int, n)
+	cr.stalls = make([]repairStall, len(cr.InvExprs))
+	cr.stalled = make([]uint64, (n+63)/64)
+	for sid := range cr.depth {
+		cr.depth[sid] = -1
+	}
+
+	// 1. Compute Valid[s] for all states.
+	cr.log().Debug("phase start", "phase", "valid", "states", n)
+	cr.invSat = make([]int, len(cr.InvExprs))
+	cr.invWords = (len(cr.InvExprs) + 63) / 64
+	cr.holds = make([]uint64, n*cr.invWords)
+	order := cr.visitOrder(n)
+	for i, sid := range order {
+		if err := cr.interrupted("table build (valid)", i); err != nil {
+			cr.holds = nil
+			return err
+		}
+		st := cr.Schema.DecodeInto(registry.StateID(sid), cr.pre)
+		v, err := cr.evalValid(registry.StateID(sid), st)
+		if err != nil {
+			cr.holds = nil
+			return fmt.Errorf("validity check at state %s: %w", cr.fmtState(st), err)
+		}
+		cr.Valid[sid] = v
+	}
+	// An invariant that no state satisfies can never be repaired; report it
+	// directly rather than as a compensation failure.
+	for i, count := range cr.invSat {
+		if count == 0 {
+			return fmt.Errorf("invariant %q is unsatisfiable: it is false in all %d states",
+				cr.Reg.Invariants[i].Name, n)
+		}
+	}
+
+	// 2. Compute NF[s] for all states.
+	cr.log().Debug("phase start", "phase", "nf", "states", n)
+	for i, sid := range order {
+		if err := cr.interrupted("table build (nf)", i); err != nil {
+			return err
+		}
+		nf, err := cr.computeNF(registry.StateID(sid))
+		if errors.Is(err, ErrCompensationNonTerminating) && cr.Opts.AllFailures {
+			// Leave the state unnormalized; CheckWFC reports it.
+			cr.diverges[sid] = true
+			cr.NF[sid] = registry.StateID(sid)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("normal form at state %s: %w%s",
+				cr.fmtState(cr.Schema.Decode(registry.StateID(sid))), err, cr.stallHint())
+		}
+		cr.NF[sid] = nf
+	}
+
+	// 3. Compute Step[e][s] for all transitions and states.
+	cr.log().Debug("phase start", "phase", "step", "states", n, "transitions", len(cr.EvtNames))
+	step := newStepTable(cr.Opts.SparseStep, len(cr.EvtNames), n)
+	cr.moves = make([]bool, len(cr.EvtNames))
+	for ei := range cr.EvtNames {
+		for sid := 0; sid < n; sid++ {
+			if err := cr.interrupted("table build (step)", ei*n+sid); err != nil {
+				return err
+			}
+			st := cr.Schema.DecodeInto(registry.StateID(sid), cr.pre)
+			enabled, err := cr.evalGuard(ei, st)
+			if err != nil {
+				return fmt.Errorf("event %q guard at state %s: %w",
+					cr.EvtNames[ei], cr.fmtState(st), err)
+			}
+			if !enabled {
+				continue
+			}
+			post, err := cr.applyEvent(ei, st)
+			if err != nil {
+				return fmt.Errorf("event %q at state %s: %w",
+					cr.EvtNames[ei], cr.fmtState(st), err)
+			}
+			postID := cr.Schema.Encode(post)
+			if postID != registry.StateID(sid) {
+				cr.moves[ei] = true
+			}
+			step.set(ei, registry.StateID(sid), cr.NF[postID])
+		}
+	}
+	step.finish()
+	cr.Step = step
+
+	valid, invalid := cr.Stats()
+	cr.log().Info("tables built", "states", n, "valid", valid, "invalid", invalid,
+		"transitions", len(cr.EvtNames), "step_bytes", cr.Step.Bytes())
+	return nil
+}
+
+// visitOrder returns the order in which BuildTables visits the n states
+// when computing validity and normal forms: StateID order, or a
+// permutation drawn from Opts.Seed. The Step table is always filled in
+// StateID order, as SparseStep requires.
+func (cr *CompiledRegistry) visitOrder(n int) []int {
+	if cr.Opts.Seed != 0 {
+		return rand.New(rand.NewSource(cr.Opts.Seed)).Perm(n)
+	}
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	return order
+}
+
+// Verify runs the WFC and CC checks, building tables first if needed,
+// and collects the outcome into a Result.
+func (cr *CompiledRegistry) Verify() (*Result, error) {
+	if err := cr.ensureTables(); err != nil {
+		return nil, err
+	}
+
+	r := &Result{
+		Name:        cr.Reg.Name,
+		VarSummary:  cr.varSummary(),
+		StateCount:  cr.Schema.TotalLen,
+		Transitions: len(cr.EvtNames),
+		Focus:       cr.Opts.InvariantFocus,
+		Excluded:    cr.excluded,
+	}
+	if cr.Opts.Shard.Count > 1 {
+		r.Shard = cr.Opts.Shard.String()
+	}
+	if cr.Opts.Canonical != CanonicalNone {
+		r.Encoding = cr.Encoding()
+	}
+	r.ValidStates, r.InvalidStates = cr.Stats()
+	for _, e := range cr.Reg.Events {
+		r.Events = append(r.Events, e.Name)
+	}
+	for _, inv := range cr.Reg.Invariants {
+		r.Invariants = append(r.Invariants, inv.Name)
+	}
+
+	var err error
+	r.WFCPass, r.WFCMaxDepth, r.WFCBadState, r.WFCFailCount, err = cr.checkWFC()
+	if err != nil {
+		return nil, err
+	}
+	r.CC = cr.CheckCC()
+	if err := cr.interrupted("cc", 0); err != nil {
+		return nil, err
+	}
+	var idempotent []string
+	for _, evt := range cr.Reg.Events {
+		if evt.Idempotent {
+			idempotent = append(idempotent, evt.Name)
+		}
+	}
+	if r.Idempotence, err = cr.CheckIdempotent(idempotent); err != nil {
+		return nil, err
+	}
+	if err := cr.interrupted("idempotence", 0); err != nil {
+		return nil, err
+	}
+	r.Warnings = cr.warnings()
+	return r, nil
+}
+
+// warnings collects non-fatal findings about the model itself.
+func (cr *CompiledRegistry) warnings() []string {
+	var w []string
+	if cr.Schema.TotalLen < MinUsefulStates {
+		var single []string
+		for _, v := range cr.Schema.Vars {
+			if v.Size == 1 {
+				single = append(single, v.Name)
+			}
+		}
+		msg := fmt.Sprintf("state space has only %d state(s), so every check passes trivially; check the variable definitions", cr.Schema.TotalLen)
+		if len(single) > 0 {
+			msg += fmt.Sprintf(" (single-valued: %s)", strings.Join(single, ", "))
+		}
+		w = append(w, msg)
+	}
+	for i, count := range cr.invSat {
+		if count == cr.Schema.TotalLen {
+			w = append(w, fmt.Sprintf("invariant %q is always true: it holds in all %d states and constrains nothing",
+				cr.Reg.Invariants[i].Name, count))
+		}
+	}
+	for _, name := range cr.UnusedVars() {
+		size := cr.Schema.Vars[cr.Schema.VarIndex(name)].Size
+		w = append(w, fmt.Sprintf("variable %q is never read or written: it multiplies the state space by %d for nothing", name, size))
+	}
+	for _, name := range cr.InvalidOnlyEvents() {
+		w = append(w, fmt.Sprintf("event %q can never fire from a valid state: its guard is false in every state satisfying the invariants", name))
+	}
+	for _, name := range cr.NoOpEvents() {
+		w = append(w, fmt.Sprintf("event %q is a no-op: its effect never changes the state where it is enabled", name))
+	}
+	w = append(w, cr.NarrowingAssignments()...)
+	for _, np := range cr.NonProgressingRepairs() {
+		if np.Alternatives > 1 {
+			w = append(w, fmt.Sprintf("none of the %d repairs for invariant %q progresses in %d state(s); the first is applied, e.g. %s → %s",
+				np.Alternatives, np.Invariant, np.States, np.Before, np.After))
+			continue
+		}
+		w = append(w, fmt.Sprintf("repair for invariant %q does not restore it in %d state(s), e.g. %s → %s",
+			np.Invariant, np.States, np.Before, np.After))
+	}
+	return w
+}
+
+// UnusedVars returns, in declaration order, the state variables that no
+// invariant, repair, guard or effect mentions. They are enumerated but
+// inert.
+func (cr *CompiledRegistry) UnusedVars() []string {
+	used := make([]bool, len(cr.Schema.Vars))
+	mark := func(n *expr.Node) {
+		if n.Type != expr.NodeVar {
+			return
+		}
+		if idx := cr.Schema.VarIndex(n.Name); idx >= 0 {
+			used[idx] = true
+		}
+	}
+	for _, node := range cr.InvExprs {
+		expr.Walk(node, mark)
+	}
+	markAssignments := func(assignments []map[int]*expr.Node) {
+		for _, m := range assignments {
+			for idx, node := range m {
+				used[idx] = true
+				expr.Walk(node, mark)
+			}
+		}
+	}
+	markAssignments(cr.RepExprs)
+	markAssignments(cr.EvtExprs)
+	for _, guard := range cr.EvtGuards {
+		expr.Walk(guard, mark)
+	}
+	var names []string
+	for i, v := range cr.Schema.Vars {
+		if !used[i] {
+			names = append(names, v.Name)
+		}
+	}
+	return names
+}
+
+// InvalidOnlyEvents returns the transitions that are enabled in no valid
+// state. Since checks start from normal forms, such a transition can only
+// fire before compensation, which almost always means its guard
+// contradicts an invariant. BuildTables must have been called.
+func (cr *CompiledRegistry) InvalidOnlyEvents() []string {
+	var names []string
+	for ei, name := range cr.EvtNames {
+		enabled := false
+		for sid := range cr.Valid {
+			if cr.Valid[sid] && cr.Step.Next(ei, registry.StateID(sid)) != -1 {
+				enabled = true
+				break
+			}
+		}
+		if !enabled {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// NarrowingAssignments describes each repair or effect that copies an int
+// variable or parameter into an int variable whose range does not contain
+// the source's, e.g. a := b with b in [0, 10] and a in [0, 5]. Such an
+// assignment fails with a range error at any state where it fires with the
+// source out of the target's range; the checker only reports the states it
+// actually reaches. Repairs come first, in declaration order, then events.
+func (cr *CompiledRegistry) NarrowingAssignments() []string {
+	var out []string
+	check := func(owner string, assignments map[int]*expr.Node, params []registry.VarDef) {
+		for idx, target := range cr.Schema.Vars {
+			node := assignments[idx]
+			if node == nil || node.Type != expr.NodeVar || target.Type != registry.TypeInt {
+				continue
+			}
+			kind, src := "", registry.VarDef{}
+			if i := cr.Schema.VarIndex(node.Name); i >= 0 {
+				kind, src = "variable", cr.Schema.Vars[i]
+			} else {
+				for _, p := range params {
+					if p.Name == node.Name {
+						kind, src = "parameter", p
+					}
+				}
+			}
+			if kind == "" || src.Type != registry.TypeInt || (src.Min >= target.Min && src.Max <= target.Max) {
+				continue
+			}
+			out = append(out, fmt.Sprintf("%s assigns %s %q in [%d, %d] to %q in [%d, %d]; it fails wherever %s is outside [%d, %d]",
+				owner, kind, src.Name, src.Min, src.Max, target.Name, target.Min, target.Max, src.Name, target.Min, target.Max))
+		}
+	}
+	for i, rep := range cr.Reg.Compensation {
+		check(fmt.Sprintf("repair for %q", rep.Invariant), cr.RepExprs[i], nil)
+	}
+	seen := make(map[int]bool)
+	for ei, src := range cr.EvtSource {
+		if !seen[src] {
+			seen[src] = true
+			evt := cr.Reg.Events[src]
+			check(fmt.Sprintf("event %q", evt.Name), cr.EvtExprs[ei], evt.Params)
+		}
+	}
+	return out
+}
+
+// NoOpEvents returns the transitions that are enabled somewhere but leave
+// every state they fire from unchanged. Such an event is usually a
+// modelling mistake, e.g. an effect that re-assigns the values its guard
+// already requires. BuildTables must have been called.
+func (cr *CompiledRegistry) NoOpEvents() []string {
+	var names []string
+	for ei, name := range cr.EvtNames {
+		if !cr.moves[ei] && cr.Step.Enabled(ei) > 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Passed reports whether every check passed: WFC, CC and the idempotence
+// of each event declared idempotent. It is the verdict the command-line
+// tool turns into its exit code.
+func (r *Result) Passed() bool {
+	return r.WFCPass && r.CC.CCPass && r.IdempotencePass()
+}
+
+// IdempotencePass reports whether every event declared idempotent is.
+func (r *Result) IdempotencePass() bool {
+	for _, ir := range r.Idempotence {
+		if !ir.Pass {
+			return false
+		}
+	}
+	return true
+}
+
+// Encoding describes, one line per variable in StateID order, how each
+// value is encoded and its stride, e.g. "mode: a=0 b=1 c=2  ×6". An int
+// in [min, max] is encoded as value-min. The most significant variable
+// comes first.
+func (cr *CompiledRegistry) Encoding() []string {
+	lines := make([]string, len(cr.Schema.Vars))
+	for i, v := range cr.Schema.Vars {
+		var vals []string
+		switch v.Type {
+		case registry.TypeBool:
+			vals = []string{"false=0", "true=1"}
+		case registry.TypeEnum:
+			for j, lit := range v.Values {
+				vals = append(vals, fmt.Sprintf("%s=%d", lit, j))
+			}
+		default:
+			vals = []string{fmt.Sprintf("%d..%d=0..%d", v.Min, v.Max, v.Size-1)}
+		}
+		lines[i] = fmt.Sprintf("%s: %s  ×%d", v.Name, strings.Join(vals, " "), cr.Schema.Strides[i])
+	}
+	return lines
+}
+
+// varSummary describes each variable's domain, joined by " × ".
+func (cr *CompiledRegistry) varSummary() string {
+	var parts []string
+	for _, v := range cr.Schema.Vars {
+		switch v.Type {
+		case registry.TypeBool:
+			parts = append(parts, fmt.Sprintf("%s:bool", v.Name))
+		case registry.TypeEnum:
+			parts = append(parts, fmt.Sprintf("%s:enum(%d)", v.Name, v.Size))
+		case registry.TypeInt:
+			parts = append(parts, fmt.Sprintf("%s:int[%d..%d]", v.Name, v.Min, v.Max))
+		}
+	}
+	return strings.Join(parts, " × ")
+}
+
+// CheckWFC verifies well-founded compensation.
+func (cr *CompiledRegistry) CheckWFC() (pass bool, maxDepth int, badState string, err error) {
+	pass, maxDepth, badState, _, err = cr.checkWFC()
+	return
+}
+
+// checkWFC verifies well-founded compensation, also returning the number of
+// failing states. Unless Opts.AllFailures is set it stops at the first one.
+func (cr *CompiledRegistry) checkWFC() (pass bool, maxDepth int, badState string, failures int, err error) {
+	cr.log().Debug("phase start", "phase", "wfc")
+	defer func() {
+		cr.log().Info("wfc checked", "pass", pass, "max_depth", maxDepth, "failures", failures)
+	}()
+	for sid := 0; sid < cr.Schema.TotalLen; sid++ {
+		if err := cr.interrupted("wfc", sid); err != nil {
+			return false, 0, "", 0, err
+		}
+		// Check that NF exists and is valid.
+		nfID := cr.NF[sid]
+		bad := ""
+		if cr.diverges[sid] {
+			bad = fmt.Sprintf("compensation does not terminate from state %s",
+				cr.fmtState(cr.Schema.Decode(registry.StateID(sid))))
+		} else if !cr.Valid[nfID] {
+			st := cr.Schema.Decode(registry.StateID(sid))
+			nfSt := cr.Schema.Decode(nfID)
+			bad = fmt.Sprintf("state %s → NF %s which is not valid",
+				cr.fmtState(st), cr.fmtState(nfSt))
+		} else if cr.Valid[sid] && cr.NF[sid] != registry.StateID(sid) {
+			// Check fixpoint: valid states are fixed. Repairs fire only on
+			// violated invariants, so this is a consistency check on the
+			// tables rather than a property a spec can violate. For the
+			// same reason there is no relaxed mode accepting a valid state
+			// whose NF is another valid state: no spec can produce one.
+			st := cr.Schema.Decode(registry.StateID(sid))
+			nfSt := cr.Schema.Decode(cr.NF[sid])
+			bad = fmt.Sprintf("valid state %s has NF %s (not a fixpoint)",
+				cr.fmtState(st), cr.fmtState(nfSt))
+		}
+		if bad == "" {
+			continue
+		}
+		if failures == 0 {
+			badState = bad
+		}
+		failures++
+		if !cr.Opts.AllFailures {
+			break
+		}
+	}
+	if failures > 0 {
+		return false, 0, badState, failures, nil
+	}
+
+	// Compute max depth from repair iteration counts.
+	depths, err := cr.repairDepths()
+	if err != nil {
+		return false, 0, "", 0, err
+	}
+	for _, depth := range depths {
+		if depth > maxDepth {
+			maxDepth = depth
+		}
+	}
+
+	return true, maxDepth, "", 0, nil
+}
+
+// DepthEntry describes the repair chain from one state to its normal form.
+type DepthEntry struct {
+	ID    registry.StateID `json:"id"`
+	Depth int              `json:"depth"` // number of repair steps to reach NF
+	State string           `json:"state"` // formatted starting state
+	NF    string           `json:"nf"`    // formatted normal form
+}
+
+// DeepestRepairs returns the k states with the longest repair chains,
+// sorted by depth descending (ties by StateID ascending). Valid states
+// (depth 0) are never reported. k <= 0 returns every invalid state.
+func (cr *CompiledRegistry) DeepestRepairs(k int) ([]DepthEntry, error) {
+	depths, err := cr.repairDepths()
+	if err != nil {
+		return nil, err
+	}
+	var ids []registry.StateID
+	for sid, depth := range depths {
+		if err := cr.interrupted("deepest repairs", sid); err != nil {
+			return nil, err
+		}
+		if depth > 0 {
+			ids = append(ids, registry.StateID(sid))
+		}
+	}
+	sort.SliceStable(ids, func(i, j int) bool {
+		return depths[ids[i]] > depths[ids[j]]
+	})
+	if k > 0 && len(ids) > k {
+		ids = ids[:k]
+	}
+
+	entries := make([]DepthEntry, len(ids))
+	for i, sid := range ids {
+		entries[i] = DepthEntry{
+			ID:    sid,
+			Depth: depths[sid],
+			State: cr.fmtState(cr.Schema.Decode(sid)),
+			NF:    cr.fmtState(cr.Schema.Decode(cr.NF[sid])),
+		}
+	}
+	return entries, nil
+}
+
+// repairDepths returns the repair depth of every state, indexed by StateID,
+// as recorded while building the NF table.
+func (cr *CompiledRegistry) repairDepths() ([]int, error) {
+	for _, depth := range cr.depth {
+		if depth < 0 {
+			return nil, ErrCompensationNonTerminating
+		}
+	}
+	return cr.depth, nil
+}
+
+// CheckCC checks compensation commutativity (CC1 and CC2).
+func (cr *CompiledRegistry) CheckCC() (result CCResult) {
+	cr.log().Debug("phase start", "phase", "cc")
+	defer func() {
+		cr.log().Info("cc checked", "cc1_pass", result.CC1Pass, "cc2_pass", result.CC2Pass,
+			"pairs_checked", result.PairsChecked, "dependent_skipped", result.DependentSkipped)
+	}()
+	lo, hi := cr.Opts.Shard.Range(cr.Schema.TotalLen)
+	numEvts := len(cr.EvtNames)
+
+	// Two transitions are independent candidates if their write sets don't
+	// intersect each other's read/write sets.
+	reads, writes := cr.accessSets()
+	isIndependent := func(e1, e2 int) bool {
+		return independent(reads[cr.EvtSource[e1]], writes[cr.EvtSource[e1]],
+			reads[cr.EvtSource[e2]], writes[cr.EvtSource[e2]])
+	}
+
+	// CC1: for independent event pairs (e1, e2), for all states s where both enabled:
+	//   Step[e2][Step[e1][s]] == Step[e1][Step[e2][s]]
+	all := cr.Opts.AllFailures
+	result.CC1Pass = true
+	checkDependent := cr.Opts.CheckDependentPairs || cr.Opts.StrictDependentPairs
+	type pair struct {
+		e1, e2    int
+		dependent bool
+	}
+	var pairs []pair
+	var indep []int // indices into pairs
+	for e1 := 0; e1 < numEvts; e1++ {
+		for e2 := e1 + 1; e2 < numEvts; e2++ {
+			dependent := !isIndependent(e1, e2)
+			if dependent && !checkDependent {
+				result.DependentSkipped++
+				continue
+			}
+			if !dependent {
+				indep = append(indep, len(pairs))
+			}
+			pairs = append(pairs, pair{e1, e2, dependent})
+		}
+	}
+	if limit := cr.Opts.MaxCCPairs; limit > 0 && len(indep) > limit {
+		seed := cr.Opts.SampleSeed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		result.Sampled, result.PairsTotal, result.SampleSeed = true, len(indep), seed
+		drop := make(map[int]bool, len(indep)-limit)
+		rng := rand.New(rand.NewSource(seed))
+		for _, i := range rng.Perm(len(indep))[limit:] {
+			drop[indep[i]] = true
+		}
+		kept := pairs[:0]
+		for i, p := range pairs {
+			if !drop[i] {
+				kept = append(kept, p)
+			}
+		}
+		pairs = kept
+		cr.log().Info("cc1 pairs sampled", "kept", limit, "total", len(indep), "seed", seed)
+	}
+	for _, p := range pairs {
+		if !result.CC1Pass && !all {
+			break
+		}
+		pf := cr.comparePair(p.e1, p.e2, lo, hi, all)
+		if p.dependent {
+			dp := DependentPair{Event1: cr.EvtNames[p.e1], Event2: cr.EvtNames[p.e2], Commutes: pf == nil}
+			if pf != nil {
+				dp.States, dp.State = pf.States, pf.State
+			}
+			result.DependentPairs = append(result.DependentPairs, dp)
+			if !cr.Opts.StrictDependentPairs {
+				continue
+			}
+		} else {
+			result.PairsChecked++
+		}
+		if pf != nil {
+			if cr.Opts.MinimizeCounterexamples {
+				st := cr.Schema.Decode(pf.sid)
+				pf.Minimal = cr.fmtPartial(st, cr.MinimizeCC1(pf.e1, pf.e2, st))
+			}
+			result.CC1FailCount += pf.States
+			if result.CC1Pass {
+				result.CC1Pass = false
+				result.CC1FailEvent1 = pf.Event1
+				result.CC1FailEvent2 = pf.Event2
+				result.CC1FailState = pf.State
+				result.CC1FailNF1 = pf.NF1
+				result.CC1FailNF2 = pf.NF2
+				result.CC1FailMinimal = pf.Minimal
+			}
+			result.CC1Failures = append(result.CC1Failures, *pf)
+		}
+	}
+
+	// CC2: for all events e, for all states s:
+	//   Step[e][s] == Step[e][NF[s]]   (when both defined)
+	// Under StrictCC2, e must also be enabled at both s and NF[s] or at neither.
+	result.CC2Pass = true
+	for ei := 0; ei < numEvts && (result.CC2Pass || all); ei++ {
+		for sid := lo; sid < hi; sid++ {
+			if cr.interrupted("cc", sid) != nil {
+				break // Verify reports the interruption
+			}
+			stepRaw := cr.Step.Next(ei, registry.StateID(sid))
+			nfID := cr.NF[sid]
+			stepNF := cr.Step.Next(ei, nfID)
+
+			reason := ""
+			switch {
+			case stepRaw == -1 && stepNF == -1:
+				continue
+			case stepRaw == -1 || stepNF == -1:
+				if !cr.Opts.StrictCC2 {
+					continue
+				}
+				if stepRaw == -1 {
+					reason = "event disabled at s but enabled at NF(s)"
+				} else {
+					reason = "event enabled at s but disabled at NF(s)"
+				}
+			case stepRaw == stepNF:
+				continue
+			}
+
+			result.CC2FailCount++
+			if !result.CC2Pass {
+				continue // keep the first counterexample
+			}
+			result.CC2Pass = false
+			st := cr.Schema.Decode(registry.StateID(sid))
+			nfSt := cr.Schema.Decode(nfID)
+			result.CC2FailEvent = cr.EvtNames[ei]
+			result.CC2FailState = cr.fmtState(st)
+			result.CC2FailNFState = cr.fmtState(nfSt)
+			result.CC2FailNF1 = cr.fmtStep(stepRaw)
+			result.CC2FailNF2 = cr.fmtStep(stepNF)
+			result.CC2FailReason = reason
+			if !all {
+				break
+			}
+		}
+	}
+
+	result.CCPass = result.CC1Pass && result.CC2Pass
+	return
+}
+
+// CCResult holds CC verification results.
+type CCResult struct {
+	CCPass  bool `json:"cc_pass"`
+	CC1Pass bool `json:"cc1_pass"`
+	CC2Pass bool `json:"cc2_pass"`
+
+	PairsChecked     int `json:"pairs_checked"`
+	DependentSkipped int `json:"dependent_skipped"`
+
+	// Under Options.MaxCCPairs, Sampled reports that only PairsChecked of
+	// the PairsTotal independent pairs were compared, drawn with SampleSeed.
+	Sampled    bool  `json:"sampled,omitempty"`
+	PairsTotal int   `json:"pairs_total,omitempty"`
+	SampleSeed int64 `json:"sample_seed,omitempty"`
+
+	// DependentPairs is filled under Options.CheckDependentPairs.
+	DependentPairs []DependentPair `json:"dependent_pairs,omitempty"`
+
+	CC1FailEvent1 string `json:"cc1_fail_event1,omitempty"`
+	CC1FailEvent2 string `json:"cc1_fail_event2,omitempty"`
+	CC1FailState  string `json:"cc1_fail_state,omitempty"`
+	CC1FailNF1    string `json:"cc1_fail_nf1,omitempty"`
+	CC1FailNF2    string `json:"cc1_fail_nf2,omitempty"`
+	// CC1FailMinimal is CC1FailState with irrelevant variables as *, under
+	// Options.MinimizeCounterexamples.
+	CC1FailMinimal string `json:"cc1_fail_minimal,omitempty"`
+
+	// Under Options.AllFailures these cover every failure; otherwise
+	// only the first.
+	CC1FailCount int           `json:"cc1_fail_count,omitempty"` // failing (pair, state) instances
+	CC1Failures  []PairFailure `json:"cc1_failures,omitempty"`   // one entry per failing pair
+	CC2FailCount int           `json:"cc2_fail_count,omitempty"` // failing (event, state) instances
+
+	CC2FailEvent   string `json:"cc2_fail_event,omitempty"`
+	CC2FailState   string `json:"cc2_fail_state,omitempty"`
+	CC2FailNFState string `json:"cc2_fail_nf_state,omitempty"`
+	CC2FailNF1     string `json:"cc2_fail_nf1,omitempty"`
+	CC2FailNF2     string `json:"cc2_fail_nf2,omitempty"`
+	CC2FailReason  string `json:"cc2_fail_reason,omitempty"` // set for enabledness mismatches under StrictCC2
+}
+
+// comparePair runs the CC1 comparison for transitions e1 and e2 over the
+// states in [lo, hi) where both orders are defined, returning nil if they
+// commute everywhere. Unless all is set it stops at the first failing state.
+func (cr *CompiledRegistry) comparePair(e1, e2, lo, hi int, all bool) *PairFailure {
+	var pf *PairFailure
+	for sid := lo; sid < hi; sid++ {
+		if cr.interrupted("cc", sid) != nil {
+			break // Verify reports the interruption
+		}
+		s1 := cr.Step.Next(e1, registry.StateID(sid))
+		s2 := cr.Step.Next(e2, registry.StateID(sid))
+		if s1 == -1 || s2 == -1 {
+			continue // at least one not enabled
+		}
+
+		// e1 then e2
+		r12 := cr.Step.Next(e2, s1)
+		// e2 then e1
+		r21 := cr.Step.Next(e1, s2)
+
+		// If either step is disabled in the intermediate state, skip.
+		if r12 == -1 || r21 == -1 {
+			continue
 		}
-		cr.EvtGuards = append(cr.EvtGuards, guard)
 
-		evtMap := make(map[int]*expr.Node)
-		for varName, exprStr := range evt.Assignments {
-			idx := schema.VarIndex(varName)
-			if idx < 0 {
-				return nil, fmt.Errorf("event %q: unknown variable %q", evt.Name, varName)
+		if r12 != r21 {
+			if pf == nil {
+				pf = &PairFailure{
+					Event1: cr.EvtNames[e1],
+					Event2: cr.EvtNames[e2],
+					State:  cr.fmtState(cr.Schema.Decode(registry.StateID(sid))),
+					NF1:    cr.fmtState(cr.Schema.Decode(r12)),
+					NF2:    cr.fmtState(cr.Schema.Decode(r21)),
+					e1:     e1,
+					e2:     e2,
+					sid:    registry.StateID(sid),
+				}
 			}
-			node, err := expr.Parse(exprStr)
-			if err != nil {
-				return nil, fmt.Errorf("event %q, var %q: %w", evt.Name, varName, err)
+			pf.States++
+			if !all {
+				break
 			}
-			evtMap[idx] = node
 		}
-		cr.EvtExprs = append(cr.EvtExprs, evtMap)
 	}
+	return pf
+}
 
-	return cr, nil
+// DependentPair records whether a dependent transition pair, which CC1
+// does not require to commute, happens to commute anyway.
+type DependentPair struct {
+	Event1   string `json:"event1"`
+	Event2   string `json:"event2"`
+	Commutes bool   `json:"commutes"`
+	States   int    `json:"states,omitempty"` // states where the orders disagree
+	State    string `json:"state,omitempty"`  // first such state
 }
 
-// BuildTables precomputes Valid, NF, and Step tables.
-func (cr *CompiledRegistry) BuildTables() error {
-	n := cr.Schema.TotalLen
-	cr.Valid = make([]bool, n)
-	cr.NF = make([]registry.StateID, n)
+// PairFailure summarizes CC1 failures of one event pair, with the first
+// failing state as a representative counterexample.
+type PairFailure struct {
+	Event1 string `json:"event1"`
+	Event2 string `json:"event2"`
+	States int    `json:"states"` // number of states where the pair fails to commute
+	State  string `json:"state"`
+	NF1    string `json:"nf1"` // Event1 then Event2
+	NF2    string `json:"nf2"` // Event2 then Event1
 
-	// 1. Compute Valid[s] for all states.
-	for sid := 0; sid < n; sid++ {
-		st := cr.Schema.Decode(registry.StateID(sid))
-		v, err := cr.evalValid(st)
-		if err != nil {
-			return fmt.Errorf("validity check at state %s: %w", cr.fmtState(st), err)
-		}
-		cr.Valid[sid] = v
-	}
+	Minimal string `json:"minimal,omitempty"` // under Options.MinimizeCounterexamples
 
-	// 2. Compute NF[s] for all states.
-	for sid := 0; sid < n; sid++ {
-		nf, err := cr.computeNF(registry.StateID(sid))
-		if err != nil {
-			return fmt.Errorf("normal form at state %s: %w",
-				cr.fmtState(cr.Schema.Decode(registry.StateID(sid))), err)
-		}
-		cr.NF[sid] = nf
-	}
+	e1, e2 int
+	sid    registry.StateID
+}
 
-	// 3. Compute Step[e][s] for all events and states.
-	cr.Step = make([][]registry.StateID, len(cr.Reg.Events))
-	for ei := range cr.Reg.Events {
-		cr.Step[ei] = make([]registry.StateID, n)
-		for sid := 0; sid < n; sid++ {
-			st := cr.Schema.Decode(registry.StateID(sid))
-			enabled, err := cr.evalGuard(ei, st)
-			if err != nil {
-				return fmt.Errorf("event %q guard at state %s: %w",
-					cr.Reg.Events[ei].Name, cr.fmtState(st), err)
-			}
-			if !enabled {
-				cr.Step[ei][sid] = -1
-				continue
+// Dependencies lists the state variables an event reads (in its guard and
+// effect right-hand sides) and writes (its effect targets).
+type Dependencies struct {
+	Reads  []string `json:"reads"`
+	Writes []string `json:"writes"`
+}
+
+// EventDependencies returns the read and write sets of each declared event,
+// as used by CC1's independence analysis. Variables are listed in schema
+// order.
+func (cr *CompiledRegistry) EventDependencies() map[string]Dependencies {
+	reads, writes := cr.accessSets()
+	deps := make(map[string]Dependencies, len(cr.Reg.Events))
+	for i, evt := range cr.Reg.Events {
+		d := Dependencies{Reads: []string{}, Writes: []string{}}
+		for idx, v := range cr.Schema.Vars {
+			if reads[i][idx] {
+				d.Reads = append(d.Reads, v.Name)
 			}
-			post, err := cr.applyEvent(ei, st)
-			if err != nil {
-				return fmt.Errorf("event %q at state %s: %w",
-					cr.Reg.Events[ei].Name, cr.fmtState(st), err)
+			if writes[i][idx] {
+				d.Writes = append(d.Writes, v.Name)
 			}
-			postID := cr.Schema.Encode(post)
-			cr.Step[ei][sid] = cr.NF[postID]
 		}
+		deps[evt.Name] = d
 	}
+	return deps
+}
 
-	return nil
+// Conflict is a variable that makes two events dependent: Kind is
+// "write/write" if both assign it, "write/read" if the first assigns it and
+// the second reads it, or "read/write" for the converse.
+type Conflict struct {
+	Var  string `json:"var"`
+	Kind string `json:"kind"`
 }
 
-// CheckWFC verifies well-founded compensation.
-func (cr *CompiledRegistry) CheckWFC() (pass bool, maxDepth int, badState string, err error) {
-	maxDepth = 0
-	for sid := 0; sid < cr.Schema.TotalLen; sid++ {
-		// Check that NF exists and is valid.
-		nfID := cr.NF[sid]
-		if !cr.Valid[nfID] {
-			st := cr.Schema.Decode(registry.StateID(sid))
-			nfSt := cr.Schema.Decode(nfID)
-			return false, 0, fmt.Sprintf(
-				"state %s → NF %s which is not valid",
-				cr.fmtState(st), cr.fmtState(nfSt)), nil
-		}
-		// Check fixpoint: valid states are fixed.
-		if cr.Valid[sid] && cr.NF[sid] != registry.StateID(sid) {
-			st := cr.Schema.Decode(registry.StateID(sid))
-			nfSt := cr.Schema.Decode(cr.NF[sid])
-			return false, 0, fmt.Sprintf(
-				"valid state %s has NF %s (not a fixpoint)",
-				cr.fmtState(st), cr.fmtState(nfSt)), nil
-		}
-	}
+// IndependenceExplanation is the reasoning behind CC1's treatment of one
+// event pair: their access sets, and the variables, if any, that make them
+// dependent.
+type IndependenceExplanation struct {
+	Event1, Event2 string
+	Deps1, Deps2   Dependencies
+	Independent    bool
+	Conflicts      []Conflict // in schema order; empty if Independent
+}
 
-	// Compute max depth from repair iteration counts.
-	for sid := 0; sid < cr.Schema.TotalLen; sid++ {
-		depth, err := cr.repairDepth(registry.StateID(sid))
-		if err != nil {
-			return false, 0, "", err
+// ExplainIndependence explains whether CC1 compares the declared events
+// e1 and e2 (independent) or skips them (dependent), naming each variable
+// that causes a dependency.
+func (cr *CompiledRegistry) ExplainIndependence(e1, e2 string) (*IndependenceExplanation, error) {
+	deps := cr.EventDependencies()
+	for _, name := range []string{e1, e2} {
+		if _, ok := deps[name]; !ok {
+			return nil, fmt.Errorf("unknown event %q", name)
 		}
-		if depth > maxDepth {
-			maxDepth = depth
+	}
+	x := &IndependenceExplanation{Event1: e1, Event2: e2, Deps1: deps[e1], Deps2: deps[e2]}
+	for _, v := range cr.Schema.Vars {
+		w1, w2 := containsString(x.Deps1.Writes, v.Name), containsString(x.Deps2.Writes, v.Name)
+		switch {
+		case w1 && w2:
+			x.Conflicts = append(x.Conflicts, Conflict{v.Name, "write/write"})
+		case w1 && containsString(x.Deps2.Reads, v.Name):
+			x.Conflicts = append(x.Conflicts, Conflict{v.Name, "write/read"})
+		case w2 && containsString(x.Deps1.Reads, v.Name):
+			x.Conflicts = append(x.Conflicts, Conflict{v.Name, "read/write"})
 		}
 	}
-
-	return true, maxDepth, "", nil
+	x.Independent = len(x.Conflicts) == 0
+	return x, nil
 }
 
-// CheckCC checks compensation commutativity (CC1 and CC2).
-func (cr *CompiledRegistry) CheckCC() (result CCResult) {
-	n := cr.Schema.TotalLen
-	numEvts := len(cr.Reg.Events)
-
-	// Compute write sets and read sets for independence analysis.
-	type evtSets struct {
-		writes map[int]bool // var indices written
-		reads  map[int]bool // var indices read (in guard + effect RHS)
-	}
-	sets := make([]evtSets, numEvts)
-	for ei, evt := range cr.Reg.Events {
-		s := evtSets{writes: map[int]bool{}, reads: map[int]bool{}}
-		for varIdx := range cr.EvtExprs[ei] {
-			s.writes[varIdx] = true
-		}
-		// Read sets: variables referenced in guard and effect expressions.
-		if evt.Guard != "" {
-			for _, v := range cr.Schema.Vars {
-				idx := cr.Schema.VarIndex(v.Name)
-				// Simple conservative approach: scan expression string for var names.
-				if containsIdent(evt.Guard, v.Name) {
-					s.reads[idx] = true
-				}
-			}
+// String renders the explanation for the terminal.
+func (x *IndependenceExplanation) String() string {
+	var b strings.Builder
+	list := func(vars []string) string {
+		if len(vars) == 0 {
+			return "(none)"
 		}
-		for _, exprStr := range evt.Assignments {
-			for _, v := range cr.Schema.Vars {
-				idx := cr.Schema.VarIndex(v.Name)
-				if containsIdent(exprStr, v.Name) {
-					s.reads[idx] = true
-				}
-			}
+		return strings.Join(vars, ", ")
+	}
+	for _, e := range []struct {
+		name string
+		deps Dependencies
+	}{{x.Event1, x.Deps1}, {x.Event2, x.Deps2}} {
+		fmt.Fprintf(&b, "%s\n  reads:  %s\n  writes: %s\n", e.name, list(e.deps.Reads), list(e.deps.Writes))
+	}
+	if x.Independent {
+		fmt.Fprintf(&b, "\nIndependent: neither writes a variable the other reads or writes, so CC1 checks that they commute.\n")
+		return b.String()
+	}
+	fmt.Fprintf(&b, "\nDependent: CC1 skips this pair because of\n")
+	for _, c := range x.Conflicts {
+		switch c.Kind {
+		case "write/write":
+			fmt.Fprintf(&b, "  %s: written by both\n", c.Var)
+		case "write/read":
+			fmt.Fprintf(&b, "  %s: written by %s, read by %s\n", c.Var, x.Event1, x.Event2)
+		default:
+			fmt.Fprintf(&b, "  %s: read by %s, written by %s\n", c.Var, x.Event1, x.Event2)
 		}
-		sets[ei] = s
 	}
+	return b.String()
+}
 
-	// Two events are independent candidates if their write sets don't
-	// intersect each other's read/write sets.
-	isIndependent := func(e1, e2 int) bool {
-		for w := range sets[e1].writes {
-			if sets[e2].writes[w] || sets[e2].reads[w] {
-				return false
+// independentOf reports whether d and o touch disjoint variables in the
+// sense used by CC1; see independent.
+func (d Dependencies) independentOf(o Dependencies) bool {
+	ids := map[string]int{}
+	set := func(names []string) map[int]bool {
+		m := make(map[int]bool, len(names))
+		for _, n := range names {
+			if _, ok := ids[n]; !ok {
+				ids[n] = len(ids)
 			}
+			m[ids[n]] = true
 		}
-		for w := range sets[e2].writes {
-			if sets[e1].writes[w] || sets[e1].reads[w] {
-				return false
-			}
-		}
-		return true
+		return m
 	}
+	return independent(set(d.Reads), set(d.Writes), set(o.Reads), set(o.Writes))
+}
 
-	// CC1: for independent event pairs (e1, e2), for all states s where both enabled:
-	//   Step[e2][Step[e1][s]] == Step[e1][Step[e2][s]]
-	result.CC1Pass = true
-	for e1 := 0; e1 < numEvts && result.CC1Pass; e1++ {
-		for e2 := e1 + 1; e2 < numEvts && result.CC1Pass; e2++ {
-			if !isIndependent(e1, e2) {
-				result.DependentSkipped++
-				continue
-			}
-			result.PairsChecked++
-			for sid := 0; sid < n; sid++ {
-				s1 := cr.Step[e1][sid]
-				s2 := cr.Step[e2][sid]
-				if s1 == -1 || s2 == -1 {
-					continue // at least one not enabled
-				}
-
-				// e1 then e2
-				r12 := cr.Step[e2][s1]
-				// e2 then e1
-				r21 := cr.Step[e1][s2]
-
-				// If either step is disabled in the intermediate state, skip.
-				if r12 == -1 || r21 == -1 {
-					continue
-				}
-
-				if r12 != r21 {
-					result.CC1Pass = false
-					st := cr.Schema.Decode(registry.StateID(sid))
-					result.CC1FailEvent1 = cr.Reg.Events[e1].Name
-					result.CC1FailEvent2 = cr.Reg.Events[e2].Name
-					result.CC1FailState = cr.fmtState(st)
-					result.CC1FailNF1 = cr.fmtState(cr.Schema.Decode(r12))
-					result.CC1FailNF2 = cr.fmtState(cr.Schema.Decode(r21))
-					break
-				}
-			}
+func containsString(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
 		}
 	}
+	return false
+}
 
-	// CC2: for all events e, for all states s:
-	//   Step[e][s] == Step[e][NF[s]]   (when both defined)
-	result.CC2Pass = true
-	for ei := 0; ei < numEvts && result.CC2Pass; ei++ {
-		for sid := 0; sid < n; sid++ {
-			stepRaw := cr.Step[ei][sid]
-			if stepRaw == -1 {
-				continue
-			}
-			nfID := cr.NF[sid]
-			stepNF := cr.Step[ei][nfID]
-			if stepNF == -1 {
-				continue
+// accessSets computes, per declared event, the variable indices read by
+// its guard and effect expressions and the indices it assigns. Parameters
+// cannot shadow state variables, so every state-variable reference in the
+// AST is a read.
+func (cr *CompiledRegistry) accessSets() (reads, writes []map[int]bool) {
+	reads = make([]map[int]bool, len(cr.Reg.Events))
+	writes = make([]map[int]bool, len(cr.Reg.Events))
+	for ei := range cr.EvtNames {
+		src := cr.EvtSource[ei]
+		if reads[src] != nil {
+			continue // already computed for an earlier transition of this event
+		}
+		r, w := map[int]bool{}, map[int]bool{}
+		collect := func(n *expr.Node) {
+			if n.Type != expr.NodeVar {
+				return
 			}
-			if stepRaw != stepNF {
-				result.CC2Pass = false
-				st := cr.Schema.Decode(registry.StateID(sid))
-				nfSt := cr.Schema.Decode(nfID)
-				result.CC2FailEvent = cr.Reg.Events[ei].Name
-				result.CC2FailState = cr.fmtState(st)
-				result.CC2FailNFState = cr.fmtState(nfSt)
-				result.CC2FailNF1 = cr.fmtState(cr.Schema.Decode(stepRaw))
-				result.CC2FailNF2 = cr.fmtState(cr.Schema.Decode(stepNF))
-				break
+			if idx := cr.Schema.VarIndex(n.Name); idx >= 0 {
+				r[idx] = true
 			}
 		}
+		expr.Walk(cr.EvtGuards[ei], collect)
+		for varIdx, node := range cr.EvtExprs[ei] {
+			w[varIdx] = true
+			expr.Walk(node, collect)
+		}
+		reads[src], writes[src] = r, w
 	}
-
-	result.CCPass = result.CC1Pass && result.CC2Pass
-	return
+	return reads, writes
 }
 
-// CCResult holds CC verification results.
-type CCResult struct {
-	CCPass  bool
-	CC1Pass bool
-	CC2Pass bool
-
-	PairsChecked     int
-	DependentSkipped int
-
-	CC1FailEvent1 string
-	CC1FailEvent2 string
-	CC1FailState  string
-	CC1FailNF1    string
-	CC1FailNF2    string
-
-	CC2FailEvent   string
-	CC2FailState   string
-	CC2FailNFState string
-	CC2FailNF1     string
-	CC2FailNF2     string
-}
-
-// containsIdent checks if a string contains an identifier (simple heuristic).
-func containsIdent(s, ident string) bool {
-	// Simple: check for word boundary match.
-	idx := 0
-	for {
-		pos := strings.Index(s[idx:], ident)
-		if pos == -1 {
+// independent reports whether neither event writes a variable the other
+// reads or writes.
+func independent(r1, w1, r2, w2 map[int]bool) bool {
+	for v := range w1 {
+		if w2[v] || r2[v] {
 			return false
 		}
-		absPos := idx + pos
-		before := absPos == 0 || !isIdentChar(s[absPos-1])
-		after := absPos+len(ident) >= len(s) || !isIdentChar(s[absPos+len(ident)])
-		if before && after {
-			return true
+	}
+	for v := range w2 {
+		if r1[v] {
+			return false
 		}
-		idx = absPos + 1
 	}
-}
-
-func isIdentChar(b byte) bool {
-	return (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || (b >= '0' && b <= '9') || b == '_'
+	return true
 }
 
 // Internal helpers.
 
+// makeEnv points the shared evaluation environment at st, with no
+// parameters bound. The environment is reused, so it must not be retained
+// across calls.
 func (cr *CompiledRegistry) makeEnv(st registry.State) *expr.Env {
-	return expr.NewEnv(&cr.Schema, st, cr.EnumLiterals)
+	cr.env.State = st
+	cr.env.Params = nil
+	cr.env.StrictDiv = false
+	return cr.env
 }
 
-func (cr *CompiledRegistry) evalValid(st registry.State) (bool, error) {
+// evalValid reports whether st, the decoding of sid, satisfies every
+// invariant. It evaluates all of them, rather than stopping at the first
+// violation, so that it can count the states satisfying each invariant in
+// invSat and record each result in holds.
+func (cr *CompiledRegistry) evalValid(sid registry.StateID, st registry.State) (bool, error) {
 	env := cr.makeEnv(st)
-	for _, invExpr := range cr.InvExprs {
+	valid := true
+	row := cr.holds[int(sid)*cr.invWords:]
+	for i, invExpr := range cr.InvExprs {
 		v, err := expr.EvalBool(invExpr, env)
 		if err != nil {
-			return false, err
+			return false, fmt.Errorf("invariant %q: %w", cr.Reg.Invariants[i].Name, err)
 		}
-		if !v {
-			return false, nil
+		if v {
+			cr.invSat[i]++
+			row[i/64] |= 1 << (uint(i) % 64)
+		} else {
+			valid = false
 		}
 	}
-	return true, nil
+	return valid, nil
 }
 
 func (cr *CompiledRegistry) evalGuard(evtIdx int, st registry.State) (bool, error) {
@@ -416,22 +1677,28 @@ func (cr *CompiledRegistry) evalGuard(evtIdx int, st registry.State) (bool, erro
 	if guard == nil {
 		return true, nil // no guard means always enabled
 	}
-	return expr.EvalBool(guard, cr.makeEnv(st))
+	env := cr.makeEnv(st)
+	env.Params = cr.EvtParams[evtIdx]
+	return expr.EvalBool(guard, env)
 }
 
 func (cr *CompiledRegistry) applyEvent(evtIdx int, st registry.State) (registry.State, error) {
-	return cr.applyAssignments(cr.EvtExprs[evtIdx], st)
+	return cr.applyAssignments(cr.EvtExprs[evtIdx], st, cr.EvtParams[evtIdx])
 }
 
 func (cr *CompiledRegistry) applyRepair(repIdx int, st registry.State) (registry.State, error) {
-	return cr.applyAssignments(cr.RepExprs[repIdx], st)
+	return cr.applyAssignments(cr.RepExprs[repIdx], st, nil)
 }
 
 // applyAssignments applies a set of simultaneous assignments.
-// All RHS expressions are evaluated in the pre-state.
-func (cr *CompiledRegistry) applyAssignments(assignments map[int]*expr.Node, st registry.State) (registry.State, error) {
+// All RHS expressions are evaluated in the pre-state, with any event
+// parameters bound. The returned post-state is a scratch buffer that is
+// overwritten by the next call; encode or copy it before reuse.
+func (cr *CompiledRegistry) applyAssignments(assignments map[int]*expr.Node, st registry.State, params map[string]expr.Value) (registry.State, error) {
 	env := cr.makeEnv(st)
-	post := make(registry.State, len(st))
+	env.Params = params
+	env.StrictDiv = cr.Opts.StrictArith
+	post := cr.post
 	copy(post, st)
 
 	for varIdx, exprNode := range assignments {
@@ -463,112 +1730,424 @@ func (cr *CompiledRegistry) applyAssignments(assignments map[int]*expr.Node, st
 			if !val.IsInt {
 				return nil, fmt.Errorf("assignment to int %q requires int value", v.Name)
 			}
-			if val.Int < v.Min || val.Int > v.Max {
-				return nil, fmt.Errorf(
-					"SPEC ERROR: assignment to %q computed value %d, allowed range [%d, %d] in state %s",
-					v.Name, val.Int, v.Min, v.Max, cr.fmtState(st))
+			n := val.Int
+			if n < v.Min || n > v.Max {
+				switch cr.Opts.OutOfRange {
+				case OutOfRangeClamp:
+					n = min(max(n, v.Min), v.Max)
+				case OutOfRangeWrap:
+					n = v.Min + ((n-v.Min)%v.Size+v.Size)%v.Size
+				default:
+					return nil, &RangeError{Var: v.Name, Value: val.Int, Min: v.Min, Max: v.Max, State: cr.fmtState(st)}
+				}
 			}
-			post[varIdx] = val.Int
+			post[varIdx] = n
 		}
 	}
 	return post, nil
 }
 
-// computeNF computes the normal form by iterating compensation.
+// computeNF computes the normal form of sid by iterating compensation and
+// records it, with the repair depth, for every state on the way. A chain
+// that runs into a state resolved earlier reuses that state's result, so a
+// repair suffix shared by many states is walked only once. A chain longer
+// than MaxRepairIter steps is reported as non-terminating and nothing on
+// it is recorded.
 func (cr *CompiledRegistry) computeNF(sid registry.StateID) (registry.StateID, error) {
+	var path []registry.StateID // unresolved invalid states, in repair order
 	current := sid
-	for iter := 0; iter < MaxRepairIter; iter++ {
+	for cr.depth[current] < 0 {
 		if cr.Valid[current] {
-			return current, nil
+			cr.NF[current], cr.depth[current] = current, 0
+			break
 		}
-		st := cr.Schema.Decode(current)
-		env := cr.makeEnv(st)
-
-		// Apply first violated invariant's repair (in declared order).
-		repaired := false
-		for ri, invExpr := range cr.InvExprs {
-			v, err := expr.EvalBool(invExpr, env)
-			if err != nil {
-				return -1, err
-			}
-			if !v {
-				// This invariant is violated; apply its repair.
-				if ri >= len(cr.RepExprs) {
-					return -1, fmt.Errorf("no repair defined for invariant %q", cr.Reg.Invariants[ri].Name)
-				}
-				newSt, err := cr.applyRepair(ri, st)
-				if err != nil {
-					return -1, err
-				}
-				current = cr.Schema.Encode(newSt)
-				repaired = true
-				break
-			}
+		if len(path) == MaxRepairIter {
+			break
 		}
-		if !repaired {
+		next, ri, progressed, err := cr.repair(current, true)
+		if err != nil {
+			return -1, err
+		}
+		if ri < 0 {
 			// All invariants pass but Valid[] says false? Shouldn't happen.
-			return current, nil
+			cr.NF[current], cr.depth[current] = current, 0
+			break
+		}
+		if w, bit := int(current)/64, uint64(1)<<(uint(current)%64); !progressed && cr.stalled[w]&bit == 0 {
+			cr.stalled[w] |= bit
+			cr.stalls[ri].note(current, next)
+		}
+		if cr.debugEnabled() {
+			cr.log().Debug("repair", "iter", len(path), "invariant", cr.Reg.Invariants[ri].Name,
+				"from", cr.fmtState(cr.Schema.Decode(current)), "to", cr.fmtState(cr.Schema.Decode(next)))
 		}
+		path = append(path, current)
+		current = next
 	}
-	st := cr.Schema.Decode(sid)
-	return -1, fmt.Errorf("compensation did not terminate within %d steps from state %s",
-		MaxRepairIter, cr.fmtState(st))
+
+	depth := cr.depth[current]
+	if depth < 0 || len(path)+depth >= MaxRepairIter {
+		st := cr.Schema.Decode(sid)
+		return -1, fmt.Errorf("%w within %d steps from state %s",
+			ErrCompensationNonTerminating, MaxRepairIter, cr.fmtState(st))
+	}
+	nf := cr.NF[current]
+	for i := len(path) - 1; i >= 0; i-- {
+		depth++
+		cr.NF[path[i]], cr.depth[path[i]] = nf, depth
+	}
+	return nf, nil
 }
 
-// repairDepth counts how many repair steps from sid to NF.
-func (cr *CompiledRegistry) repairDepth(sid registry.StateID) (int, error) {
-	current := sid
-	for depth := 0; depth < MaxRepairIter; depth++ {
-		if cr.Valid[current] {
-			return depth, nil
+// repairStep applies one compensation step to sid: a repair of the first
+// violated invariant in repair order (declaration order unless a priority
+// strategy is selected). It returns that invariant's index, or -1 (and sid
+// unchanged) if no invariant is violated. Once BuildTables has filled
+// holds, invariants are looked up rather than evaluated.
+//
+// An invariant with several repairs takes the first that progresses: one
+// that restores the invariant, or leaves fewer invariants violated than
+// before. If none does, the first is applied.
+func (cr *CompiledRegistry) repairStep(sid registry.StateID) (registry.StateID, int, error) {
+	next, ri, _, err := cr.repair(sid, false)
+	return next, ri, err
+}
+
+// repair is repairStep, also reporting whether the step progressed. For an
+// invariant with a single repair, that is whether it restored the
+// invariant, and is only computed if check is set.
+func (cr *CompiledRegistry) repair(sid registry.StateID, check bool) (registry.StateID, int, bool, error) {
+	st := cr.Schema.DecodeInto(sid, cr.pre)
+	for _, ri := range cr.repairOrder {
+		v, err := cr.invariantHolds(ri, sid, st)
+		if err != nil {
+			return -1, -1, false, err
 		}
-		st := cr.Schema.Decode(current)
-		env := cr.makeEnv(st)
-		repaired := false
-		for ri, invExpr := range cr.InvExprs {
-			v, err := expr.EvalBool(invExpr, env)
+		if v {
+			continue
+		}
+		alts := cr.Repairs[ri]
+		if len(alts) == 0 {
+			return -1, -1, false, fmt.Errorf("no repair defined for invariant %q", cr.Reg.Invariants[ri].Name)
+		}
+		if len(alts) == 1 && !check {
+			newSt, err := cr.applyRepair(alts[0], st)
 			if err != nil {
-				return 0, err
+				return -1, -1, false, err
 			}
-			if !v {
-				newSt, err := cr.applyRepair(ri, st)
-				if err != nil {
-					return 0, err
-				}
-				current = cr.Schema.Encode(newSt)
-				repaired = true
-				break
+			return cr.Schema.Encode(newSt), ri, false, nil
+		}
+		next, progressed, err := cr.tryRepairs(ri, alts, sid, st)
+		return next, ri, progressed, err
+	}
+	return sid, -1, false, nil
+}
+
+// tryRepairs applies the repairs alts of the violated invariant ri to sid,
+// whose decoding is st, in order, and returns the result of the first that
+// progresses, or of the first if none does.
+func (cr *CompiledRegistry) tryRepairs(ri int, alts []int, sid registry.StateID, st registry.State) (registry.StateID, bool, error) {
+	first, violated := registry.StateID(-1), -1
+	for _, rep := range alts {
+		newSt, err := cr.applyRepair(rep, st)
+		if err != nil {
+			return -1, false, err
+		}
+		next := cr.Schema.Encode(newSt)
+		if first < 0 {
+			first = next
+		}
+		restored, err := cr.invariantHolds(ri, next, newSt)
+		if err != nil {
+			return -1, false, err
+		}
+		if restored {
+			return next, true, nil
+		}
+		if len(alts) == 1 {
+			break
+		}
+		if violated < 0 {
+			if violated, err = cr.countViolated(sid, st); err != nil {
+				return -1, false, err
 			}
 		}
-		if !repaired {
-			return depth, nil
+		n, err := cr.countViolated(next, newSt)
+		if err != nil {
+			return -1, false, err
+		}
+		if n < violated {
+			return next, true, nil
+		}
+	}
+	return first, false, nil
+}
+
+// countViolated returns the number of invariants violated at sid, whose
+// decoding is st.
+func (cr *CompiledRegistry) countViolated(sid registry.StateID, st registry.State) (int, error) {
+	n := 0
+	for i := range cr.InvExprs {
+		v, err := cr.invariantHolds(i, sid, st)
+		if err != nil {
+			return 0, err
+		}
+		if !v {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// invariantIndex returns the index of the invariant named name, or -1.
+func invariantIndex(invs []registry.Invariant, name string) int {
+	for i, inv := range invs {
+		if inv.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// invariantHolds reports whether invariant i holds at sid, whose decoding
+// is st, from holds if it has been filled and by evaluation otherwise.
+func (cr *CompiledRegistry) invariantHolds(i int, sid registry.StateID, st registry.State) (bool, error) {
+	if cr.holds != nil {
+		return cr.holdsAt(i, sid), nil
+	}
+	return expr.EvalBool(cr.InvExprs[i], cr.makeEnv(st))
+}
+
+// holdsAt looks up in holds whether invariant i holds at sid.
+func (cr *CompiledRegistry) holdsAt(i int, sid registry.StateID) bool {
+	return cr.holds[int(sid)*cr.invWords+i/64]&(1<<(uint(i)%64)) != 0
+}
+
+// repairStall counts the states from which an invariant's repair leaves
+// that invariant violated, keeping the step from the lowest StateID so the
+// example does not depend on the order states are visited in.
+type repairStall struct {
+	count    int
+	from, to registry.StateID
+}
+
+func (st *repairStall) note(from, to registry.StateID) {
+	if st.count == 0 || from < st.from {
+		st.from, st.to = from, to
+	}
+	st.count++
+}
+
+// NonProgressingRepair describes an invariant whose repair does not always
+// restore it in one step. That is legitimate for a repair that converges
+// gradually (x = x - 1), but a repair that never restores its invariant
+// cycles forever. For an invariant with several repairs, it describes the
+// states where none of them progressed and the first was applied.
+type NonProgressingRepair struct {
+	Invariant    string `json:"invariant"`
+	Alternatives int    `json:"alternatives"` // number of repairs for the invariant
+	States       int    `json:"states"`       // states where the repair leaves the invariant violated
+	Before       string `json:"before"`
+	After        string `json:"after"`
+}
+
+// NonProgressingRepairs lists, in declaration order, the invariants whose
+// repair did not progress at some state during normal-form computation.
+// BuildTables must have been called.
+func (cr *CompiledRegistry) NonProgressingRepairs() []NonProgressingRepair {
+	var out []NonProgressingRepair
+	for i, st := range cr.stalls {
+		if st.count == 0 {
+			continue
 		}
+		out = append(out, NonProgressingRepair{
+			Invariant:    cr.Reg.Invariants[i].Name,
+			Alternatives: len(cr.Repairs[i]),
+			States:       st.count,
+			Before:       cr.fmtState(cr.Schema.Decode(st.from)),
+			After:        cr.fmtState(cr.Schema.Decode(st.to)),
+		})
 	}
-	return MaxRepairIter, fmt.Errorf("repair did not terminate")
+	return out
+}
+
+// stallHint returns a note naming the first non-progressing repair, to
+// append to a non-termination error, or "" if there is none.
+func (cr *CompiledRegistry) stallHint() string {
+	np := cr.NonProgressingRepairs()
+	if len(np) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (non-progressing repair: the repair for %q leaves it violated, e.g. %s → %s)",
+		np[0].Invariant, np[0].Before, np[0].After)
+}
+
+// repairOrder returns the invariant indices in the order the strategy
+// tries them.
+func repairOrder(invs []registry.Invariant, strategy RepairStrategy) []int {
+	order := make([]int, len(invs))
+	for i := range order {
+		order[i] = i
+	}
+	if strategy == RepairPriority {
+		sort.SliceStable(order, func(a, b int) bool {
+			return invs[order[a]].Priority > invs[order[b]].Priority
+		})
+	}
+	return order
 }
 
 func (cr *CompiledRegistry) fmtState(st registry.State) string {
-	parts := make([]string, len(st))
-	for i, v := range st {
-		vd := cr.Schema.Vars[i]
-		switch vd.Type {
-		case registry.TypeBool:
-			if v == 1 {
-				parts[i] = vd.Name + "=true"
-			} else {
-				parts[i] = vd.Name + "=false"
-			}
-		case registry.TypeEnum:
-			if v >= 0 && v < len(vd.Values) {
-				parts[i] = vd.Name + "=" + vd.Values[v]
-			} else {
-				parts[i] = fmt.Sprintf("%s=?%d", vd.Name, v)
+	return cr.Schema.Format(st)
+}
+
+// Eval parses, type-checks and evaluates an expression in state st,
+// returning its value and static type.
+func (cr *CompiledRegistry) Eval(src string, st registry.State) (expr.Value, expr.Type, error) {
+	node, err := cr.parse(src)
+	if err != nil {
+		return expr.Value{}, expr.Type{}, err
+	}
+	t, err := cr.typecheck(node, nil)
+	if err != nil {
+		return expr.Value{}, expr.Type{}, err
+	}
+	v, err := expr.Eval(node, cr.makeEnv(st))
+	if err != nil {
+		return expr.Value{}, expr.Type{}, err
+	}
+	return v, t, nil
+}
+
+// ensureTables builds the tables unless they already exist.
+func (cr *CompiledRegistry) ensureTables() error {
+	if cr.Valid != nil {
+		return nil
+	}
+	return cr.BuildTables()
+}
+
+// IsValid reports whether st satisfies every invariant. It evaluates the
+// invariants directly and does not need tables.
+func (cr *CompiledRegistry) IsValid(st registry.State) (bool, error) {
+	if err := cr.Schema.CheckState(st); err != nil {
+		return false, err
+	}
+	env := cr.makeEnv(st)
+	for i, invExpr := range cr.InvExprs {
+		v, err := expr.EvalBool(invExpr, env)
+		if err != nil {
+			return false, fmt.Errorf("invariant %q: %w", cr.Reg.Invariants[i].Name, err)
+		}
+		if !v {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// NormalForm returns the normal form of st, building the tables first if
+// needed. st itself is returned (as a copy) if it is already valid.
+func (cr *CompiledRegistry) NormalForm(st registry.State) (registry.State, error) {
+	if err := cr.Schema.CheckState(st); err != nil {
+		return nil, err
+	}
+	if err := cr.ensureTables(); err != nil {
+		return nil, err
+	}
+	sid := cr.Schema.Encode(st)
+	if cr.diverges[sid] {
+		return nil, fmt.Errorf("%w from state %s", ErrCompensationNonTerminating, cr.fmtState(st))
+	}
+	return cr.Schema.Decode(cr.NF[sid]), nil
+}
+
+// FormatState renders a state as "{name=value, ...}"; see Schema.Format.
+func (cr *CompiledRegistry) FormatState(st registry.State) string {
+	return cr.fmtState(st)
+}
+
+// fmtStep formats a Step table entry, which may be the disabled sentinel.
+func (cr *CompiledRegistry) fmtStep(id registry.StateID) string {
+	if id == -1 {
+		return "(disabled)"
+	}
+	return cr.fmtState(cr.Schema.Decode(id))
+}
+
+// TransitionStats counts the enabled (state, transition) pairs in the Step
+// table and the resulting average out-degree per state. BuildTables must
+// have been called.
+func (cr *CompiledRegistry) TransitionStats() (enabled int, avgOutDegree float64) {
+	for ei := range cr.EvtNames {
+		enabled += cr.Step.Enabled(ei)
+	}
+	if cr.Schema.TotalLen > 0 {
+		avgOutDegree = float64(enabled) / float64(cr.Schema.TotalLen)
+	}
+	return enabled, avgOutDegree
+}
+
+// TransitionRelation flattens the Step table into triples
+// [from StateID, transition index, to StateID], one per enabled entry, where
+// to is the normal form reached. Triples are ordered by from state, then
+// transition index; TransitionName maps the index back to a name. The length
+// equals the enabled count of TransitionStats. BuildTables must have been
+// called.
+func (cr *CompiledRegistry) TransitionRelation() [][3]int {
+	enabled, _ := cr.TransitionStats()
+	rel := make([][3]int, 0, enabled)
+	for sid := 0; sid < cr.Schema.TotalLen; sid++ {
+		for ei := range cr.EvtNames {
+			if next := cr.Step.Next(ei, registry.StateID(sid)); next != -1 {
+				rel = append(rel, [3]int{sid, ei, int(next)})
 			}
-		case registry.TypeInt:
-			parts[i] = fmt.Sprintf("%s=%d", vd.Name, v)
 		}
 	}
-	return "{" + strings.Join(parts, ", ") + "}"
+	return rel
+}
+
+// TransitionName returns the name of transition ei as used in
+// TransitionRelation, e.g. "deposit(n=3)" for a parameterized event.
+func (cr *CompiledRegistry) TransitionName(ei int) string {
+	return cr.EvtNames[ei]
+}
+
+// TableBytes estimates the memory BuildTables allocates: per state, the
+// Valid and divergence flags, the NF entry and repair depth and the
+// invariant memo, plus the Step table in the layout Opts.SparseStep
+// selects. A dense Step table holds one entry per transition and state, so
+// min and max are equal. A sparse one holds a bitmap per transition and an
+// entry per enabled state only, which is not known before the table is
+// built: min assumes no transition is enabled anywhere, max that every
+// transition is enabled everywhere. Other bitmaps of a bit per state are
+// not counted.
+func (cr *CompiledRegistry) TableBytes() (min, max int64) {
+	const id = 8 // StateID and int are 64-bit
+	n, t := int64(cr.Schema.TotalLen), int64(len(cr.EvtNames))
+	memo := int64(8 * ((len(cr.InvExprs) + 63) / 64))
+	fixed := n * (1 + 1 + id + id + memo)
+	entries := n * t * id
+	if !cr.Opts.SparseStep {
+		return fixed + entries, fixed + entries
+	}
+	words := (n + 63) / 64
+	rows := t * words * (8 + 4) // enabled bitmap and rank prefixes
+	return fixed + rows, fixed + rows + entries
+}
+
+// Fixpoints returns, in StateID order, the states that are valid and their
+// own normal form. Since compensation runs only while an invariant is
+// violated, this is exactly the valid set for any registry, passing or
+// not; it is read from the tables rather than assumed. Requires tables.
+func (cr *CompiledRegistry) Fixpoints() []registry.StateID {
+	var out []registry.StateID
+	for sid, valid := range cr.Valid {
+		if valid && cr.NF[sid] == registry.StateID(sid) {
+			out = append(out, registry.StateID(sid))
+		}
+	}
+	return out
 }
 
 // Stats returns summary statistics.
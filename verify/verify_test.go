@@ -0,0 +1,2194 @@
+package verify
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/blackwell-systems/nccheck/expr"
+	"github.com/blackwell-systems/nccheck/registry"
+)
+
+// compileYAML parses and compiles a registry given as YAML source.
+func compileYAML(t *testing.T, src string, opts Options) *CompiledRegistry {
+	t.Helper()
+	reg, err := registry.Parse([]byte(src))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	cr, err := CompileWithOptions(reg, opts)
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	return cr
+}
+
+// compileErr parses and compiles a registry that is expected to fail
+// compilation, and returns the error.
+func compileErr(t *testing.T, src string, opts Options) error {
+	t.Helper()
+	reg, err := registry.Parse([]byte(src))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	_, err = CompileWithOptions(reg, opts)
+	if err == nil {
+		t.Fatal("compile succeeded, want an error")
+	}
+	return err
+}
+
+// verifyYAML compiles a registry, builds its tables and runs the checks.
+func verifyYAML(t *testing.T, src string, opts Options) (*CompiledRegistry, *Result) {
+	t.Helper()
+	cr := compileYAML(t, src, opts)
+	if err := cr.BuildTables(); err != nil {
+		t.Fatalf("build tables: %v", err)
+	}
+	res, err := cr.Verify()
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	return cr, res
+}
+
+const walletYAML = `
+registry:
+  name: wallet
+  states:
+    balance: {type: int, range: [0, 10]}
+    frozen: {type: bool}
+  initial: {balance: 0, frozen: false}
+  invariants:
+    frozen_is_empty: {expr: "not frozen or balance == 0"}
+  compensation:
+    - invariant: frozen_is_empty
+      repair: {balance: 0}
+  events:
+    deposit:
+      params:
+        n: {type: int, range: [1, 3]}
+      guard: "balance + n <= 10"
+      effect: {balance: "balance + n"}
+    withdraw:
+      params:
+        n: {type: int, range: [1, 3]}
+      guard: "balance >= n"
+      effect: {balance: "balance - n"}
+    freeze:
+      effect: {frozen: true}
+`
+
+func TestParamExpansion(t *testing.T) {
+	cr := compileYAML(t, walletYAML, Options{})
+	want := []string{
+		"deposit(n=1)", "deposit(n=2)", "deposit(n=3)",
+		"withdraw(n=1)", "withdraw(n=2)", "withdraw(n=3)",
+		"freeze",
+	}
+	if len(cr.EvtNames) != len(want) {
+		t.Fatalf("transitions = %v, want %v", cr.EvtNames, want)
+	}
+	for i, name := range want {
+		if cr.EvtNames[i] != name {
+			t.Errorf("transition %d = %q, want %q", i, cr.EvtNames[i], name)
+		}
+	}
+	if err := cr.BuildTables(); err != nil {
+		t.Fatal(err)
+	}
+	from := cr.Schema.Encode(registry.State{4, 0})
+	tests := []struct {
+		event string
+		want  int // balance after, or -1 if disabled
+	}{
+		{"deposit(n=3)", 7},
+		{"withdraw(n=3)", 1},
+	}
+	for _, tt := range tests {
+		ei := indexOf(cr.EvtNames, tt.event)
+		next := cr.Step.Next(ei, from)
+		if got := cr.Schema.Decode(next)[0]; got != tt.want {
+			t.Errorf("%s from balance=4: balance = %d, want %d", tt.event, got, tt.want)
+		}
+	}
+	high := cr.Schema.Encode(registry.State{9, 0})
+	if next := cr.Step.Next(indexOf(cr.EvtNames, "deposit(n=3)"), high); next != -1 {
+		t.Errorf("deposit(n=3) from balance=9 enabled, want disabled by its guard")
+	}
+}
+
+func TestParamExpansionCap(t *testing.T) {
+	// A billion combinations: the cap must be checked before enumerating.
+	const wide = `
+registry:
+  name: wide
+  states:
+    x: {type: int, range: [0, 3]}
+  invariants: {}
+  events:
+    go:
+      params:
+        a: {type: int, range: [0, 999]}
+        b: {type: int, range: [0, 999]}
+        c: {type: int, range: [0, 999]}
+      effect: {x: 0}
+`
+	tests := []struct {
+		name string
+		src  string
+		opts Options
+	}{
+		{"default cap", wide, Options{}},
+		{"explicit cap", walletYAML, Options{MaxTransitions: 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := compileErr(t, tt.src, tt.opts)
+			if !errors.Is(err, ErrTooManyTransitions) {
+				t.Errorf("error = %v, want ErrTooManyTransitions", err)
+			}
+		})
+	}
+	if cr := compileYAML(t, walletYAML, Options{MaxTransitions: 7}); len(cr.EvtNames) != 7 {
+		t.Errorf("cap equal to the count: %d transitions, want 7", len(cr.EvtNames))
+	}
+}
+
+func indexOf(list []string, s string) int {
+	for i, v := range list {
+		if v == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// chainYAML has repair chains up to 17 steps long that all share the
+// suffix through x == 3, plus a second invariant repaired in one step.
+const chainYAML = `
+registry:
+  name: chain
+  states:
+    x: {type: int, range: [0, 20]}
+    y: {type: int, range: [0, 4]}
+  initial: {x: 0, y: 0}
+  invariants:
+    x_small: {expr: "x <= 3"}
+    y_below_x: {expr: "y <= x"}
+  compensation:
+    - invariant: x_small
+      repair: {x: "x - 1"}
+    - invariant: y_below_x
+      repair: {y: "x"}
+  events:
+    grow:
+      guard: "x < 20"
+      effect: {x: "x + 1"}
+    bump:
+      guard: "y < 4"
+      effect: {y: "y + 1"}
+`
+
+func TestDeepestRepairs(t *testing.T) {
+	cr := compileYAML(t, chainYAML, Options{})
+	if err := cr.BuildTables(); err != nil {
+		t.Fatal(err)
+	}
+	_, invalid := cr.Stats()
+	tests := []struct {
+		k    int
+		want int // entries returned
+	}{
+		{1, 1},
+		{3, 3},
+		{0, invalid},
+		{-1, invalid},
+		{invalid + 10, invalid},
+	}
+	for _, tt := range tests {
+		got, err := cr.DeepestRepairs(tt.k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != tt.want {
+			t.Fatalf("DeepestRepairs(%d) returned %d entries, want %d", tt.k, len(got), tt.want)
+		}
+		first := DepthEntry{ID: got[0].ID, Depth: 18, State: "{x=20, y=4}", NF: "{x=3, y=3}"}
+		if got[0] != first {
+			t.Errorf("DeepestRepairs(%d)[0] = %+v, want %+v", tt.k, got[0], first)
+		}
+		for i := 1; i < len(got); i++ {
+			a, b := got[i-1], got[i]
+			if a.Depth < b.Depth || a.Depth == b.Depth && a.ID > b.ID {
+				t.Errorf("DeepestRepairs(%d): %+v before %+v", tt.k, a, b)
+			}
+			if b.Depth == 0 {
+				t.Errorf("DeepestRepairs(%d) lists valid state %s", tt.k, b.State)
+			}
+		}
+	}
+}
+
+// Enums sharing only some literals cannot both be sorted, so canonical
+// order leaves them as declared rather than rejecting the registry.
+func TestCanonicalPartiallySharedEnums(t *testing.T) {
+	const src = `
+registry:
+  name: overlap
+  states:
+    a: {type: enum, values: [p, q]}
+    b: {type: enum, values: [p, q, aa]}
+  initial: {a: p, b: aa}
+  invariants:
+    same: {expr: "a == q or b != p"}
+  compensation:
+    - invariant: same
+      repair: {b: aa}
+  events:
+    flip:
+      guard: "a == p"
+      effect: {a: q}
+`
+	_, want := verifyYAML(t, src, Options{})
+	for _, order := range []CanonicalOrder{CanonicalEnums, CanonicalAll} {
+		cr, res := verifyYAML(t, src, Options{Canonical: order})
+		if got := cr.Schema.Vars[1].Values; !slices.Equal(got, []string{"p", "q", "aa"}) {
+			t.Errorf("canonical order %d: b values %v, want them as declared", order, got)
+		}
+		if res.WFCPass != want.WFCPass || res.CC.CC1Pass != want.CC.CC1Pass || res.CC.CC2Pass != want.CC.CC2Pass {
+			t.Errorf("canonical order %d: verdicts differ from declared order:\n%s", order, FormatReport(res))
+		}
+	}
+}
+
+func TestAssignTargetErrors(t *testing.T) {
+	const tmpl = `
+registry:
+  name: targets
+  states:
+    n: {type: int, range: [0, 3]}
+    status: {type: enum, values: [pending, paid]}
+  initial: {n: 0, status: pending}
+  invariants:
+    small: {expr: "n < 3"}
+  compensation:
+    - invariant: small
+      repair: {%s: 0}
+  events:
+    add:
+      params:
+        k: {type: int, range: [1, 2]}
+      effect: {%s: "k"}
+`
+	tests := []struct {
+		repair, effect string
+		wantErr        string
+	}{
+		{"n", "n", ""},
+		{"paid", "n", `repair for "small": cannot assign to enum literal "paid"`},
+		{"min", "n", `repair for "small": cannot assign to builtin "min"`},
+		{"m", "n", `repair for "small": unknown variable "m"`},
+		{"n", "k", `event "add": cannot assign to parameter "k"`},
+		{"n", "pending", `event "add": cannot assign to enum literal "pending"`},
+	}
+	for _, tt := range tests {
+		src := fmt.Sprintf(tmpl, tt.repair, tt.effect)
+		if tt.wantErr == "" {
+			compileYAML(t, src, Options{})
+			continue
+		}
+		if err := compileErr(t, src, Options{}); !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("repair %s, effect %s: error %q, want it to contain %q", tt.repair, tt.effect, err, tt.wantErr)
+		}
+	}
+}
+
+// compileExample compiles one of the registries under examples/ and builds
+// its tables.
+func compileExample(t *testing.T, name string, opts Options) *CompiledRegistry {
+	t.Helper()
+	src, err := os.ReadFile(filepath.Join("..", "examples", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cr := compileYAML(t, string(src), opts)
+	if err := cr.BuildTables(); err != nil {
+		t.Fatalf("%s: build tables: %v", name, err)
+	}
+	return cr
+}
+
+var exampleNames = []string{
+	"access_control.yaml",
+	"counters.yaml",
+	"disjoint.yaml",
+	"independent.yaml",
+	"order_fulfillment.yaml",
+	"permissions.yaml",
+	"traffic_light.yaml",
+	"two_flags.yaml",
+	"wallet.yaml",
+	"workflow.yaml",
+}
+
+func TestStrictCC2(t *testing.T) {
+	const tmpl = `
+registry:
+  name: enabledness
+  states:
+    x: {type: int, range: [0, 2]}
+    done: {type: bool}
+  initial: {x: 0, done: false}
+  invariants:
+    small: {expr: "x < 2"}
+  compensation:
+    - invariant: small
+      repair: {x: 0}
+  events:
+    finish:
+      guard: "%s"
+      effect: {done: true}
+`
+	tests := []struct {
+		guard      string
+		strict     bool
+		wantPass   bool
+		wantReason string
+	}{
+		{"x == 2", false, true, ""},
+		{"x == 2", true, false, "event enabled at s but disabled at NF(s)"},
+		{"x == 0", false, true, ""},
+		{"x == 0", true, false, "event disabled at s but enabled at NF(s)"},
+		{"not done", true, true, ""},
+	}
+	for _, tt := range tests {
+		_, res := verifyYAML(t, fmt.Sprintf(tmpl, tt.guard), Options{StrictCC2: tt.strict})
+		if res.CC.CC2Pass != tt.wantPass || res.CC.CC2FailReason != tt.wantReason {
+			t.Errorf("guard %q, strict %v: CC2 pass %v reason %q, want %v %q",
+				tt.guard, tt.strict, res.CC.CC2Pass, res.CC.CC2FailReason, tt.wantPass, tt.wantReason)
+		}
+		if !tt.wantPass && res.CC.CC2FailState != "{x=2, done=false}" {
+			t.Errorf("guard %q: CC2 counterexample %s, want {x=2, done=false}", tt.guard, res.CC.CC2FailState)
+		}
+	}
+}
+
+// divergeYAML never compensates x >= 2: the repair moves 2 to 3 and 3 to
+// itself.
+const divergeYAML = `
+registry:
+  name: diverge
+  states:
+    x: {type: int, range: [0, 3]}
+  initial: {x: 0}
+  invariants:
+    small: {expr: "x < 2"}
+  compensation:
+    - invariant: small
+      repair: {x: 3}
+  events:
+    inc:
+      guard: "x < 3"
+      effect: {x: "x + 1"}
+`
+
+func TestAllFailures(t *testing.T) {
+	cr := compileYAML(t, divergeYAML, Options{})
+	if err := cr.BuildTables(); !errors.Is(err, ErrCompensationNonTerminating) {
+		t.Errorf("fail-fast build: error %v, want ErrCompensationNonTerminating", err)
+	}
+	_, res := verifyYAML(t, divergeYAML, Options{AllFailures: true})
+	if res.WFCPass || res.WFCFailCount != 2 {
+		t.Errorf("all failures: WFC pass %v with %d failures, want 2 failures", res.WFCPass, res.WFCFailCount)
+	}
+	if want := "compensation does not terminate from state {x=2}"; res.WFCBadState != want {
+		t.Errorf("WFC counterexample %q, want %q", res.WFCBadState, want)
+	}
+
+	for _, name := range []string{"counters.yaml", "traffic_light.yaml", "workflow.yaml"} {
+		fast, err := compileExample(t, name, Options{}).Verify()
+		if err != nil {
+			t.Fatal(err)
+		}
+		all, err := compileExample(t, name, Options{AllFailures: true}).Verify()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fast.Passed() != all.Passed() || fast.CC.CC1Pass != all.CC.CC1Pass || fast.CC.CC2Pass != all.CC.CC2Pass {
+			t.Errorf("%s: verdicts differ between fail-fast and all failures", name)
+		}
+		if len(fast.CC.CC1Failures) > 1 {
+			t.Errorf("%s: fail-fast reported %d CC1 pairs, want at most 1", name, len(fast.CC.CC1Failures))
+		}
+		if fast.CC.CC1FailState != all.CC.CC1FailState || fast.CC.CC2FailState != all.CC.CC2FailState {
+			t.Errorf("%s: first counterexamples differ between fail-fast and all failures", name)
+		}
+		sum := 0
+		for _, pf := range all.CC.CC1Failures {
+			sum += pf.States
+		}
+		if sum != all.CC.CC1FailCount || all.CC.CC1FailCount < fast.CC.CC1FailCount || all.CC.CC2FailCount < fast.CC.CC2FailCount {
+			t.Errorf("%s: all-failure counts CC1 %d (pairs sum %d) CC2 %d, fail-fast CC1 %d CC2 %d",
+				name, all.CC.CC1FailCount, sum, all.CC.CC2FailCount, fast.CC.CC1FailCount, fast.CC.CC2FailCount)
+		}
+	}
+}
+
+// swapYAML swaps two variables in one effect, which must read both from
+// the pre-state.
+const swapYAML = `
+registry:
+  name: swap
+  states:
+    a: {type: int, range: [0, 3]}
+    b: {type: int, range: [0, 3]}
+    active: {type: bool}
+  initial: {a: 0, b: 1, active: false}
+  invariants:
+    ordered: {expr: "not active or a <= b"}
+  compensation:
+    - invariant: ordered
+      repair: {a: "b", b: "a"}
+  events:
+    swap:
+      effect: {a: "b", b: "a"}
+    toggle:
+      effect: {active: "not active"}
+`
+
+// freshStep fires transition ei at st the way table building did before
+// the shared Env and state buffers: with a new Env and a new post-state.
+// It returns the raw successor, or -1 if the transition is disabled.
+func freshStep(t *testing.T, cr *CompiledRegistry, ei int, st registry.State) registry.StateID {
+	t.Helper()
+	env := expr.NewEnv(&cr.Schema, st, cr.EnumLiterals)
+	env.Params = cr.EvtParams[ei]
+	if g := cr.EvtGuards[ei]; g != nil {
+		ok, err := expr.EvalBool(g, env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			return -1
+		}
+	}
+	post := slices.Clone(st)
+	for idx, node := range cr.EvtExprs[ei] {
+		v, err := expr.Eval(node, env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case v.IsBool && v.Bool:
+			post[idx] = 1
+		case v.IsBool:
+			post[idx] = 0
+		default:
+			post[idx] = v.Int
+		}
+	}
+	return cr.Schema.Encode(post)
+}
+
+// Reusing one Env and scratch states while building tables must give the
+// same tables as allocating fresh ones for every evaluation.
+func TestEnvReuseLeavesTablesUnchanged(t *testing.T) {
+	srcs := map[string]string{"swap": swapYAML, "wallet": walletYAML, "chain": chainYAML}
+	for _, name := range exampleNames {
+		src, err := os.ReadFile(filepath.Join("..", "examples", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		srcs[name] = string(src)
+	}
+	for name, src := range srcs {
+		cr := compileYAML(t, src, Options{})
+		if err := cr.BuildTables(); err != nil {
+			t.Fatalf("%s: build tables: %v", name, err)
+		}
+		for sid := range cr.Valid {
+			st := cr.Schema.Decode(registry.StateID(sid))
+			env := expr.NewEnv(&cr.Schema, st, cr.EnumLiterals)
+			valid := true
+			for _, inv := range cr.InvExprs {
+				ok, err := expr.EvalBool(inv, env)
+				if err != nil {
+					t.Fatal(err)
+				}
+				valid = valid && ok
+			}
+			if cr.Valid[sid] != valid {
+				t.Errorf("%s: Valid[%d] = %v, want %v", name, sid, cr.Valid[sid], valid)
+			}
+			for ei := range cr.EvtNames {
+				want := freshStep(t, cr, ei, st)
+				if want >= 0 {
+					want = cr.NF[want]
+				}
+				if got := cr.Step.Next(ei, registry.StateID(sid)); got != want {
+					t.Errorf("%s: Step(%s, %s) = %d, want %d", name, cr.EvtNames[ei], cr.fmtState(st), got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestNoOpEvents(t *testing.T) {
+	const src = `
+registry:
+  name: noop
+  states:
+    status: {type: enum, values: [open, closed]}
+    n: {type: int, range: [0, 2]}
+  initial: {status: open, n: 0}
+  invariants:
+    small: {expr: "n < 2"}
+  compensation:
+    - invariant: small
+      repair: {n: 0}
+  events:
+    reclose:
+      guard: "status == closed"
+      effect: {status: closed}
+    close:
+      effect: {status: closed}
+    never:
+      guard: "n > 5"
+      effect: {n: 0}
+    inc:
+      guard: "n < 2"
+      effect: {n: "n + 1"}
+`
+	cr, res := verifyYAML(t, src, Options{})
+	if got, want := cr.NoOpEvents(), []string{"reclose"}; !slices.Equal(got, want) {
+		t.Errorf("NoOpEvents() = %v, want %v", got, want)
+	}
+	found := false
+	for _, w := range res.Warnings {
+		found = found || strings.Contains(w, `"reclose"`)
+	}
+	if !found {
+		t.Errorf("no warning names reclose: %q", res.Warnings)
+	}
+}
+
+func TestTransitionStats(t *testing.T) {
+	const src = `
+registry:
+  name: degree
+  states:
+    x: {type: int, range: [0, 3]}
+    b: {type: bool}
+  initial: {x: 0, b: false}
+  invariants:
+    any: {expr: "true"}
+  events:
+    inc:
+      guard: "x < 3"
+      effect: {x: "x + 1"}
+    toggle:
+      effect: {b: "not b"}
+    never:
+      guard: "x > 3"
+      effect: {x: 0}
+    pick:
+      params:
+        v: {type: int, range: [0, 1]}
+      guard: "b"
+      effect: {x: v}
+`
+	// inc: 6 of 8 states; toggle: 8; never: 0; pick: 4 states for each
+	// of its 2 bindings.
+	const wantEnabled = 6 + 8 + 0 + 2*4
+	for _, sparse := range []bool{false, true} {
+		cr := compileYAML(t, src, Options{SparseStep: sparse})
+		if err := cr.BuildTables(); err != nil {
+			t.Fatal(err)
+		}
+		enabled, avg := cr.TransitionStats()
+		if enabled != wantEnabled || avg != float64(wantEnabled)/8 {
+			t.Errorf("sparse=%v: TransitionStats() = %d, %v; want %d, %v",
+				sparse, enabled, avg, wantEnabled, float64(wantEnabled)/8)
+		}
+	}
+
+	cr, res := verifyYAML(t, src, Options{})
+	res.EnabledTransitions, res.AvgOutDegree = cr.TransitionStats()
+	if want := "Enabled:     22 (state, transition) pairs, avg out-degree 2.75\n"; !strings.Contains(FormatReport(res), want) {
+		t.Errorf("report does not contain %q:\n%s", want, FormatReport(res))
+	}
+}
+
+// invariantYAML has 12 states, the invariant real (x <= 4) and a second
+// invariant, other, whose expression replaces INV.
+const invariantYAML = `
+registry:
+  name: inv
+  states:
+    x: {type: int, range: [0, 5]}
+    b: {type: bool}
+  initial: {x: 0, b: false}
+  invariants:
+    real: {expr: "x <= 4"}
+    other: {expr: "INV"}
+  compensation:
+    - invariant: real
+      repair: {x: 4}
+    - invariant: other
+      repair: {x: 0, b: false}
+  events:
+    inc:
+      guard: "x < 5"
+      effect: {x: "x + 1"}
+`
+
+func TestUnsatisfiableInvariant(t *testing.T) {
+	tests := []struct {
+		inv     string
+		wantErr string // "" if tables build
+	}{
+		{"x > 5 and x < 3", `invariant "other" is unsatisfiable: it is false in all 12 states`},
+		{"false", `invariant "other" is unsatisfiable`},
+		{"b and not b", `invariant "other" is unsatisfiable`},
+		{"x == 0 and not b", ""}, // satisfied by a single state
+		{"x < 3", ""},
+	}
+	for _, tt := range tests {
+		cr := compileYAML(t, strings.Replace(invariantYAML, "INV", tt.inv, 1), Options{})
+		err := cr.BuildTables()
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%s: %v", tt.inv, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("%s: error %v, want %q", tt.inv, err, tt.wantErr)
+		}
+	}
+}
+
+func TestAlwaysTrueInvariant(t *testing.T) {
+	tests := []struct {
+		inv  string
+		want bool // other is flagged
+	}{
+		{"x >= 0", true},
+		{"b or not b", true},
+		{"x <= 5", true},
+		{"x < 5 or x == 5", true},
+		{"x < 3", false},
+		{"not b", false},
+	}
+	for _, tt := range tests {
+		_, res := verifyYAML(t, strings.Replace(invariantYAML, "INV", tt.inv, 1), Options{})
+		var flagged []string
+		for _, w := range res.Warnings {
+			if strings.Contains(w, "is always true") {
+				flagged = append(flagged, w)
+			}
+		}
+		var want []string
+		if tt.want {
+			want = []string{`invariant "other" is always true: it holds in all 12 states and constrains nothing`}
+		}
+		if !slices.Equal(flagged, want) {
+			t.Errorf("%s: always-true warnings %q, want %q", tt.inv, flagged, want)
+		}
+	}
+}
+
+// priorityYAML violates both invariants at a=true, b=false, c=false.
+// Repairing a_needs_b first discards a at once; repairing a_needs_c
+// first sets c before a_needs_b discards a, reaching a different normal form.
+const priorityYAML = `
+registry:
+  name: priority
+  states:
+    a: {type: bool}
+    b: {type: bool}
+    c: {type: bool}
+  initial: {a: false, b: false, c: false}
+  invariants:
+    a_needs_b: {expr: "not a or b"}
+    a_needs_c: {expr: "not a or c", priority: 1}
+  compensation:
+    - invariant: a_needs_b
+      repair: {a: false}
+    - invariant: a_needs_c
+      repair: {c: true}
+  events:
+    set_a:
+      effect: {a: true}
+`
+
+func TestRepairStrategies(t *testing.T) {
+	tests := []struct {
+		strategy string
+		from     string
+		wantNF   string
+	}{
+		{"first", "a=true, b=false, c=false", "a=false, b=false, c=false"},
+		{"priority", "a=true, b=false, c=false", "a=false, b=false, c=true"},
+		// With one invariant violated the strategies agree.
+		{"first", "a=true, b=true, c=false", "a=true, b=true, c=true"},
+		{"priority", "a=true, b=true, c=false", "a=true, b=true, c=true"},
+		{"first", "a=true, b=false, c=true", "a=false, b=false, c=true"},
+		{"priority", "a=true, b=false, c=true", "a=false, b=false, c=true"},
+	}
+	for _, tt := range tests {
+		strategy, err := ParseRepairStrategy(tt.strategy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cr, res := verifyYAML(t, priorityYAML, Options{Repair: strategy})
+		if !res.WFCPass {
+			t.Errorf("%s: WFC failed", tt.strategy)
+		}
+		from, err := cr.Schema.ParseState(tt.from)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := cr.Schema.ParseState(tt.wantNF)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := cr.NF[cr.Schema.Encode(from)]; got != cr.Schema.Encode(want) {
+			t.Errorf("%s: NF(%s) = %s, want %s", tt.strategy, tt.from, cr.fmtStep(got), tt.wantNF)
+		}
+	}
+
+	if _, err := ParseRepairStrategy("last"); err == nil || !strings.Contains(err.Error(), `unknown repair strategy "last"`) {
+		t.Errorf("ParseRepairStrategy(last): error %v", err)
+	}
+}
+
+func TestNormalForm(t *testing.T) {
+	tests := []struct {
+		state   registry.State
+		wantNF  registry.State
+		valid   bool
+		wantErr string
+	}{
+		{registry.State{2, 1}, registry.State{2, 1}, true, ""},
+		{registry.State{3, 3}, registry.State{3, 3}, true, ""},
+		{registry.State{1, 4}, registry.State{1, 1}, false, ""},
+		{registry.State{7, 4}, registry.State{3, 3}, false, ""},
+		{registry.State{20, 0}, registry.State{3, 0}, false, ""},
+		{registry.State{21, 0}, nil, false, `variable "x": value 21 out of range [0, 20]`},
+		{registry.State{1}, nil, false, "state has 1 values, schema has 2 variables"},
+	}
+	// Tables are built lazily by the first NormalForm call.
+	cr := compileYAML(t, chainYAML, Options{})
+	for _, tt := range tests {
+		valid, err := cr.IsValid(tt.state)
+		if err == nil && valid != tt.valid {
+			t.Errorf("IsValid(%v) = %v, want %v", tt.state, valid, tt.valid)
+		}
+		nf, nfErr := cr.NormalForm(tt.state)
+		switch {
+		case tt.wantErr != "":
+			if err == nil || nfErr == nil || !strings.Contains(nfErr.Error(), tt.wantErr) {
+				t.Errorf("%v: errors %v, %v; want %q", tt.state, err, nfErr, tt.wantErr)
+			}
+		case err != nil || nfErr != nil:
+			t.Errorf("%v: errors %v, %v", tt.state, err, nfErr)
+		case !nf.Equal(tt.wantNF):
+			t.Errorf("NormalForm(%v) = %v, want %v", tt.state, nf, tt.wantNF)
+		case &nf[0] == &tt.state[0]:
+			t.Errorf("NormalForm(%v) returned its argument, want a copy", tt.state)
+		}
+	}
+
+	cr = compileYAML(t, divergeYAML, Options{AllFailures: true})
+	if _, err := cr.NormalForm(registry.State{2}); !errors.Is(err, ErrCompensationNonTerminating) {
+		t.Errorf("diverging state: error %v, want ErrCompensationNonTerminating", err)
+	}
+}
+
+func TestAssignmentTypes(t *testing.T) {
+	const tmpl = `
+registry:
+  name: types
+  states:
+    n: {type: int, range: [0, 3]}
+    b: {type: bool}
+    status: {type: enum, values: [pending, paid]}
+    stage: {type: enum, values: [pending, shipped]}
+  initial: {n: 0, b: false, status: pending, stage: pending}
+  invariants:
+    small: {expr: "n < 3"}
+  compensation:
+    - invariant: small
+      repair: {%s}
+  events:
+    set:
+      effect: {%s}
+`
+	tests := []struct {
+		repair, effect string
+		wantErr        string
+	}{
+		{"n: 0", `n: "n + 1"`, ""},
+		{"n: 0", `b: "n > 1"`, ""},
+		{"n: 0", `status: paid`, ""},
+		{"n: 0", `status: "if b then paid else status"`, ""},
+		{"n: 0", `n: "if b then 1 else n"`, ""},
+		{"n: 0", `n: "n > 1"`, `event "set", var "n": cannot assign bool value to int variable "n"`},
+		{"n: 0", `b: "n + 1"`, `event "set", var "b": cannot assign int value to bool variable "b"`},
+		{"n: 0", `status: "n"`, `event "set", var "status": cannot assign int value to enum variable "status"`},
+		{"n: 0", `n: paid`, `event "set", var "n": cannot assign enum value to int variable "n"`},
+		{"n: 0", `status: stage`, `event "set", var "status": cannot assign to "status"`},
+		{"n: 0", `status: shipped`, `event "set", var "status": cannot assign to "status"`},
+		{"n: true", `n: 1`, `repair for "small", var "n": cannot assign bool value to int variable "n"`},
+	}
+	for _, tt := range tests {
+		src := fmt.Sprintf(tmpl, tt.repair, tt.effect)
+		if tt.wantErr == "" {
+			compileYAML(t, src, Options{})
+			continue
+		}
+		if err := compileErr(t, src, Options{}); !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("repair {%s}, effect {%s}: error %q, want it to contain %q", tt.repair, tt.effect, err, tt.wantErr)
+		}
+	}
+}
+
+func TestInvariantFocus(t *testing.T) {
+	// small's repair jumps back out of range of the invariant, so
+	// compensation diverges; y_zero on its own is benign.
+	const src = `
+registry:
+  name: focus
+  states:
+    x: {type: int, range: [0, 3]}
+    y: {type: int, range: [0, 1]}
+  initial: {x: 0, y: 0}
+  invariants:
+    small: {expr: "x < 2"}
+    y_zero: {expr: "y == 0"}
+  compensation:
+    - invariant: small
+      repair: {x: 3}
+    - invariant: y_zero
+      repair: {y: 0}
+  events:
+    inc:
+      guard: "x < 3"
+      effect: {x: "x + 1"}
+    set_y:
+      effect: {y: 1}
+`
+	tests := []struct {
+		focus      string
+		wantWFC    bool
+		invariants []string
+	}{
+		{"", false, []string{"small", "y_zero"}},
+		{"small", false, []string{"small"}},
+		{"y_zero", true, []string{"y_zero"}},
+	}
+	for _, tt := range tests {
+		cr, res := verifyYAML(t, src, Options{InvariantFocus: tt.focus, AllFailures: true})
+		if res.WFCPass != tt.wantWFC {
+			t.Errorf("focus %q: WFC pass %v, want %v", tt.focus, res.WFCPass, tt.wantWFC)
+		}
+		if tt.wantWFC && !res.CC.CCPass {
+			t.Errorf("focus %q: CC failed", tt.focus)
+		}
+		if !slices.Equal(res.Invariants, tt.invariants) || len(cr.InvExprs) != len(tt.invariants) {
+			t.Errorf("focus %q: invariants %v (%d compiled), want %v", tt.focus, res.Invariants, len(cr.InvExprs), tt.invariants)
+		}
+		report := FormatReport(res)
+		if want := "Focus:       " + tt.focus + "  (all other invariants ignored)"; (tt.focus != "") != strings.Contains(report, want) {
+			t.Errorf("focus %q: report focus line wrong:\n%s", tt.focus, report)
+		}
+	}
+
+	if err := compileErr(t, src, Options{InvariantFocus: "big"}); !strings.Contains(err.Error(), `invariant focus: no invariant named "big"`) {
+		t.Errorf("unknown focus: error %v", err)
+	}
+}
+
+func TestTrivialStateSpaceWarning(t *testing.T) {
+	const tmpl = `
+registry:
+  name: tiny
+  states:
+    mode: {type: enum, values: [%s]}
+    n: {type: int, range: [%s]}
+  initial: {mode: idle, n: 0}
+  invariants:
+    ok: {expr: "n == 0"}
+  compensation:
+    - invariant: ok
+      repair: {n: 0}
+  events:
+    noop:
+      effect: {n: 0}
+`
+	tests := []struct {
+		values, rng string
+		want        string // "" if no warning
+	}{
+		{"idle", "0, 0", "state space has only 1 state(s), so every check passes trivially; check the variable definitions (single-valued: mode, n)"},
+		{"idle, busy", "0, 0", ""},
+		{"idle", "0, 1", ""},
+	}
+	for _, tt := range tests {
+		_, res := verifyYAML(t, fmt.Sprintf(tmpl, tt.values, tt.rng), Options{})
+		var got string
+		for _, w := range res.Warnings {
+			if strings.HasPrefix(w, "state space has only") {
+				got = w
+			}
+		}
+		if got != tt.want {
+			t.Errorf("values [%s], range [%s]: warning %q, want %q", tt.values, tt.rng, got, tt.want)
+		}
+	}
+}
+
+func TestEventsFilter(t *testing.T) {
+	// In counters.yaml every x event fails CC1 against every y event.
+	tests := []struct {
+		events   []string
+		wantCC1  bool
+		names    []string
+		excluded []string
+	}{
+		{nil, false, []string{"inc_x", "dec_x", "inc_y", "dec_y"}, nil},
+		{[]string{"inc_y", "inc_x"}, false, []string{"inc_x", "inc_y"}, []string{"dec_x", "dec_y"}},
+		{[]string{"inc_x", "dec_x"}, true, []string{"inc_x", "dec_x"}, []string{"inc_y", "dec_y"}},
+		{[]string{"dec_y"}, true, []string{"dec_y"}, []string{"inc_x", "dec_x", "inc_y"}},
+	}
+	for _, tt := range tests {
+		cr := compileExample(t, "counters.yaml", Options{Events: tt.events})
+		res, err := cr.Verify()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.CC.CC1Pass != tt.wantCC1 {
+			t.Errorf("events %v: CC1 pass %v, want %v", tt.events, res.CC.CC1Pass, tt.wantCC1)
+		}
+		if !slices.Equal(cr.EvtNames, tt.names) || !slices.Equal(res.Events, tt.names) || !slices.Equal(res.Excluded, tt.excluded) {
+			t.Errorf("events %v: transitions %v, reported %v excluding %v; want %v excluding %v",
+				tt.events, cr.EvtNames, res.Events, res.Excluded, tt.names, tt.excluded)
+		}
+	}
+
+	src, err := os.ReadFile(filepath.Join("..", "examples", "counters.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := compileErr(t, string(src), Options{Events: []string{"inc_x", "inc_z"}}); !strings.Contains(err.Error(), `events filter: no event named "inc_z"`) {
+		t.Errorf("unknown event: error %v", err)
+	}
+}
+
+func TestUnusedVars(t *testing.T) {
+	// Each used variable is referenced in just one place.
+	const src = `
+registry:
+  name: unused
+  states:
+    inv: {type: bool}
+    rep: {type: bool}
+    guard: {type: bool}
+    target: {type: int, range: [0, 1]}
+    rhs: {type: int, range: [0, 1]}
+    spare: {type: enum, values: [a, b, c]}
+  initial: {inv: false, rep: false, guard: false, target: 0, rhs: 0, spare: a}
+  invariants:
+    only: {expr: "not inv"}
+  compensation:
+    - invariant: only
+      repair: {inv: "rep and not rep"}
+  events:
+    set:
+      guard: "guard or true"
+      effect: {target: rhs}
+`
+	_, res := verifyYAML(t, src, Options{})
+	cr := compileYAML(t, src, Options{})
+	if got, want := cr.UnusedVars(), []string{"spare"}; !slices.Equal(got, want) {
+		t.Errorf("UnusedVars() = %v, want %v", got, want)
+	}
+	var got []string
+	for _, w := range res.Warnings {
+		if strings.Contains(w, "is never read or written") {
+			got = append(got, w)
+		}
+	}
+	want := []string{`variable "spare" is never read or written: it multiplies the state space by 3 for nothing`}
+	if !slices.Equal(got, want) {
+		t.Errorf("unused-variable warnings %q, want %q", got, want)
+	}
+
+	if got := compileExample(t, "wallet.yaml", Options{}).UnusedVars(); len(got) != 0 {
+		t.Errorf("wallet.yaml: UnusedVars() = %v, want none", got)
+	}
+}
+
+func TestCanonicalEncoding(t *testing.T) {
+	const tmpl = `
+registry:
+  name: canon
+  states:
+%s
+  initial: {mode: idle, n: 0}
+  invariants:
+    done_at_top: {expr: "mode != done or n == 2"}
+  compensation:
+    - invariant: done_at_top
+      repair: {n: 2}
+  events:
+    start:
+      guard: "mode == idle"
+      effect: {mode: running}
+    finish:
+      guard: "mode == running"
+      effect: {mode: done}
+    inc:
+      guard: "n < 2"
+      effect: {n: "n + 1"}
+`
+	declared := fmt.Sprintf(tmpl, "    mode: {type: enum, values: [idle, running, done]}\n    n: {type: int, range: [0, 2]}")
+	reordered := fmt.Sprintf(tmpl, "    n: {type: int, range: [0, 2]}\n    mode: {type: enum, values: [done, running, idle]}")
+
+	tests := []struct {
+		order    CanonicalOrder
+		enumsOK  bool // only enum value order differs
+		allOK    bool // variable order differs too
+		encoding []string
+	}{
+		{CanonicalNone, false, false, nil},
+		{CanonicalEnums, true, false, []string{"mode: done=0 idle=1 running=2  ×3", "n: 0..2=0..2  ×1"}},
+		{CanonicalAll, true, true, []string{"mode: done=0 idle=1 running=2  ×3", "n: 0..2=0..2  ×1"}},
+	}
+	enumsOnly := strings.Replace(declared, "[idle, running, done]", "[running, done, idle]", 1)
+	for _, tt := range tests {
+		crA, resA := verifyYAML(t, declared, Options{Canonical: tt.order})
+		for _, other := range []struct {
+			src  string
+			want bool
+		}{{enumsOnly, tt.enumsOK}, {reordered, tt.allOK}} {
+			crB, resB := verifyYAML(t, other.src, Options{Canonical: tt.order})
+			same := slices.Equal(crA.NF, crB.NF) && slices.Equal(crA.Valid, crB.Valid) &&
+				slices.Equal(crA.TransitionRelation(), crB.TransitionRelation()) &&
+				slices.Equal(resA.Encoding, resB.Encoding)
+			if same != other.want {
+				t.Errorf("order %d: identical encodings = %v, want %v", tt.order, same, other.want)
+			}
+			if resA.WFCPass != resB.WFCPass || resA.CC.CCPass != resB.CC.CCPass || resA.ReachableStates != resB.ReachableStates {
+				t.Errorf("order %d: results differ between equivalent registries", tt.order)
+			}
+		}
+		if !slices.Equal(resA.Encoding, tt.encoding) {
+			t.Errorf("order %d: encoding %q, want %q", tt.order, resA.Encoding, tt.encoding)
+		}
+	}
+}
+
+func init() {
+	expr.RegisterBuiltin("roundup", 2, func(args []expr.Value) (expr.Value, error) {
+		x, k := args[0].Int, args[1].Int
+		return expr.Value{IsInt: true, Int: (x + k - 1) / k * k}, nil
+	})
+}
+
+func TestRegisteredBuiltinInInvariant(t *testing.T) {
+	const src = `
+registry:
+  name: custom
+  states:
+    n: {type: int, range: [0, 8]}
+  initial: {n: 0}
+  invariants:
+    even: {expr: "roundup(n, 2) == n"}
+  compensation:
+    - invariant: even
+      repair: {n: "roundup(n, 2)"}
+  events:
+    add:
+      guard: "n < 8"
+      effect: {n: "n + 1"}
+`
+	cr, res := verifyYAML(t, src, Options{})
+	for sid, valid := range cr.Valid {
+		if want := sid%2 == 0; valid != want {
+			t.Errorf("Valid[n=%d] = %v, want %v", sid, valid, want)
+		}
+	}
+	if nf := cr.NF[7]; nf != 8 {
+		t.Errorf("NF[n=7] = %d, want 8", nf)
+	}
+	if !res.WFCPass {
+		t.Error("WFC failed")
+	}
+}
+
+// naiveNF walks the repair chain from sid one step at a time, evaluating
+// invariants directly rather than through the holds memo, and returns the
+// normal form and the number of steps taken.
+func naiveNF(t *testing.T, cr *CompiledRegistry, sid registry.StateID) (registry.StateID, int) {
+	t.Helper()
+	holds := cr.holds
+	cr.holds = nil
+	defer func() { cr.holds = holds }()
+	for depth := 0; depth <= MaxRepairIter; depth++ {
+		next, ri, err := cr.repairStep(sid)
+		if err != nil {
+			t.Fatalf("repair step at %d: %v", sid, err)
+		}
+		if ri < 0 {
+			return sid, depth
+		}
+		sid = next
+	}
+	t.Fatalf("no normal form within %d steps", MaxRepairIter)
+	return -1, 0
+}
+
+func TestNFMatchesNaiveWalk(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		opts Options
+	}{
+		{"chain", chainYAML, Options{}},
+		{"chain priority", chainYAML, Options{Repair: RepairPriority}},
+		{"chain seeded", chainYAML, Options{Seed: 7}},
+		{"wallet", walletYAML, Options{}},
+		{"alternatives", altRepairYAML, Options{}},
+	}
+	for _, name := range exampleNames {
+		src, err := os.ReadFile(filepath.Join("..", "examples", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tests = append(tests, struct {
+			name string
+			src  string
+			opts Options
+		}{name, string(src), Options{}})
+	}
+	for _, tt := range tests {
+		cr := compileYAML(t, tt.src, tt.opts)
+		if err := cr.BuildTables(); err != nil {
+			t.Fatalf("%s: build tables: %v", tt.name, err)
+		}
+		depths, err := cr.repairDepths()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if tt.name == "chain" && slices.Max(depths) != 18 {
+			t.Errorf("chain: max depth %d, want 18", slices.Max(depths))
+		}
+		for sid := range cr.NF {
+			nf, depth := naiveNF(t, cr, registry.StateID(sid))
+			if cr.NF[sid] != nf || depths[sid] != depth {
+				t.Errorf("%s: state %d: memoized NF %d depth %d, naive NF %d depth %d",
+					tt.name, sid, cr.NF[sid], depths[sid], nf, depth)
+			}
+		}
+	}
+}
+
+func TestCheckDependentPairs(t *testing.T) {
+	// inc and add_two both write x, so every pair among them and reset is
+	// dependent; flip is independent of all three.
+	const src = `
+registry:
+  name: dependent
+  states:
+    x: {type: int, range: [0, 3]}
+    y: {type: bool}
+  initial: {x: 0, y: false}
+  invariants:
+    any: {expr: "x >= 0"}
+  events:
+    inc:
+      guard: "x < 3"
+      effect: {x: "x + 1"}
+    add_two:
+      guard: "x < 2"
+      effect: {x: "x + 2"}
+    reset:
+      effect: {x: 0}
+    flip:
+      effect: {y: "not y"}
+`
+	wantPairs := []DependentPair{
+		{Event1: "inc", Event2: "add_two", Commutes: true},
+		{Event1: "inc", Event2: "reset", Commutes: false, States: 6, State: "{x=0, y=false}"},
+		{Event1: "add_two", Event2: "reset", Commutes: false, States: 4, State: "{x=0, y=false}"},
+	}
+	tests := []struct {
+		opts    Options
+		wantCC1 bool
+		pairs   []DependentPair
+	}{
+		{Options{AllFailures: true}, true, nil},
+		{Options{AllFailures: true, CheckDependentPairs: true}, true, wantPairs},
+		{Options{AllFailures: true, StrictDependentPairs: true}, false, wantPairs},
+	}
+	for _, tt := range tests {
+		_, res := verifyYAML(t, src, tt.opts)
+		if res.CC.CC1Pass != tt.wantCC1 {
+			t.Errorf("%+v: CC1 pass %v, want %v", tt.opts, res.CC.CC1Pass, tt.wantCC1)
+		}
+		if !reflect.DeepEqual(res.CC.DependentPairs, tt.pairs) {
+			t.Errorf("%+v: dependent pairs %+v, want %+v", tt.opts, res.CC.DependentPairs, tt.pairs)
+		}
+		report := FormatReport(res)
+		if tt.pairs != nil && !strings.Contains(report, "  Dependent: 3 pairs checked, 1 commute\n") {
+			t.Errorf("%+v: report lacks the dependent pair summary:\n%s", tt.opts, report)
+		}
+	}
+}
+
+func TestStrictArith(t *testing.T) {
+	const src = `
+registry:
+  name: halve
+  states:
+    x: {type: int, range: [0, 7]}
+  initial: {x: 0}
+  invariants:
+    small: {expr: "x / 2 <= 2"}
+  compensation:
+    - invariant: small
+      repair: {x: "REPAIR"}
+  events:
+    inc:
+      guard: "x < 7"
+      effect: {x: "x + 1"}
+`
+	tests := []struct {
+		repair  string
+		strict  bool
+		wantNF7 registry.StateID
+		wantErr string
+	}{
+		{"7 / 2", false, 3, ""},
+		{"7 / 2", true, 0, "inexact division 7 / 2 under strict arithmetic"},
+		{"8 / 2", true, 4, ""},
+		{"floordiv(7, 2)", true, 3, ""},
+	}
+	for _, tt := range tests {
+		// The invariant divides inexactly too, which strict mode allows.
+		cr := compileYAML(t, strings.Replace(src, "REPAIR", tt.repair, 1), Options{StrictArith: tt.strict})
+		err := cr.BuildTables()
+		switch {
+		case tt.wantErr != "":
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s (strict %v): error %v, want %q", tt.repair, tt.strict, err, tt.wantErr)
+			}
+		case err != nil:
+			t.Errorf("%s (strict %v): %v", tt.repair, tt.strict, err)
+		case cr.NF[7] != tt.wantNF7:
+			t.Errorf("%s (strict %v): NF[x=7] = %d, want %d", tt.repair, tt.strict, cr.NF[7], tt.wantNF7)
+		}
+	}
+}
+
+func TestParseShard(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    Shard
+		wantErr bool
+	}{
+		{"1/1", Shard{0, 1}, false},
+		{"2/4", Shard{1, 4}, false},
+		{"4/4", Shard{3, 4}, false},
+		{"0/4", Shard{}, true},
+		{"5/4", Shard{}, true},
+		{"1/0", Shard{}, true},
+		{"2/4x", Shard{}, true},
+		{"02/4", Shard{}, true},
+		{"two", Shard{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseShard(tt.spec)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseShard(%q) = %v, %v; want %v, error %v", tt.spec, got, err, tt.want, tt.wantErr)
+		}
+		if err == nil && got.String() != tt.spec {
+			t.Errorf("ParseShard(%q).String() = %q", tt.spec, got.String())
+		}
+	}
+}
+
+func TestShardRangesPartition(t *testing.T) {
+	for _, total := range []int{0, 1, 7, 64, 1000} {
+		for count := 1; count <= 9; count++ {
+			next := 0
+			for i := 0; i < count; i++ {
+				lo, hi := Shard{i, count}.Range(total)
+				if lo != next || hi < lo {
+					t.Fatalf("total %d, shard %d/%d: range [%d, %d), want it to start at %d", total, i+1, count, lo, hi, next)
+				}
+				next = hi
+			}
+			if next != total {
+				t.Errorf("total %d, %d shards cover [0, %d)", total, count, next)
+			}
+		}
+	}
+}
+
+// Every shard's CC failures add up to those of the unsharded run, and CC
+// passes unsharded exactly when it passes on every shard.
+func TestShardsUnionEqualsUnsharded(t *testing.T) {
+	for _, name := range exampleNames {
+		for _, count := range []int{2, 3, 5} {
+			full := compileExample(t, name, Options{AllFailures: true}).CheckCC()
+			var cc1, cc2 int
+			cc1Pass, cc2Pass := true, true
+			pairStates := map[[2]string]int{}
+			for i := 0; i < count; i++ {
+				cr := compileExample(t, name, Options{AllFailures: true, Shard: Shard{i, count}})
+				r := cr.CheckCC()
+				cc1 += r.CC1FailCount
+				cc2 += r.CC2FailCount
+				cc1Pass = cc1Pass && r.CC1Pass
+				cc2Pass = cc2Pass && r.CC2Pass
+				for _, pf := range r.CC1Failures {
+					pairStates[[2]string{pf.Event1, pf.Event2}] += pf.States
+				}
+			}
+			if cc1 != full.CC1FailCount || cc2 != full.CC2FailCount {
+				t.Errorf("%s, %d shards: failures CC1 %d CC2 %d, unsharded CC1 %d CC2 %d",
+					name, count, cc1, cc2, full.CC1FailCount, full.CC2FailCount)
+			}
+			if cc1Pass != full.CC1Pass || cc2Pass != full.CC2Pass {
+				t.Errorf("%s, %d shards: pass CC1 %v CC2 %v, unsharded CC1 %v CC2 %v",
+					name, count, cc1Pass, cc2Pass, full.CC1Pass, full.CC2Pass)
+			}
+			for _, pf := range full.CC1Failures {
+				if got := pairStates[[2]string{pf.Event1, pf.Event2}]; got != pf.States {
+					t.Errorf("%s, %d shards: %s/%s fails in %d states, unsharded %d",
+						name, count, pf.Event1, pf.Event2, got, pf.States)
+				}
+			}
+		}
+	}
+}
+
+func TestBoolSynonymsBesideOnOffEnum(t *testing.T) {
+	const src = `
+registry:
+  name: lamp
+  states:
+    power: {type: enum, values: ["off", "on"]}
+    lit: {type: bool}
+  initial: {power: "off", lit: no}
+  invariants:
+    lit_needs_power: {expr: "not lit or power == on"}
+  compensation:
+    - invariant: lit_needs_power
+      repair: {lit: false}
+  events:
+    switch_on:
+      effect: {power: on}
+    switch_off:
+      effect: {power: off}
+    light:
+      guard: "lit == no"
+      effect: {lit: yes}
+`
+	cr, res := verifyYAML(t, src, Options{})
+	if !res.WFCPass {
+		t.Error("WFC failed")
+	}
+	st, err := cr.Schema.ParseState("power=on, lit=false")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cr.Valid[cr.Schema.Encode(st)] {
+		t.Error("power=on, lit=false is invalid; power == on should compare against the enum literal")
+	}
+}
+
+func TestInvalidOnlyEvents(t *testing.T) {
+	// overflow's guard contradicts the invariant; jump(to=3) only fires
+	// from x=3, which is invalid.
+	const src = `
+registry:
+  name: guards
+  states:
+    x: {type: int, range: [0, 3]}
+  initial: {x: 0}
+  invariants:
+    small: {expr: "x <= 2"}
+  compensation:
+    - invariant: small
+      repair: {x: 2}
+  events:
+    inc:
+      guard: "x < 3"
+      effect: {x: "x + 1"}
+    overflow:
+      guard: "x == 3"
+      effect: {x: 0}
+    jump:
+      params:
+        to: {type: int, range: [2, 3]}
+      guard: "x == to"
+      effect: {x: 0}
+`
+	cr, res := verifyYAML(t, src, Options{})
+	if got, want := cr.InvalidOnlyEvents(), []string{"overflow", "jump(to=3)"}; !slices.Equal(got, want) {
+		t.Errorf("InvalidOnlyEvents() = %v, want %v", got, want)
+	}
+	var got []string
+	for _, w := range res.Warnings {
+		if strings.Contains(w, "can never fire from a valid state") {
+			got = append(got, w)
+		}
+	}
+	if len(got) != 2 || !strings.HasPrefix(got[0], `event "overflow"`) || !strings.HasPrefix(got[1], `event "jump(to=3)"`) {
+		t.Errorf("guard warnings %q, want one each for overflow and jump(to=3)", got)
+	}
+}
+
+func TestInvariantMemoMatchesEvaluation(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{"chain", chainYAML},
+		{"wallet", walletYAML},
+	}
+	for _, tt := range tests {
+		cr := compileYAML(t, tt.src, Options{})
+		if err := cr.BuildTables(); err != nil {
+			t.Fatalf("%s: build tables: %v", tt.name, err)
+		}
+		for sid := range cr.Valid {
+			st := cr.Schema.Decode(registry.StateID(sid))
+			valid := true
+			for i, inv := range cr.InvExprs {
+				want, err := expr.EvalBool(inv, cr.makeEnv(st))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := cr.holdsAt(i, registry.StateID(sid)); got != want {
+					t.Errorf("%s: invariant %d at state %d: memo %v, evaluated %v", tt.name, i, sid, got, want)
+				}
+				valid = valid && want
+			}
+			if cr.Valid[sid] != valid {
+				t.Errorf("%s: Valid[%d] = %v, want %v", tt.name, sid, cr.Valid[sid], valid)
+			}
+		}
+		// Repairing through the memo and by evaluation must agree.
+		for sid := range cr.Valid {
+			gotNext, gotRI, err := cr.repairStep(registry.StateID(sid))
+			if err != nil {
+				t.Fatal(err)
+			}
+			holds := cr.holds
+			cr.holds = nil
+			wantNext, wantRI, err := cr.repairStep(registry.StateID(sid))
+			cr.holds = holds
+			if err != nil {
+				t.Fatal(err)
+			}
+			if gotNext != wantNext || gotRI != wantRI {
+				t.Errorf("%s: repair step at %d: memo (%d, %d), evaluated (%d, %d)",
+					tt.name, sid, gotNext, gotRI, wantNext, wantRI)
+			}
+		}
+	}
+}
+
+func TestMaxCCPairs(t *testing.T) {
+	// disjoint.yaml has 16 independent pairs, all of which commute.
+	tests := []struct {
+		maxPairs    int
+		seed        int64
+		wantSampled bool
+		wantChecked int
+	}{
+		{0, 0, false, 16},
+		{16, 0, false, 16},
+		{20, 5, false, 16},
+		{5, 7, true, 5},
+		{1, 0, true, 1}, // time-based seed
+	}
+	for _, tt := range tests {
+		cr := compileExample(t, "disjoint.yaml", Options{MaxCCPairs: tt.maxPairs, SampleSeed: tt.seed})
+		res, err := cr.Verify()
+		if err != nil {
+			t.Fatal(err)
+		}
+		cc := res.CC
+		if cc.Sampled != tt.wantSampled || cc.PairsChecked != tt.wantChecked || !cc.CC1Pass {
+			t.Errorf("MaxCCPairs %d: sampled %v, %d pairs checked, CC1 %v; want sampled %v, %d checked, pass",
+				tt.maxPairs, cc.Sampled, cc.PairsChecked, cc.CC1Pass, tt.wantSampled, tt.wantChecked)
+		}
+		if !tt.wantSampled {
+			continue
+		}
+		if cc.PairsTotal != 16 || cc.SampleSeed == 0 || (tt.seed != 0 && cc.SampleSeed != tt.seed) {
+			t.Errorf("MaxCCPairs %d, seed %d: reported %d total pairs, seed %d", tt.maxPairs, tt.seed, cc.PairsTotal, cc.SampleSeed)
+		}
+		report := FormatReport(res)
+		if !strings.Contains(report, "not exhaustive") || strings.Contains(report, "GUARANTEED") {
+			t.Errorf("MaxCCPairs %d: report does not mark the pass as sampled:\n%s", tt.maxPairs, report)
+		}
+	}
+}
+
+// A reported seed reproduces the sample: counters.yaml has four independent
+// pairs, all failing, so the failures show which two were drawn.
+func TestMaxCCPairsSeedReproduces(t *testing.T) {
+	sample := func(seed int64) (int64, []string) {
+		cr := compileExample(t, "counters.yaml", Options{MaxCCPairs: 2, SampleSeed: seed, AllFailures: true})
+		res, err := cr.Verify()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var pairs []string
+		for _, pf := range res.CC.CC1Failures {
+			pairs = append(pairs, pf.Event1+","+pf.Event2)
+		}
+		if len(pairs) != 2 {
+			t.Fatalf("seed %d: %d pairs failed, want the 2 sampled", seed, len(pairs))
+		}
+		return res.CC.SampleSeed, pairs
+	}
+	seed, first := sample(0)
+	for i := 0; i < 3; i++ {
+		if _, again := sample(seed); !slices.Equal(again, first) {
+			t.Errorf("seed %d sampled %v, then %v", seed, first, again)
+		}
+	}
+}
+
+func TestConstantsInExpressions(t *testing.T) {
+	const src = `
+registry:
+  name: tank
+  constants: {capacity: 4, reserve: 1}
+  states:
+    level: {type: int, range: [0, capacity]}
+  invariants:
+    headroom: {expr: "level <= capacity - reserve"}
+  compensation:
+    - invariant: headroom
+      repair: {level: "capacity - reserve"}
+  events:
+    fill: {guard: "level < capacity", effect: {level: "capacity"}}
+    drain: {effect: {level: "0"}}
+`
+	cr, res := verifyYAML(t, src, Options{})
+	if !res.Passed() {
+		t.Errorf("tank does not converge:\n%s", FormatReport(res))
+	}
+	tests := []struct {
+		src  string
+		want int
+	}{
+		{"capacity", 4},
+		{"capacity - reserve", 3},
+		{"level + reserve", 1},
+	}
+	st, err := cr.Schema.ParseState("level=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		v, _, err := cr.Eval(tt.src, st)
+		if err != nil || v.Int != tt.want {
+			t.Errorf("%s = %+v, %v; want %d", tt.src, v, err, tt.want)
+		}
+	}
+	for level, want := range []int{0, 1, 2, 3, 3} {
+		st := registry.State{level}
+		if got := cr.Schema.Decode(cr.NF[cr.Schema.Encode(st)])[0]; got != want {
+			t.Errorf("NF(level=%d) has level=%d, want %d", level, got, want)
+		}
+	}
+}
+
+func TestTransitionRelation(t *testing.T) {
+	tests := []struct {
+		example string
+		sparse  bool
+	}{
+		{"wallet.yaml", false},
+		{"wallet.yaml", true},
+		{"order_fulfillment.yaml", false},
+		{"traffic_light.yaml", true},
+		{"access_control.yaml", false},
+	}
+	for _, tt := range tests {
+		cr := compileExample(t, tt.example, Options{SparseStep: tt.sparse})
+		rel := cr.TransitionRelation()
+		if enabled, _ := cr.TransitionStats(); len(rel) != enabled {
+			t.Errorf("%s, sparse=%v: %d triples, want %d enabled transitions", tt.example, tt.sparse, len(rel), enabled)
+		}
+		for i, tr := range rel {
+			from, ei, to := tr[0], tr[1], tr[2]
+			if next := cr.Step.Next(ei, registry.StateID(from)); int(next) != to {
+				t.Errorf("%s: triple %v, but %s steps %d to %d", tt.example, tr, cr.TransitionName(ei), from, next)
+			}
+			if i > 0 && (rel[i-1][0] > from || rel[i-1][0] == from && rel[i-1][1] >= ei) {
+				t.Errorf("%s: triple %v follows %v, want order by state then transition", tt.example, tr, rel[i-1])
+			}
+		}
+	}
+}
+
+func TestTransitionName(t *testing.T) {
+	const src = `
+registry:
+  name: names
+  states:
+    x: {type: int, range: [0, 1]}
+  invariants:
+    any: {expr: "true"}
+  events:
+    reset: {effect: {x: 0}}
+    pick:
+      params:
+        v: {type: int, range: [0, 1]}
+      effect: {x: v}
+`
+	cr, _ := verifyYAML(t, src, Options{})
+	want := []string{"reset", "pick(v=0)", "pick(v=1)"}
+	for ei, name := range want {
+		if got := cr.TransitionName(ei); got != name {
+			t.Errorf("TransitionName(%d) = %q, want %q", ei, got, name)
+		}
+	}
+	// Every transition is enabled in both states.
+	if rel := cr.TransitionRelation(); len(rel) != 2*len(want) {
+		t.Errorf("%d triples, want %d", len(rel), 2*len(want))
+	}
+}
+
+func TestNonProgressingRepairs(t *testing.T) {
+	const tmpl = `
+registry:
+  name: stall
+  states:
+    x: {type: int, range: [0, 5]}
+  invariants:
+    small: {expr: "x <= 2"}
+  compensation:
+    - invariant: small
+      repair: {x: "REPAIR"}
+  events:
+    grow: {guard: "x < 5", effect: {x: "x + 1"}}
+`
+	tests := []struct {
+		repair   string
+		want     []NonProgressingRepair
+		wantWarn string
+		wantErr  string // substring of the BuildTables error
+	}{
+		{repair: "2"},
+		{repair: "x - 3"},
+		// Gradual: from x=4 and x=5 one step is not enough.
+		{repair: "x - 1",
+			want:     []NonProgressingRepair{{Invariant: "small", Alternatives: 1, States: 2, Before: "{x=4}", After: "{x=3}"}},
+			wantWarn: `repair for invariant "small" does not restore it in 2 state(s), e.g. {x=4} → {x=3}`},
+		// 3 and 4 swap forever.
+		{repair: "7 - x",
+			wantErr: `did not terminate within 1000 steps from state {x=3} (non-progressing repair: the repair for "small" leaves it violated, e.g. {x=3} → {x=4})`},
+	}
+	for _, tt := range tests {
+		cr := compileYAML(t, strings.Replace(tmpl, "REPAIR", tt.repair, 1), Options{})
+		err := cr.BuildTables()
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("repair %s: error %v, want %q", tt.repair, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("repair %s: %v", tt.repair, err)
+		}
+		if got := cr.NonProgressingRepairs(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("repair %s: NonProgressingRepairs() = %+v, want %+v", tt.repair, got, tt.want)
+		}
+		res, err := cr.Verify()
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := false
+		for _, w := range res.Warnings {
+			found = found || w == tt.wantWarn
+		}
+		if tt.wantWarn != "" && !found {
+			t.Errorf("repair %s: warnings %q, want %q", tt.repair, res.Warnings, tt.wantWarn)
+		}
+	}
+}
+
+func TestValidStatesAreFixpoints(t *testing.T) {
+	for _, name := range exampleNames {
+		cr := compileExample(t, name, Options{})
+		for sid := range cr.Valid {
+			nf := cr.NF[sid]
+			if cr.Valid[sid] && nf != registry.StateID(sid) {
+				t.Errorf("%s: valid state %d has NF %d", name, sid, nf)
+			}
+			if !cr.diverges[sid] && cr.NF[nf] != nf {
+				t.Errorf("%s: NF %d of state %d is not its own NF", name, nf, sid)
+			}
+		}
+	}
+}
+
+// The visiting order drawn from Seed must not change any table or result.
+func TestSeedDoesNotChangeResults(t *testing.T) {
+	srcs := map[string]string{"chain": chainYAML, "wallet": walletYAML}
+	for _, name := range exampleNames {
+		src, err := os.ReadFile(filepath.Join("..", "examples", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		srcs[name] = string(src)
+	}
+	for name, src := range srcs {
+		base, want := verifyYAML(t, src, Options{AllFailures: true})
+		want.Elapsed = 0
+		for _, seed := range []int64{1, 2, 42, -7, 1 << 40} {
+			cr, got := verifyYAML(t, src, Options{AllFailures: true, Seed: seed})
+			got.Elapsed = 0
+			if !slices.Equal(cr.Valid, base.Valid) || !slices.Equal(cr.NF, base.NF) || !slices.Equal(cr.depth, base.depth) {
+				t.Errorf("%s, seed %d: tables differ from the unseeded run", name, seed)
+			}
+			if !reflect.DeepEqual(cr.Step, base.Step) {
+				t.Errorf("%s, seed %d: Step differs from the unseeded run", name, seed)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s, seed %d: result differs from the unseeded run:\n%s\nwant:\n%s", name, seed, got, want)
+			}
+		}
+	}
+}
+
+func TestNarrowingAssignments(t *testing.T) {
+	const tmpl = `
+registry:
+  name: narrow
+  states:
+    a: {type: int, range: [0, 5]}
+    b: {type: int, range: BRANGE}
+  invariants:
+    ok: {expr: "a <= 5"}
+  compensation:
+    - invariant: ok
+      repair: {a: "REPAIR"}
+  events:
+    copy:
+      params:
+        k: {type: int, range: KRANGE}
+      effect: {a: "EFFECT"}
+`
+	tests := []struct {
+		bRange, kRange, effect, repair string
+		want                           []string
+	}{
+		{"[0, 5]", "[0, 5]", "b", "b", nil},
+		{"[1, 3]", "[0, 5]", "b", "b", nil},
+		{"[0, 5]", "[2, 4]", "k", "0", nil},
+		{"[0, 10]", "[0, 5]", "b + 0", "min(b, 5)", nil}, // only plain copies are checked
+		{"[0, 10]", "[0, 5]", "b", "0", []string{
+			`event "copy" assigns variable "b" in [0, 10] to "a" in [0, 5]; it fails wherever b is outside [0, 5]`,
+		}},
+		{"[-1, 5]", "[0, 5]", "0", "b", []string{
+			`repair for "ok" assigns variable "b" in [-1, 5] to "a" in [0, 5]; it fails wherever b is outside [0, 5]`,
+		}},
+		{"[0, 10]", "[0, 9]", "k", "b", []string{
+			`repair for "ok" assigns variable "b" in [0, 10] to "a" in [0, 5]; it fails wherever b is outside [0, 5]`,
+			`event "copy" assigns parameter "k" in [0, 9] to "a" in [0, 5]; it fails wherever k is outside [0, 5]`,
+		}},
+	}
+	for _, tt := range tests {
+		src := strings.NewReplacer("BRANGE", tt.bRange, "KRANGE", tt.kRange, "EFFECT", tt.effect, "REPAIR", tt.repair).Replace(tmpl)
+		cr := compileYAML(t, src, Options{})
+		if got := cr.NarrowingAssignments(); !slices.Equal(got, tt.want) {
+			t.Errorf("b in %s, k in %s, effect %s, repair %s: %q, want %q",
+				tt.bRange, tt.kRange, tt.effect, tt.repair, got, tt.want)
+		}
+	}
+}
+
+func TestEnumParameterEffects(t *testing.T) {
+	const tmpl = `
+registry:
+  name: status
+  states:
+    status: {type: enum, values: [draft, review, live]}
+    archive: {type: enum, values: [draft, review, live, gone]}
+  invariants:
+    any: {expr: "true"}
+  events:
+    setStatus:
+      params:
+        s: {type: enum, values: VALUES}
+      effect: {status: "s"}
+`
+	tests := []struct {
+		values  string
+		want    map[string]string // transition -> status reached from draft
+		wantErr string
+	}{
+		{"[draft, review, live]", map[string]string{
+			"setStatus(s=draft)":  "draft",
+			"setStatus(s=review)": "review",
+			"setStatus(s=live)":   "live",
+		}, ""},
+		{"[live, review]", map[string]string{
+			"setStatus(s=live)":   "live",
+			"setStatus(s=review)": "review",
+		}, ""},
+		{"[draft, gone]", nil, `cannot assign "s" to "status": it may take value "gone", which is not a value of "status"`},
+	}
+	for _, tt := range tests {
+		src := strings.Replace(tmpl, "VALUES", tt.values, 1)
+		if tt.wantErr != "" {
+			if err := compileErr(t, src, Options{}); !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("values %s: error %v, want %q", tt.values, err, tt.wantErr)
+			}
+			continue
+		}
+		cr, _ := verifyYAML(t, src, Options{})
+		if len(cr.EvtNames) != len(tt.want) {
+			t.Errorf("values %s: transitions %v, want %d", tt.values, cr.EvtNames, len(tt.want))
+		}
+		from, err := cr.Schema.ParseState("status=draft, archive=gone")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for ei, name := range cr.EvtNames {
+			next := cr.Step.Next(ei, cr.Schema.Encode(from))
+			st, err := cr.Schema.ParseState("status=" + tt.want[name] + ", archive=gone")
+			if err != nil {
+				t.Fatalf("values %s: unexpected transition %s", tt.values, name)
+			}
+			if next != cr.Schema.Encode(st) {
+				t.Errorf("values %s: %s leads to %s, want status=%s", tt.values, name, cr.Schema.Format(cr.Schema.Decode(next)), tt.want[name])
+			}
+		}
+	}
+}
+
+func TestFixpoints(t *testing.T) {
+	tests := []struct {
+		name         string
+		cr           func() *CompiledRegistry
+		wantNFFixed  int // states that are their own NF, valid or not
+		wantFixpoint []registry.StateID
+	}{
+		{"wallet", func() *CompiledRegistry { return compileExample(t, "wallet.yaml", Options{}) }, 12, nil},
+		{"order_fulfillment", func() *CompiledRegistry { return compileExample(t, "order_fulfillment.yaml", Options{}) }, 188, nil},
+		// x=2 and x=3 diverge, so their NF entries are left as themselves;
+		// Fixpoints still excludes them.
+		{"diverge", func() *CompiledRegistry {
+			cr := compileYAML(t, divergeYAML, Options{AllFailures: true})
+			if err := cr.BuildTables(); err != nil {
+				t.Fatal(err)
+			}
+			return cr
+		}, 4, []registry.StateID{0, 1}},
+	}
+	for _, tt := range tests {
+		cr := tt.cr()
+		var valid []registry.StateID
+		nfFixed := 0
+		for sid, v := range cr.Valid {
+			if v {
+				valid = append(valid, registry.StateID(sid))
+			}
+			if cr.NF[sid] == registry.StateID(sid) {
+				nfFixed++
+			}
+		}
+		got := cr.Fixpoints()
+		if !slices.Equal(got, valid) {
+			t.Errorf("%s: Fixpoints() = %v, want the valid states %v", tt.name, got, valid)
+		}
+		if tt.wantFixpoint != nil && !slices.Equal(got, tt.wantFixpoint) {
+			t.Errorf("%s: Fixpoints() = %v, want %v", tt.name, got, tt.wantFixpoint)
+		}
+		if nfFixed != tt.wantNFFixed {
+			t.Errorf("%s: %d states are their own NF, want %d", tt.name, nfFixed, tt.wantNFFixed)
+		}
+	}
+}
+
+func TestOutOfRangePolicy(t *testing.T) {
+	const tmpl = `
+registry:
+  name: policy
+  states:
+    x: {type: int, range: [2, 5]}
+  invariants:
+    any: {expr: "true"}
+  events:
+    bump: {effect: {x: "EFFECT"}}
+`
+	tests := []struct {
+		effect string
+		from   int
+		policy OutOfRangePolicy
+		want   int    // x after bump
+		errMsg string // substring of the BuildTables error
+	}{
+		{"x + 1", 5, OutOfRangeError, 0, `SPEC ERROR: assignment to "x" computed value 6, allowed range [2, 5]`},
+		{"x + 1", 5, OutOfRangeClamp, 5, ""},
+		{"x + 1", 5, OutOfRangeWrap, 2, ""},
+		{"x + 6", 5, OutOfRangeClamp, 5, ""},
+		{"x + 6", 5, OutOfRangeWrap, 3, ""}, // 11 is 9 above min, 1 mod 4
+		{"x - 7", 2, OutOfRangeClamp, 2, ""},
+		{"x - 7", 2, OutOfRangeWrap, 3, ""}, // -5 is 7 below min, -7 mod 4 = 1
+		{"x - 1", 3, OutOfRangeWrap, 2, ""}, // in range: unchanged by the policy
+	}
+	for _, tt := range tests {
+		cr := compileYAML(t, strings.Replace(tmpl, "EFFECT", tt.effect, 1), Options{OutOfRange: tt.policy})
+		err := cr.BuildTables()
+		if tt.errMsg != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Errorf("%s from %d under policy %d: error %v, want %q", tt.effect, tt.from, tt.policy, err, tt.errMsg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s under policy %d: %v", tt.effect, tt.policy, err)
+		}
+		next := cr.Step.Next(0, cr.Schema.Encode(registry.State{tt.from}))
+		if got := cr.Schema.Decode(next)[0]; got != tt.want {
+			t.Errorf("%s from %d under policy %d: x=%d, want %d", tt.effect, tt.from, tt.policy, got, tt.want)
+		}
+	}
+}
+
+func TestParseOutOfRangePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    OutOfRangePolicy
+		wantErr string
+	}{
+		{"error", OutOfRangeError, ""},
+		{"clamp", OutOfRangeClamp, ""},
+		{"wrap", OutOfRangeWrap, ""},
+		{"saturate", 0, `unknown out-of-range policy "saturate" (want error, clamp or wrap)`},
+		{"", 0, `unknown out-of-range policy ""`},
+	}
+	for _, tt := range tests {
+		got, err := ParseOutOfRangePolicy(tt.name)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseOutOfRangePolicy(%q): error %v, want %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseOutOfRangePolicy(%q) = %v, %v; want %v", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseCache(t *testing.T) {
+	cr := compileYAML(t, `
+registry:
+  name: shared
+  states:
+    x: {type: int, range: [0, 5]}
+    y: {type: int, range: [0, 5]}
+  initial: {x: 0, y: 0}
+  invariants:
+    a: {expr: "x <= 4"}
+    b: {expr: "x <= 4"}
+    c: {expr: "y <= 4"}
+  compensation:
+    - invariant: a
+      repair: {x: 0}
+    - invariant: c
+      repair: {y: 0}
+  events:
+    inc_x:
+      guard: "x < 5"
+      effect: {x: "x + 1"}
+    inc_y:
+      guard: "x < 5"
+      effect: {y: "y + 1"}
+    reset:
+      effect: {x: "0", y: "0"}
+`, Options{})
+	tests := []struct {
+		name string
+		a, b *expr.Node
+		same bool
+	}{
+		{"identical invariants", cr.InvExprs[0], cr.InvExprs[1], true},
+		{"identical guards", cr.EvtGuards[0], cr.EvtGuards[1], true},
+		{"effects of one event", cr.EvtExprs[2][0], cr.EvtExprs[2][1], true},
+		{"effect and repair", cr.EvtExprs[2][0], cr.RepExprs[0][0], true},
+		{"different invariants", cr.InvExprs[0], cr.InvExprs[2], false},
+		{"different effects", cr.EvtExprs[0][0], cr.EvtExprs[1][1], false},
+	}
+	for _, tt := range tests {
+		if (tt.a == tt.b) != tt.same {
+			t.Errorf("%s: shared AST %v, want %v", tt.name, tt.a == tt.b, tt.same)
+		}
+	}
+}
+
+func TestCanonicalOrderedEnum(t *testing.T) {
+	const src = `
+registry:
+  name: alarm
+  states:
+    sev: {type: enum, values: [low, medium, high], ordered: true}
+    alarm: {type: bool}
+  invariants:
+    quiet: {expr: "alarm or sev < medium"}
+  compensation:
+    - invariant: quiet
+      repair: {alarm: true}
+  events: {}
+`
+	for _, order := range []CanonicalOrder{CanonicalNone, CanonicalEnums, CanonicalAll} {
+		cr, _ := verifyYAML(t, src, Options{Canonical: order})
+		st, err := cr.Schema.ParseState("sev=high, alarm=false")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cr.Valid[cr.Schema.Encode(st)] {
+			t.Errorf("canonical order %d: sev=high, alarm=false is valid, want invalid", order)
+		}
+	}
+}
+
+// altRepairYAML gives invariants several repairs. For a_zero only the
+// third restores it, and the second progresses by restoring b_zero; for
+// x_not_two the first never progresses and the second restores it.
+const altRepairYAML = `
+registry:
+  name: alternatives
+  states:
+    a: {type: int, range: [0, 1]}
+    b: {type: int, range: [0, 1]}
+    x: {type: int, range: [0, 3]}
+  initial: {a: 0, b: 0, x: 0}
+  invariants:
+    a_zero: {expr: "a == 0"}
+    b_zero: {expr: "b == 0"}
+    x_not_two: {expr: "x != 2"}
+  compensation:
+    - invariant: a_zero
+      repair: {b: 1}
+    - invariant: x_not_two
+      repair: {x: 2}
+    - invariant: a_zero
+      repair: {b: 0}
+    - invariant: x_not_two
+      repair: {x: 3}
+    - invariant: b_zero
+      repair: {b: 0}
+    - invariant: a_zero
+      repair: {a: 0}
+    - invariant: x_not_two
+      repair: {x: 0}
+  events:
+    set_a:
+      effect: {a: 1}
+    set_x:
+      effect: {x: 2}
+`
+
+func TestRepairAlternatives(t *testing.T) {
+	cr := compileYAML(t, altRepairYAML, Options{})
+	if err := cr.BuildTables(); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		state string
+		path  []string // the states visited after state, ending at its NF
+	}{
+		// The first repair does not progress; the second restores x_not_two
+		// and wins over the third.
+		{"a=0, b=0, x=2", []string{"a=0, b=0, x=3"}},
+		// Neither b repair restores a_zero, but b=0 leaves fewer invariants
+		// violated, so the second is taken; then only the third progresses.
+		{"a=1, b=1, x=0", []string{"a=1, b=0, x=0", "a=0, b=0, x=0"}},
+		{"a=1, b=0, x=2", []string{"a=0, b=0, x=2", "a=0, b=0, x=3"}},
+		// b_zero has a single repair.
+		{"a=0, b=1, x=1", []string{"a=0, b=0, x=1"}},
+		{"a=0, b=0, x=1", nil},
+	}
+	for _, tt := range tests {
+		st, err := cr.Schema.ParseState(tt.state)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sid := cr.Schema.Encode(st)
+		for _, want := range tt.path {
+			next, _, err := cr.repairStep(sid)
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantSt, err := cr.Schema.ParseState(want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if next != cr.Schema.Encode(wantSt) {
+				t.Fatalf("%s: repaired to %s, want %s", tt.state, cr.fmtState(cr.Schema.Decode(next)), want)
+			}
+			sid = next
+		}
+		if !cr.Valid[sid] {
+			t.Errorf("%s: path ends at invalid %s", tt.state, cr.fmtState(cr.Schema.Decode(sid)))
+		}
+		if nf := cr.NF[cr.Schema.Encode(st)]; nf != sid {
+			t.Errorf("%s: NF %s, want %s", tt.state, cr.fmtState(cr.Schema.Decode(nf)), cr.fmtState(cr.Schema.Decode(sid)))
+		}
+	}
+	if np := cr.NonProgressingRepairs(); len(np) != 0 {
+		t.Errorf("NonProgressingRepairs() = %+v, want none", np)
+	}
+}
+
+func TestRepairAlternativesNoneProgresses(t *testing.T) {
+	const src = `
+registry:
+  name: stall
+  states:
+    x: {type: int, range: [0, 3]}
+  initial: {x: 0}
+  invariants:
+    small: {expr: "x < 2"}
+  compensation:
+    - invariant: small
+      repair: {x: "x - 1"}
+    - invariant: small
+      repair: {x: 2}
+  events:
+    grow:
+      guard: "x < 3"
+      effect: {x: "x + 1"}
+`
+	cr := compileYAML(t, src, Options{})
+	if err := cr.BuildTables(); err != nil {
+		t.Fatal(err)
+	}
+	want := []NonProgressingRepair{{Invariant: "small", Alternatives: 2, States: 1, Before: "{x=3}", After: "{x=2}"}}
+	if got := cr.NonProgressingRepairs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("NonProgressingRepairs() = %+v, want %+v", got, want)
+	}
+	if nf := cr.NF[3]; nf != 1 {
+		t.Errorf("NF of x=3 is %d, want 1 (the first repair, applied twice)", nf)
+	}
+}
@@ -0,0 +1,95 @@
+package verify
+
+import (
+	"github.com/blackwell-systems/nccheck/registry"
+)
+
+// WFCGroup counts the WFC failures attributed to one invariant's repair.
+type WFCGroup struct {
+	Invariant string `json:"invariant"` // "" if no repair was applied
+	Kind      string `json:"kind"`      // "stuck", "cycle", "too-long" or "invalid-nf"
+	States    int    `json:"states"`
+	State     string `json:"state"` // the failing state with the lowest StateID
+}
+
+// WFC failure kinds, from the repair chain of a failing state.
+const (
+	wfcStuck     = "stuck"      // a repair left the state unchanged
+	wfcCycle     = "cycle"      // the chain revisits a state
+	wfcTooLong   = "too-long"   // the chain runs past MaxRepairIter without repeating
+	wfcInvalidNF = "invalid-nf" // the chain ends, but not in a valid state
+)
+
+// WFCFailuresByInvariant attributes every WFC failure to the invariant
+// whose repair was applied last: the step that left the state unchanged or
+// closed a cycle, or the final step of a chain that ended invalid or ran
+// past MaxRepairIter. Groups are listed by invariant in declaration order,
+// then by kind. Divergence is only recorded in the tables under
+// Options.AllFailures; otherwise BuildTables fails at the first diverging
+// state and there is nothing to group. Requires tables.
+func (cr *CompiledRegistry) WFCFailuresByInvariant() ([]WFCGroup, error) {
+	type key struct {
+		inv  int
+		kind string
+	}
+	groups := make(map[key]*WFCGroup)
+	for sid := 0; sid < cr.Schema.TotalLen; sid++ {
+		if err := cr.interrupted("wfc grouping", sid); err != nil {
+			return nil, err
+		}
+		if !cr.diverges[sid] && cr.Valid[cr.NF[sid]] {
+			continue
+		}
+		inv, kind, err := cr.blameRepair(registry.StateID(sid))
+		if err != nil {
+			return nil, err
+		}
+		k := key{inv, kind}
+		g := groups[k]
+		if g == nil {
+			g = &WFCGroup{Kind: kind, State: cr.fmtState(cr.Schema.Decode(registry.StateID(sid)))}
+			if inv >= 0 {
+				g.Invariant = cr.Reg.Invariants[inv].Name
+			}
+			groups[k] = g
+		}
+		g.States++
+	}
+
+	var out []WFCGroup
+	for inv := -1; inv < len(cr.Reg.Invariants); inv++ {
+		for _, kind := range []string{wfcStuck, wfcCycle, wfcTooLong, wfcInvalidNF} {
+			if g := groups[key{inv, kind}]; g != nil {
+				out = append(out, *g)
+			}
+		}
+	}
+	return out, nil
+}
+
+// blameRepair follows the repair chain from sid and returns the index of
+// the invariant repaired last (-1 if none) and how the chain fails.
+func (cr *CompiledRegistry) blameRepair(sid registry.StateID) (inv int, kind string, err error) {
+	seen := map[registry.StateID]bool{sid: true}
+	inv = -1
+	current := sid
+	for steps := 0; steps < MaxRepairIter; steps++ {
+		next, ri, err := cr.repairStep(current)
+		if err != nil {
+			return -1, "", err
+		}
+		if ri < 0 {
+			return inv, wfcInvalidNF, nil
+		}
+		inv = ri
+		switch {
+		case next == current:
+			return inv, wfcStuck, nil
+		case seen[next]:
+			return inv, wfcCycle, nil
+		}
+		seen[next] = true
+		current = next
+	}
+	return inv, wfcTooLong, nil
+}
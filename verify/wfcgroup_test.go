@@ -0,0 +1,59 @@
+package verify
+
+import (
+	"reflect"
+	"testing"
+)
+
+// cycleYAML has two repairs that undo each other: low moves 2 to 3 and
+// high moves 3 back to 2.
+const cycleYAML = `
+registry:
+  name: cycle
+  states:
+    x: {type: int, range: [0, 3]}
+  initial: {x: 0}
+  invariants:
+    low: {expr: "x != 2"}
+    high: {expr: "x != 3"}
+  compensation:
+    - invariant: low
+      repair: {x: 3}
+    - invariant: high
+      repair: {x: 2}
+  events:
+    inc:
+      guard: "x < 1"
+      effect: {x: "x + 1"}
+`
+
+func TestWFCFailuresByInvariant(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want []WFCGroup
+	}{
+		{"stuck", divergeYAML, []WFCGroup{
+			{Invariant: "small", Kind: wfcStuck, States: 2, State: "{x=2}"},
+		}},
+		// Each cycle is closed by the repair that leads back to its start.
+		{"cycle", cycleYAML, []WFCGroup{
+			{Invariant: "low", Kind: wfcCycle, States: 1, State: "{x=3}"},
+			{Invariant: "high", Kind: wfcCycle, States: 1, State: "{x=2}"},
+		}},
+		{"pass", walletYAML, nil},
+	}
+	for _, tt := range tests {
+		cr := compileYAML(t, tt.yaml, Options{AllFailures: true})
+		if err := cr.BuildTables(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		got, err := cr.WFCFailuresByInvariant()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: groups %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
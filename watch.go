@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/blackwell-systems/nccheck/verify"
+)
+
+const (
+	watchPoll     = 300 * time.Millisecond
+	watchDebounce = 200 * time.Millisecond
+)
+
+// fileStamp identifies a version of a file by modification time and size.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func statFile(path string) (fileStamp, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return fileStamp{fi.ModTime(), fi.Size()}, nil
+}
+
+// changeDetector reports when a polled file differs from the version last
+// seen. A change is only reported once the file has stayed the same for the
+// debounce interval, so an editor's burst of writes triggers one re-run.
+type changeDetector struct {
+	path     string
+	debounce time.Duration
+
+	seen    fileStamp // version last reported (or initial)
+	pending fileStamp // latest differing version, not yet settled
+	since   time.Time // when pending was first observed
+	dirty   bool
+}
+
+func newChangeDetector(path string, debounce time.Duration) (*changeDetector, error) {
+	st, err := statFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &changeDetector{path: path, debounce: debounce, seen: st}, nil
+}
+
+// poll stats the file once at time now and reports whether a settled
+// change is ready. A file that is temporarily missing (as during an
+// editor's rename-into-place) is treated as still changing.
+func (d *changeDetector) poll(now time.Time) bool {
+	st, err := statFile(d.path)
+	if err != nil {
+		d.dirty, d.since = true, now
+		d.pending = fileStamp{}
+		return false
+	}
+	if !d.dirty {
+		if st == d.seen {
+			return false
+		}
+		d.dirty, d.pending, d.since = true, st, now
+		return false
+	}
+	if st != d.pending {
+		d.pending, d.since = st, now
+		return false
+	}
+	if now.Sub(d.since) < d.debounce {
+		return false
+	}
+	d.seen, d.dirty = st, false
+	return true
+}
+
+// watchFile runs the check once, then again each time the file at path
+// changes, until interrupted. Compiled expressions are cached, so saving an
+// unchanged registry does not re-parse it.
+func watchFile(path string, cfg config) int {
+	det, err := newChangeDetector(path, watchDebounce)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	cache := verify.NewCache()
+	rerun := func() {
+		fmt.Print("\033[H\033[2J") // clear screen
+		check(path, cfg, cache)
+		fmt.Printf("\nWatching %s for changes (Ctrl-C to exit)\n", path)
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	rerun()
+	ticker := time.NewTicker(watchPoll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-interrupt:
+			fmt.Println()
+			return 0
+		case now := <-ticker.C:
+			if det.poll(now) {
+				rerun()
+			}
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestChangeDetector(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reg.yaml")
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+	// write replaces the file with data stamped at base plus mod seconds,
+	// so changes are visible whatever the filesystem's timestamp resolution.
+	write := func(data string, mod int) {
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		stamp := base.Add(time.Duration(mod) * time.Second)
+		if err := os.Chtimes(path, stamp, stamp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	remove := func() {
+		if err := os.Remove(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("v1", 0)
+
+	const debounce = 200 * time.Millisecond
+	d, err := newChangeDetector(path, debounce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t0 := time.Now()
+	steps := []struct {
+		what   string
+		change func()
+		at     time.Duration // poll time, relative to t0
+		want   bool
+	}{
+		{"unchanged", nil, 0, false},
+		{"still unchanged after debounce", nil, time.Second, false},
+		{"write seen", func() { write("v2", 1) }, 2 * time.Second, false},
+		{"not yet settled", nil, 2*time.Second + 100*time.Millisecond, false},
+		{"settled", nil, 2*time.Second + debounce, true},
+		{"reported once", nil, 3 * time.Second, false},
+		{"burst: first write", func() { write("v3", 2) }, 4 * time.Second, false},
+		{"burst: second write restarts debounce", func() { write("v3 longer", 3) }, 4*time.Second + 150*time.Millisecond, false},
+		{"burst: old debounce elapsed", nil, 4*time.Second + 250*time.Millisecond, false},
+		{"burst: settled once", nil, 4*time.Second + 150*time.Millisecond + debounce, true},
+		{"removed", remove, 5 * time.Second, false},
+		{"still missing", nil, 6 * time.Second, false},
+		{"rewritten", func() { write("v4", 4) }, 6*time.Second + 50*time.Millisecond, false},
+		{"rewrite settled", nil, 7 * time.Second, true},
+		{"same content rewritten in place", func() { write("v4", 4) }, 8 * time.Second, false},
+	}
+	for _, st := range steps {
+		if st.change != nil {
+			st.change()
+		}
+		if got := d.poll(t0.Add(st.at)); got != st.want {
+			t.Errorf("%s: poll = %v, want %v", st.what, got, st.want)
+		}
+	}
+
+	if _, err := newChangeDetector(filepath.Join(t.TempDir(), "missing.yaml"), debounce); err == nil {
+		t.Error("newChangeDetector on a missing file: want an error")
+	}
+}